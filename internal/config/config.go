@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"flag"
 	"os"
+	"reflect"
+	"strings"
 
 	"llm-router/internal/model"
 	"llm-router/internal/utils"
@@ -34,11 +36,17 @@ func LoadConfig(configFile, llmRouterAPIKeyEnv, llmRouterAPIKey string, listenin
 			logger.Error("Failed to read config file", zap.String("file", configFile), zap.Error(err))
 			return nil, err
 		}
+		fileData, err = MigrateConfig(fileData, logger)
+		if err != nil {
+			logger.Error("Failed to migrate config file", zap.String("file", configFile), zap.Error(err))
+			return nil, err
+		}
 		err = json.Unmarshal(fileData, &cfg) // Unmarshal the JSON data into the Config struct
 		if err != nil {
 			logger.Error("Failed to unmarshal config data", zap.String("file", configFile), zap.Error(err))
 			return nil, err
 		}
+		ExpandEnv(&cfg, logger)
 		logger.Info("Config file loaded and parsed", zap.String("file", configFile))
 	} else { // If the file doesn't exist, use the default config
 		logger.Warn("Config file not found, using default configuration", zap.String("file", configFile))
@@ -111,12 +119,164 @@ func LoadConfig(configFile, llmRouterAPIKeyEnv, llmRouterAPIKey string, listenin
 		logger.Info("Geoapify API key loaded from config file")
 	}
 
+	// Load OTLP endpoint - environment variable takes precedence over config file
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		cfg.OTLPEndpoint = endpoint
+		logger.Info("OTLP endpoint loaded from environment variable", zap.String("endpoint", endpoint))
+	}
+
+	applyAttachmentEnv(&cfg, logger)
+
+	if err := cfg.Validate(); err != nil {
+		logger.Error("Configuration is invalid", zap.Error(err))
+		return nil, err
+	}
+
 	logger.Info("Configuration loading completed successfully")
 	return &cfg, nil
 }
 
+// applyAttachmentEnv overrides the attachment store settings with any that are
+// set in the environment. S3 credentials fall back to the standard AWS variables.
+func applyAttachmentEnv(cfg *model.Config, logger *zap.Logger) {
+	if store := os.Getenv("ATTACHMENT_STORE"); store != "" {
+		if cfg.Attachments == nil {
+			cfg.Attachments = &model.AttachmentsConfig{}
+		}
+		cfg.Attachments.Store = store
+		logger.Info("Attachment store loaded from environment variable", zap.String("store", store))
+	}
+
+	a := cfg.Attachments
+	if a == nil || a.Store != model.AttachmentStoreS3 {
+		return
+	}
+
+	if a.S3 == nil {
+		a.S3 = &model.S3Config{}
+	}
+	envOverrides := []struct {
+		field *string
+		names []string
+	}{
+		{&a.S3.Bucket, []string{"S3_BUCKET"}},
+		{&a.S3.Region, []string{"S3_REGION", "AWS_REGION"}},
+		{&a.S3.Endpoint, []string{"S3_ENDPOINT"}},
+		{&a.S3.Prefix, []string{"S3_PREFIX"}},
+		{&a.S3.AccessKeyID, []string{"S3_ACCESS_KEY_ID", "AWS_ACCESS_KEY_ID"}},
+		{&a.S3.SecretAccessKey, []string{"S3_SECRET_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY"}},
+	}
+	for _, o := range envOverrides {
+		for _, name := range o.names {
+			if value := os.Getenv(name); value != "" {
+				*o.field = value
+				break
+			}
+		}
+	}
+}
+
+// ExpandEnv replaces ${VAR} and $VAR references in every string value of the
+// config with the value of the environment variable. $$ yields a literal $.
+// Unset variables expand to an empty string and are logged.
+func ExpandEnv(cfg *model.Config, logger *zap.Logger) {
+	missing := make(map[string]bool)
+	mapping := func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing[name] = true
+		}
+		return value
+	}
+
+	expandValue(reflect.ValueOf(cfg).Elem(), mapping)
+
+	// An API key whose variable is unset would otherwise be used as an empty key
+	for i := range cfg.Backends {
+		keys := cfg.Backends[i].APIKeys[:0]
+		for _, key := range cfg.Backends[i].APIKeys {
+			if key != "" {
+				keys = append(keys, key)
+			}
+		}
+		cfg.Backends[i].APIKeys = keys
+	}
+
+	for name := range missing {
+		logger.Warn("Environment variable referenced in config is not set", zap.String("envVar", name))
+	}
+}
+
+// expandValue expands strings in v, descending into structs, slices and string maps
+func expandValue(v reflect.Value, mapping func(string) string) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(expandString(v.String(), mapping))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				expandValue(v.Field(i), mapping)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			expandValue(v.Index(i), mapping)
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return
+		}
+		for _, key := range v.MapKeys() {
+			expanded := expandString(v.MapIndex(key).String(), mapping)
+			v.SetMapIndex(key, reflect.ValueOf(expanded).Convert(v.Type().Elem()))
+		}
+	}
+}
+
+// expandString replaces ${VAR} and $VAR references in s using mapping in a
+// single pass, so the result is never expanded again. $$ yields a literal $,
+// and a $ that doesn't start a reference is kept as is.
+func expandString(s string, mapping func(string) string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch next := s[i+1]; {
+		case next == '$':
+			b.WriteByte('$')
+			i++
+		case next == '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				b.WriteByte('$')
+				continue
+			}
+			b.WriteString(mapping(s[i+2 : i+2+end]))
+			i += end + 2
+		case isEnvNameStart(next):
+			end := i + 2
+			for end < len(s) && (isEnvNameStart(s[end]) || '0' <= s[end] && s[end] <= '9') {
+				end++
+			}
+			b.WriteString(mapping(s[i+1 : end]))
+			i = end - 1
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String()
+}
+
+func isEnvNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
 // InitFlags initializes and parses the command-line flags.
-func InitFlags() (string, string, string, int, string, string, string) {
+func InitFlags() (string, string, string, int, string, string, string, bool) {
 	configFile := flag.String("config", "config.json", "Path to the configuration file")
 	llmRouterAPIKeyEnv := flag.String("llmrouter-api-key-env", "LLMROUTER_API_KEY", "Environment variable for the Chat API key")
 	llmRouterAPIKey := flag.String("llmrouter-api-key", "", "Chat API key to use (takes precedence over environment variable)")
@@ -124,8 +284,9 @@ func InitFlags() (string, string, string, int, string, string, string) {
 	logLevel := flag.String("log-level", "warn", "define the log level: debug, info, warn, error, dpanic, panic, fatal")
 	exaAPIKey := flag.String("exa-api-key", "", "Exa API key for search tool (takes precedence over environment variable)")
 	geoapifyAPIKey := flag.String("geoapify-api-key", "", "Geoapify API key for geo tool (takes precedence over environment variable)")
+	watchConfig := flag.Bool("watch-config", false, "Reload the configuration when the config file changes")
 
 	flag.Parse()
 
-	return *configFile, *llmRouterAPIKeyEnv, *llmRouterAPIKey, *listeningPort, *logLevel, *exaAPIKey, *geoapifyAPIKey
+	return *configFile, *llmRouterAPIKeyEnv, *llmRouterAPIKey, *listeningPort, *logLevel, *exaAPIKey, *geoapifyAPIKey, *watchConfig
 }
@@ -3,7 +3,9 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"llm-router/internal/model"
 
@@ -137,7 +139,7 @@ func TestGeneratedAPIKey(t *testing.T) {
 	}
 
 	// Check it has the correct prefix
-	if len(config.LLMRouterAPIKey) < 4 || config.LLMRouterAPIKey[:4] != "sk_" {
+	if len(config.LLMRouterAPIKey) < 4 || config.LLMRouterAPIKey[:3] != "sk_" {
 		t.Errorf("Expected API key with 'sk_' prefix, got: %s", config.LLMRouterAPIKey)
 	}
 
@@ -198,3 +200,445 @@ func TestDotEnvLoading(t *testing.T) {
 	// Clean up
 	os.Unsetenv("ENV_TEST_KEY")
 }
+
+func TestEnvInterpolation(t *testing.T) {
+	logger := zap.NewNop()
+
+	os.Setenv("INTERP_HOST", "llm.internal")
+	os.Setenv("INTERP_DB_PASSWORD", "s3cret")
+	os.Setenv("INTERP_KEY", "key-1")
+	os.Unsetenv("INTERP_MISSING")
+	defer os.Unsetenv("INTERP_HOST")
+	defer os.Unsetenv("INTERP_DB_PASSWORD")
+	defer os.Unsetenv("INTERP_KEY")
+
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(configFile, []byte(`{
+		"database_url": "postgres://user:${INTERP_DB_PASSWORD}@db/chat",
+		"aliases": {"fast": "$INTERP_HOST/model", "escaped": "$$INTERP_HOST and $${INTERP_HOST}", "price": "$5"},
+		"backends": [{
+			"name": "local",
+			"base_url": "https://${INTERP_HOST}/v1",
+			"prefix": "cost$$/",
+			"api_keys": ["$INTERP_KEY", "${INTERP_MISSING}"],
+			"role_rewrites": {"developer": "${INTERP_MISSING}"}
+		}]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(configFile, "", "key", 0, model.Config{}, logger)
+	if err != nil {
+		t.Fatalf("Failed to load config: %s", err)
+	}
+
+	backend := cfg.Backends[0]
+	if backend.BaseURL != "https://llm.internal/v1" {
+		t.Errorf("Expected expanded base_url, got '%s'", backend.BaseURL)
+	}
+	if cfg.DatabaseURL != "postgres://user:s3cret@db/chat" {
+		t.Errorf("Expected expanded database_url, got '%s'", cfg.DatabaseURL)
+	}
+	if cfg.Aliases["fast"] != "llm.internal/model" {
+		t.Errorf("Expected expanded alias, got '%s'", cfg.Aliases["fast"])
+	}
+
+	t.Run("EscapedDollar", func(t *testing.T) {
+		if backend.Prefix != "cost$/" {
+			t.Errorf("Expected '$$' to produce a literal '$', got '%s'", backend.Prefix)
+		}
+		if cfg.Aliases["escaped"] != "$INTERP_HOST and ${INTERP_HOST}" {
+			t.Errorf("Expected escaped references to stay unexpanded, got '%s'", cfg.Aliases["escaped"])
+		}
+		if cfg.Aliases["price"] != "$5" {
+			t.Errorf("Expected a '$' that starts no reference to be kept, got '%s'", cfg.Aliases["price"])
+		}
+	})
+
+	t.Run("MissingVars", func(t *testing.T) {
+		if backend.RoleRewrites["developer"] != "" {
+			t.Errorf("Expected missing variable to expand to empty, got '%s'", backend.RoleRewrites["developer"])
+		}
+		if len(backend.APIKeys) != 1 || backend.APIKeys[0] != "key-1" {
+			t.Errorf("Expected keys with missing variables to be dropped, got %v", backend.APIKeys)
+		}
+	})
+}
+
+func TestInvalidBackendConfig(t *testing.T) {
+	logger := zap.NewNop()
+
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(configFile, []byte(`{
+		"backends": [
+			{"name": "good", "base_url": "https://api.example.com/v1", "prefix": "good/"},
+			{"name": "no-scheme", "base_url": "api.example.com", "prefix": "a/"},
+			{"name": "no-host", "base_url": "http:///v1", "prefix": "b/"},
+			{"name": "ftp", "base_url": "ftp://files.example.com", "prefix": "c/"}
+		]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadConfig(configFile, "", "key", 0, model.Config{}, logger)
+	if err == nil {
+		t.Fatal("Expected an error for invalid backend URLs")
+	}
+
+	for _, name := range []string{"no-scheme", "no-host", "ftp"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected error to mention backend %q, got: %s", name, err)
+		}
+	}
+	if strings.Contains(err.Error(), `"good"`) {
+		t.Errorf("Did not expect error to mention the valid backend, got: %s", err)
+	}
+}
+
+func TestDuplicateBackendPrefix(t *testing.T) {
+	logger := zap.NewNop()
+
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(configFile, []byte(`{
+		"backends": [
+			{"name": "openai", "base_url": "https://api.openai.com/v1", "prefix": "openai/", "default": true},
+			{"name": "azure", "base_url": "https://azure.example.com/v1", "prefix": " openai/ "},
+			{"name": "local", "base_url": "http://localhost:11434/v1", "prefix": ""}
+		]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadConfig(configFile, "", "key", 0, model.Config{}, logger)
+	if err == nil {
+		t.Fatal("Expected an error for duplicate and empty prefixes")
+	}
+
+	msg := err.Error()
+	if !strings.Contains(msg, `"azure"`) || !strings.Contains(msg, `already used by backend "openai"`) {
+		t.Errorf("Expected error to name both backends sharing a prefix, got: %s", msg)
+	}
+	if !strings.Contains(msg, `"local"`) {
+		t.Errorf("Expected error to name the backend with an empty prefix, got: %s", msg)
+	}
+}
+
+func TestMultipleDefaultBackends(t *testing.T) {
+	logger := zap.NewNop()
+
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(configFile, []byte(`{
+		"backends": [
+			{"name": "openai", "base_url": "https://api.openai.com/v1", "prefix": "openai/", "default": true},
+			{"name": "groq", "base_url": "https://api.groq.com/openai/v1", "prefix": "groq/", "default": true}
+		]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadConfig(configFile, "", "key", 0, model.Config{}, logger)
+	if err == nil {
+		t.Fatal("Expected an error for multiple default backends")
+	}
+	if !strings.Contains(err.Error(), `"openai", "groq"`) {
+		t.Errorf("Expected error to list both default backends, got: %s", err)
+	}
+}
+
+func TestBackendFallbackValidation(t *testing.T) {
+	logger := zap.NewNop()
+
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(configFile, []byte(`{
+		"backends": [
+			{"name": "a", "base_url": "https://a.example.com", "prefix": "a/", "fallback": "b/"},
+			{"name": "b", "base_url": "https://b.example.com", "prefix": "b/", "fallback": "a/"},
+			{"name": "c", "base_url": "https://c.example.com", "prefix": "c/", "fallback": "missing/"}
+		]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadConfig(configFile, "", "key", 0, model.Config{}, logger)
+	if err == nil {
+		t.Fatal("Expected an error for invalid fallbacks")
+	}
+	if !strings.Contains(err.Error(), "loops back") {
+		t.Errorf("Expected a fallback cycle error, got: %s", err)
+	}
+	if !strings.Contains(err.Error(), `"missing/" does not match`) {
+		t.Errorf("Expected an unknown fallback error, got: %s", err)
+	}
+}
+
+func TestSharedPrefixWithLoadBalance(t *testing.T) {
+	logger := zap.NewNop()
+
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(configFile, []byte(`{
+		"backends": [
+			{"name": "provider-a", "base_url": "https://a.example.com/v1", "prefix": "llama/", "load_balance": "round_robin"},
+			{"name": "provider-b", "base_url": "https://b.example.com/v1", "prefix": "llama/", "load_balance": "round_robin"}
+		]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(configFile, "", "key", 0, model.Config{}, logger)
+	if err != nil {
+		t.Fatalf("Expected backends with load_balance to share a prefix, got: %s", err)
+	}
+	if len(cfg.Backends) != 2 {
+		t.Errorf("Expected 2 backends, got %d", len(cfg.Backends))
+	}
+}
+
+func TestParamLimitsValidation(t *testing.T) {
+	logger := zap.NewNop()
+
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(configFile, []byte(`{
+		"backends": [
+			{"name": "openai", "base_url": "https://api.openai.com/v1", "prefix": "openai/", "default": true,
+			 "param_limits": {"max_tokens": {"min": 8192, "max": 4096}, "temperature": {"max": 1}}}
+		]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadConfig(configFile, "", "key", 0, model.Config{}, logger)
+	if err == nil {
+		t.Fatal("Expected an error for min above max")
+	}
+	if !strings.Contains(err.Error(), "max_tokens") {
+		t.Errorf("Expected error to mention max_tokens, got: %s", err)
+	}
+	if strings.Contains(err.Error(), "temperature") {
+		t.Errorf("Did not expect error to mention temperature, got: %s", err)
+	}
+}
+
+func TestRetryableStatusesValidation(t *testing.T) {
+	logger := zap.NewNop()
+
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(configFile, []byte(`{
+		"backends": [
+			{"name": "openai", "base_url": "https://api.openai.com/v1", "prefix": "openai/", "retryable_statuses": [409, 5000]}
+		]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadConfig(configFile, "", "key", 0, model.Config{}, logger)
+	if err == nil || !strings.Contains(err.Error(), "5000") {
+		t.Errorf("Expected an error for the invalid status code, got: %v", err)
+	}
+}
+
+func TestDatabasePoolConfig(t *testing.T) {
+	logger := zap.NewNop()
+
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(configFile, []byte(`{
+		"backends": [
+			{"name": "openai", "base_url": "https://api.openai.com/v1", "prefix": "openai/", "default": true}
+		],
+		"db_max_idle_conns": 20
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadConfig(configFile, "", "key", 0, model.Config{}, logger)
+	if err == nil || !strings.Contains(err.Error(), "db_max_idle_conns 20 is above db_max_open_conns 10") {
+		t.Fatalf("Expected an error for idle connections above the default max, got: %v", err)
+	}
+
+	err = os.WriteFile(configFile, []byte(`{
+		"backends": [
+			{"name": "openai", "base_url": "https://api.openai.com/v1", "prefix": "openai/", "default": true}
+		],
+		"db_max_open_conns": 50,
+		"db_max_idle_conns": 20,
+		"db_conn_max_lifetime": 600
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(configFile, "", "key", 0, model.Config{}, logger)
+	if err != nil {
+		t.Fatalf("Failed to load config: %s", err)
+	}
+	pool := cfg.DatabasePool()
+	if pool.MaxOpenConns != 50 || pool.MaxIdleConns != 20 || pool.ConnMaxLifetime != 10*time.Minute {
+		t.Errorf("Expected configured pool settings, got %+v", pool)
+	}
+	if pool.ConnMaxIdleTime != model.DefaultDBConnMaxIdleTime {
+		t.Errorf("Expected default idle time, got %s", pool.ConnMaxIdleTime)
+	}
+}
+
+func TestBackendConnectionPoolConfig(t *testing.T) {
+	logger := zap.NewNop()
+
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(configFile, []byte(`{
+		"backends": [
+			{"name": "openai", "base_url": "https://api.openai.com/v1", "prefix": "openai/", "default": true, "max_idle_conns_per_host": 200}
+		]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadConfig(configFile, "", "key", 0, model.Config{}, logger)
+	if err == nil || !strings.Contains(err.Error(), "max_idle_conns_per_host 200 is above max_idle_conns 100") {
+		t.Fatalf("Expected an error for per-host idle connections above the total, got: %v", err)
+	}
+
+	err = os.WriteFile(configFile, []byte(`{
+		"backends": [
+			{"name": "openai", "base_url": "https://api.openai.com/v1", "prefix": "openai/", "default": true, "max_idle_conns_per_host": 50}
+		]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadConfig(configFile, "", "key", 0, model.Config{}, logger)
+	if err == nil || !strings.Contains(err.Error(), "max_idle_conns_per_host 50 is above max_conns_per_host 20") {
+		t.Fatalf("Expected an error for idle connections above the connection limit, got: %v", err)
+	}
+
+	err = os.WriteFile(configFile, []byte(`{
+		"backends": [
+			{"name": "openai", "base_url": "https://api.openai.com/v1", "prefix": "openai/", "default": true, "max_conns_per_host": 500, "max_idle_conns_per_host": 50}
+		]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(configFile, "", "key", 0, model.Config{}, logger)
+	if err != nil {
+		t.Fatalf("Failed to load config: %s", err)
+	}
+	pool := cfg.Backends[0].ConnectionPool()
+	if pool.MaxConnsPerHost != 500 || pool.MaxIdleConnsPerHost != 50 || pool.MaxIdleConns != model.DefaultMaxIdleConns {
+		t.Errorf("Expected configured pool settings with the default idle total, got %+v", pool)
+	}
+}
+
+func TestAttachmentStoreConfig(t *testing.T) {
+	logger := zap.NewNop()
+
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(configFile, []byte(`{
+		"backends": [
+			{"name": "openai", "base_url": "https://api.openai.com/v1", "prefix": "openai/", "default": true}
+		],
+		"attachments": {"store": "s3", "s3": {"region": "eu-west-1"}}
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadConfig(configFile, "", "key", 0, model.Config{}, logger)
+	if err == nil || !strings.Contains(err.Error(), "s3.bucket") {
+		t.Fatalf("Expected an error for a missing bucket, got: %v", err)
+	}
+
+	t.Setenv("S3_BUCKET", "attachments")
+	t.Setenv("S3_ENDPOINT", "http://minio:9000")
+	t.Setenv("AWS_ACCESS_KEY_ID", "minio")
+
+	cfg, err := LoadConfig(configFile, "", "key", 0, model.Config{}, logger)
+	if err != nil {
+		t.Fatalf("Failed to load config: %s", err)
+	}
+	s3 := cfg.Attachments.S3
+	if s3.Bucket != "attachments" || s3.Endpoint != "http://minio:9000" || s3.AccessKeyID != "minio" {
+		t.Errorf("Expected S3 settings from the environment, got %+v", s3)
+	}
+	if s3.Region != "eu-west-1" {
+		t.Errorf("Expected region from the config file, got '%s'", s3.Region)
+	}
+}
+
+func TestConfigMigration(t *testing.T) {
+	logger := zap.NewNop()
+	if len(configMigrations) != model.CurrentConfigVersion {
+		t.Fatalf("expected a migration for each version, got %d for version %d", len(configMigrations), model.CurrentConfigVersion)
+	}
+
+	os.Setenv("MIGRATE_KEY", "key-from-env")
+	defer os.Unsetenv("MIGRATE_KEY")
+
+	load := func(t *testing.T, content string) (*model.Config, error) {
+		configFile := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return LoadConfig(configFile, "", "key", 0, model.Config{}, logger)
+	}
+
+	t.Run("Unversioned", func(t *testing.T) {
+		cfg, err := load(t, `{
+			"max_request_body_size": 9007199254740993,
+			"backends": [
+				{"name": "a", "base_url": "http://a", "prefix": "a/", "key_env_var": "MIGRATE_KEY"},
+				{"name": "b", "base_url": "http://b", "prefix": "b/", "key_env_var": "MIGRATE_KEY", "api_key": "plain"}
+			]
+		}`)
+		if err != nil {
+			t.Fatalf("Failed to load config: %s", err)
+		}
+		if cfg.ConfigVersion != model.CurrentConfigVersion {
+			t.Errorf("Expected config_version %d, got %d", model.CurrentConfigVersion, cfg.ConfigVersion)
+		}
+		a := cfg.Backends[0]
+		if a.KeyEnvVar != "" || len(a.APIKeys) != 1 || a.APIKeys[0] != "key-from-env" {
+			t.Errorf("Expected key_env_var to move to api_keys, got %+v", a)
+		}
+		b := cfg.Backends[1]
+		if b.KeyEnvVar != "MIGRATE_KEY" || len(b.APIKeys) != 0 {
+			t.Errorf("Expected backend with api_key to be unchanged, got %+v", b)
+		}
+		if cfg.MaxRequestBodySize != 9007199254740993 {
+			t.Errorf("Expected integers to survive migration, got %d", cfg.MaxRequestBodySize)
+		}
+	})
+
+	t.Run("Current Version", func(t *testing.T) {
+		cfg, err := load(t, `{"config_version": 1, "backends": [{"name": "a", "base_url": "http://a", "prefix": "a/", "key_env_var": "MIGRATE_KEY"}]}`)
+		if err != nil {
+			t.Fatalf("Failed to load config: %s", err)
+		}
+		if cfg.Backends[0].KeyEnvVar != "MIGRATE_KEY" {
+			t.Errorf("Expected a current config to be left alone, got %+v", cfg.Backends[0])
+		}
+	})
+
+	t.Run("Newer Version", func(t *testing.T) {
+		_, err := load(t, `{"config_version": 99, "backends": []}`)
+		if err == nil || !strings.Contains(err.Error(), "newer") {
+			t.Errorf("Expected a newer config version to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Invalid Version", func(t *testing.T) {
+		if _, err := load(t, `{"config_version": "two", "backends": []}`); err == nil {
+			t.Error("Expected a non-integer config version to be rejected")
+		}
+	})
+}
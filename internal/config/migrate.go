@@ -0,0 +1,92 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"llm-router/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// configMigrations upgrade a config file one version at a time: the entry at
+// index i turns a version i file into version i+1. Each returns a description
+// of every change it made. Files written before versioning are version 0.
+var configMigrations = []func(raw map[string]interface{}) []string{
+	migrateKeyEnvVar,
+}
+
+// MigrateConfig upgrades the JSON of a config file to model.CurrentConfigVersion
+// so it unmarshals into the current Config shape. Files from a newer version
+// are rejected, since fields this binary doesn't know would be silently dropped.
+func MigrateConfig(data []byte, logger *zap.Logger) ([]byte, error) {
+	var raw map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // keep large integers exact when the file is re-encoded
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	version := 0
+	if value, ok := raw["config_version"]; ok {
+		number, _ := value.(json.Number)
+		parsed, err := number.Int64()
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("config_version must be a non-negative integer, got %v", value)
+		}
+		version = int(parsed)
+	}
+
+	if version > model.CurrentConfigVersion {
+		return nil, fmt.Errorf("config version %d is newer than the latest version this build supports (%d); upgrade the binary",
+			version, model.CurrentConfigVersion)
+	}
+	if version == model.CurrentConfigVersion {
+		return data, nil
+	}
+
+	for v := version; v < model.CurrentConfigVersion; v++ {
+		changes := configMigrations[v](raw)
+		logger.Info("Migrated config file",
+			zap.Int("fromVersion", v),
+			zap.Int("toVersion", v+1),
+			zap.Strings("changes", changes))
+	}
+	raw["config_version"] = model.CurrentConfigVersion
+	logger.Warn("Config file uses an older config_version and was upgraded in memory; save the settings to update the file",
+		zap.Int("fileVersion", version),
+		zap.Int("currentVersion", model.CurrentConfigVersion))
+
+	return json.Marshal(raw)
+}
+
+// migrateKeyEnvVar (0 -> 1) moves each backend's legacy key_env_var into
+// api_keys as an environment reference, so the key is picked up by the
+// credential manager like any other. Backends that already set api_key or
+// api_keys are left alone, as key_env_var was ignored for them.
+func migrateKeyEnvVar(raw map[string]interface{}) []string {
+	backends, _ := raw["backends"].([]interface{})
+
+	var changes []string
+	for _, entry := range backends {
+		backend, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		envVar, _ := backend["key_env_var"].(string)
+		if envVar == "" {
+			continue
+		}
+		apiKey, _ := backend["api_key"].(string)
+		apiKeys, _ := backend["api_keys"].([]interface{})
+		if apiKey != "" || len(apiKeys) > 0 {
+			continue
+		}
+
+		backend["api_keys"] = []interface{}{"${" + envVar + "}"}
+		delete(backend, "key_env_var")
+		changes = append(changes, fmt.Sprintf("backend %v: key_env_var %q moved to api_keys", backend["name"], envVar))
+	}
+	return changes
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// DefaultWatchDebounce is how long the watcher waits for writes to settle before reloading
+const DefaultWatchDebounce = 500 * time.Millisecond
+
+// Watcher calls a reload function when the config file changes on disk
+type Watcher struct {
+	watcher  *fsnotify.Watcher
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// WatchConfig watches configFile and calls reload once writes have settled for
+// debounce. The file's directory is watched rather than the file itself so
+// editors that save by renaming a temp file over it are still picked up.
+// Errors from reload are logged and the watcher keeps running, so the caller
+// should keep its last good config when reload fails.
+func WatchConfig(configFile string, debounce time.Duration, reload func() error, logger *zap.Logger) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	target := filepath.Clean(configFile)
+	if err := fsw.Add(filepath.Dir(target)); err != nil {
+		fsw.Close()
+		return nil, err
+	}
+
+	w := &Watcher{
+		watcher: fsw,
+		done:    make(chan struct{}),
+	}
+	go w.run(target, debounce, reload, logger)
+
+	logger.Info("Watching config file for changes", zap.String("file", configFile))
+	return w, nil
+}
+
+func (w *Watcher) run(target string, debounce time.Duration, reload func() error, logger *zap.Logger) {
+	var timer *time.Timer
+	fire := make(chan struct{}, 1)
+
+	for {
+		select {
+		case <-w.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != target || !event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+				continue
+			}
+
+			// Restart the debounce window on every write
+			if timer == nil {
+				timer = time.AfterFunc(debounce, func() {
+					select {
+					case fire <- struct{}{}:
+					default:
+					}
+				})
+			} else {
+				timer.Reset(debounce)
+			}
+
+		case <-fire:
+			logger.Info("Config file changed, reloading", zap.String("file", target))
+			if err := reload(); err != nil {
+				logger.Error("Failed to reload changed config file, keeping current config",
+					zap.String("file", target),
+					zap.Error(err))
+			}
+
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Warn("Config watcher error", zap.Error(err))
+		}
+	}
+}
+
+// Close stops watching the config file
+func (w *Watcher) Close() error {
+	var err error
+	w.stopOnce.Do(func() {
+		close(w.done)
+		err = w.watcher.Close()
+	})
+	return err
+}
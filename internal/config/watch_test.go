@@ -0,0 +1,48 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestWatchConfig(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configFile, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var reloads atomic.Int32
+	watcher, err := WatchConfig(configFile, 50*time.Millisecond, func() error {
+		reloads.Add(1)
+		return nil
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("failed to watch config: %v", err)
+	}
+	defer watcher.Close()
+
+	// Changes to other files in the directory are ignored
+	os.WriteFile(filepath.Join(dir, "other.json"), []byte(`{}`), 0644)
+
+	// Rapid successive writes are debounced into one reload
+	for i := 0; i < 5; i++ {
+		os.WriteFile(configFile, []byte(`{"listening_port": 8080}`), 0644)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for reloads.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	if n := reloads.Load(); n != 1 {
+		t.Errorf("expected 1 reload, got %d", n)
+	}
+}
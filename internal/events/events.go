@@ -0,0 +1,142 @@
+// Package events is an in-process bus of routing events, such as requests
+// starting and finishing, backend choices, retries and key failures, for live
+// monitoring. Publishing costs next to nothing while nobody is listening.
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event types
+const (
+	RequestReceived = "request_received"
+	RequestFinished = "request_finished"
+	BackendSelected = "backend_selected"
+	Retry           = "retry"
+	KeyFailed       = "key_failed"
+	Fallback        = "fallback"
+	CircuitOpen     = "circuit_open"
+	Error           = "error"
+)
+
+// subscriberBuffer is how many events a slow listener may fall behind by
+// before it misses some
+const subscriberBuffer = 64
+
+// Event is one routing event. Fields that don't apply to its type are empty.
+type Event struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Method     string    `json:"method,omitempty"`
+	Path       string    `json:"path,omitempty"`
+	Backend    string    `json:"backend,omitempty"`
+	Target     string    `json:"target,omitempty"` // Backend a failed request falls back to
+	Model      string    `json:"model,omitempty"`
+	Status     int       `json:"status,omitempty"`
+	Attempt    int       `json:"attempt,omitempty"`
+	KeyIndex   *int      `json:"key_index,omitempty"` // Position of the API key in the backend's list
+	DurationMs int64     `json:"duration_ms,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Bus fans events out to every listener
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[chan Event]struct{}
+	count       atomic.Int32
+	closed      bool
+}
+
+// NewBus creates a Bus without listeners
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[chan Event]struct{})}
+}
+
+// Subscribe registers a listener. The channel is closed when the bus is
+// closed; the returned function unregisters the listener and must be called
+// once it is done.
+func (b *Bus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	b.subscribers[ch] = struct{}{}
+	b.count.Add(1)
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if _, ok := b.subscribers[ch]; ok {
+				delete(b.subscribers, ch)
+				b.count.Add(-1)
+				close(ch)
+			}
+		})
+	}
+}
+
+// Active reports whether anyone is listening, so callers can skip building
+// events nobody would see
+func (b *Bus) Active() bool {
+	return b.count.Load() > 0
+}
+
+// Publish delivers an event to every listener, stamping its time if unset.
+// Listeners with a full buffer miss the event rather than slow the router.
+func (b *Bus) Publish(event Event) {
+	if !b.Active() {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Close ends every subscription, so long-lived listeners return on shutdown
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+	b.count.Store(0)
+}
+
+// defaultBus is the router's bus
+var defaultBus = NewBus()
+
+// Default returns the router's bus
+func Default() *Bus {
+	return defaultBus
+}
+
+// Publish sends an event on the router's bus
+func Publish(event Event) {
+	defaultBus.Publish(event)
+}
+
+// Active reports whether anyone is listening on the router's bus
+func Active() bool {
+	return defaultBus.Active()
+}
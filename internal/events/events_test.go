@@ -0,0 +1,87 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBus(t *testing.T) {
+	t.Run("Publish Without Listeners", func(t *testing.T) {
+		bus := NewBus()
+		if bus.Active() {
+			t.Fatal("expected a new bus to be inactive")
+		}
+		bus.Publish(Event{Type: RequestReceived})
+	})
+
+	t.Run("Fans Out To Listeners", func(t *testing.T) {
+		bus := NewBus()
+		first, unsubscribeFirst := bus.Subscribe()
+		defer unsubscribeFirst()
+		second, unsubscribeSecond := bus.Subscribe()
+		defer unsubscribeSecond()
+
+		bus.Publish(Event{Type: BackendSelected, Backend: "openai"})
+
+		for _, ch := range []<-chan Event{first, second} {
+			event := <-ch
+			if event.Type != BackendSelected || event.Backend != "openai" {
+				t.Errorf("unexpected event: %+v", event)
+			}
+			if event.Time.IsZero() {
+				t.Error("expected the event time to be set")
+			}
+		}
+	})
+
+	t.Run("Unsubscribe Closes Channel", func(t *testing.T) {
+		bus := NewBus()
+		ch, unsubscribe := bus.Subscribe()
+		unsubscribe()
+		unsubscribe()
+
+		if _, ok := <-ch; ok {
+			t.Error("expected the channel to be closed")
+		}
+		if bus.Active() {
+			t.Error("expected the bus to be inactive")
+		}
+	})
+
+	t.Run("Slow Listener Misses Events", func(t *testing.T) {
+		bus := NewBus()
+		ch, unsubscribe := bus.Subscribe()
+		defer unsubscribe()
+
+		done := make(chan struct{})
+		go func() {
+			for i := 0; i < subscriberBuffer*2; i++ {
+				bus.Publish(Event{Type: Retry, Attempt: i + 1})
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("expected publishing not to block on a full listener")
+		}
+		if len(ch) != subscriberBuffer {
+			t.Errorf("expected %d buffered events, got %d", subscriberBuffer, len(ch))
+		}
+	})
+
+	t.Run("Close Ends Subscriptions", func(t *testing.T) {
+		bus := NewBus()
+		ch, unsubscribe := bus.Subscribe()
+		bus.Close()
+		unsubscribe()
+
+		if _, ok := <-ch; ok {
+			t.Error("expected the channel to be closed")
+		}
+		late, _ := bus.Subscribe()
+		if _, ok := <-late; ok {
+			t.Error("expected subscribing to a closed bus to return a closed channel")
+		}
+	})
+}
@@ -1,9 +1,12 @@
 package handler
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"llm-router/internal/identity"
 	"llm-router/internal/model"
@@ -43,11 +46,18 @@ func HandleAttachment(w http.ResponseWriter, r *http.Request, cfg *model.Config)
 		return
 	}
 
-	// Set content type and serve the file
+	// The modification time is only used for conditional requests, so serve without it if unavailable
+	var modTime time.Time
+	if info, err := attachmentStore.Stat(uuid); err == nil {
+		modTime = info.ModTime
+	}
+
+	// Attachments never change once stored, so the ID is a strong ETag.
+	// ServeContent handles Range and conditional requests.
 	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Cache-Control", "public, max-age=31536000") // Cache for 1 year
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+	w.Header().Set("ETag", `"`+uuid+`"`)
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(data))
 }
 
 // HandleAttachmentUpload handles uploading new attachments
@@ -70,6 +80,15 @@ func HandleAttachmentUpload(w http.ResponseWriter, r *http.Request, cfg *model.C
 		return
 	}
 
+	limits := identity.AttachmentLimits{
+		MaxSize:      cfg.AttachmentSizeLimit(),
+		AllowedTypes: cfg.AttachmentTypes(),
+	}
+	if err := limits.CheckEncodedSize(req.Data); err != nil {
+		respondWithAttachmentError(w, err, cfg.Logger)
+		return
+	}
+
 	// Decode base64 image
 	data, contentType, err := identity.DecodeBase64Image(req.Data)
 	if err != nil {
@@ -84,6 +103,31 @@ func HandleAttachmentUpload(w http.ResponseWriter, r *http.Request, cfg *model.C
 		contentType = req.ContentType
 	}
 
+	if err := limits.Check(data, contentType); err != nil {
+		respondWithAttachmentError(w, err, cfg.Logger)
+		return
+	}
+
+	// Uploads by a signed-in user count towards their storage quota
+	var userID int64
+	if authManager != nil {
+		if session, _ := authManager.GetSession(r); session != nil {
+			userID = session.UserID
+		}
+	}
+	if userID != 0 {
+		err := authManager.CheckStorageQuota(userID, int64(len(data)))
+		if errors.Is(err, identity.ErrStorageQuotaExceeded) {
+			respondWithAttachmentError(w, err, cfg.Logger)
+			return
+		}
+		if err != nil {
+			cfg.Logger.Error("Failed to check storage quota", zap.Error(err))
+			http.Error(w, "failed to save attachment", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Save to attachment store
 	uuid, err := attachmentStore.Save(data, contentType)
 	if err != nil {
@@ -93,9 +137,32 @@ func HandleAttachmentUpload(w http.ResponseWriter, r *http.Request, cfg *model.C
 		return
 	}
 
+	if userID != 0 {
+		if err := authManager.RecordAttachmentUsage(userID, uuid, int64(len(data))); err != nil {
+			cfg.Logger.Error("Failed to record attachment usage",
+				zap.String("uuid", uuid),
+				zap.Error(err))
+		}
+	}
+
 	// Return UUID
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"uuid": uuid,
 	})
 }
+
+// respondWithAttachmentError rejects an upload that failed the attachment limits
+func respondWithAttachmentError(w http.ResponseWriter, err error, logger *zap.Logger) {
+	logger.Warn("Rejected attachment upload", zap.Error(err))
+	switch {
+	case errors.Is(err, identity.ErrAttachmentTooLarge):
+		http.Error(w, "attachment too large", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, identity.ErrStorageQuotaExceeded):
+		http.Error(w, "storage quota exceeded", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, identity.ErrAttachmentType):
+		http.Error(w, "unsupported attachment type", http.StatusUnsupportedMediaType)
+	default:
+		http.Error(w, "invalid attachment", http.StatusBadRequest)
+	}
+}
@@ -7,15 +7,18 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"llm-router/internal/identity"
 	"llm-router/internal/model"
 
 	"go.uber.org/zap"
 )
 
 type MockAttachmentStore struct {
-	data map[string][]byte
-	ct   map[string]string
+	data    map[string][]byte
+	ct      map[string]string
+	modTime time.Time
 }
 
 func (m *MockAttachmentStore) Save(data []byte, contentType string) (string, error) {
@@ -33,6 +36,14 @@ func (m *MockAttachmentStore) Get(uuid string) ([]byte, string, error) {
 	return data, m.ct[uuid], nil
 }
 
+func (m *MockAttachmentStore) Stat(uuid string) (identity.AttachmentInfo, error) {
+	data, ok := m.data[uuid]
+	if !ok {
+		return identity.AttachmentInfo{}, fmt.Errorf("not found")
+	}
+	return identity.AttachmentInfo{Size: int64(len(data)), ContentType: m.ct[uuid], ModTime: m.modTime}, nil
+}
+
 func (m *MockAttachmentStore) Delete(uuid string) error {
 	delete(m.data, uuid)
 	delete(m.ct, uuid)
@@ -44,8 +55,9 @@ func TestHandleAttachment(t *testing.T) {
 	cfg := &model.Config{Logger: logger}
 
 	mockStore := &MockAttachmentStore{
-		data: map[string][]byte{"uuid1": []byte("test-data")},
-		ct:   map[string]string{"uuid1": "image/png"},
+		data:    map[string][]byte{"uuid1": []byte("test-data")},
+		ct:      map[string]string{"uuid1": "image/png"},
+		modTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
 	}
 	SetAttachmentStore(mockStore)
 
@@ -66,6 +78,48 @@ func TestHandleAttachment(t *testing.T) {
 		}
 	})
 
+	t.Run("Range", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/v1/attachments/uuid1", nil)
+		req.Header.Set("Range", "bytes=5-8")
+		rr := httptest.NewRecorder()
+
+		HandleAttachment(rr, req, cfg)
+
+		if rr.Code != http.StatusPartialContent {
+			t.Fatalf("expected 206, got %d", rr.Code)
+		}
+		if rr.Body.String() != "data" {
+			t.Errorf("expected data, got %s", rr.Body.String())
+		}
+		if rr.Header().Get("Content-Range") != "bytes 5-8/9" {
+			t.Errorf("unexpected Content-Range %q", rr.Header().Get("Content-Range"))
+		}
+		if rr.Header().Get("Accept-Ranges") != "bytes" {
+			t.Errorf("expected Accept-Ranges bytes, got %q", rr.Header().Get("Accept-Ranges"))
+		}
+		if rr.Header().Get("Cache-Control") != "public, max-age=31536000" {
+			t.Errorf("unexpected Cache-Control %q", rr.Header().Get("Cache-Control"))
+		}
+	})
+
+	t.Run("Conditional", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/v1/attachments/uuid1", nil)
+		req.Header.Set("If-None-Match", `"uuid1"`)
+		rr := httptest.NewRecorder()
+		HandleAttachment(rr, req, cfg)
+		if rr.Code != http.StatusNotModified {
+			t.Errorf("expected 304 for matching ETag, got %d", rr.Code)
+		}
+
+		req, _ = http.NewRequest("GET", "/v1/attachments/uuid1", nil)
+		req.Header.Set("If-Modified-Since", mockStore.modTime.Add(time.Hour).Format(http.TimeFormat))
+		rr = httptest.NewRecorder()
+		HandleAttachment(rr, req, cfg)
+		if rr.Code != http.StatusNotModified {
+			t.Errorf("expected 304 for unmodified attachment, got %d", rr.Code)
+		}
+	})
+
 	t.Run("NotFound", func(t *testing.T) {
 		req, _ := http.NewRequest("GET", "/v1/attachments/nonexistent", nil)
 		rr := httptest.NewRecorder()
@@ -112,3 +166,48 @@ func TestHandleAttachmentUpload(t *testing.T) {
 		t.Errorf("expected uuid in response")
 	}
 }
+
+func TestHandleAttachmentUploadLimits(t *testing.T) {
+	SetAttachmentStore(&MockAttachmentStore{
+		data: make(map[string][]byte),
+		ct:   make(map[string]string),
+	})
+
+	pngData := "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mP8z8BQDwAEhQGAhKmMIQAAAABJRU5ErkJggg=="
+
+	upload := func(cfg *model.Config, data, contentType string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"data": data, "contentType": contentType})
+		req, _ := http.NewRequest("POST", "/v1/attachments/upload", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+		HandleAttachmentUpload(rr, req, cfg)
+		return rr
+	}
+
+	t.Run("Too Large", func(t *testing.T) {
+		cfg := &model.Config{Logger: zap.NewNop(), Attachments: &model.AttachmentsConfig{MaxSize: 16}}
+		if rr := upload(cfg, pngData, "image/png"); rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected 413, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Disallowed Type", func(t *testing.T) {
+		cfg := &model.Config{Logger: zap.NewNop()}
+		if rr := upload(cfg, "data:text/plain;base64,aGVsbG8gd29ybGQ=", ""); rr.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("expected 415, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Content Does Not Match Type", func(t *testing.T) {
+		cfg := &model.Config{Logger: zap.NewNop()}
+		if rr := upload(cfg, "data:image/png;base64,aGVsbG8gd29ybGQ=", "image/png"); rr.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("expected 415, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Configured Type", func(t *testing.T) {
+		cfg := &model.Config{Logger: zap.NewNop(), Attachments: &model.AttachmentsConfig{AllowedTypes: []string{"image/jpeg"}}}
+		if rr := upload(cfg, pngData, "image/png"); rr.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("expected 415 for a type outside the allowlist, got %d", rr.Code)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"llm-router/internal/model"
+	"llm-router/internal/proxy"
+
+	"go.uber.org/zap"
+)
+
+// maxModelFieldSize bounds the model form field, which is read into memory
+const maxModelFieldSize = 1024
+
+// formPart is a multipart part read ahead of the model field
+type formPart struct {
+	header textproto.MIMEHeader
+	data   []byte
+}
+
+// HandleAudio routes multipart audio requests (transcriptions, translations)
+// by the prefix of their model form field. Only the parts before the model
+// field are held in memory; the rest of the upload, normally the audio file,
+// is streamed through to the backend with the model field rewritten.
+func HandleAudio(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	logger := cfg.Logger
+
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get(headerContentType))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		http.Error(w, "Expected a multipart/form-data request", http.StatusBadRequest)
+		return
+	}
+
+	reader := multipart.NewReader(r.Body, params["boundary"])
+
+	// Clients usually send the model before the file, so this rarely buffers much
+	var leading []formPart
+	var modelName string
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			http.Error(w, "Model field missing", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			respondWithBodyReadError(w, err)
+			return
+		}
+
+		if part.FormName() == "model" {
+			value, err := io.ReadAll(io.LimitReader(part, maxModelFieldSize))
+			if err != nil {
+				respondWithBodyReadError(w, err)
+				return
+			}
+			modelName = strings.TrimSpace(string(value))
+			break
+		}
+
+		data, err := io.ReadAll(part)
+		if err != nil {
+			respondWithBodyReadError(w, err)
+			return
+		}
+		leading = append(leading, formPart{header: part.Header, data: data})
+	}
+
+	logger.Info("Incoming audio request for model", zap.String("model", modelName))
+	modelName = resolveModelAlias(modelName, cfg)
+
+	proxies := proxy.Current()
+	var target http.Handler
+	newModelName := modelName
+	if upstream, stripped := matchUpstream(proxies, modelName); upstream != nil {
+		target = upstream.Proxy
+		newModelName = stripped
+		logger.Info("Routing model to new model",
+			zap.String("originalModel", modelName),
+			zap.String("newModel", newModelName),
+			zap.String("backend", upstream.Backend.Name))
+	} else if proxies.DefaultProxy != nil {
+		target = proxies.DefaultProxy
+		logger.Info("Routing request to default proxy", zap.String("model", modelName))
+	} else {
+		respondWithNoBackend(w, proxies, modelName, logger)
+		return
+	}
+
+	// Re-encode the form as it is read so the upload is never held in full
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(rewriteMultipart(writer, leading, newModelName, reader))
+	}()
+
+	r.Body = pr
+	r.ContentLength = -1
+	r.Header.Del("Content-Length")
+	r.Header.Set(headerContentType, writer.FormDataContentType())
+
+	target.ServeHTTP(w, r)
+}
+
+// rewriteMultipart writes the buffered leading parts, the rewritten model
+// field, and then copies the remaining parts straight from reader
+func rewriteMultipart(writer *multipart.Writer, leading []formPart, modelName string, reader *multipart.Reader) error {
+	for _, part := range leading {
+		dst, err := writer.CreatePart(part.header)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(dst, bytes.NewReader(part.data)); err != nil {
+			return err
+		}
+	}
+
+	if err := writer.WriteField("model", modelName); err != nil {
+		return err
+	}
+
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		dst, err := writer.CreatePart(part.Header)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(dst, part); err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"llm-router/internal/model"
+	"llm-router/internal/proxy"
+
+	"go.uber.org/zap"
+)
+
+func TestHandleAudio(t *testing.T) {
+	type received struct {
+		path     string
+		model    string
+		language string
+		file     []byte
+	}
+	results := make(chan received, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("backend failed to parse multipart form: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("backend got no file: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		results <- received{
+			path:     r.URL.Path,
+			model:    r.FormValue("model"),
+			language: r.FormValue("language"),
+			file:     data,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"text":"hello"}`))
+	}))
+	defer server.Close()
+
+	backend := model.BackendConfig{Name: "openai", BaseURL: server.URL, Prefix: "openai/"}
+	proxy.SetCurrent(proxy.NewProxySet([]model.BackendConfig{backend}, zap.NewNop()))
+
+	cfg := &model.Config{
+		Logger:   zap.NewNop(),
+		Backends: []model.BackendConfig{backend},
+	}
+
+	audio := bytes.Repeat([]byte("RIFF...."), 4096)
+
+	buildRequest := func(modelFirst bool) *http.Request {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		if modelFirst {
+			mw.WriteField("model", "openai/whisper-1")
+		}
+		fw, _ := mw.CreateFormFile("file", "speech.wav")
+		fw.Write(audio)
+		mw.WriteField("language", "en")
+		if !modelFirst {
+			mw.WriteField("model", "openai/whisper-1")
+		}
+		mw.Close()
+
+		req := httptest.NewRequest("POST", "/v1/audio/transcriptions", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		return req
+	}
+
+	for _, tt := range []struct {
+		name       string
+		modelFirst bool
+	}{
+		{"Model Before File", true},
+		{"Model After File", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			HandleAudio(rr, buildRequest(tt.modelFirst), cfg)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+
+			got := <-results
+			if got.path != "/v1/audio/transcriptions" {
+				t.Errorf("expected path /v1/audio/transcriptions, got %s", got.path)
+			}
+			if got.model != "whisper-1" {
+				t.Errorf("expected prefix stripped from model, got %q", got.model)
+			}
+			if got.language != "en" {
+				t.Errorf("expected language field preserved, got %q", got.language)
+			}
+			if !bytes.Equal(got.file, audio) {
+				t.Errorf("expected file to arrive intact, got %d bytes", len(got.file))
+			}
+		})
+	}
+
+	t.Run("Model Missing", func(t *testing.T) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("file", "speech.wav")
+		fw.Write(audio)
+		mw.Close()
+
+		req := httptest.NewRequest("POST", "/v1/audio/transcriptions", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rr := httptest.NewRecorder()
+		HandleAudio(rr, req, cfg)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Not Multipart", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/audio/transcriptions", bytes.NewBufferString(`{"model":"openai/whisper-1"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		HandleAudio(rr, req, cfg)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", rr.Code)
+		}
+	})
+}
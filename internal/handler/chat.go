@@ -3,6 +3,7 @@ package handler
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
@@ -15,9 +16,175 @@ import (
 
 // HandleChatCompletions processes the chat completions endpoint with model routing and transformations
 func HandleChatCompletions(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	routeByModel(w, r, cfg, transformChatRequest)
+}
+
+// transformChatRequest applies a backend's chat-specific settings to the request
+func transformChatRequest(chatReq map[string]interface{}, backend model.BackendConfig, logger *zap.Logger) {
+	// Inject the system prompt first so role rewrites also apply to it
+	applySystemPrompt(chatReq, backend, logger)
+	rewriteMessageRoles(chatReq, backend, logger)
+	applyDefaultParams(chatReq, backend, logger)
+	clampParams(chatReq, backend, logger)
+}
+
+// applyDefaultParams adds the backend's default params the client didn't set.
+// Values come from the JSON config, so they marshal back exactly as written.
+func applyDefaultParams(chatReq map[string]interface{}, backend model.BackendConfig, logger *zap.Logger) {
+	for param, value := range backend.DefaultParams {
+		if _, exists := chatReq[param]; exists {
+			continue
+		}
+		logger.Info("Applying default parameter",
+			zap.String("parameter", param),
+			zap.Any("value", value))
+		chatReq[param] = value
+	}
+}
+
+// applySystemPrompt injects the backend's system prompt. In prepend mode it is
+// put ahead of the client's first system message, or added as a new one; in
+// replace mode the client's system messages are dropped in its favor.
+func applySystemPrompt(chatReq map[string]interface{}, backend model.BackendConfig, logger *zap.Logger) {
+	if backend.SystemPrompt == "" {
+		return
+	}
+
+	messages, ok := chatReq["messages"].([]interface{})
+	if !ok {
+		return
+	}
+
+	systemMsg := map[string]interface{}{
+		"role":    "system",
+		"content": backend.SystemPrompt,
+	}
+
+	if backend.SystemPromptMode == model.SystemPromptReplace {
+		kept := make([]interface{}, 0, len(messages)+1)
+		kept = append(kept, systemMsg)
+		for _, msg := range messages {
+			if msgMap, ok := msg.(map[string]interface{}); ok && msgMap["role"] == "system" {
+				continue
+			}
+			kept = append(kept, msg)
+		}
+		chatReq["messages"] = kept
+		logger.Info("Replaced system message with backend system prompt", zap.String("backend", backend.Name))
+		return
+	}
+
+	for _, msg := range messages {
+		msgMap, ok := msg.(map[string]interface{})
+		if !ok || msgMap["role"] != "system" {
+			continue
+		}
+		switch content := msgMap["content"].(type) {
+		case string:
+			msgMap["content"] = backend.SystemPrompt + "\n\n" + content
+		case []interface{}:
+			textPart := map[string]interface{}{"type": "text", "text": backend.SystemPrompt}
+			msgMap["content"] = append([]interface{}{textPart}, content...)
+		default:
+			continue
+		}
+		logger.Info("Prepended backend system prompt to system message", zap.String("backend", backend.Name))
+		return
+	}
+
+	chatReq["messages"] = append([]interface{}{systemMsg}, messages...)
+	logger.Info("Added backend system prompt as system message", zap.String("backend", backend.Name))
+}
+
+// rewriteMessageRoles applies the backend's role rewrites to chat messages
+func rewriteMessageRoles(chatReq map[string]interface{}, backend model.BackendConfig, logger *zap.Logger) {
+	if len(backend.RoleRewrites) == 0 {
+		return
+	}
+
+	// Check if there are messages to rewrite
+	if messages, ok := chatReq["messages"].([]interface{}); ok {
+		for i, msg := range messages {
+			if msgMap, ok := msg.(map[string]interface{}); ok {
+				if role, ok := msgMap["role"].(string); ok {
+					// Check if this role needs to be rewritten
+					if newRole, exists := backend.RoleRewrites[role]; exists {
+						logger.Info("Rewriting message role",
+							zap.String("originalRole", role),
+							zap.String("newRole", newRole))
+						msgMap["role"] = newRole
+						messages[i] = msgMap
+					}
+				}
+			}
+		}
+		chatReq["messages"] = messages
+	}
+}
+
+// resolveModelAlias returns the model an alias points to, or modelName itself
+func resolveModelAlias(modelName string, cfg *model.Config) string {
+	if aliasTarget, exists := cfg.Aliases[modelName]; exists {
+		cfg.Logger.Info("Applying model alias",
+			zap.String("originalModel", modelName),
+			zap.String("aliasTarget", aliasTarget))
+		return aliasTarget
+	}
+	return modelName
+}
+
+// matchUpstream picks a backend whose prefix matches modelName and returns it
+// along with the model name stripped of the prefix. The upstream is nil when
+// no prefix matches.
+func matchUpstream(proxies *proxy.ProxySet, modelName string) (*proxy.Upstream, string) {
+	for prefix, group := range proxies.Proxies {
+		if strings.HasPrefix(modelName, prefix) {
+			// Pick a backend when several share the prefix
+			if upstream := group.Pick(); upstream != nil {
+				return upstream, strings.TrimPrefix(modelName, prefix)
+			}
+		}
+	}
+	return nil, modelName
+}
+
+// clampParams keeps numeric params within the backend's configured limits.
+// Non-numeric values are left for the backend to reject.
+func clampParams(chatReq map[string]interface{}, backend model.BackendConfig, logger *zap.Logger) {
+	for param, limit := range backend.ParamLimits {
+		value, ok := chatReq[param].(float64)
+		if !ok {
+			continue
+		}
+
+		clamped := value
+		if limit.Min != nil && clamped < *limit.Min {
+			clamped = *limit.Min
+		}
+		if limit.Max != nil && clamped > *limit.Max {
+			clamped = *limit.Max
+		}
+		if clamped != value {
+			logger.Info("Clamped parameter to backend limit",
+				zap.String("backend", backend.Name),
+				zap.String("parameter", param),
+				zap.Float64("requested", value),
+				zap.Float64("clamped", clamped))
+			chatReq[param] = clamped
+		}
+	}
+}
+
+// routeByModel reads a JSON request carrying a "model" field, resolves aliases,
+// strips the matching backend prefix, drops the backend's unsupported params
+// and proxies the request. transform, when set, applies endpoint-specific
+// changes for the chosen backend. Several models may be requested, as a
+// comma-separated "model" or a "models" array; they are tried in order as
+// described in routeToFirstAvailable.
+func routeByModel(w http.ResponseWriter, r *http.Request, cfg *model.Config, transform func(map[string]interface{}, model.BackendConfig, *zap.Logger)) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusInternalServerError)
+		respondWithBodyReadError(w, err)
 		return
 	}
 
@@ -27,92 +194,71 @@ func HandleChatCompletions(w http.ResponseWriter, r *http.Request, cfg *model.Co
 		return
 	}
 
-	modelName, ok := chatReq["model"].(string)
-	if !ok {
-		http.Error(w, "Model key missing or not a string", http.StatusBadRequest)
+	modelNames, err := requestedModels(chatReq)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	logger := cfg.Logger
-	logger.Info("Incoming request for model", zap.String("model", modelName))
-
-	// Check for model aliases
-	if cfg.Aliases != nil {
-		if aliasTarget, exists := cfg.Aliases[modelName]; exists {
-			logger.Info("Applying model alias",
-				zap.String("originalModel", modelName),
-				zap.String("aliasTarget", aliasTarget))
-			modelName = aliasTarget
-			chatReq["model"] = modelName
-		}
+	logger.Info("Incoming request for model", zap.String("model", strings.Join(modelNames, ",")))
+
+	proxies := proxy.Current()
+	if _, hasModelList := chatReq["models"]; hasModelList || len(modelNames) > 1 {
+		routeToFirstAvailable(w, r, cfg, proxies, body, modelNames, transform)
+		return
 	}
 
-	for prefix, proxyHandler := range proxy.Proxies {
-		if strings.HasPrefix(modelName, prefix) {
-			newModelName := strings.TrimPrefix(modelName, prefix)
-			chatReq["model"] = newModelName
-
-			// Apply role rewrites for the selected backend if available
-			var selectedBackend model.BackendConfig
-			for _, backend := range cfg.Backends {
-				if strings.TrimSpace(backend.Prefix) == prefix {
-					selectedBackend = backend
-					break
-				}
-			}
+	modelName := resolveModelAlias(modelNames[0], cfg)
+	if !proxyModel(w, r, cfg, proxies, chatReq, body, modelName, transform) {
+		respondWithNoBackend(w, proxies, modelName, logger)
+	}
+}
 
-			// Apply role rewrites if configured for this backend
-			if len(selectedBackend.RoleRewrites) > 0 {
-				// Check if there are messages to rewrite
-				if messages, ok := chatReq["messages"].([]interface{}); ok {
-					for i, msg := range messages {
-						if msgMap, ok := msg.(map[string]interface{}); ok {
-							if role, ok := msgMap["role"].(string); ok {
-								// Check if this role needs to be rewritten
-								if newRole, exists := selectedBackend.RoleRewrites[role]; exists {
-									logger.Info("Rewriting message role",
-										zap.String("originalRole", role),
-										zap.String("newRole", newRole))
-									msgMap["role"] = newRole
-									messages[i] = msgMap
-								}
-							}
-						}
-					}
-					chatReq["messages"] = messages
-				}
-			}
+// proxyModel sends the request, decoded as chatReq from body, to the backend
+// serving modelName. The default proxy gets body unchanged when no prefix
+// matches. It returns false, having written nothing, when no backend serves
+// modelName.
+func proxyModel(w http.ResponseWriter, r *http.Request, cfg *model.Config, proxies *proxy.ProxySet, chatReq map[string]interface{}, body []byte, modelName string, transform func(map[string]interface{}, model.BackendConfig, *zap.Logger)) bool {
+	logger := cfg.Logger
 
-			// Remove unsupported parameters if configured for this backend
-			if len(selectedBackend.UnsupportedParams) > 0 {
-				for _, param := range selectedBackend.UnsupportedParams {
-					if _, exists := chatReq[param]; exists {
-						logger.Info("Dropping unsupported parameter",
-							zap.String("parameter", param))
-						delete(chatReq, param)
-					}
-				}
-			}
+	if upstream, newModelName := matchUpstream(proxies, modelName); upstream != nil {
+		chatReq["model"] = newModelName
+		selectedBackend := upstream.Backend
+		applyBackendSettings(chatReq, selectedBackend, transform, logger)
 
-			modifiedBody, err := json.Marshal(chatReq)
-			if err != nil {
-				http.Error(w, "Error re-marshalling request body", http.StatusInternalServerError)
-				return
+		modifiedBody, err := json.Marshal(chatReq)
+		if err != nil {
+			http.Error(w, "Error re-marshalling request body", http.StatusInternalServerError)
+			return true
+		}
+		// A fallback backend starts again from the client's body with its own settings
+		r = r.WithContext(proxy.WithBackendBody(r.Context(), func(backend model.BackendConfig) ([]byte, error) {
+			var backendReq map[string]interface{}
+			if err := json.Unmarshal(body, &backendReq); err != nil {
+				return nil, err
 			}
-			r.Body = io.NopCloser(bytes.NewBuffer(modifiedBody))
-			// Let Go calculate and handle Content-Length automatically
-			r.ContentLength = int64(len(modifiedBody))
-			// Don't set Content-Length header explicitly - let http.Client handle it
+			backendReq["model"] = newModelName
+			applyBackendSettings(backendReq, backend, transform, logger)
+			return json.Marshal(backendReq)
+		}))
+		r.Body = io.NopCloser(bytes.NewBuffer(modifiedBody))
+		// Let Go calculate and handle Content-Length automatically
+		r.ContentLength = int64(len(modifiedBody))
+		// Don't set Content-Length header explicitly - let http.Client handle it
 
-			logger.Info("Routing model to new model", zap.String("originalModel", modelName), zap.String("newModel", newModelName))
+		logger.Info("Routing model to new model",
+			zap.String("originalModel", modelName),
+			zap.String("newModel", newModelName),
+			zap.String("backend", selectedBackend.Name))
 
-			proxyHandler.ServeHTTP(w, r)
-			return
-		}
+		w.Header().Set(servedModelHeader, modelName)
+		upstream.Proxy.ServeHTTP(w, r)
+		return true
 	}
 
 	// If no prefix matches, use the default proxy
-	if proxy.DefaultProxy != nil {
+	if proxies.DefaultProxy != nil {
 		logger.Info("Routing request to default proxy", zap.String("model", modelName))
 
 		r.Body = io.NopCloser(bytes.NewBuffer(body))
@@ -120,10 +266,47 @@ func HandleChatCompletions(w http.ResponseWriter, r *http.Request, cfg *model.Co
 		r.ContentLength = int64(len(body))
 		// Don't set Content-Length header explicitly - let http.Client handle it
 
-		proxy.DefaultProxy.ServeHTTP(w, r)
-		return
+		w.Header().Set(servedModelHeader, modelName)
+		proxies.DefaultProxy.ServeHTTP(w, r)
+		return true
+	}
+
+	return false
+}
+
+// applyBackendSettings applies transform and drops the params the backend
+// doesn't support
+func applyBackendSettings(chatReq map[string]interface{}, backend model.BackendConfig, transform func(map[string]interface{}, model.BackendConfig, *zap.Logger), logger *zap.Logger) {
+	if transform != nil {
+		transform(chatReq, backend, logger)
 	}
 
-	logger.Warn("No suitable backend found", zap.String("model", modelName))
-	http.Error(w, "No suitable backend found", http.StatusBadGateway)
+	// Remove unsupported parameters if configured for this backend
+	for _, param := range backend.UnsupportedParams {
+		if _, exists := chatReq[param]; exists {
+			logger.Info("Dropping unsupported parameter",
+				zap.String("parameter", param))
+			delete(chatReq, param)
+		}
+	}
+}
+
+// respondWithNoBackend tells the client that no backend serves modelName and
+// lists the prefixes that do route somewhere. Backend URLs are not included.
+func respondWithNoBackend(w http.ResponseWriter, proxies *proxy.ProxySet, modelName string, logger *zap.Logger) {
+	prefixes := proxies.Prefixes()
+	logger.Warn("No suitable backend found",
+		zap.String("model", modelName),
+		zap.Strings("prefixes", prefixes))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message":            fmt.Sprintf("No backend matches model %q; model names must start with one of the available prefixes", modelName),
+			"type":               "invalid_request_error",
+			"code":               "model_not_found",
+			"available_prefixes": prefixes,
+		},
+	})
 }
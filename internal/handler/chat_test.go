@@ -3,10 +3,12 @@ package handler
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/http/httputil"
 	"net/url"
+	"strings"
 	"testing"
 
 	"llm-router/internal/model"
@@ -38,9 +40,9 @@ func TestHandleChatCompletions(t *testing.T) {
 	backendURL, _ := url.Parse("http://backend")
 	mockProxy := httputil.NewSingleHostReverseProxy(backendURL)
 
-	proxy.Proxies = map[string]*httputil.ReverseProxy{
-		"test:": mockProxy,
-	}
+	proxy.SetCurrent(&proxy.ProxySet{Proxies: map[string]*proxy.ProxyGroup{
+		"test:": proxy.NewProxyGroup("", &proxy.Upstream{Backend: cfg.Backends[0], Proxy: mockProxy}),
+	}})
 
 	t.Run("Model Key Missing", func(t *testing.T) {
 		reqBody, _ := json.Marshal(map[string]interface{}{"messages": []interface{}{}})
@@ -82,7 +84,10 @@ func TestHandleChatCompletions(t *testing.T) {
 		defer server.Close()
 
 		targetURL, _ := url.Parse(server.URL)
-		proxy.Proxies["test:"] = httputil.NewSingleHostReverseProxy(targetURL)
+		proxy.Current().Proxies["test:"] = proxy.NewProxyGroup("", &proxy.Upstream{
+			Backend: cfg.Backends[0],
+			Proxy:   httputil.NewSingleHostReverseProxy(targetURL),
+		})
 
 		chatReq := map[string]interface{}{
 			"model": "alias-model",
@@ -101,4 +106,224 @@ func TestHandleChatCompletions(t *testing.T) {
 			t.Errorf("expected 200, got %d: %s", rr.Code, rr.Body.String())
 		}
 	})
+	t.Run("No Matching Prefix", func(t *testing.T) {
+		body, _ := json.Marshal(map[string]interface{}{"model": "tset:real-model", "messages": []interface{}{}})
+		req, _ := http.NewRequest("POST", "/v1/chat/completions", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+
+		HandleChatCompletions(rr, req, cfg)
+
+		if rr.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp struct {
+			Error struct {
+				Code              string   `json:"code"`
+				AvailablePrefixes []string `json:"available_prefixes"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("expected a JSON error body, got %q", rr.Body.String())
+		}
+		if resp.Error.Code != "model_not_found" || len(resp.Error.AvailablePrefixes) != 1 || resp.Error.AvailablePrefixes[0] != "test:" {
+			t.Errorf("unexpected error: %+v", resp.Error)
+		}
+		if strings.Contains(rr.Body.String(), "http://") {
+			t.Errorf("expected no backend URLs in the error, got %s", rr.Body.String())
+		}
+	})
+}
+
+func TestFallbackGetsItsOwnSettings(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	var fallbackReq map[string]interface{}
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&fallbackReq)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer fallback.Close()
+
+	backends := []model.BackendConfig{
+		{
+			Name:              "primary",
+			BaseURL:           primary.URL,
+			Prefix:            "a/",
+			Fallback:          "b/",
+			SystemPrompt:      "Primary rules",
+			RoleRewrites:      map[string]string{"user": "human"},
+			UnsupportedParams: []string{"temperature"},
+		},
+		{Name: "fallback", BaseURL: fallback.URL, Prefix: "b/", SystemPrompt: "Fallback rules"},
+	}
+	cfg := &model.Config{Logger: zap.NewNop(), Backends: backends}
+	proxy.SetCurrent(proxy.NewProxySet(backends, zap.NewNop()))
+
+	body := `{"model":"a/m","temperature":0.5,"messages":[{"role":"user","content":"hi"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	HandleChatCompletions(rr, req, cfg)
+
+	if rr.Code != http.StatusOK || fallbackReq == nil {
+		t.Fatalf("expected the fallback to answer, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if fallbackReq["model"] != "m" || fallbackReq["temperature"] != 0.5 {
+		t.Errorf("expected the client's model and params, got %v", fallbackReq)
+	}
+	messages := fallbackReq["messages"].([]interface{})
+	system := messages[0].(map[string]interface{})
+	user := messages[1].(map[string]interface{})
+	if len(messages) != 2 || system["content"] != "Fallback rules" || user["role"] != "user" {
+		t.Errorf("expected only the fallback's own settings applied, got %v", messages)
+	}
+}
+
+func TestApplySystemPrompt(t *testing.T) {
+	logger := zap.NewNop()
+
+	newRequest := func(messages ...map[string]interface{}) map[string]interface{} {
+		list := make([]interface{}, len(messages))
+		for i, msg := range messages {
+			list[i] = msg
+		}
+		return map[string]interface{}{"model": "m", "messages": list}
+	}
+	system := map[string]interface{}{"role": "system", "content": "Be brief."}
+	user := map[string]interface{}{"role": "user", "content": "hi"}
+
+	t.Run("Prepend Without System Message", func(t *testing.T) {
+		req := newRequest(user)
+		applySystemPrompt(req, model.BackendConfig{SystemPrompt: "Follow the guidelines."}, logger)
+
+		messages := req["messages"].([]interface{})
+		if len(messages) != 2 {
+			t.Fatalf("expected 2 messages, got %d", len(messages))
+		}
+		first := messages[0].(map[string]interface{})
+		if first["role"] != "system" || first["content"] != "Follow the guidelines." {
+			t.Errorf("expected injected system message first, got %v", first)
+		}
+	})
+
+	t.Run("Prepend To System Message", func(t *testing.T) {
+		req := newRequest(map[string]interface{}{"role": "system", "content": "Be brief."}, user)
+		applySystemPrompt(req, model.BackendConfig{SystemPrompt: "Follow the guidelines."}, logger)
+
+		messages := req["messages"].([]interface{})
+		if len(messages) != 2 {
+			t.Fatalf("expected 2 messages, got %d", len(messages))
+		}
+		if got := messages[0].(map[string]interface{})["content"]; got != "Follow the guidelines.\n\nBe brief." {
+			t.Errorf("expected prompt prepended to system message, got %q", got)
+		}
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		req := newRequest(system, user)
+		applySystemPrompt(req, model.BackendConfig{
+			SystemPrompt:     "Follow the guidelines.",
+			SystemPromptMode: model.SystemPromptReplace,
+		}, logger)
+
+		messages := req["messages"].([]interface{})
+		if len(messages) != 2 {
+			t.Fatalf("expected 2 messages, got %d", len(messages))
+		}
+		if got := messages[0].(map[string]interface{})["content"]; got != "Follow the guidelines." {
+			t.Errorf("expected system message replaced, got %q", got)
+		}
+		if messages[1].(map[string]interface{})["role"] != "user" {
+			t.Errorf("expected user message kept, got %v", messages[1])
+		}
+	})
+}
+
+func TestDefaultParams(t *testing.T) {
+	received := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// Load the backend from JSON so defaults have the types a real config produces
+	var backend model.BackendConfig
+	if err := json.Unmarshal([]byte(`{
+		"name": "test-backend",
+		"prefix": "test:",
+		"default_params": {"max_tokens": 1024, "temperature": 0.7, "stop": ["END"]}
+	}`), &backend); err != nil {
+		t.Fatal(err)
+	}
+
+	serverURL, _ := url.Parse(server.URL)
+	proxy.SetCurrent(&proxy.ProxySet{Proxies: map[string]*proxy.ProxyGroup{
+		"test:": proxy.NewProxyGroup("", &proxy.Upstream{Backend: backend, Proxy: httputil.NewSingleHostReverseProxy(serverURL)}),
+	}})
+	cfg := &model.Config{Logger: zap.NewNop(), Backends: []model.BackendConfig{backend}}
+
+	req, _ := http.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(
+		`{"model":"test:m","messages":[{"role":"user","content":"hi"}],"temperature":0.2}`))
+	rr := httptest.NewRecorder()
+	HandleChatCompletions(rr, req, cfg)
+
+	body := string(<-received)
+	if !strings.Contains(body, `"max_tokens":1024`) {
+		t.Errorf("expected max_tokens default to be added as an integer, got %s", body)
+	}
+	if !strings.Contains(body, `"stop":["END"]`) {
+		t.Errorf("expected stop default to be added, got %s", body)
+	}
+	if !strings.Contains(body, `"temperature":0.2`) {
+		t.Errorf("expected client temperature to be kept, got %s", body)
+	}
+}
+
+func TestClampParams(t *testing.T) {
+	var backend model.BackendConfig
+	if err := json.Unmarshal([]byte(`{
+		"name": "test-backend",
+		"param_limits": {
+			"max_tokens": {"max": 4096},
+			"temperature": {"min": 0, "max": 1}
+		}
+	}`), &backend); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		param string
+		value interface{}
+		want  interface{}
+	}{
+		{"Above Max", "max_tokens", 8000.0, 4096.0},
+		{"Within Limits", "max_tokens", 1000.0, 1000.0},
+		{"Below Min", "temperature", -0.5, 0.0},
+		{"Non Numeric", "temperature", "hot", "hot"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := map[string]interface{}{tt.param: tt.value}
+			clampParams(req, backend, zap.NewNop())
+			if req[tt.param] != tt.want {
+				t.Errorf("%s = %v, want %v", tt.param, req[tt.param], tt.want)
+			}
+		})
+	}
+
+	t.Run("Marshals As Integer", func(t *testing.T) {
+		req := map[string]interface{}{"max_tokens": 100000.0}
+		clampParams(req, backend, zap.NewNop())
+		body, _ := json.Marshal(req)
+		if string(body) != `{"max_tokens":4096}` {
+			t.Errorf("expected clamped value to marshal as an integer, got %s", body)
+		}
+	})
 }
@@ -0,0 +1,14 @@
+package handler
+
+import (
+	"net/http"
+
+	"llm-router/internal/model"
+)
+
+// HandleCompletions processes the legacy prompt-based completions endpoint with
+// the same model routing as chat completions. There are no messages, so role
+// rewrites don't apply.
+func HandleCompletions(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	routeByModel(w, r, cfg, nil)
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+
+	"llm-router/internal/model"
+	"llm-router/internal/proxy"
+
+	"go.uber.org/zap"
+)
+
+func TestHandleCompletions(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		received <- body
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := &model.Config{
+		Logger: zap.NewNop(),
+		Backends: []model.BackendConfig{
+			{
+				Name:              "test-backend",
+				Prefix:            "test:",
+				UnsupportedParams: []string{"logprobs"},
+			},
+		},
+		Aliases: map[string]string{
+			"alias-model": "test:real-model",
+		},
+	}
+
+	serverURL, _ := url.Parse(server.URL)
+	proxy.SetCurrent(&proxy.ProxySet{Proxies: map[string]*proxy.ProxyGroup{
+		"test:": proxy.NewProxyGroup("", &proxy.Upstream{Backend: cfg.Backends[0], Proxy: httputil.NewSingleHostReverseProxy(serverURL)}),
+	}})
+
+	t.Run("Model Key Missing", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/v1/completions", bytes.NewBufferString(`{"prompt":"hi"}`))
+		rr := httptest.NewRecorder()
+
+		HandleCompletions(rr, req, cfg)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Alias and Routing", func(t *testing.T) {
+		reqBody, _ := json.Marshal(map[string]interface{}{
+			"model":    "alias-model",
+			"prompt":   "Once upon a time",
+			"logprobs": 5,
+		})
+		req, _ := http.NewRequest("POST", "/v1/completions", bytes.NewBuffer(reqBody))
+		rr := httptest.NewRecorder()
+
+		HandleCompletions(rr, req, cfg)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rr.Code)
+		}
+
+		body := <-received
+		if body["model"] != "real-model" {
+			t.Errorf("expected model real-model, got %v", body["model"])
+		}
+		if body["prompt"] != "Once upon a time" {
+			t.Errorf("expected prompt to be preserved, got %v", body["prompt"])
+		}
+		if _, exists := body["logprobs"]; exists {
+			t.Errorf("parameter logprobs should have been dropped")
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// minCompressSize is the smallest response with a known length worth compressing
+const minCompressSize = 1024
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// CompressMiddleware gzips responses for clients that accept it. Event
+// streams, responses that are already encoded or hold compressed data, and
+// small responses are sent as they are.
+func CompressMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) || r.Header.Get("Upgrade") != "" {
+			next(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w}
+		defer cw.Close()
+		next(cw, r)
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, found := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); found {
+			if value, err := strconv.ParseFloat(q, 64); err == nil && value == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressWriter decides whether to compress when the response's headers are
+// written, then gzips the body if so
+type compressWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer // nil when the response is passed through
+	wroteHeader bool
+}
+
+func (cw *compressWriter) WriteHeader(statusCode int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+
+	if shouldCompress(statusCode, cw.Header()) {
+		cw.Header().Del("Content-Length")
+		cw.Header().Set("Content-Encoding", "gzip")
+		cw.gz = gzipWriters.Get().(*gzip.Writer)
+		cw.gz.Reset(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		// Sniff the type from the plain bytes, as net/http would have
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.gz != nil {
+		return cw.gz.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *compressWriter) Flush() {
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close finishes the gzip stream
+func (cw *compressWriter) Close() {
+	if cw.gz == nil {
+		return
+	}
+	cw.gz.Close()
+	gzipWriters.Put(cw.gz)
+	cw.gz = nil
+}
+
+// shouldCompress reports whether a response with these headers is worth compressing
+func shouldCompress(statusCode int, header http.Header) bool {
+	if statusCode < http.StatusOK || statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length < minCompressSize {
+		return false
+	}
+
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	switch {
+	case strings.HasPrefix(contentType, "text/event-stream"):
+		return false
+	case strings.HasPrefix(contentType, "image/svg"):
+		return true
+	case strings.HasPrefix(contentType, "image/"), strings.HasPrefix(contentType, "audio/"), strings.HasPrefix(contentType, "video/"):
+		return false
+	case strings.Contains(contentType, "zip"), strings.Contains(contentType, "compressed"), strings.HasPrefix(contentType, "application/octet-stream"):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCompressMiddleware(t *testing.T) {
+	large := strings.Repeat(`{"id":"gpt-4o"},`, 200)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		contentLength  bool
+		body           string
+		wantGzip       bool
+	}{
+		{"JSON", "gzip, deflate", "application/json", false, large, true},
+		{"Known Length", "gzip", "application/json", true, large, true},
+		{"Not Accepted", "deflate", "application/json", false, large, false},
+		{"Refused With Zero Quality", "gzip;q=0, identity", "application/json", false, large, false},
+		{"Event Stream", "gzip", "text/event-stream", false, "data: " + large + "\n\n", false},
+		{"Compressed Content", "gzip", "image/png", false, large, false},
+		{"Small Known Length", "gzip", "application/json", true, `{"ok":true}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := CompressMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				if tt.contentLength {
+					w.Header().Set("Content-Length", strconv.Itoa(len(tt.body)))
+				}
+				io.WriteString(w, tt.body)
+			})
+
+			req := httptest.NewRequest("GET", "/v1/models", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if vary := rr.Header().Get("Vary"); vary != "Accept-Encoding" {
+				t.Errorf("expected Vary: Accept-Encoding, got %q", vary)
+			}
+			gzipped := rr.Header().Get("Content-Encoding") == "gzip"
+			if gzipped != tt.wantGzip {
+				t.Fatalf("expected gzip %v, got %v", tt.wantGzip, gzipped)
+			}
+
+			body := rr.Body.String()
+			if gzipped {
+				if rr.Header().Get("Content-Length") != "" {
+					t.Error("expected Content-Length to be dropped")
+				}
+				reader, err := gzip.NewReader(rr.Body)
+				if err != nil {
+					t.Fatalf("expected a gzip body: %v", err)
+				}
+				decoded, _ := io.ReadAll(reader)
+				body = string(decoded)
+			}
+			if body != tt.body {
+				t.Errorf("expected the body to round-trip, got %d bytes", len(body))
+			}
+		})
+	}
+
+	t.Run("Sniffs Content Type", func(t *testing.T) {
+		handler := CompressMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "<html>"+large+"</html>")
+		})
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+
+		if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("expected the type sniffed from the plain body, got %q", ct)
+		}
+	})
+}
@@ -2,23 +2,35 @@ package handler
 
 import (
 	"net/http"
+	"net/url"
+	"strings"
 
 	"go.uber.org/zap"
 )
 
-// CORSMiddleware wraps an http.Handler with CORS headers that allow all origins
-func CORSMiddleware(next http.HandlerFunc, logger *zap.Logger) http.HandlerFunc {
+// CORSMiddleware wraps an http.Handler with CORS headers. When allowedOrigins
+// is empty every origin is allowed; otherwise only origins matching an entry
+// are echoed back and others get no Access-Control-Allow-Origin header.
+func CORSMiddleware(next http.HandlerFunc, allowedOrigins []string, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Set CORS headers for all requests
 		origin := r.Header.Get("Origin")
-		if origin == "" {
-			origin = "*"
+		if len(allowedOrigins) == 0 {
+			if origin == "" {
+				origin = "*"
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		} else if origin != "" && originAllowed(origin, allowedOrigins) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		} else if origin != "" {
+			logger.Debug("Origin not in CORS allowlist", zap.String("origin", origin))
 		}
 
-		w.Header().Set("Access-Control-Allow-Origin", origin)
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, X-Router-Version")
 
 		// Handle preflight OPTIONS requests
 		if r.Method == "OPTIONS" {
@@ -29,7 +41,7 @@ func CORSMiddleware(next http.HandlerFunc, logger *zap.Logger) http.HandlerFunc
 			if reqHeaders != "" {
 				w.Header().Set("Access-Control-Allow-Headers", reqHeaders)
 			} else {
-				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Accept")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Accept, X-Request-Timeout, X-Request-ID")
 			}
 
 			// Log the requested method in preflight
@@ -45,9 +57,40 @@ func CORSMiddleware(next http.HandlerFunc, logger *zap.Logger) http.HandlerFunc
 		}
 
 		// For non-OPTIONS requests, set allowed headers
-		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Accept")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Accept, X-Request-Timeout, X-Request-ID")
 
 		// Call the next handler
 		next(w, r)
 	}
 }
+
+// originAllowed reports whether origin matches one of the patterns. A pattern
+// is "*", an exact origin such as "https://app.example.com", or a subdomain
+// wildcard such as "https://*.example.com" or "*.example.com" (any scheme).
+func originAllowed(origin string, patterns []string) bool {
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	origin = strings.ToLower(parsed.Scheme + "://" + parsed.Host)
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(pattern), "/"))
+		if pattern == "*" || pattern == origin {
+			return true
+		}
+
+		scheme, hostPattern, hasScheme := strings.Cut(pattern, "://")
+		if !hasScheme {
+			scheme, hostPattern = "", pattern
+		}
+		suffix, isWildcard := strings.CutPrefix(hostPattern, "*.")
+		if !isWildcard || (scheme != "" && scheme != parsed.Scheme) {
+			continue
+		}
+		if strings.HasSuffix(strings.ToLower(parsed.Host), "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
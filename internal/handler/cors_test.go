@@ -17,7 +17,7 @@ func TestCORSMiddleware(t *testing.T) {
 		w.Write([]byte("OK"))
 	})
 
-	middleware := CORSMiddleware(nextHandler, logger)
+	middleware := CORSMiddleware(nextHandler, nil, logger)
 
 	t.Run("OPTIONS Request", func(t *testing.T) {
 		req, _ := http.NewRequest("OPTIONS", "/v1/test", nil)
@@ -68,3 +68,76 @@ func TestCORSMiddleware(t *testing.T) {
 		}
 	})
 }
+
+func TestCORSAllowedOrigins(t *testing.T) {
+	logger := zap.NewNop()
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    string
+	}{
+		{"Allowed Origin", []string{"https://chat.example.com"}, "https://chat.example.com", "https://chat.example.com"},
+		{"Disallowed Origin", []string{"https://chat.example.com"}, "https://evil.example.org", ""},
+		{"Scheme Mismatch", []string{"https://chat.example.com"}, "http://chat.example.com", ""},
+		{"Wildcard", []string{"*"}, "https://anything.test", "https://anything.test"},
+		{"Subdomain Pattern", []string{"https://*.example.com"}, "https://app.example.com", "https://app.example.com"},
+		{"Subdomain Pattern Any Scheme", []string{"*.example.com"}, "http://a.b.example.com", "http://a.b.example.com"},
+		{"Subdomain Pattern Excludes Apex", []string{"https://*.example.com"}, "https://example.com", ""},
+		{"Subdomain Pattern Excludes Lookalike", []string{"https://*.example.com"}, "https://badexample.com", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			middleware := CORSMiddleware(nextHandler, tt.allowed, logger)
+
+			req, _ := http.NewRequest("GET", "/v1/test", nil)
+			req.Header.Set("Origin", tt.origin)
+			rr := httptest.NewRecorder()
+			middleware.ServeHTTP(rr, req)
+
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.want {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("Preflight From Disallowed Origin", func(t *testing.T) {
+		middleware := CORSMiddleware(nextHandler, []string{"https://chat.example.com"}, logger)
+
+		req, _ := http.NewRequest("OPTIONS", "/v1/test", nil)
+		req.Header.Set("Origin", "https://evil.example.org")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		rr := httptest.NewRecorder()
+		middleware.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("OPTIONS status = %v, want %v", rr.Code, http.StatusNoContent)
+		}
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("Access-Control-Allow-Origin = %q, want it omitted", got)
+		}
+	})
+
+	t.Run("Preflight From Allowed Origin", func(t *testing.T) {
+		middleware := CORSMiddleware(nextHandler, []string{"https://chat.example.com"}, logger)
+
+		req, _ := http.NewRequest("OPTIONS", "/v1/test", nil)
+		req.Header.Set("Origin", "https://chat.example.com")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		rr := httptest.NewRecorder()
+		middleware.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("OPTIONS status = %v, want %v", rr.Code, http.StatusNoContent)
+		}
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://chat.example.com" {
+			t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, "https://chat.example.com")
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"llm-router/internal/proxy"
+	"llm-router/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+// CredentialsResponse lists the state of each backend's API keys
+type CredentialsResponse struct {
+	Backends map[string][]proxy.KeyStatus `json:"backends"`
+}
+
+// credentialRequest picks one of a backend's keys by its position in the
+// backend's api_keys, or by the characters it ends with
+type credentialRequest struct {
+	Index  *int   `json:"index"`
+	Suffix string `json:"suffix"`
+}
+
+// HandleGetCredentials reports the state of every backend's API keys. Use with RequireAdmin.
+func HandleGetCredentials(w http.ResponseWriter, r *http.Request) {
+	response := CredentialsResponse{Backends: make(map[string][]proxy.KeyStatus)}
+	for name, cm := range proxy.Current().CredentialManagers {
+		response.Backends[name] = cm.Status()
+	}
+	respondWithJSON(w, response)
+}
+
+// HandleCredentialAction serves POST /v1/admin/credentials/{backend}/disable and
+// /enable, taking a key out of rotation or putting it back without a config
+// change. A disabled key stays disabled across config reloads until enabled.
+// Use with RequireAdmin.
+func HandleCredentialAction(w http.ResponseWriter, r *http.Request, logger *zap.Logger) {
+	backend, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, adminCredentialsPath+"/"), "/")
+	if action != "disable" && action != "enable" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	cm := proxy.Current().CredentialManagers[backend]
+	if cm == nil {
+		http.Error(w, "backend has no api_keys", http.StatusNotFound)
+		return
+	}
+
+	var req credentialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	index := -1
+	if req.Index != nil {
+		index = *req.Index
+	}
+	key, err := cm.FindKey(index, req.Suffix)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fields := []zap.Field{
+		zap.String("backend", backend),
+		zap.Int("keyIndex", cm.KeyIndex(key)),
+		zap.String("key", utils.RedactAuthorization("Bearer "+key)),
+	}
+	if action == "disable" {
+		cm.Disable(key)
+		logger.Warn("API key disabled by admin", fields...)
+	} else {
+		cm.Enable(key)
+		logger.Info("API key enabled by admin", fields...)
+	}
+
+	respondWithJSON(w, cm.Status())
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"llm-router/internal/model"
+	"llm-router/internal/proxy"
+
+	"go.uber.org/zap"
+)
+
+func TestHandleCredentialAction(t *testing.T) {
+	proxy.SetCurrent(proxy.NewProxySet([]model.BackendConfig{
+		{Name: "openai", BaseURL: "http://openai", Prefix: "openai/", RequireAPIKey: true, APIKeys: []string{"sk-first-aaaa", "sk-second-bbbb"}},
+	}, zap.NewNop()))
+	defer proxy.SetCurrent(nil)
+	cm := proxy.Current().CredentialManagers["openai"]
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		HandleCredentialAction(rr, req, zap.NewNop())
+		return rr
+	}
+
+	t.Run("Disable By Index", func(t *testing.T) {
+		rr := post("/v1/admin/credentials/openai/disable", `{"index": 0}`)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if cm.IsKeyAvailable("sk-first-aaaa", "") {
+			t.Error("expected the key to be disabled")
+		}
+		if strings.Contains(rr.Body.String(), "sk-first") {
+			t.Errorf("expected the response to mask keys, got %s", rr.Body.String())
+		}
+	})
+
+	t.Run("Snapshot Shows Disabled Key", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/v1/admin/credentials", nil)
+		rr := httptest.NewRecorder()
+		HandleGetCredentials(rr, req)
+
+		var resp CredentialsResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		keys := resp.Backends["openai"]
+		if len(keys) != 2 || !keys[0].Disabled || keys[1].Disabled || keys[0].Key != "...aaaa" {
+			t.Errorf("unexpected snapshot: %+v", keys)
+		}
+	})
+
+	t.Run("Enable By Suffix", func(t *testing.T) {
+		rr := post("/v1/admin/credentials/openai/enable", `{"suffix": "aaaa"}`)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if !cm.IsKeyAvailable("sk-first-aaaa", "") {
+			t.Error("expected the key to be enabled")
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			path   string
+			body   string
+			status int
+		}{
+			{"Unknown Backend", "/v1/admin/credentials/groq/disable", `{"index": 0}`, http.StatusNotFound},
+			{"Unknown Action", "/v1/admin/credentials/openai/rotate", `{"index": 0}`, http.StatusNotFound},
+			{"No Matching Key", "/v1/admin/credentials/openai/disable", `{"suffix": "zzzz"}`, http.StatusBadRequest},
+			{"Invalid Body", "/v1/admin/credentials/openai/disable", `{`, http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if rr := post(tt.path, tt.body); rr.Code != tt.status {
+					t.Errorf("expected %d, got %d", tt.status, rr.Code)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,13 @@
+package handler
+
+import (
+	"net/http"
+
+	"llm-router/internal/model"
+)
+
+// HandleEmbeddings routes embedding requests to the backend matching the model
+// prefix, stripping the prefix from the model before proxying
+func HandleEmbeddings(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	routeByModel(w, r, cfg, nil)
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+
+	"llm-router/internal/model"
+	"llm-router/internal/proxy"
+
+	"go.uber.org/zap"
+)
+
+func TestHandleEmbeddings(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		received <- r
+		bodies <- body
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object":"list","data":[]}`))
+	}))
+	defer server.Close()
+
+	cfg := &model.Config{
+		Logger: zap.NewNop(),
+		Backends: []model.BackendConfig{
+			{Name: "openai", Prefix: "openai/"},
+		},
+	}
+
+	serverURL, _ := url.Parse(server.URL)
+	proxy.SetCurrent(&proxy.ProxySet{Proxies: map[string]*proxy.ProxyGroup{
+		"openai/": proxy.NewProxyGroup("", &proxy.Upstream{Backend: cfg.Backends[0], Proxy: httputil.NewSingleHostReverseProxy(serverURL)}),
+	}})
+
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"model": "openai/text-embedding-3-small",
+		"input": "hello world",
+	})
+	req, _ := http.NewRequest("POST", "/v1/embeddings", bytes.NewBuffer(reqBody))
+	rr := httptest.NewRecorder()
+
+	HandleEmbeddings(rr, req, cfg)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	if r := <-received; r.URL.Path != "/v1/embeddings" {
+		t.Errorf("expected request proxied to /v1/embeddings, got %s", r.URL.Path)
+	}
+	body := <-bodies
+	if body["model"] != "text-embedding-3-small" {
+		t.Errorf("expected prefix stripped from model, got %v", body["model"])
+	}
+	if body["input"] != "hello world" {
+		t.Errorf("expected input to be preserved, got %v", body["input"])
+	}
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"llm-router/internal/events"
+	"llm-router/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// eventsKeepaliveInterval is how often an idle event stream gets a comment,
+// so proxies in between don't close it
+const eventsKeepaliveInterval = 15 * time.Second
+
+// HandleAdminEvents streams routing events to an admin as server-sent
+// events, one per routing event with the event type as its name and the
+// event as JSON data, until the client disconnects or the router shuts down
+func HandleAdminEvents(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	stream, unsubscribe := events.Default().Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	cfg.Logger.Info("Admin event stream opened")
+	defer cfg.Logger.Info("Admin event stream closed")
+
+	keepalive := time.NewTicker(eventsKeepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-stream:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				cfg.Logger.Error("Failed to encode routing event", zap.Error(err))
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
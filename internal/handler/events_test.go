@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"llm-router/internal/events"
+	"llm-router/internal/model"
+
+	"go.uber.org/zap"
+)
+
+func TestHandleAdminEvents(t *testing.T) {
+	cfg := &model.Config{Logger: zap.NewNop()}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HandleAdminEvents(w, r, cfg)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+adminEventsPath, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to open the stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", ct)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for !events.Active() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the stream to subscribe")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	events.Publish(events.Event{Type: events.KeyFailed, Backend: "openai", Status: http.StatusTooManyRequests})
+
+	reader := bufio.NewReader(resp.Body)
+	name, _ := reader.ReadString('\n')
+	data, _ := reader.ReadString('\n')
+	if name != "event: key_failed\n" {
+		t.Fatalf("unexpected event line %q", name)
+	}
+	var event events.Event
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &event); err != nil {
+		t.Fatalf("failed to decode event data %q: %v", data, err)
+	}
+	if event.Backend != "openai" || event.Status != http.StatusTooManyRequests {
+		t.Errorf("unexpected event: %+v", event)
+	}
+
+	cancel()
+	deadline = time.Now().Add(time.Second)
+	for events.Active() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the stream to unsubscribe once the client left")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -1,7 +1,9 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"llm-router/internal/model"
 	"llm-router/internal/tools/exa"
 	"net/http"
@@ -20,6 +22,9 @@ type ExaToolResponse struct {
 	Error   string      `json:"error,omitempty"`
 }
 
+// newExaClient creates the client for a tool request; tests point it at a fake server
+var newExaClient = exa.NewClient
+
 func HandleExaTool(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
 	if cfg.ExaAPIKey == "" {
 		cfg.Logger.Warn("Exa API key not configured")
@@ -34,23 +39,32 @@ func HandleExaTool(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
 		return
 	}
 
-	client := exa.NewClient(cfg.ExaAPIKey)
+	client := newExaClient(cfg.ExaAPIKey)
 
+	ctx := r.Context()
 	var result interface{}
 	var err error
 
 	switch req.Action {
 	case "search":
 		searchReq := parseSearchRequest(req.Params)
-		result, err = client.Search(searchReq)
+		if stream, _ := req.Params["stream"].(bool); stream {
+			streamExaSearch(ctx, w, client, searchReq, cfg.Logger)
+			return
+		}
+		result, err = client.SearchContext(ctx, searchReq)
 
 	case "find_similar":
 		findSimilarReq := parseFindSimilarRequest(req.Params)
-		result, err = client.FindSimilar(findSimilarReq)
+		result, err = client.FindSimilarContext(ctx, findSimilarReq)
 
 	case "get_contents":
 		getContentsReq := parseGetContentsRequest(req.Params)
-		result, err = client.GetContents(getContentsReq)
+		result, err = client.GetContentsContext(ctx, getContentsReq)
+
+	case "answer":
+		answerReq := parseAnswerRequest(req.Params)
+		result, err = client.AnswerContext(ctx, answerReq)
 
 	default:
 		respondWithError(w, "Unknown action: "+req.Action, http.StatusBadRequest)
@@ -69,6 +83,52 @@ func HandleExaTool(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
 	})
 }
 
+// streamExaSearch relays search results as server-sent events, one
+// ExaToolResponse per result, as soon as Exa returns them. An error before the
+// first result gets the usual error response; a later one ends the stream with
+// an error event.
+func streamExaSearch(ctx context.Context, w http.ResponseWriter, client *exa.Client, req exa.SearchRequest, logger *zap.Logger) {
+	flusher, _ := w.(http.Flusher)
+	started := false
+	start := func() {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		started = true
+	}
+	send := func(resp ExaToolResponse) {
+		if !started {
+			start()
+		}
+		data, err := json.Marshal(resp)
+		if err != nil {
+			logger.Error("Failed to encode Exa search result", zap.Error(err))
+			return
+		}
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	err := client.SearchStreamContext(ctx, req, func(result exa.Result) {
+		send(ExaToolResponse{Success: true, Data: result})
+	})
+	switch {
+	case err == nil:
+		if !started {
+			start()
+		}
+	case !started:
+		logger.Error("Exa API request failed", zap.String("action", "search"), zap.Error(err))
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+	default:
+		logger.Error("Exa search stream failed", zap.Error(err))
+		send(ExaToolResponse{Success: false, Error: err.Error()})
+	}
+}
+
 func parseSearchRequest(params map[string]interface{}) exa.SearchRequest {
 	req := exa.SearchRequest{}
 
@@ -138,6 +198,22 @@ func parseGetContentsRequest(params map[string]interface{}) exa.GetContentsReque
 	return req
 }
 
+func parseAnswerRequest(params map[string]interface{}) exa.AnswerRequest {
+	req := exa.AnswerRequest{}
+
+	if v, ok := params["query"].(string); ok {
+		req.Query = v
+	}
+	if v, ok := params["text"].(bool); ok {
+		req.Text = v
+	}
+	if v, ok := params["model"].(string); ok {
+		req.Model = v
+	}
+
+	return req
+}
+
 func toStringSlice(v []interface{}) []string {
 	result := make([]string, 0, len(v))
 	for _, item := range v {
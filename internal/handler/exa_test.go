@@ -3,11 +3,14 @@ package handler
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"llm-router/internal/model"
+	"llm-router/internal/tools/exa"
 
 	"go.uber.org/zap"
 )
@@ -63,6 +66,83 @@ func TestHandleExaTool(t *testing.T) {
 	})
 }
 
+// exaTransport answers every Exa request with a fixed server-sent event body
+type exaTransport struct {
+	status int
+	body   string
+}
+
+func (t exaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: t.status,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader(t.body)),
+		Request:    req,
+	}, nil
+}
+
+func TestHandleExaToolStreamedSearch(t *testing.T) {
+	cfg := &model.Config{Logger: zap.NewNop(), ExaAPIKey: "test-key"}
+	defer func(orig func(string) *exa.Client) { newExaClient = orig }(newExaClient)
+
+	search := func(transport exaTransport) *httptest.ResponseRecorder {
+		newExaClient = func(apiKey string) *exa.Client {
+			client := exa.NewClientWithRetries(apiKey, 1)
+			client.HTTPClient.Transport = transport
+			return client
+		}
+		reqBody, _ := json.Marshal(ExaToolRequest{Action: "search", Params: map[string]interface{}{"query": "go", "stream": true}})
+		req, _ := http.NewRequest("POST", "/v1/exa", bytes.NewBuffer(reqBody))
+		rr := httptest.NewRecorder()
+		HandleExaTool(rr, req, cfg)
+		return rr
+	}
+
+	events := func(body string) []ExaToolResponse {
+		var responses []ExaToolResponse
+		for _, line := range strings.Split(body, "\n") {
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				var resp ExaToolResponse
+				json.Unmarshal([]byte(data), &resp)
+				responses = append(responses, resp)
+			}
+		}
+		return responses
+	}
+
+	t.Run("One Event Per Result", func(t *testing.T) {
+		rr := search(exaTransport{status: http.StatusOK, body: "data: {\"url\":\"https://a\"}\n\ndata: {\"url\":\"https://b\"}\n\n"})
+
+		if ct := rr.Header().Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("expected an event stream, got %q: %s", ct, rr.Body.String())
+		}
+		got := events(rr.Body.String())
+		if len(got) != 2 || !got[0].Success || got[0].Data.(map[string]interface{})["url"] != "https://a" {
+			t.Errorf("expected one successful event per result, got %+v", got)
+		}
+	})
+
+	t.Run("Error Before Results", func(t *testing.T) {
+		rr := search(exaTransport{status: http.StatusUnauthorized, body: "bad key"})
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("expected 500, got %d", rr.Code)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("expected a JSON error, got %q", ct)
+		}
+	})
+
+	t.Run("Error Mid Stream", func(t *testing.T) {
+		rr := search(exaTransport{status: http.StatusOK, body: "data: {\"url\":\"https://a\"}\n\ndata: {broken\n\n"})
+
+		got := events(rr.Body.String())
+		if len(got) != 2 || !got[0].Success || got[1].Success || got[1].Error == "" {
+			t.Errorf("expected a result followed by an error event, got %+v", got)
+		}
+	})
+}
+
 func TestToStringSlice(t *testing.T) {
 	input := []interface{}{"a", "b", 123, "c"}
 	expected := []string{"a", "b", "c"}
@@ -5,10 +5,23 @@ import (
 	"llm-router/internal/model"
 	"llm-router/internal/tools/geo"
 	"net/http"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
 
+const (
+	geoAutocompleteTimeout = 5 * time.Second
+	geoCacheSize           = 1000
+	geoCacheTTL            = 24 * time.Hour
+)
+
+var (
+	geoClientsMu sync.Mutex
+	geoClients   = make(map[string]*geo.Client)
+)
+
 type GeoToolRequest struct {
 	Action string                 `json:"action"`
 	Params map[string]interface{} `json:"params"`
@@ -34,23 +47,45 @@ func HandleGeoTool(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
 		return
 	}
 
-	client := geo.NewClient(cfg.GeoapifyAPIKey)
+	client := getGeoClient(cfg.GeoapifyAPIKey)
 
+	ctx := r.Context()
 	var result interface{}
 	var err error
 
 	switch req.Action {
 	case "geocode_search":
 		geocodeReq := parseGeocodeSearchRequest(req.Params)
-		result, err = client.GeocodeSearch(geocodeReq)
+		result, err = client.GeocodeSearchContext(ctx, geocodeReq)
+
+	case "geocode_autocomplete":
+		// Type-ahead callers would rather fail fast than wait for the default timeout
+		autocompleteReq := parseGeocodeSearchRequest(req.Params)
+		result, err = client.WithTimeout(geoAutocompleteTimeout).GeocodeAutocompleteContext(ctx, autocompleteReq)
 
 	case "geocode_reverse":
 		reverseReq := parseGeocodeReverseRequest(req.Params)
-		result, err = client.GeocodeReverse(reverseReq)
+		result, err = client.GeocodeReverseContext(ctx, reverseReq)
 
 	case "routing":
 		routingReq := parseRoutingRequest(req.Params)
-		result, err = client.Routing(routingReq)
+		result, err = client.RoutingContext(ctx, routingReq)
+
+	case "isoline":
+		isolineReq := parseIsolineRequest(req.Params)
+		result, err = client.IsolineContext(ctx, isolineReq)
+
+	case "batch_geocode":
+		addresses, timeout := parseBatchGeocodeRequest(req.Params)
+		batchClient := *client
+		if timeout > 0 {
+			batchClient.BatchPollTimeout = timeout
+		}
+		result, err = batchClient.BatchGeocodeContext(ctx, addresses)
+
+	case "route_matrix":
+		matrixReq := parseMatrixRequest(req.Params)
+		result, err = client.RouteMatrixContext(ctx, matrixReq)
 
 	case "static_map":
 		staticMapReq := parseStaticMapRequest(req.Params)
@@ -65,7 +100,7 @@ func HandleGeoTool(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
 
 	case "places":
 		placesReq := parsePlacesRequest(req.Params)
-		result, err = client.Places(placesReq)
+		result, err = client.PlacesContext(ctx, placesReq)
 
 	default:
 		respondWithError(w, "Unknown action: "+req.Action, http.StatusBadRequest)
@@ -84,6 +119,19 @@ func HandleGeoTool(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
 	})
 }
 
+// getGeoClient returns a shared client per API key so geocoding results are cached across requests
+func getGeoClient(apiKey string) *geo.Client {
+	geoClientsMu.Lock()
+	defer geoClientsMu.Unlock()
+
+	client, ok := geoClients[apiKey]
+	if !ok {
+		client = geo.NewClientWithCache(apiKey, geoCacheSize, geoCacheTTL)
+		geoClients[apiKey] = client
+	}
+	return client
+}
+
 func parseGeocodeSearchRequest(params map[string]interface{}) geo.GeocodeSearchRequest {
 	req := geo.GeocodeSearchRequest{}
 
@@ -156,6 +204,39 @@ func parseRoutingRequest(params map[string]interface{}) geo.RoutingRequest {
 	return req
 }
 
+func parseMatrixRequest(params map[string]interface{}) geo.MatrixRequest {
+	req := geo.MatrixRequest{}
+
+	req.Sources = parseWaypoints(params["sources"])
+	req.Targets = parseWaypoints(params["targets"])
+	if v, ok := params["mode"].(string); ok {
+		req.Mode = v
+	}
+
+	return req
+}
+
+func parseWaypoints(value interface{}) []geo.Waypoint {
+	var waypoints []geo.Waypoint
+
+	if v, ok := value.([]interface{}); ok {
+		for _, wp := range v {
+			if wpMap, ok := wp.(map[string]interface{}); ok {
+				waypoint := geo.Waypoint{}
+				if lat, ok := wpMap["lat"].(float64); ok {
+					waypoint.Lat = lat
+				}
+				if lon, ok := wpMap["lon"].(float64); ok {
+					waypoint.Lon = lon
+				}
+				waypoints = append(waypoints, waypoint)
+			}
+		}
+	}
+
+	return waypoints
+}
+
 func parseStaticMapRequest(params map[string]interface{}) geo.StaticMapRequest {
 	req := geo.StaticMapRequest{}
 
@@ -253,3 +334,52 @@ func parsePlacesRequest(params map[string]interface{}) geo.PlacesRequest {
 
 	return req
 }
+
+func parseIsolineRequest(params map[string]interface{}) geo.IsolineRequest {
+	req := geo.IsolineRequest{}
+
+	if v, ok := params["lat"].(float64); ok {
+		req.Lat = v
+	}
+	if v, ok := params["lon"].(float64); ok {
+		req.Lon = v
+	}
+	if v, ok := params["type"].(string); ok {
+		req.Type = v
+	}
+	if v, ok := params["mode"].(string); ok {
+		req.Mode = v
+	}
+
+	// Range may be a single value or a list of values
+	switch v := params["range"].(type) {
+	case float64:
+		req.Range = append(req.Range, int(v))
+	case []interface{}:
+		for _, r := range v {
+			if f, ok := r.(float64); ok {
+				req.Range = append(req.Range, int(f))
+			}
+		}
+	}
+
+	return req
+}
+
+func parseBatchGeocodeRequest(params map[string]interface{}) ([]string, time.Duration) {
+	var addresses []string
+	var timeout time.Duration
+
+	if v, ok := params["addresses"].([]interface{}); ok {
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				addresses = append(addresses, s)
+			}
+		}
+	}
+	if v, ok := params["timeout_seconds"].(float64); ok {
+		timeout = time.Duration(v * float64(time.Second))
+	}
+
+	return addresses, timeout
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"llm-router/internal/model"
 
@@ -81,3 +82,63 @@ func TestParseGeocodeSearchRequest(t *testing.T) {
 		t.Errorf("expected 5, got %d", req.Limit)
 	}
 }
+
+func TestParseIsolineRequest(t *testing.T) {
+	req := parseIsolineRequest(map[string]interface{}{
+		"lat":   51.5,
+		"lon":   -0.12,
+		"type":  "time",
+		"mode":  "walk",
+		"range": []interface{}{900.0, 1800.0},
+	})
+
+	if req.Lat != 51.5 || req.Lon != -0.12 {
+		t.Errorf("expected 51.5,-0.12, got %f,%f", req.Lat, req.Lon)
+	}
+	if req.Mode != "walk" {
+		t.Errorf("expected walk, got %s", req.Mode)
+	}
+	if len(req.Range) != 2 || req.Range[0] != 900 || req.Range[1] != 1800 {
+		t.Errorf("expected ranges [900 1800], got %v", req.Range)
+	}
+
+	single := parseIsolineRequest(map[string]interface{}{"range": 600.0})
+	if len(single.Range) != 1 || single.Range[0] != 600 {
+		t.Errorf("expected a single range of 600, got %v", single.Range)
+	}
+}
+
+func TestParseBatchGeocodeRequest(t *testing.T) {
+	addresses, timeout := parseBatchGeocodeRequest(map[string]interface{}{
+		"addresses":       []interface{}{"10 Downing St, London", "Eiffel Tower, Paris"},
+		"timeout_seconds": 90.0,
+	})
+
+	if len(addresses) != 2 || addresses[1] != "Eiffel Tower, Paris" {
+		t.Errorf("unexpected addresses: %v", addresses)
+	}
+	if timeout != 90*time.Second {
+		t.Errorf("expected 90s timeout, got %s", timeout)
+	}
+}
+
+func TestParseMatrixRequest(t *testing.T) {
+	req := parseMatrixRequest(map[string]interface{}{
+		"sources": []interface{}{map[string]interface{}{"lat": 1.0, "lon": 2.0}},
+		"targets": []interface{}{
+			map[string]interface{}{"lat": 3.0, "lon": 4.0},
+			map[string]interface{}{"lat": 5.0, "lon": 6.0},
+		},
+		"mode": "truck",
+	})
+
+	if len(req.Sources) != 1 || req.Sources[0].Lat != 1.0 || req.Sources[0].Lon != 2.0 {
+		t.Errorf("unexpected sources: %+v", req.Sources)
+	}
+	if len(req.Targets) != 2 || req.Targets[1].Lon != 6.0 {
+		t.Errorf("unexpected targets: %+v", req.Targets)
+	}
+	if req.Mode != "truck" {
+		t.Errorf("expected truck, got %s", req.Mode)
+	}
+}
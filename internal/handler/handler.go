@@ -2,27 +2,42 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"llm-router/internal/events"
 	"llm-router/internal/identity"
 	"llm-router/internal/model"
 	"llm-router/internal/proxy"
 	"llm-router/internal/tools/containers"
+	"llm-router/internal/tracing"
 	"llm-router/internal/utils"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 const (
 	chatCompletionsPath   = "/chat/completions"
 	chatCompletionsV1Path = "/v1/chat/completions"
+	completionsPath       = "/v1/completions"
+	embeddingsPath        = "/v1/embeddings"
+	audioTranscribePath   = "/v1/audio/transcriptions"
+	audioTranslatePath    = "/v1/audio/translations"
 	validatePath          = "/v1/validate"
 	modelsPath            = "/v1/models"
+	healthPath            = "/v1/health"
+	versionPath           = "/v1/version"
 	settingsPath          = "/v1/settings"
 	authLoginPath         = "/v1/auth/login"
 	authLogoutPath        = "/v1/auth/logout"
@@ -32,38 +47,184 @@ const (
 	historyPath           = "/v1/user/me/history"
 	historyManifestPath   = "/v1/user/me/history/manifest"
 	historyDeltaPath      = "/v1/user/me/history/delta"
+	historyImportPath     = "/v1/user/me/history/import"
+	historyTrashPath      = "/v1/user/me/history/trash"
+	historyRestorePath    = "/v1/user/me/history/restore"
+	syncWebSocketPath     = "/v1/user/me/sync/ws"
 	configPath            = "/v1/user/me/config"
+	exportPath            = "/v1/user/me/export"
+	storageUsagePath      = "/v1/user/me/usage/storage"
+	adminAuditPath        = "/v1/admin/audit"
+	adminCredentialsPath  = "/v1/admin/credentials"
+	adminEventsPath       = "/v1/admin/events"
+	adminUsersPath        = "/v1/admin/users/"
 	attachmentsPath       = "/v1/attachments/"
 	exaToolPath           = "/v1/tools/exa"
 	geoToolPath           = "/v1/tools/geo"
 	containerToolPath     = "/v1/tools/container"
 	contentTypeJSON       = "application/json"
-	streamTruePattern     = `"stream":true`
-	peekBufferSize        = 1024
+	requestTimeoutHeader  = "X-Request-Timeout"
 )
 
+// proxyPaths are the /v1 endpoints the router has no handler for but passes
+// on to the default backend as they are; a trailing "*" matches by prefix, as
+// in the proxy_paths setting that extends the list. Other unknown /v1 paths
+// are answered with 404 rather than forwarded.
+var proxyPaths = []string{
+	"/v1/audio/speech",
+	"/v1/images/generations",
+	"/v1/images/edits",
+	"/v1/images/variations",
+	"/v1/moderations",
+	"/v1/responses", "/v1/responses/*",
+	"/v1/rerank",
+	"/v1/files", "/v1/files/*",
+	"/v1/uploads", "/v1/uploads/*",
+	"/v1/batches", "/v1/batches/*",
+	"/v1/fine_tuning/*",
+	"/v1/assistants", "/v1/assistants/*",
+	"/v1/threads", "/v1/threads/*",
+	"/v1/vector_stores", "/v1/vector_stores/*",
+}
+
+// routePaths are the /v1 paths the router answers itself, so a request with
+// the wrong method gets 405 instead of 404. identityRoutePaths only exist
+// while the identity system is enabled.
+var routePaths = map[string]bool{
+	chatCompletionsV1Path:    true,
+	completionsPath:          true,
+	embeddingsPath:           true,
+	audioTranscribePath:      true,
+	audioTranslatePath:       true,
+	validatePath:             true,
+	modelsPath:               true,
+	healthPath:               true,
+	versionPath:              true,
+	settingsPath:             true,
+	"/v1/attachments/upload": true,
+	exaToolPath:              true,
+	geoToolPath:              true,
+	containerToolPath:        true,
+}
+
+var identityRoutePaths = map[string]bool{
+	authLoginPath:        true,
+	authLogoutPath:       true,
+	authCheckPath:        true,
+	authSetupPath:        true,
+	authAPIKeysPath:      true,
+	historyPath:          true,
+	historyManifestPath:  true,
+	historyDeltaPath:     true,
+	historyImportPath:    true,
+	historyTrashPath:     true,
+	historyRestorePath:   true,
+	syncWebSocketPath:    true,
+	configPath:           true,
+	exportPath:           true,
+	storageUsagePath:     true,
+	adminAuditPath:       true,
+	adminCredentialsPath: true,
+	adminEventsPath:      true,
+}
+
 var authManager *identity.AuthManager
 var attachmentStore identity.AttachmentStore
+var configReloader func() error
 
 // SetAuthManager sets the global auth manager instance
 func SetAuthManager(am *identity.AuthManager) {
 	authManager = am
 }
 
+// SetConfigReloader sets the function that re-reads the config file and rebuilds
+// the proxies after settings are saved
+func SetConfigReloader(reload func() error) {
+	configReloader = reload
+}
+
 // SetAttachmentStore sets the global attachment store instance
 func SetAttachmentStore(store identity.AttachmentStore) {
 	attachmentStore = store
 }
 
 func HandleRequest(cfg *model.Config, w http.ResponseWriter, r *http.Request) {
-	recorder := utils.NewResponseRecorder(w)
-	CORSMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		handleRequestInternal(cfg, w, r)
-	}, cfg.Logger)(recorder, r)
+	start := time.Now()
+	requestID := utils.RequestID(r)
+	ctx, info := utils.WithRequestInfo(r.Context(), requestID)
+	ctx, span := tracing.Tracer().Start(tracing.Extract(ctx, r.Header), r.Method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+			attribute.String("request_id", requestID)))
+	defer span.End()
+	r = r.WithContext(ctx)
+	w.Header().Set(utils.RequestIDHeader, requestID)
+	w.Header().Set(versionHeader, buildInfo.Version)
+
+	// Tag every log line written while handling this request with its ID
+	requestCfg := *cfg
+	requestCfg.Logger = cfg.Logger.With(zap.String("request_id", requestID))
+	cfg = &requestCfg
+
+	// Compression wraps the recorder so it logs and counts the uncompressed response
+	var recorder *utils.ResponseRecorder
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		recorder = utils.NewResponseRecorder(w)
+		CORSMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			handleRequestInternal(cfg, w, r)
+		}, cfg.AllowedOrigins, cfg.Logger)(recorder, r)
+	}
+	if cfg.CompressResponses {
+		serve = CompressMiddleware(serve)
+	}
+
+	// The event stream itself isn't reported on it
+	publishEvents := r.URL.Path != adminEventsPath && events.Active()
+	if publishEvents {
+		events.Publish(events.Event{Type: events.RequestReceived, RequestID: requestID, Method: r.Method, Path: r.URL.Path})
+	}
+	serve(w, r)
+
+	duration := time.Since(start)
+	logAccess(cfg.Logger, r, recorder, info, duration)
+	if publishEvents {
+		events.Publish(events.Event{
+			Type:       events.RequestFinished,
+			RequestID:  requestID,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Backend:    info.Backend,
+			Status:     recorder.StatusCode,
+			DurationMs: duration.Milliseconds(),
+		})
+	}
+	if info.Backend != "" {
+		span.SetAttributes(attribute.String("backend", info.Backend))
+	}
+	tracing.RecordResponse(span, recorder.StatusCode, nil)
 }
 
+// logAccess writes the single access log line for a request
+func logAccess(logger *zap.Logger, r *http.Request, recorder *utils.ResponseRecorder, info *utils.RequestInfo, duration time.Duration) {
+	logger.Info("Access",
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.Int("status", recorder.StatusCode),
+		zap.Int64("bytes", recorder.BytesWritten),
+		zap.Duration("duration", duration),
+		zap.String("backend", info.Backend),
+		zap.String("client_ip", utils.ExtractClientIP(r.RemoteAddr)),
+		zap.Int64("user_id", info.UserID),
+		zap.Int64("api_key_id", info.APIKeyID))
+}
+
+// checkStreamingRequest reports whether a chat completion request asks for a
+// streamed response. The body is read in full and decoded, since "stream" can
+// come after any number of messages, then restored for the proxy.
 func checkStreamingRequest(r *http.Request) (bool, error) {
-	if (r.URL.Path != chatCompletionsPath && r.URL.Path != chatCompletionsV1Path) || r.Method != "POST" {
+	if (r.URL.Path != chatCompletionsPath && r.URL.Path != chatCompletionsV1Path) || r.Method != "POST" || r.Body == nil {
 		return false, nil
 	}
 
@@ -72,35 +233,36 @@ func checkStreamingRequest(r *http.Request) (bool, error) {
 		return false, nil
 	}
 
-	peeked := make([]byte, peekBufferSize)
-	n, _ := r.Body.Read(peeked)
-	if n > 0 {
-		peeked = peeked[:n]
-		isStreaming := strings.Contains(string(peeked), streamTruePattern)
-		combinedReader := io.MultiReader(bytes.NewReader(peeked), r.Body)
-		r.Body = io.NopCloser(combinedReader)
-
-		if r.ContentLength > 0 {
-			r.ContentLength = int64(n) + r.ContentLength
-		}
-		return isStreaming, nil
+	bodyBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		return false, err
 	}
-	return false, nil
+	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	r.ContentLength = int64(len(bodyBytes))
+
+	return utils.IsStreamRequest(bodyBytes), nil
 }
 
-func prepareRequestBody(r *http.Request, isStreaming bool, logger *zap.Logger) string {
+func prepareRequestBody(r *http.Request, isStreaming bool, logger *zap.Logger) (string, error) {
 	if r.Body == nil {
-		return ""
+		return "", nil
 	}
 
+	// Multipart uploads are read by their handlers as they stream in, so they aren't buffered here
+	isMultipart := strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/")
+
 	var reqBody string
 	if isStreaming {
-		r.Body, reqBody = utils.DrainAndCapture(r.Body, isStreaming)
-	} else {
-		r.Body, reqBody = utils.DrainBody(r.Body)
+		r.Body, reqBody = utils.DrainAndCapture(r.Body, isStreaming, 0)
+	} else if !isMultipart {
+		var err error
+		r.Body, reqBody, err = utils.DrainBody(r.Body)
+		if err != nil {
+			return "", err
+		}
 	}
 
-	if r.ContentLength > 0 && !isStreaming {
+	if r.ContentLength > 0 && !isStreaming && !isMultipart {
 		bodyBytes := []byte(reqBody)
 		r.ContentLength = int64(len(bodyBytes))
 	}
@@ -110,7 +272,45 @@ func prepareRequestBody(r *http.Request, isStreaming bool, logger *zap.Logger) s
 		zap.String("method", r.Method),
 		zap.Bool("streaming", isStreaming))
 
-	return reqBody
+	return reqBody, nil
+}
+
+// requestTimeout parses the X-Request-Timeout header, given either as seconds
+// ("30", "1.5") or as a duration ("90s", "2m"), and caps it at the configured
+// maximum. Invalid or missing values report false so the backend's own
+// timeouts apply.
+func requestTimeout(r *http.Request, cfg *model.Config) (time.Duration, bool) {
+	value := strings.TrimSpace(r.Header.Get(requestTimeoutHeader))
+	if value == "" {
+		return 0, false
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			cfg.Logger.Debug("Ignoring invalid request timeout header", zap.String("value", value))
+			return 0, false
+		}
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+	if timeout <= 0 {
+		cfg.Logger.Debug("Ignoring non-positive request timeout header", zap.String("value", value))
+		return 0, false
+	}
+
+	return min(timeout, cfg.RequestTimeoutLimit()), true
+}
+
+// respondWithBodyReadError rejects a request whose body could not be read,
+// using 413 when it went over the configured size limit
+func respondWithBodyReadError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		http.Error(w, fmt.Sprintf("Request body exceeds the %d byte limit", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "Error reading request body", http.StatusBadRequest)
 }
 
 func handlePublicEndpoints(w http.ResponseWriter, r *http.Request, cfg *model.Config) bool {
@@ -126,6 +326,12 @@ func handlePublicEndpoints(w http.ResponseWriter, r *http.Request, cfg *model.Co
 		return true
 	}
 
+	if r.URL.Path == versionPath && r.Method == "GET" {
+		HandleVersion(w, r)
+		logResponse(cfg.Logger, w)
+		return true
+	}
+
 	// Identity endpoints (when authManager is available)
 	if authManager != nil {
 		if r.URL.Path == authSetupPath && r.Method == "GET" {
@@ -161,13 +367,18 @@ func authenticateRequest(r *http.Request, cfg *model.Config) bool {
 	// If identity system is enabled, use it for authentication
 	if authManager != nil {
 		session, _ := authManager.GetSession(r)
-		return session != nil
+		if session == nil {
+			return false
+		}
+		if info := utils.RequestInfoFrom(r.Context()); info != nil {
+			info.UserID = session.UserID
+			info.APIKeyID = session.APIKeyID
+		}
+		return true
 	}
 
 	// Fall back to legacy API key authentication
-	authHeader := r.Header.Get("Authorization")
-	expectedAuthHeader := "Bearer " + cfg.LLMRouterAPIKey
-	return authHeader == expectedAuthHeader
+	return routerKeyMatches(r.Header.Get("Authorization"), cfg)
 }
 
 func handleProtectedEndpoints(w http.ResponseWriter, r *http.Request, cfg *model.Config) bool {
@@ -177,8 +388,32 @@ func handleProtectedEndpoints(w http.ResponseWriter, r *http.Request, cfg *model
 		return true
 	}
 
+	if r.URL.Path == completionsPath && r.Method == "POST" {
+		HandleCompletions(w, r, cfg)
+		logResponse(cfg.Logger, w)
+		return true
+	}
+
+	if r.URL.Path == embeddingsPath && r.Method == "POST" {
+		HandleEmbeddings(w, r, cfg)
+		logResponse(cfg.Logger, w)
+		return true
+	}
+
+	if (r.URL.Path == audioTranscribePath || r.URL.Path == audioTranslatePath) && r.Method == "POST" {
+		HandleAudio(w, r, cfg)
+		logResponse(cfg.Logger, w)
+		return true
+	}
+
+	if r.URL.Path == healthPath && r.Method == "GET" {
+		HandleHealth(w, r, cfg)
+		logResponse(cfg.Logger, w)
+		return true
+	}
+
 	if r.URL.Path == settingsPath && r.Method == "GET" {
-		HandleGetSettings(w, r, cfg)
+		HandleGetSettings(w, r, cfg, cfg.ConfigFilePath)
 		logResponse(cfg.Logger, w)
 		return true
 	}
@@ -203,20 +438,21 @@ func handleProtectedEndpoints(w http.ResponseWriter, r *http.Request, cfg *model
 			return true
 		}
 
+		// Key management is cookie-only so an API key can't mint or revoke keys
 		if r.URL.Path == authAPIKeysPath && r.Method == "POST" {
-			authManager.CreateAPIKey(w, r)
+			authManager.RequireCookieAuth(authManager.CreateAPIKey)(w, r)
 			logResponse(cfg.Logger, w)
 			return true
 		}
 
 		if r.URL.Path == authAPIKeysPath && r.Method == "GET" {
-			authManager.GetAPIKeys(w, r)
+			authManager.RequireCookieAuth(authManager.GetAPIKeys)(w, r)
 			logResponse(cfg.Logger, w)
 			return true
 		}
 
 		if r.URL.Path == authAPIKeysPath && r.Method == "DELETE" {
-			authManager.DeleteAPIKey(w, r)
+			authManager.RequireCookieAuth(authManager.DeleteAPIKey)(w, r)
 			logResponse(cfg.Logger, w)
 			return true
 		}
@@ -254,6 +490,33 @@ func handleProtectedEndpoints(w http.ResponseWriter, r *http.Request, cfg *model
 			return true
 		}
 
+		// History bulk import endpoint
+		if r.URL.Path == historyImportPath && r.Method == "POST" {
+			authManager.ImportHistory(w, r)
+			logResponse(cfg.Logger, w)
+			return true
+		}
+
+		// History trash endpoints
+		if r.URL.Path == historyTrashPath && r.Method == "GET" {
+			authManager.GetTrash(w, r)
+			logResponse(cfg.Logger, w)
+			return true
+		}
+
+		if r.URL.Path == historyRestorePath && r.Method == "POST" {
+			authManager.RestoreHistoryItem(w, r)
+			logResponse(cfg.Logger, w)
+			return true
+		}
+
+		// History change notifications for multi-device sync
+		if r.URL.Path == syncWebSocketPath && r.Method == "GET" {
+			authManager.SyncWebSocket(w, r)
+			logResponse(cfg.Logger, w)
+			return true
+		}
+
 		// Config endpoints
 		if r.URL.Path == configPath && r.Method == "GET" {
 			authManager.GetConfig(w, r)
@@ -266,6 +529,54 @@ func handleProtectedEndpoints(w http.ResponseWriter, r *http.Request, cfg *model
 			logResponse(cfg.Logger, w)
 			return true
 		}
+
+		// Data export endpoint
+		if r.URL.Path == exportPath && r.Method == "GET" {
+			authManager.ExportUserData(w, r)
+			logResponse(cfg.Logger, w)
+			return true
+		}
+
+		if r.URL.Path == storageUsagePath && r.Method == "GET" {
+			authManager.GetStorageUsage(w, r)
+			logResponse(cfg.Logger, w)
+			return true
+		}
+
+		// Admin endpoints
+		if r.URL.Path == adminAuditPath && r.Method == "GET" {
+			authManager.RequireAdmin(authManager.GetAuditLog)(w, r)
+			logResponse(cfg.Logger, w)
+			return true
+		}
+
+		if r.URL.Path == adminEventsPath && r.Method == "GET" {
+			authManager.RequireAdmin(func(w http.ResponseWriter, r *http.Request) {
+				HandleAdminEvents(w, r, cfg)
+			})(w, r)
+			logResponse(cfg.Logger, w)
+			return true
+		}
+
+		if r.URL.Path == adminCredentialsPath && r.Method == "GET" {
+			authManager.RequireAdmin(HandleGetCredentials)(w, r)
+			logResponse(cfg.Logger, w)
+			return true
+		}
+
+		if strings.HasPrefix(r.URL.Path, adminUsersPath) && strings.HasSuffix(r.URL.Path, "/quota") && r.Method == "PUT" {
+			authManager.RequireAdmin(authManager.SetUserStorageQuota)(w, r)
+			logResponse(cfg.Logger, w)
+			return true
+		}
+
+		if strings.HasPrefix(r.URL.Path, adminCredentialsPath+"/") && r.Method == "POST" {
+			authManager.RequireAdmin(func(w http.ResponseWriter, r *http.Request) {
+				HandleCredentialAction(w, r, cfg.Logger)
+			})(w, r)
+			logResponse(cfg.Logger, w)
+			return true
+		}
 	}
 
 	// Attachment upload endpoint (protected)
@@ -311,8 +622,35 @@ func handleProtectedEndpoints(w http.ResponseWriter, r *http.Request, cfg *model
 }
 
 func handleRequestInternal(cfg *model.Config, w http.ResponseWriter, r *http.Request) {
-	isStreaming, _ := checkStreamingRequest(r)
-	reqBody := prepareRequestBody(r, isStreaming, cfg.Logger)
+	if r.Body != nil {
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.RequestBodyLimit())
+	}
+
+	isStreaming, err := checkStreamingRequest(r)
+	if err != nil {
+		cfg.Logger.Warn("Failed to read request body",
+			zap.String("path", r.URL.Path),
+			zap.Error(err))
+		respondWithBodyReadError(w, err)
+		logResponse(cfg.Logger, w)
+		return
+	}
+	// Honor the client's timeout hint; cancelling the context cancels the upstream request
+	if timeout, ok := requestTimeout(r, cfg); ok {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	reqBody, err := prepareRequestBody(r, isStreaming, cfg.Logger)
+	if err != nil {
+		cfg.Logger.Warn("Failed to read request body",
+			zap.String("path", r.URL.Path),
+			zap.Error(err))
+		respondWithBodyReadError(w, err)
+		logResponse(cfg.Logger, w)
+		return
+	}
 
 	if reqBody != "" {
 		utils.LogRequestResponse(cfg.Logger, r, nil, reqBody, "")
@@ -326,6 +664,7 @@ func handleRequestInternal(cfg *model.Config, w http.ResponseWriter, r *http.Req
 		if authManager != nil {
 			// Identity system is enabled but authentication failed
 			cfg.Logger.Warn("Authentication failed - no valid session or API key")
+			authManager.RecordAuthFailure(r)
 		} else {
 			// Legacy authentication failed
 			authHeader := r.Header.Get("Authorization")
@@ -350,25 +689,82 @@ func handleRequestInternal(cfg *model.Config, w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if !isProxyPath(r.URL.Path, cfg.ProxyPaths) {
+		respondWithUnknownRoute(w, r, cfg.Logger)
+		logResponse(cfg.Logger, w)
+		return
+	}
+
 	routeRequestThroughProxy(r, w, cfg.Logger)
 	logResponse(cfg.Logger, w)
 }
 
+// isProxyPath reports whether a request no handler took may go to the
+// default backend: any path outside /v1, and the /v1 paths in proxyPaths or
+// the configured extra paths
+func isProxyPath(path string, extra []string) bool {
+	if path != "/v1" && !strings.HasPrefix(path, "/v1/") {
+		return true
+	}
+	for _, pattern := range slices.Concat(proxyPaths, extra) {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// isRoutePath reports whether the router answers path itself with some method
+func isRoutePath(path string) bool {
+	if routePaths[path] {
+		return true
+	}
+	return authManager != nil && identityRoutePaths[path]
+}
+
+// respondWithUnknownRoute answers a /v1 request that matches no route with an
+// OpenAI-style JSON error instead of passing a mistyped path upstream: 405
+// when the router serves the path with another method, 404 otherwise
+func respondWithUnknownRoute(w http.ResponseWriter, r *http.Request, logger *zap.Logger) {
+	logger.Info("No route for request",
+		zap.String("path", r.URL.Path),
+		zap.String("method", r.Method))
+
+	status, code, message := http.StatusNotFound, "unknown_route", "Unknown route"
+	if isRoutePath(r.URL.Path) {
+		status, code, message = http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed for route"
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": fmt.Sprintf("%s %s %s", message, r.Method, r.URL.Path),
+			"type":    "invalid_request_error",
+			"code":    code,
+		},
+	})
+}
+
 func logResponse(logger *zap.Logger, w http.ResponseWriter) {
 	if recorder, ok := w.(*utils.ResponseRecorder); ok {
 		logger.Debug("Response details",
 			zap.Int("status", recorder.StatusCode),
 			zap.Any("headers", recorder.Header()),
-			zap.String("body", recorder.GetBody()))
+			zap.String("body", utils.RedactSecrets(recorder.GetBody())))
 	}
 }
 
 func routeRequestThroughProxy(r *http.Request, w http.ResponseWriter, logger *zap.Logger) {
-	if proxy.DefaultProxy != nil {
+	if defaultProxy := proxy.Current().DefaultProxy; defaultProxy != nil {
 		logger.Info("Routing request",
 			zap.String("path", r.URL.Path),
 			zap.String("method", r.Method))
-		proxy.DefaultProxy.ServeHTTP(w, r)
+		defaultProxy.ServeHTTP(w, r)
 	} else {
 		logger.Info("No suitable backend configured for request",
 			zap.String("path", r.URL.Path))
@@ -394,6 +790,7 @@ func HandleContainerTool(w http.ResponseWriter, r *http.Request, cfg *model.Conf
 		Content         string `json:"content,omitempty"`
 		Name            string `json:"name,omitempty"` // Optional override check? No, we force isolation
 		WorkDir         string `json:"work_dir,omitempty"`
+		TimeoutSeconds  int    `json:"timeout_seconds,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -437,7 +834,14 @@ func HandleContainerTool(w http.ResponseWriter, r *http.Request, cfg *model.Conf
 			// Split command string into args? Or assume user provided full shell command?
 			// Use sh -c to allow complex commands
 			cmd := []string{"/bin/sh", "-c", req.Command}
-			output, exitCode, err := cli.Execute(ctx, containerName, cmd, req.WorkDir)
+			var output string
+			var exitCode int
+			var err error
+			if req.TimeoutSeconds > 0 {
+				output, exitCode, err = cli.ExecuteWithTimeout(ctx, containerName, cmd, req.WorkDir, time.Duration(req.TimeoutSeconds)*time.Second)
+			} else {
+				output, exitCode, err = cli.Execute(ctx, containerName, cmd, req.WorkDir)
+			}
 			if err != nil {
 				response["error"] = err.Error()
 				response["success"] = false
@@ -469,7 +873,10 @@ func HandleContainerTool(w http.ResponseWriter, r *http.Request, cfg *model.Conf
 			response["success"] = false
 		} else {
 			content, err := cli.ReadFile(ctx, containerName, req.Path)
-			if err != nil {
+			if errors.Is(err, containers.ErrFileTooLarge) {
+				response["error"] = fmt.Sprintf("file too large to read here (over %dMB), use the workspace file download endpoint", containers.MaxReadFileSize>>20)
+				response["success"] = false
+			} else if err != nil {
 				response["error"] = err.Error()
 				response["success"] = false
 			} else {
@@ -546,36 +953,11 @@ func HandleWorkspaceFiles(w http.ResponseWriter, r *http.Request, cfg *model.Con
 		}
 
 		filePath := filepath.Join(workspacePath, filename)
-		content, err := cli.ReadFile(ctx, containerName, filePath)
-		if err != nil {
-			// Log but don't error 500 if just not found?
-			// checking err string might be fragile.
-			http.Error(w, fmt.Sprintf("failed to read file: %v", err), http.StatusNotFound)
-			return
-		}
-
-		// Detect content type
-		ext := filepath.Ext(filename)
-		contentType := "text/plain"
-		switch ext {
-		case ".html", ".htm":
-			contentType = "text/html"
-		case ".json":
-			contentType = "application/json"
-		case ".js":
-			contentType = "application/javascript"
-		case ".css":
-			contentType = "text/css"
-		case ".png":
-			contentType = "image/png"
-		case ".jpg", ".jpeg":
-			contentType = "image/jpeg"
-		case ".svg":
-			contentType = "image/svg+xml"
-		}
-
-		w.Header().Set("Content-Type", contentType)
-		w.Write(content)
+		w.Header().Set("Content-Type", workspaceContentType(filename))
+		// Stream rather than buffer so large build artifacts don't exhaust memory
+		streamWorkspaceFile(w, cfg.Logger, func(dst io.Writer) error {
+			return cli.ReadFileStream(ctx, containerName, filePath, dst)
+		})
 		return
 	}
 
@@ -641,70 +1023,52 @@ func HandleWorkspaceFiles(w http.ResponseWriter, r *http.Request, cfg *model.Con
 	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 }
 
-// HandleReadWorkspaceFile reads a file from the workspace
-func HandleReadWorkspaceFile(w http.ResponseWriter, r *http.Request, cfg *model.Config, client *containers.Client) {
-	// Path: /v1/workspaces/{conversationId}/files/{filename}
-	parts := strings.Split(r.URL.Path, "/")
-	// /v1/workspaces/uid/files/filename -> 6 parts: "", v1, workspaces, uid, files, filename
-	if len(parts) < 6 {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
-		return
-	}
-
-	conversationId := parts[3]
-	// filename might contain slashes if we support subdirs in future, but for now simple
-	// Reconstruct filename from parts[5:] to allow slashes e.g. /files/dir/file.txt
-	filename := strings.Join(parts[5:], "/")
-
-	if strings.Contains(filename, "..") {
-		http.Error(w, "Invalid filename", http.StatusBadRequest)
-		return
-	}
-
-	workspacePath := getWorkspacePath(conversationId)
-
-	// We need to resolve user id to construct container name llm-sandbox-{uid}
-	// The middleware should have put user_id in context
-	// But wait, getWorkspacePath relies on context? No, it takes conversationId.
-	// We need container name.
-
-	val := r.Context().Value("user_id")
-	userId, ok := val.(string)
-	if !ok {
-		http.Error(w, "User ID not found in context", http.StatusUnauthorized)
-		return
-	}
-
-	containerName := fmt.Sprintf("llm-sandbox-%s", userId)
-	filePath := filepath.Join(workspacePath, filename)
-
-	content, err := client.ReadFile(r.Context(), containerName, filePath)
-	if err != nil {
-		// Log error?
-		http.Error(w, fmt.Sprintf("Failed to read file: %v", err), http.StatusNotFound)
-		return
-	}
-
-	// Simple content type detection based on extension
-	ext := filepath.Ext(filename)
-	contentType := "text/plain"
-	switch ext {
+// workspaceContentType guesses a workspace file's content type from its extension
+func workspaceContentType(filename string) string {
+	switch filepath.Ext(filename) {
 	case ".html", ".htm":
-		contentType = "text/html"
+		return "text/html"
 	case ".json":
-		contentType = "application/json"
+		return "application/json"
 	case ".js":
-		contentType = "application/javascript"
+		return "application/javascript"
 	case ".css":
-		contentType = "text/css"
+		return "text/css"
 	case ".png":
-		contentType = "image/png"
+		return "image/png"
 	case ".jpg", ".jpeg":
-		contentType = "image/jpeg"
+		return "image/jpeg"
 	case ".svg":
-		contentType = "image/svg+xml"
+		return "image/svg+xml"
+	}
+	return "text/plain"
+}
+
+// streamWorkspaceFile writes the file copied by stream to w. A file that
+// can't be opened gets a 404; once part of it has been sent, a failure
+// aborts the connection so the client sees a truncated download instead of
+// an error message appended to the file.
+func streamWorkspaceFile(w http.ResponseWriter, logger *zap.Logger, stream func(io.Writer) error) {
+	out := &sentWriter{w: w}
+	err := stream(out)
+	if err == nil {
+		return
 	}
+	if !out.sent {
+		http.Error(w, fmt.Sprintf("Failed to read file: %v", err), http.StatusNotFound)
+		return
+	}
+	logger.Warn("Workspace file stream failed", zap.Error(err))
+	panic(http.ErrAbortHandler)
+}
+
+// sentWriter records whether anything has been written through it
+type sentWriter struct {
+	w    io.Writer
+	sent bool
+}
 
-	w.Header().Set("Content-Type", contentType)
-	w.Write(content)
+func (s *sentWriter) Write(p []byte) (int, error) {
+	s.sent = true
+	return s.w.Write(p)
 }
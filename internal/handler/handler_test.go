@@ -3,11 +3,13 @@ package handler
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/http/httputil"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -15,6 +17,8 @@ import (
 	"llm-router/internal/proxy"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestModelAlias(t *testing.T) {
@@ -32,8 +36,8 @@ func TestModelAlias(t *testing.T) {
 	targetURL, _ := url.Parse(testServer.URL)
 
 	// Set up a test proxy with proper initialization
-	proxy.Proxies = make(map[string]*httputil.ReverseProxy)
-	proxy.Proxies["ollama/"] = httputil.NewSingleHostReverseProxy(targetURL)
+	proxy.SetCurrent(&proxy.ProxySet{Proxies: make(map[string]*proxy.ProxyGroup)})
+	proxy.Current().Proxies["ollama/"] = proxy.NewProxyGroup("", &proxy.Upstream{Proxy: httputil.NewSingleHostReverseProxy(targetURL)})
 
 	// Create a config with aliases
 	cfg := &model.Config{
@@ -91,10 +95,6 @@ func TestRoleRewrites(t *testing.T) {
 	// Create a target URL for the proxy
 	targetURL, _ := url.Parse(testServer.URL)
 
-	// Set up a test proxy with proper initialization
-	proxy.Proxies = make(map[string]*httputil.ReverseProxy)
-	proxy.Proxies["groq/"] = httputil.NewSingleHostReverseProxy(targetURL)
-
 	// Create a config with role rewrites
 	cfg := &model.Config{
 		Logger: logger,
@@ -107,6 +107,13 @@ func TestRoleRewrites(t *testing.T) {
 		},
 	}
 
+	// Set up a test proxy with proper initialization
+	proxy.SetCurrent(&proxy.ProxySet{Proxies: make(map[string]*proxy.ProxyGroup)})
+	proxy.Current().Proxies["groq/"] = proxy.NewProxyGroup("", &proxy.Upstream{
+		Backend: cfg.Backends[0],
+		Proxy:   httputil.NewSingleHostReverseProxy(targetURL),
+	})
+
 	// Create a test request with roles that should be rewritten
 	requestBody := []byte(`{
 		"model": "groq/llama3",
@@ -180,10 +187,6 @@ func TestUnsupportedParams(t *testing.T) {
 	// Create a target URL for the proxy
 	targetURL, _ := url.Parse(testServer.URL)
 
-	// Set up a test proxy with proper initialization
-	proxy.Proxies = make(map[string]*httputil.ReverseProxy)
-	proxy.Proxies["groq/"] = httputil.NewSingleHostReverseProxy(targetURL)
-
 	// Create a config with unsupported params
 	cfg := &model.Config{
 		Logger: logger,
@@ -196,6 +199,13 @@ func TestUnsupportedParams(t *testing.T) {
 		},
 	}
 
+	// Set up a test proxy with proper initialization
+	proxy.SetCurrent(&proxy.ProxySet{Proxies: make(map[string]*proxy.ProxyGroup)})
+	proxy.Current().Proxies["groq/"] = proxy.NewProxyGroup("", &proxy.Upstream{
+		Backend: cfg.Backends[0],
+		Proxy:   httputil.NewSingleHostReverseProxy(targetURL),
+	})
+
 	// Create a test request with unsupported parameters
 	requestBody := []byte(`{
 		"model": "groq/test-model",
@@ -234,3 +244,418 @@ func TestUnsupportedParams(t *testing.T) {
 		t.Errorf("model parameter should be preserved and modified")
 	}
 }
+
+func TestRequestBodyLimit(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer testServer.Close()
+
+	targetURL, _ := url.Parse(testServer.URL)
+	backend := model.BackendConfig{Name: "test", BaseURL: testServer.URL, Prefix: "test/"}
+	proxy.SetCurrent(&proxy.ProxySet{Proxies: map[string]*proxy.ProxyGroup{
+		"test/": proxy.NewProxyGroup("", &proxy.Upstream{Backend: backend, Proxy: httputil.NewSingleHostReverseProxy(targetURL)}),
+	}})
+
+	cfg := &model.Config{
+		Logger:             zap.NewNop(),
+		Backends:           []model.BackendConfig{backend},
+		LLMRouterAPIKey:    "test-key",
+		MaxRequestBodySize: 128,
+	}
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer test-key")
+		w := httptest.NewRecorder()
+		HandleRequest(cfg, w, req)
+		return w
+	}
+	padding := string(bytes.Repeat([]byte("a"), 256))
+
+	t.Run("WithinLimit", func(t *testing.T) {
+		w := send(`{"model":"test/m","messages":[]}`)
+		if w.Code != http.StatusOK {
+			t.Errorf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("NonStreamingTooLarge", func(t *testing.T) {
+		w := send(`{"model":"test/m","messages":[{"role":"user","content":"` + padding + `"}]}`)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected 413, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("StreamingTooLarge", func(t *testing.T) {
+		w := send(`{"stream":true,"model":"test/m","messages":[{"role":"user","content":"` + padding + `"}]}`)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected 413, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestRequestTimeoutHeader(t *testing.T) {
+	cfg := &model.Config{Logger: zap.NewNop(), MaxRequestTimeout: 60}
+
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Duration
+		applied bool
+	}{
+		{"Seconds", "30", 30 * time.Second, true},
+		{"Fractional Seconds", "1.5", 1500 * time.Millisecond, true},
+		{"Duration", "2s", 2 * time.Second, true},
+		{"Capped", "3600", 60 * time.Second, true},
+		{"Missing", "", 0, false},
+		{"Invalid", "soon", 0, false},
+		{"Negative", "-5", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+			if tt.value != "" {
+				req.Header.Set("X-Request-Timeout", tt.value)
+			}
+			got, applied := requestTimeout(req, cfg)
+			if applied != tt.applied || got != tt.want {
+				t.Errorf("requestTimeout(%q) = %v, %v; want %v, %v", tt.value, got, applied, tt.want, tt.applied)
+			}
+		})
+	}
+
+	t.Run("Truncates Stream", func(t *testing.T) {
+		upstreamDone := make(chan struct{})
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer close(upstreamDone)
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"hello\"}}]}\n\n"))
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}))
+		defer testServer.Close()
+
+		backend := model.BackendConfig{Name: "test", BaseURL: testServer.URL, Prefix: "test/"}
+		proxy.SetCurrent(proxy.NewProxySet([]model.BackendConfig{backend}, zap.NewNop()))
+
+		streamCfg := &model.Config{
+			Logger:          zap.NewNop(),
+			Backends:        []model.BackendConfig{backend},
+			LLMRouterAPIKey: "test-key",
+		}
+
+		// Serve through a real server so an aborted response would surface as a client read error
+		frontServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			HandleRequest(streamCfg, w, r)
+		}))
+		defer frontServer.Close()
+
+		req, _ := http.NewRequest("POST", frontServer.URL+"/v1/chat/completions",
+			bytes.NewBufferString(`{"model":"test/m","stream":true,"messages":[]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer test-key")
+		req.Header.Set("X-Request-Timeout", "0.2")
+
+		start := time.Now()
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("expected a cleanly truncated stream, got read error: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Fatalf("expected the request to stop at its timeout, took %v", elapsed)
+		}
+		if !strings.Contains(string(body), "hello") {
+			t.Errorf("expected the partial stream to reach the client, got %q", body)
+		}
+
+		select {
+		case <-upstreamDone:
+		case <-time.After(2 * time.Second):
+			t.Error("expected the upstream request to be cancelled")
+		}
+	})
+}
+
+func TestAccessLog(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer testServer.Close()
+
+	backend := model.BackendConfig{Name: "test", BaseURL: testServer.URL, Prefix: "test/", Default: true}
+	proxy.SetCurrent(proxy.NewProxySet([]model.BackendConfig{backend}, zap.NewNop()))
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	cfg := &model.Config{
+		Logger:          zap.New(core),
+		Backends:        []model.BackendConfig{backend},
+		LLMRouterAPIKey: "test-key",
+	}
+
+	send := func(authorization string) map[string]interface{} {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model":"test/m","messages":[]}`))
+		req.Header.Set("Authorization", authorization)
+		req.RemoteAddr = "192.0.2.7:5555"
+		HandleRequest(cfg, httptest.NewRecorder(), req)
+
+		entries := logs.FilterMessage("Access").All()
+		logs.TakeAll()
+		if len(entries) != 1 {
+			t.Fatalf("expected one access log line, got %d", len(entries))
+		}
+		return entries[0].ContextMap()
+	}
+
+	t.Run("Proxied", func(t *testing.T) {
+		fields := send("Bearer test-key")
+		if fields["status"] != int64(http.StatusOK) || fields["backend"] != "test" || fields["bytes"] != int64(len(`{"choices":[]}`)) {
+			t.Errorf("unexpected access log fields: %v", fields)
+		}
+		if fields["method"] != "POST" || fields["path"] != "/v1/chat/completions" || fields["client_ip"] != "192.0.2.7" {
+			t.Errorf("unexpected request fields: %v", fields)
+		}
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		fields := send("Bearer wrong")
+		if fields["status"] != int64(http.StatusUnauthorized) || fields["backend"] != "" {
+			t.Errorf("unexpected access log fields: %v", fields)
+		}
+	})
+}
+
+func TestRequestID(t *testing.T) {
+	received := make(chan string, 1)
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("X-Request-ID")
+		w.Header().Set("X-Request-ID", "upstream-id")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer testServer.Close()
+
+	backend := model.BackendConfig{Name: "test", BaseURL: testServer.URL, Prefix: "test/", Default: true}
+	proxy.SetCurrent(proxy.NewProxySet([]model.BackendConfig{backend}, zap.NewNop()))
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	cfg := &model.Config{
+		Logger:          zap.New(core),
+		Backends:        []model.BackendConfig{backend},
+		LLMRouterAPIKey: "test-key",
+	}
+
+	send := func(incoming string) (echoed, forwarded string) {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model":"test/m","messages":[]}`))
+		req.Header.Set("Authorization", "Bearer test-key")
+		if incoming != "" {
+			req.Header.Set("X-Request-ID", incoming)
+		}
+		w := httptest.NewRecorder()
+		HandleRequest(cfg, w, req)
+		if values := w.Header().Values("X-Request-ID"); len(values) != 1 {
+			t.Fatalf("expected a single echoed request ID, got %v", values)
+		}
+		return w.Header().Get("X-Request-ID"), <-received
+	}
+
+	t.Run("Incoming", func(t *testing.T) {
+		echoed, forwarded := send("trace-123")
+		if echoed != "trace-123" || forwarded != "trace-123" {
+			t.Errorf("expected trace-123 to be forwarded and echoed, got %q and %q", forwarded, echoed)
+		}
+		for _, entry := range logs.FilterMessage("Access").All() {
+			if entry.ContextMap()["request_id"] != "trace-123" {
+				t.Errorf("expected access log to carry the request ID, got %v", entry.ContextMap())
+			}
+		}
+	})
+
+	t.Run("Generated", func(t *testing.T) {
+		echoed, forwarded := send("")
+		if echoed == "" || echoed != forwarded {
+			t.Errorf("expected a generated ID to be forwarded and echoed, got %q and %q", forwarded, echoed)
+		}
+	})
+
+	t.Run("Invalid Incoming", func(t *testing.T) {
+		echoed, _ := send("bad id\twith spaces")
+		if echoed == "" || strings.Contains(echoed, " ") {
+			t.Errorf("expected an invalid ID to be replaced, got %q", echoed)
+		}
+	})
+}
+
+func TestUnknownRoutes(t *testing.T) {
+	var forwarded []string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = append(forwarded, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer testServer.Close()
+
+	backend := model.BackendConfig{Name: "test", BaseURL: testServer.URL, Prefix: "test/", Default: true}
+	proxy.SetCurrent(proxy.NewProxySet([]model.BackendConfig{backend}, zap.NewNop()))
+	cfg := &model.Config{
+		Logger:          zap.NewNop(),
+		Backends:        []model.BackendConfig{backend},
+		LLMRouterAPIKey: "test-key",
+	}
+
+	cfg.ProxyPaths = []string{"/v1/custom", "/v1/plugins/*"}
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		wantStatus    int
+		wantForwarded bool
+	}{
+		{"Typo", "POST", "/v1/chat/completion", http.StatusNotFound, false},
+		{"Unknown Version Root", "POST", "/v1", http.StatusNotFound, false},
+		{"Allowed Passthrough", "POST", "/v1/moderations", http.StatusOK, true},
+		{"Outside V1", "POST", "/moderations", http.StatusOK, true},
+		{"Files Passthrough", "GET", "/v1/files/file-abc/content", http.StatusOK, true},
+		{"Fine Tuning Passthrough", "POST", "/v1/fine_tuning/jobs", http.StatusOK, true},
+		{"Threads Passthrough", "POST", "/v1/threads/thread_1/runs", http.StatusOK, true},
+		{"Configured Path", "POST", "/v1/custom", http.StatusOK, true},
+		{"Configured Prefix", "POST", "/v1/plugins/search", http.StatusOK, true},
+		{"Configured Path Is Exact", "POST", "/v1/custom/more", http.StatusNotFound, false},
+		{"Wrong Method", "GET", "/v1/chat/completions", http.StatusMethodNotAllowed, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forwarded = nil
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"input":"hi"}`))
+			req.Header.Set("Authorization", "Bearer test-key")
+			w := httptest.NewRecorder()
+			HandleRequest(cfg, w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if (len(forwarded) > 0) != tt.wantForwarded {
+				t.Errorf("expected forwarded to be %v, got %v", tt.wantForwarded, forwarded)
+			}
+			if tt.wantForwarded {
+				return
+			}
+			var resp struct {
+				Error struct {
+					Message string `json:"message"`
+					Code    string `json:"code"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("expected a JSON error, got %q", w.Body.String())
+			}
+			wantCode := "unknown_route"
+			if tt.wantStatus == http.StatusMethodNotAllowed {
+				wantCode = "method_not_allowed"
+			}
+			if resp.Error.Code != wantCode || !strings.Contains(resp.Error.Message, tt.path) {
+				t.Errorf("unexpected error: %+v", resp.Error)
+			}
+		})
+	}
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/chat/completion", nil)
+		w := httptest.NewRecorder()
+		HandleRequest(cfg, w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("expected unknown routes to still require auth, got %d", w.Code)
+		}
+	})
+}
+
+func TestStreamWorkspaceFile(t *testing.T) {
+	t.Run("Open Failure", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		streamWorkspaceFile(w, zap.NewNop(), func(io.Writer) error {
+			return errors.New("file not found in tar stream")
+		})
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("Failure After First Write", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			streamWorkspaceFile(w, zap.NewNop(), func(dst io.Writer) error {
+				dst.Write([]byte("partial log line\n"))
+				return errors.New("connection reset")
+			})
+		}))
+		defer server.Close()
+
+		// The connection is dropped, before the headers or during the body
+		// depending on what was still buffered
+		resp, err := http.Get(server.URL)
+		if err != nil {
+			return
+		}
+		defer resp.Body.Close()
+		if body, err := io.ReadAll(resp.Body); err == nil {
+			t.Errorf("expected the download to be cut off, got a complete body %q", body)
+		}
+	})
+}
+
+func TestCheckStreamingRequest(t *testing.T) {
+	check := func(body string) (bool, *http.Request) {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		isStreaming, err := checkStreamingRequest(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return isStreaming, req
+	}
+
+	t.Run("Stream After Long Messages", func(t *testing.T) {
+		content := strings.Repeat("a", 2048)
+		body := `{"model":"test/m","messages":[{"role":"user","content":"` + content + `"}],"stream":true}`
+		isStreaming, req := check(body)
+		if !isStreaming {
+			t.Error("expected the request to be detected as streaming")
+		}
+		restored, _ := io.ReadAll(req.Body)
+		if string(restored) != body || req.ContentLength != int64(len(body)) {
+			t.Errorf("expected the body to be restored intact, got %d bytes with content length %d", len(restored), req.ContentLength)
+		}
+	})
+
+	t.Run("Spaced Stream Field", func(t *testing.T) {
+		if isStreaming, _ := check(`{"model":"test/m", "stream": true}`); !isStreaming {
+			t.Error("expected the request to be detected as streaming")
+		}
+	})
+
+	t.Run("Not Streaming", func(t *testing.T) {
+		if isStreaming, _ := check(`{"model":"test/m","stream":false,"messages":[{"role":"user","content":"\"stream\":true"}]}`); isStreaming {
+			t.Error("expected the request not to be detected as streaming")
+		}
+	})
+
+	t.Run("Invalid JSON", func(t *testing.T) {
+		if isStreaming, _ := check(`{"stream":true`); isStreaming {
+			t.Error("expected invalid JSON not to be detected as streaming")
+		}
+	})
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"llm-router/internal/model"
+	"llm-router/internal/proxy"
+
+	"go.uber.org/zap"
+)
+
+const (
+	healthCheckTimeout = 3 * time.Second
+	healthCacheTTL     = 5 * time.Second
+)
+
+// BackendHealth is the result of probing a single backend's /models endpoint
+type BackendHealth struct {
+	Name      string `json:"name"`
+	Reachable bool   `json:"reachable"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+	Circuit   string `json:"circuit,omitempty"` // Circuit breaker state, when one is configured
+}
+
+// HealthResponse lists the health of every configured backend
+type HealthResponse struct {
+	Backends  []BackendHealth `json:"backends"`
+	CheckedAt time.Time       `json:"checked_at"`
+}
+
+// healthCache holds each backend's last probe so frequent polling doesn't
+// hammer upstreams. The lock only guards the map; probes run without it.
+var healthCache = struct {
+	mu      sync.Mutex
+	entries map[string]backendHealthEntry
+}{entries: make(map[string]backendHealthEntry)}
+
+// backendHealthEntry is a cached probe result
+type backendHealthEntry struct {
+	health    BackendHealth
+	checkedAt time.Time
+}
+
+// HandleHealth reports whether each configured backend is reachable
+func HandleHealth(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	response := checkBackends(r.Context(), cfg.Backends, cfg.Logger)
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(healthCacheTTL.Seconds())))
+	respondWithJSON(w, withCircuitStates(response))
+}
+
+// withCircuitStates copies response with each backend's current circuit
+// breaker state. Breaker state changes between probes, so it is not cached.
+func withCircuitStates(response *HealthResponse) *HealthResponse {
+	breakers := proxy.Current().Breakers
+	if len(breakers) == 0 {
+		return response
+	}
+
+	withStates := *response
+	withStates.Backends = make([]BackendHealth, len(response.Backends))
+	for i, health := range response.Backends {
+		if breaker, ok := breakers[health.Name]; ok {
+			health.Circuit = breaker.State()
+		}
+		withStates.Backends[i] = health
+	}
+	return &withStates
+}
+
+// checkBackends probes all backends concurrently, each bounded by
+// healthCheckTimeout, reusing results younger than healthCacheTTL. CheckedAt
+// is the time of the oldest result.
+func checkBackends(ctx context.Context, backends []model.BackendConfig, logger *zap.Logger) *HealthResponse {
+	entries := make([]backendHealthEntry, len(backends))
+
+	var wg sync.WaitGroup
+	for i, backend := range backends {
+		wg.Add(1)
+		go func(i int, backend model.BackendConfig) {
+			defer wg.Done()
+			entries[i] = cachedBackendHealth(ctx, backend, logger)
+		}(i, backend)
+	}
+	wg.Wait()
+
+	response := &HealthResponse{Backends: make([]BackendHealth, len(entries)), CheckedAt: time.Now()}
+	for i, entry := range entries {
+		response.Backends[i] = entry.health
+		if entry.checkedAt.Before(response.CheckedAt) {
+			response.CheckedAt = entry.checkedAt
+		}
+	}
+	return response
+}
+
+// cachedBackendHealth returns the backend's cached probe result, probing it
+// again once the result is older than healthCacheTTL. A probe cut short by
+// the request's cancellation says nothing about the backend, so it is not
+// cached.
+func cachedBackendHealth(ctx context.Context, backend model.BackendConfig, logger *zap.Logger) backendHealthEntry {
+	key := modelsCacheKey(backend)
+
+	healthCache.mu.Lock()
+	entry, ok := healthCache.entries[key]
+	healthCache.mu.Unlock()
+	if ok && time.Since(entry.checkedAt) <= healthCacheTTL {
+		return entry
+	}
+
+	entry = backendHealthEntry{health: checkBackend(ctx, backend, logger), checkedAt: time.Now()}
+	if ctx.Err() != nil {
+		return entry
+	}
+
+	healthCache.mu.Lock()
+	defer healthCache.mu.Unlock()
+	for k, cached := range healthCache.entries {
+		// Drop results for backends removed from the config
+		if time.Since(cached.checkedAt) > healthCacheTTL {
+			delete(healthCache.entries, k)
+		}
+	}
+	healthCache.entries[key] = entry
+	return entry
+}
+
+func checkBackend(ctx context.Context, backend model.BackendConfig, logger *zap.Logger) BackendHealth {
+	health := BackendHealth{Name: backend.Name}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	req, err := createBackendRequest(backend, logger)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	health.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		logger.Warn("Backend health check failed", zap.String("backend", backend.Name), zap.Error(err))
+		health.Error = err.Error()
+		return health
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		health.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+		return health
+	}
+
+	health.Reachable = true
+	return health
+}
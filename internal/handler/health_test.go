@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"llm-router/internal/model"
+	"llm-router/internal/proxy"
+
+	"go.uber.org/zap"
+)
+
+// resetHealthCache forgets every cached probe result
+func resetHealthCache() {
+	healthCache.mu.Lock()
+	defer healthCache.mu.Unlock()
+	clear(healthCache.entries)
+}
+
+func TestHandleHealth(t *testing.T) {
+	var upProbes atomic.Int32
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upProbes.Add(1)
+		json.NewEncoder(w).Encode(model.ModelsResponse{Object: "list"})
+	}))
+	defer up.Close()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	cfg := &model.Config{
+		Logger: zap.NewNop(),
+		Backends: []model.BackendConfig{
+			{Name: "up", BaseURL: up.URL},
+			{Name: "failing", BaseURL: failing.URL},
+			{Name: "down", BaseURL: down.URL},
+		},
+	}
+
+	resetHealthCache()
+	req, _ := http.NewRequest("GET", "/v1/health", nil)
+	rr := httptest.NewRecorder()
+	HandleHealth(rr, req, cfg)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	var resp HealthResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Backends) != 3 {
+		t.Fatalf("expected 3 backends, got %d", len(resp.Backends))
+	}
+
+	expected := map[string]bool{"up": true, "failing": false, "down": false}
+	for _, b := range resp.Backends {
+		if b.Reachable != expected[b.Name] {
+			t.Errorf("%s: expected reachable %v, got %v", b.Name, expected[b.Name], b.Reachable)
+		}
+		if !b.Reachable && b.Error == "" {
+			t.Errorf("%s: expected an error message", b.Name)
+		}
+	}
+
+	t.Run("Cached", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		HandleHealth(rr, req, cfg)
+
+		var cached HealthResponse
+		json.Unmarshal(rr.Body.Bytes(), &cached)
+		if len(cached.Backends) != 3 {
+			t.Errorf("expected cached result with 3 backends, got %d", len(cached.Backends))
+		}
+		if probes := upProbes.Load(); probes != 1 {
+			t.Errorf("expected the cached result to be reused, got %d probes", probes)
+		}
+	})
+
+	t.Run("Cancelled Probe Not Cached", func(t *testing.T) {
+		resetHealthCache()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		HandleHealth(httptest.NewRecorder(), req.WithContext(ctx), cfg)
+
+		rr := httptest.NewRecorder()
+		HandleHealth(rr, req, cfg)
+
+		var resp HealthResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		if len(resp.Backends) != 3 || resp.Backends[0].Name != "up" || !resp.Backends[0].Reachable {
+			t.Errorf("expected a fresh probe after a cancelled one, got %+v", resp.Backends)
+		}
+	})
+}
+
+func TestHandleHealthCircuitState(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(model.ModelsResponse{Object: "list"})
+	}))
+	defer up.Close()
+
+	backends := []model.BackendConfig{
+		{Name: "guarded", BaseURL: up.URL, CircuitBreaker: &model.CircuitBreakerConfig{Threshold: 1}},
+		{Name: "plain", BaseURL: up.URL},
+	}
+	cfg := &model.Config{Logger: zap.NewNop(), Backends: backends}
+
+	set := proxy.NewProxySet(backends, zap.NewNop())
+	proxy.SetCurrent(set)
+
+	resetHealthCache()
+	check := func() map[string]string {
+		req, _ := http.NewRequest("GET", "/v1/health", nil)
+		rr := httptest.NewRecorder()
+		HandleHealth(rr, req, cfg)
+
+		var resp HealthResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		states := make(map[string]string)
+		for _, b := range resp.Backends {
+			states[b.Name] = b.Circuit
+		}
+		return states
+	}
+
+	states := check()
+	if states["guarded"] != proxy.CircuitClosed {
+		t.Errorf("expected closed circuit, got %q", states["guarded"])
+	}
+	if states["plain"] != "" {
+		t.Errorf("expected no circuit state without a breaker, got %q", states["plain"])
+	}
+
+	// The cached probe result must not hide a change in breaker state
+	set.Breakers["guarded"].RecordFailure()
+	if states := check(); states["guarded"] != proxy.CircuitOpen {
+		t.Errorf("expected open circuit, got %q", states["guarded"])
+	}
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"llm-router/internal/model"
+	"llm-router/internal/proxy"
+
+	"go.uber.org/zap"
+)
+
+// servedModelHeader names the model that served a request, which is the one
+// that answered when the client listed several
+const servedModelHeader = "X-Served-Model"
+
+var (
+	errModelMissing     = errors.New("Model key missing or not a string")
+	errInvalidModelList = errors.New("Models must be an array of strings")
+)
+
+// requestedModels returns the models a request asks for, in order. "model"
+// may hold a comma-separated list, and a "models" array adds more after it.
+func requestedModels(chatReq map[string]interface{}) ([]string, error) {
+	var names []string
+	add := func(name string) {
+		name = strings.TrimSpace(name)
+		for _, existing := range names {
+			if existing == name {
+				return
+			}
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	if value, exists := chatReq["model"]; exists {
+		modelName, ok := value.(string)
+		if !ok {
+			return nil, errModelMissing
+		}
+		for _, name := range strings.Split(modelName, ",") {
+			add(name)
+		}
+	}
+
+	if value, exists := chatReq["models"]; exists {
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil, errInvalidModelList
+		}
+		for _, item := range list {
+			name, ok := item.(string)
+			if !ok {
+				return nil, errInvalidModelList
+			}
+			add(name)
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, errModelMissing
+	}
+	return names, nil
+}
+
+// routeToFirstAvailable tries each of the client's models in order until one
+// answers. A model is skipped when no backend's prefix matches it, unless no
+// requested model matches one and the default backend takes them all. The next one is
+// tried when its backend can't be reached or answers with a 5xx. Any other
+// response, including a 4xx, is passed on. The last model's response is
+// passed on whatever it is.
+func routeToFirstAvailable(w http.ResponseWriter, r *http.Request, cfg *model.Config, proxies *proxy.ProxySet, body []byte, modelNames []string, transform func(map[string]interface{}, model.BackendConfig, *zap.Logger)) {
+	logger := cfg.Logger
+
+	var chatReq map[string]interface{}
+	if err := json.Unmarshal(body, &chatReq); err != nil {
+		http.Error(w, "Error unmarshalling request body", http.StatusInternalServerError)
+		return
+	}
+	delete(chatReq, "models")
+
+	var available, unmatched []string
+	for _, name := range modelNames {
+		name = resolveModelAlias(name, cfg)
+		if servesModel(proxies, name) {
+			available = append(available, name)
+			continue
+		}
+		unmatched = append(unmatched, name)
+	}
+	// The default backend would take any model, so it only serves the list
+	// when no requested model matches a backend's prefix
+	if len(available) == 0 && proxies.DefaultProxy != nil {
+		available, unmatched = unmatched, nil
+	}
+	for _, name := range unmatched {
+		logger.Info("Skipping requested model with no backend", zap.String("model", name))
+	}
+	if len(available) == 0 {
+		respondWithNoBackend(w, proxies, strings.Join(modelNames, ","), logger)
+		return
+	}
+
+	for i, modelName := range available {
+		// Each attempt gets its own copy of the request naming just this model;
+		// transforms change the request in place
+		chatReq["model"] = modelName
+		attemptBody, err := json.Marshal(chatReq)
+		if err != nil {
+			http.Error(w, "Error re-marshalling request body", http.StatusInternalServerError)
+			return
+		}
+		var attemptReq map[string]interface{}
+		json.Unmarshal(attemptBody, &attemptReq)
+
+		attempt := &fallbackWriter{w: w, header: make(http.Header), final: i == len(available)-1}
+		proxyModel(attempt, r, cfg, proxies, attemptReq, attemptBody, modelName, transform)
+		if !attempt.failed {
+			return
+		}
+		logger.Warn("Requested model failed, trying the next one",
+			zap.String("model", modelName),
+			zap.Int("status", attempt.status),
+			zap.String("next", available[i+1]))
+	}
+}
+
+// servesModel reports whether a backend's prefix matches modelName. Unlike
+// matchUpstream it doesn't pick a backend, so load balancing is unaffected.
+func servesModel(proxies *proxy.ProxySet, modelName string) bool {
+	for prefix, group := range proxies.Proxies {
+		if strings.HasPrefix(modelName, prefix) && len(group.Upstreams) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// fallbackWriter holds back an attempt's response until its status is known.
+// A failed attempt's response is dropped so the next model can answer in its
+// place; otherwise the response is passed through as it arrives.
+type fallbackWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+	final  bool // last attempt; its response is passed on whatever it is
+	status int
+	failed bool // the response was dropped
+	wrote  bool // the response is being passed on
+}
+
+func (f *fallbackWriter) Header() http.Header {
+	return f.header
+}
+
+func (f *fallbackWriter) WriteHeader(statusCode int) {
+	if f.wrote || f.failed {
+		return
+	}
+	f.status = statusCode
+	if statusCode >= http.StatusInternalServerError && !f.final {
+		f.failed = true
+		return
+	}
+
+	for name, values := range f.header {
+		f.w.Header()[name] = values
+	}
+	f.w.WriteHeader(statusCode)
+	f.wrote = true
+}
+
+func (f *fallbackWriter) Write(b []byte) (int, error) {
+	if !f.wrote && !f.failed {
+		f.WriteHeader(http.StatusOK)
+	}
+	if f.failed {
+		return len(b), nil
+	}
+	return f.w.Write(b)
+}
+
+func (f *fallbackWriter) Flush() {
+	if !f.wrote {
+		return
+	}
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"llm-router/internal/model"
+	"llm-router/internal/proxy"
+
+	"go.uber.org/zap"
+)
+
+func TestModelFallbackList(t *testing.T) {
+	statuses := map[string]int{}
+	var served []string
+	newBackend := func(name string) (model.BackendConfig, *httptest.Server) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			if _, exists := body["models"]; exists {
+				t.Errorf("expected the models list to be dropped, got %v", body["models"])
+			}
+			served = append(served, name+"/"+body["model"].(string))
+			w.WriteHeader(statuses[name])
+			w.Write([]byte(`{"backend":"` + name + `"}`))
+		}))
+		return model.BackendConfig{Name: name, BaseURL: server.URL, Prefix: name + "/"}, server
+	}
+
+	backendA, serverA := newBackend("a")
+	defer serverA.Close()
+	backendB, serverB := newBackend("b")
+	defer serverB.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	backendDown := model.BackendConfig{Name: "down", BaseURL: down.URL, Prefix: "down/"}
+
+	group := func(backend model.BackendConfig) *proxy.ProxyGroup {
+		targetURL, _ := url.Parse(backend.BaseURL)
+		return proxy.NewProxyGroup("", &proxy.Upstream{Backend: backend, Proxy: httputil.NewSingleHostReverseProxy(targetURL)})
+	}
+	proxy.SetCurrent(&proxy.ProxySet{Proxies: map[string]*proxy.ProxyGroup{
+		"a/":    group(backendA),
+		"b/":    group(backendB),
+		"down/": group(backendDown),
+	}})
+	defer proxy.SetCurrent(&proxy.ProxySet{})
+
+	cfg := &model.Config{Logger: zap.NewNop(), Backends: []model.BackendConfig{backendA, backendB, backendDown}}
+	send := func(body string) *httptest.ResponseRecorder {
+		served = nil
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		HandleChatCompletions(rr, req, cfg)
+		return rr
+	}
+
+	t.Run("Falls Over On 5xx", func(t *testing.T) {
+		statuses["a"], statuses["b"] = http.StatusServiceUnavailable, http.StatusOK
+		rr := send(`{"model":"a/gpt-4o, b/claude-3","messages":[]}`)
+
+		if rr.Code != http.StatusOK || rr.Body.String() != `{"backend":"b"}` {
+			t.Fatalf("expected b's response, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if got := rr.Header().Get(servedModelHeader); got != "b/claude-3" {
+			t.Errorf("expected %s b/claude-3, got %q", servedModelHeader, got)
+		}
+		if strings.Join(served, ",") != "a/gpt-4o,b/claude-3" {
+			t.Errorf("expected both models to be tried in order, got %v", served)
+		}
+	})
+
+	t.Run("Falls Over On Connection Error", func(t *testing.T) {
+		statuses["b"] = http.StatusOK
+		rr := send(`{"model":"down/m,b/m","messages":[]}`)
+
+		if rr.Code != http.StatusOK || rr.Header().Get(servedModelHeader) != "b/m" {
+			t.Errorf("expected b to serve the request, got %d from %q", rr.Code, rr.Header().Get(servedModelHeader))
+		}
+	})
+
+	t.Run("Passes On 4xx", func(t *testing.T) {
+		statuses["a"], statuses["b"] = http.StatusBadRequest, http.StatusOK
+		rr := send(`{"model":"a/m,b/m","messages":[]}`)
+
+		if rr.Code != http.StatusBadRequest || rr.Header().Get(servedModelHeader) != "a/m" {
+			t.Errorf("expected a's 400 to be passed on, got %d from %q", rr.Code, rr.Header().Get(servedModelHeader))
+		}
+		if len(served) != 1 {
+			t.Errorf("expected only a to be tried, got %v", served)
+		}
+	})
+
+	t.Run("Models Array", func(t *testing.T) {
+		statuses["b"] = http.StatusOK
+		rr := send(`{"models":["missing/m","b/m"],"messages":[]}`)
+
+		if rr.Code != http.StatusOK || rr.Header().Get(servedModelHeader) != "b/m" {
+			t.Errorf("expected b to serve the request, got %d from %q", rr.Code, rr.Header().Get(servedModelHeader))
+		}
+	})
+
+	t.Run("Last Failure Passed On", func(t *testing.T) {
+		statuses["a"], statuses["b"] = http.StatusInternalServerError, http.StatusBadGateway
+		rr := send(`{"model":"a/m,b/m","messages":[]}`)
+
+		if rr.Code != http.StatusBadGateway || rr.Body.String() != `{"backend":"b"}` {
+			t.Errorf("expected b's failure to be passed on, got %d: %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("Default Backend", func(t *testing.T) {
+		statuses["b"], statuses["default"] = http.StatusOK, http.StatusOK
+		defaultBackend, defaultServer := newBackend("default")
+		defer defaultServer.Close()
+		defaultURL, _ := url.Parse(defaultBackend.BaseURL)
+		proxies := proxy.Current()
+		proxy.SetCurrent(&proxy.ProxySet{Proxies: proxies.Proxies, DefaultProxy: httputil.NewSingleHostReverseProxy(defaultURL)})
+		defer proxy.SetCurrent(proxies)
+
+		rr := send(`{"models":["missing/m","b/m"],"messages":[]}`)
+		if rr.Header().Get(servedModelHeader) != "b/m" || strings.Join(served, ",") != "b/m" {
+			t.Errorf("expected the unmatched model to be skipped for b, got %q after %v", rr.Header().Get(servedModelHeader), served)
+		}
+
+		rr = send(`{"model":"x/m,y/m","messages":[]}`)
+		if rr.Code != http.StatusOK || strings.Join(served, ",") != "default/x/m" {
+			t.Errorf("expected the default backend to serve a list with no prefix match, got %d after %v", rr.Code, served)
+		}
+	})
+
+	t.Run("No Model Served", func(t *testing.T) {
+		rr := send(`{"model":"x/m,y/m","messages":[]}`)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d: %s", rr.Code, rr.Body.String())
+		}
+	})
+}
@@ -23,6 +23,7 @@ const (
 	headerAuthorization  = "Authorization"
 	methodGet            = "GET"
 	modelTypeChat        = "chat"
+	modelTypeEmbedding   = "embedding"
 	responseObjectList   = "list"
 )
 
@@ -31,7 +32,7 @@ func getBackendAPIKey(backend model.BackendConfig, logger *zap.Logger) string {
 		return ""
 	}
 
-	if cm, exists := proxy.CredentialManagers[backend.Name]; exists {
+	if cm, exists := proxy.Current().CredentialManagers[backend.Name]; exists {
 		if key, err := cm.GetNextKey(""); err == nil {
 			logger.Debug("Using API key from credential manager for models request",
 				zap.String("backend", backend.Name))
@@ -47,7 +48,7 @@ func getBackendAPIKey(backend model.BackendConfig, logger *zap.Logger) string {
 }
 
 func createBackendRequest(backend model.BackendConfig, logger *zap.Logger) (*http.Request, error) {
-	modelsURL := strings.TrimSuffix(backend.BaseURL, "/") + modelsEndpointSuffix
+	modelsURL := modelsFormatFor(backend).url(backend.BaseURL)
 	req, err := http.NewRequest(methodGet, modelsURL, nil)
 	if err != nil {
 		return nil, err
@@ -108,7 +109,7 @@ func fetchBackendModels(backend model.BackendConfig, logger *zap.Logger) ([]mode
 		return nil, nil
 	}
 
-	return parseBackendResponse(bodyBytes, logger)
+	return modelsFormatFor(backend).parse(bodyBytes, logger)
 }
 
 func processModel(m model.Model, backend model.BackendConfig) model.Model {
@@ -140,17 +141,79 @@ func processModel(m model.Model, backend model.BackendConfig) model.Model {
 	}
 }
 
+// modelType returns the model's type, inferring it from the ID or name for
+// providers that don't specify one
+func modelType(m model.Model) string {
+	switch m.Type {
+	case "":
+	case "embeddings":
+		return modelTypeEmbedding
+	default:
+		return m.Type
+	}
+
+	loweredID := strings.ToLower(m.ID)
+	loweredName := strings.ToLower(m.DisplayName)
+	nonChatKeywords := []string{modelTypeEmbedding, "audio", "video", "moderation", "imagegen"}
+	for _, kw := range nonChatKeywords {
+		if strings.Contains(loweredID, kw) || strings.Contains(loweredName, kw) {
+			return kw
+		}
+	}
+	return modelTypeChat
+}
+
+// HandleModels lists chat models from all backends. Pass ?type=embedding (or
+// another type) to list models of that type instead. Model lists are cached
+// per backend; pass ?refresh=1 to fetch them again. Concurrent identical
+// requests share one listing.
 func HandleModels(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
 	logger := cfg.Logger
 	logger.Info("Handling /v1/models request")
 
+	wantType := r.URL.Query().Get("type")
+	switch wantType {
+	case "":
+		wantType = modelTypeChat
+	case "embeddings":
+		wantType = modelTypeEmbedding
+	}
+
+	refresh := r.URL.Query().Get("refresh") == "1"
+	allModels := coalescedModels(cfg, wantType, refresh)
+
+	w.Header().Set(headerContentType, contentTypeAppJSON)
+	response := model.ModelsResponse{
+		Object: responseObjectList,
+		Data:   allModels,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error("Failed to encode models response", zap.Error(err))
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully returned aggregated models",
+		zap.Int("totalModels", len(allModels)))
+}
+
+// aggregateModels lists the models of wantType from every enabled backend,
+// prefixed for routing, skipping backends whose models can't be fetched
+func aggregateModels(cfg *model.Config, wantType string, refresh bool) []model.Model {
+	logger := cfg.Logger
+	ttl := cfg.ModelsCacheDuration()
+
 	allModels := make([]model.Model, 0)
 	seenModels := make(map[string]bool)
 
 	for _, backend := range cfg.Backends {
+		if !backend.IsEnabled() {
+			continue
+		}
 		logger.Info("Fetching models from backend", zap.String("backend", backend.Name))
 
-		models, err := fetchBackendModels(backend, logger)
+		models, err := cachedBackendModels(backend, ttl, refresh, logger)
 		if err != nil {
 			logger.Warn("Failed to fetch/parse models from backend",
 				zap.String("backend", backend.Name),
@@ -163,28 +226,8 @@ func HandleModels(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
 			zap.Int("modelCount", len(models)))
 
 		for _, m := range models {
-			// Filter out non-chat models
-			loweredID := strings.ToLower(m.ID)
-			loweredName := strings.ToLower(m.DisplayName)
-
-			// If Type is explicitly set, use it. Otherwise, infer from ID/Name.
-			if m.Type != "" {
-				if m.Type != modelTypeChat {
-					continue
-				}
-			} else {
-				// Fallback filtering for providers that don't specify type
-				nonChatKeywords := []string{"embedding", "audio", "video", "moderation", "imagegen"}
-				isNonChat := false
-				for _, kw := range nonChatKeywords {
-					if strings.Contains(loweredID, kw) || strings.Contains(loweredName, kw) {
-						isNonChat = true
-						break
-					}
-				}
-				if isNonChat {
-					continue
-				}
+			if modelType(m) != wantType {
+				continue
 			}
 
 			prefixedID := backend.Prefix + m.ID
@@ -200,19 +243,5 @@ func HandleModels(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
 				zap.String("modelID", prefixedID))
 		}
 	}
-
-	w.Header().Set(headerContentType, contentTypeAppJSON)
-	response := model.ModelsResponse{
-		Object: responseObjectList,
-		Data:   allModels,
-	}
-
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		logger.Error("Failed to encode models response", zap.Error(err))
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-		return
-	}
-
-	logger.Info("Successfully returned aggregated models",
-		zap.Int("totalModels", len(allModels)))
+	return allModels
 }
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"llm-router/internal/model"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+type modelsCacheEntry struct {
+	models    []model.Model
+	fetchedAt time.Time
+}
+
+// modelsCache holds each backend's model list so /v1/models doesn't hit every
+// provider on every request. Concurrent misses for the same backend share a
+// single upstream fetch.
+var modelsCache = struct {
+	mu      sync.Mutex
+	entries map[string]modelsCacheEntry
+	fetches singleflight.Group
+}{entries: make(map[string]modelsCacheEntry)}
+
+// modelsLists coalesces identical /v1/models requests, so a burst of them
+// on a cold cache builds the list once and every request gets the result
+var modelsLists singleflight.Group
+
+// shareModelsList joins or starts the listing for a key; replaced in tests to
+// count the requests waiting on it
+var shareModelsList = modelsLists.Do
+
+// coalescedModels returns aggregateModels' list, sharing it with concurrent
+// requests for the same config, type and refresh
+func coalescedModels(cfg *model.Config, wantType string, refresh bool) []model.Model {
+	key := fmt.Sprintf("%p\x00%s\x00%t", cfg, wantType, refresh)
+	result, _, shared := shareModelsList(key, func() (interface{}, error) {
+		return aggregateModels(cfg, wantType, refresh), nil
+	})
+	if shared {
+		cfg.Logger.Debug("Shared in-flight models list", zap.String("type", wantType))
+	}
+	return result.([]model.Model)
+}
+
+// modelsCacheKey identifies a backend, so editing its URL starts a fresh entry
+func modelsCacheKey(backend model.BackendConfig) string {
+	return backend.Name + "\x00" + backend.BaseURL
+}
+
+// cachedBackendModels returns the backend's models from the cache when they are
+// younger than ttl, fetching them otherwise. refresh skips the cached copy.
+// Failed fetches are not cached so the next request tries again.
+func cachedBackendModels(backend model.BackendConfig, ttl time.Duration, refresh bool, logger *zap.Logger) ([]model.Model, error) {
+	key := modelsCacheKey(backend)
+
+	if !refresh && ttl > 0 {
+		modelsCache.mu.Lock()
+		entry, ok := modelsCache.entries[key]
+		modelsCache.mu.Unlock()
+		if ok && time.Since(entry.fetchedAt) < ttl {
+			logger.Debug("Using cached models", zap.String("backend", backend.Name))
+			return entry.models, nil
+		}
+	}
+
+	result, err, shared := modelsCache.fetches.Do(key, func() (interface{}, error) {
+		models, err := fetchBackendModels(backend, logger)
+		if err == nil && models != nil && ttl > 0 {
+			storeCachedModels(key, models, ttl)
+		}
+		return models, err
+	})
+	if shared {
+		logger.Debug("Shared in-flight models fetch", zap.String("backend", backend.Name))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result.([]model.Model), nil
+}
+
+// storeCachedModels saves a backend's models and drops entries that have expired,
+// such as those for backends removed from the config
+func storeCachedModels(key string, models []model.Model, ttl time.Duration) {
+	modelsCache.mu.Lock()
+	defer modelsCache.mu.Unlock()
+
+	now := time.Now()
+	for k, entry := range modelsCache.entries {
+		if now.Sub(entry.fetchedAt) >= ttl {
+			delete(modelsCache.entries, k)
+		}
+	}
+	modelsCache.entries[key] = modelsCacheEntry{models: models, fetchedAt: now}
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"llm-router/internal/model"
+
+	"go.uber.org/zap"
+)
+
+const ollamaTagsPath = "/api/tags"
+
+// modelsFormat describes where a kind of backend lists its models and how to
+// normalize the response into model.Model
+type modelsFormat struct {
+	url   func(baseURL string) string
+	parse func(body []byte, logger *zap.Logger) ([]model.Model, error)
+}
+
+var modelsFormats = map[string]modelsFormat{
+	model.ModelsFormatOpenAI: {url: openAIModelsURL, parse: parseBackendResponse},
+	model.ModelsFormatOllama: {url: ollamaModelsURL, parse: parseOllamaResponse},
+}
+
+// modelsFormatFor returns the backend's models format, defaulting to OpenAI's
+func modelsFormatFor(backend model.BackendConfig) modelsFormat {
+	if format, ok := modelsFormats[backend.ModelsFormat]; ok {
+		return format
+	}
+	return modelsFormats[model.ModelsFormatOpenAI]
+}
+
+func openAIModelsURL(baseURL string) string {
+	return strings.TrimSuffix(baseURL, "/") + modelsEndpointSuffix
+}
+
+// ollamaModelsURL points at Ollama's native tags endpoint, which sits beside
+// rather than under the OpenAI-compatible /v1 API
+func ollamaModelsURL(baseURL string) string {
+	base := strings.TrimSuffix(baseURL, "/")
+	base = strings.TrimSuffix(base, "/v1")
+	return base + ollamaTagsPath
+}
+
+// ollamaTagsResponse is the body of Ollama's /api/tags
+type ollamaTagsResponse struct {
+	Models []struct {
+		Name       string    `json:"name"`
+		Model      string    `json:"model"`
+		ModifiedAt time.Time `json:"modified_at"`
+		Details    struct {
+			Family            string `json:"family"`
+			ParameterSize     string `json:"parameter_size"`
+			QuantizationLevel string `json:"quantization_level"`
+		} `json:"details"`
+	} `json:"models"`
+}
+
+func parseOllamaResponse(body []byte, logger *zap.Logger) ([]model.Model, error) {
+	var tags ollamaTagsResponse
+	if err := json.Unmarshal(body, &tags); err != nil {
+		logger.Warn("Failed to unmarshal models response (ollama format)", zap.Error(err))
+		return nil, err
+	}
+
+	models := make([]model.Model, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		id := m.Model
+		if id == "" {
+			id = m.Name
+		}
+
+		var description string
+		if m.Details.ParameterSize != "" {
+			description = strings.TrimSpace(m.Details.Family + " " + m.Details.ParameterSize + " " + m.Details.QuantizationLevel)
+		}
+
+		var created int64
+		if !m.ModifiedAt.IsZero() {
+			created = m.ModifiedAt.Unix()
+		}
+
+		models = append(models, model.Model{
+			ID:          id,
+			Object:      "model",
+			Created:     created,
+			DisplayName: m.Name,
+			Description: description,
+		})
+	}
+	return models, nil
+}
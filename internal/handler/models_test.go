@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"llm-router/internal/model"
 
@@ -62,3 +65,247 @@ func TestHandleModels(t *testing.T) {
 		}
 	}
 }
+
+func TestHandleModelsDisabledBackend(t *testing.T) {
+	requests := 0
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(model.ModelsResponse{Object: "list", Data: []model.Model{{ID: "gpt-4", Object: "model"}}})
+	}))
+	defer backendServer.Close()
+
+	disabled := false
+	cfg := &model.Config{
+		Logger: zap.NewNop(),
+		Backends: []model.BackendConfig{
+			{Name: "on", BaseURL: backendServer.URL, Prefix: "on:"},
+			{Name: "off", BaseURL: backendServer.URL, Prefix: "off:", Enabled: &disabled},
+		},
+		ModelsCacheTTL: -1,
+	}
+
+	req, _ := http.NewRequest("GET", "/v1/models", nil)
+	rr := httptest.NewRecorder()
+	HandleModels(rr, req, cfg)
+
+	var resp model.ModelsResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if len(resp.Data) != 1 || resp.Data[0].ID != "on:gpt-4" {
+		t.Errorf("expected only the enabled backend's models, got %+v", resp.Data)
+	}
+	if requests != 1 {
+		t.Errorf("expected the disabled backend not to be queried, got %d requests", requests)
+	}
+}
+
+func TestHandleModelsEmbeddingType(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(model.ModelsResponse{
+			Object: "list",
+			Data: []model.Model{
+				{ID: "gpt-4", Object: "model"},
+				{ID: "text-embedding-3-small", Object: "model", Type: "embedding"},
+				{ID: "nomic-embed", Object: "model", Type: "embeddings"},
+				{ID: "google/embedding-gecko", Object: "model"},
+			},
+		})
+	}))
+	defer backendServer.Close()
+
+	cfg := &model.Config{
+		Logger: zap.NewNop(),
+		Backends: []model.BackendConfig{
+			{Name: "openai", BaseURL: backendServer.URL, Prefix: "oa:"},
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "/v1/models?type=embedding", nil)
+	rr := httptest.NewRecorder()
+
+	HandleModels(rr, req, cfg)
+
+	var resp model.ModelsResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+
+	got := make(map[string]bool)
+	for _, m := range resp.Data {
+		got[m.ID] = true
+	}
+	for _, id := range []string{"oa:text-embedding-3-small", "oa:nomic-embed", "oa:google/embedding-gecko"} {
+		if !got[id] {
+			t.Errorf("expected %s in embedding models, got %v", id, got)
+		}
+	}
+	if got["oa:gpt-4"] {
+		t.Errorf("chat model gpt-4 should not be listed as an embedding model")
+	}
+}
+
+func TestHandleModelsCache(t *testing.T) {
+	var hits atomic.Int32
+	release := make(chan struct{})
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		<-release
+		json.NewEncoder(w).Encode(model.ModelsResponse{
+			Object: "list",
+			Data:   []model.Model{{ID: "gpt-4", Object: "model"}},
+		})
+	}))
+	defer backendServer.Close()
+
+	cfg := &model.Config{
+		Logger: zap.NewNop(),
+		Backends: []model.BackendConfig{
+			{Name: "openai", BaseURL: backendServer.URL, Prefix: "oa:"},
+		},
+	}
+
+	get := func(path string) model.ModelsResponse {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		HandleModels(rr, req, cfg)
+		var resp model.ModelsResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return resp
+	}
+
+	t.Run("Concurrent Misses Share A Fetch", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if resp := get("/v1/models"); len(resp.Data) != 1 {
+					t.Errorf("expected 1 model, got %d", len(resp.Data))
+				}
+			}()
+		}
+		// Give the requests time to pile up on the in-flight fetch
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		if got := hits.Load(); got != 1 {
+			t.Errorf("expected 1 upstream fetch, got %d", got)
+		}
+	})
+
+	t.Run("Cached", func(t *testing.T) {
+		get("/v1/models")
+		if got := hits.Load(); got != 1 {
+			t.Errorf("expected cached models to be served, got %d upstream fetches", got)
+		}
+	})
+
+	t.Run("Refresh", func(t *testing.T) {
+		get("/v1/models?refresh=1")
+		if got := hits.Load(); got != 2 {
+			t.Errorf("expected refresh to fetch again, got %d upstream fetches", got)
+		}
+	})
+}
+
+func TestHandleModelsCoalescing(t *testing.T) {
+	var hits atomic.Int32
+	release := make(chan struct{})
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		<-release
+		json.NewEncoder(w).Encode(model.ModelsResponse{
+			Object: "list",
+			Data:   []model.Model{{ID: "gpt-4", Object: "model"}, {ID: "gpt-4o", Object: "model"}},
+		})
+	}))
+	defer backendServer.Close()
+
+	cfg := &model.Config{
+		Logger: zap.NewNop(),
+		Backends: []model.BackendConfig{
+			{Name: "coalesced", BaseURL: backendServer.URL, Prefix: "co:"},
+		},
+	}
+
+	const requests = 50
+	arrived := make(chan struct{}, requests)
+	shareModelsList = func(key string, fn func() (interface{}, error)) (interface{}, error, bool) {
+		arrived <- struct{}{}
+		return modelsLists.Do(key, fn)
+	}
+	defer func() { shareModelsList = modelsLists.Do }()
+
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "/v1/models?refresh=1", nil)
+			rr := httptest.NewRecorder()
+			HandleModels(rr, req, cfg)
+
+			var resp model.ModelsResponse
+			json.Unmarshal(rr.Body.Bytes(), &resp)
+			if len(resp.Data) != 2 || resp.Data[0].ID != "co:gpt-4" {
+				t.Errorf("expected the shared model list, got %+v", resp.Data)
+			}
+		}()
+	}
+	// Hold the upstream call until every request has reached the listing
+	for i := 0; i < requests; i++ {
+		<-arrived
+	}
+	close(release)
+	wg.Wait()
+
+	if got := hits.Load(); got != 1 {
+		t.Errorf("expected %d concurrent requests to make 1 upstream call, got %d", requests, got)
+	}
+}
+
+func TestHandleModelsOllamaFormat(t *testing.T) {
+	var requestedPath string
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedPath = r.URL.Path
+		w.Write([]byte(`{"models": [
+			{"name": "llama3:latest", "model": "llama3:latest", "modified_at": "2024-05-01T10:00:00Z",
+			 "details": {"family": "llama", "parameter_size": "8B", "quantization_level": "Q4_0"}},
+			{"name": "qwen2.5:7b", "model": "qwen2.5:7b", "modified_at": "2024-06-01T10:00:00Z", "details": {}}
+		]}`))
+	}))
+	defer backendServer.Close()
+
+	cfg := &model.Config{
+		Logger: zap.NewNop(),
+		Backends: []model.BackendConfig{
+			{Name: "ollama", BaseURL: backendServer.URL + "/v1", Prefix: "ollama/", ModelsFormat: model.ModelsFormatOllama},
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "/v1/models", nil)
+	rr := httptest.NewRecorder()
+	HandleModels(rr, req, cfg)
+
+	if requestedPath != "/api/tags" {
+		t.Errorf("expected models to be listed from /api/tags, got %s", requestedPath)
+	}
+
+	var resp model.ModelsResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if len(resp.Data) != 2 {
+		t.Fatalf("expected 2 models, got %d", len(resp.Data))
+	}
+
+	first := resp.Data[0]
+	if first.ID != "ollama/llama3:latest" {
+		t.Errorf("expected prefixed ID ollama/llama3:latest, got %s", first.ID)
+	}
+	if first.OwnedBy != "ollama" {
+		t.Errorf("expected owned_by ollama, got %s", first.OwnedBy)
+	}
+	if first.Created != 1714557600 {
+		t.Errorf("expected created from modified_at, got %d", first.Created)
+	}
+	if first.Description != "llama 8B Q4_0" {
+		t.Errorf("expected description from details, got %q", first.Description)
+	}
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"llm-router/internal/identity"
+	"llm-router/internal/model"
+	"llm-router/internal/proxy"
+
+	"go.uber.org/zap"
+)
+
+// readinessPingTimeout bounds the database ping made by /readyz
+const readinessPingTimeout = 2 * time.Second
+
+// database is pinged by /readyz; nil until SetDatabase is called. The server
+// answers probes while the database is still connecting, so access is guarded.
+var (
+	databaseMu sync.RWMutex
+	database   interface {
+		Ping(ctx context.Context) error
+	}
+)
+
+// SetDatabase sets the database /readyz checks
+func SetDatabase(db identity.Database) {
+	databaseMu.Lock()
+	defer databaseMu.Unlock()
+	database = db
+}
+
+// ReadinessResponse reports the result of each readiness check
+type ReadinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// HandleLivez reports that the process is up. It checks nothing else, so a
+// slow database or backend never gets the process restarted.
+func HandleLivez(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, map[string]string{"status": "ok"})
+}
+
+// HandleReadyz answers 200 once proxies are initialized and the database, when
+// one is configured, answers a ping, and 503 otherwise
+func HandleReadyz(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+	response := ReadinessResponse{Status: "ready", Checks: make(map[string]string)}
+	fail := func(check, reason string) {
+		response.Status = "not ready"
+		response.Checks[check] = reason
+	}
+
+	if proxy.Initialized() {
+		response.Checks["proxies"] = "ok"
+	} else {
+		fail("proxies", "not initialized")
+	}
+
+	if cfg.DatabaseURL != "" {
+		databaseMu.RLock()
+		database := database
+		databaseMu.RUnlock()
+		if database == nil {
+			fail("database", "not connected")
+		} else {
+			ctx, cancel := context.WithTimeout(r.Context(), readinessPingTimeout)
+			defer cancel()
+			if err := database.Ping(ctx); err != nil {
+				// Driver errors can name the host, user and database, so they only go to the log
+				cfg.Logger.Warn("Readiness database ping failed", zap.Error(err))
+				fail("database", "unreachable")
+			} else {
+				response.Checks["database"] = "ok"
+			}
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if response.Status != "ready" {
+		w.Header().Set("Content-Type", contentTypeJSON)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	respondWithJSON(w, response)
+}
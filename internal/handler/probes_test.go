@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"llm-router/internal/model"
+	"llm-router/internal/proxy"
+
+	"go.uber.org/zap"
+)
+
+type fakeDatabase struct {
+	err error
+}
+
+func (f fakeDatabase) Ping(ctx context.Context) error { return f.err }
+
+func TestHandleLivez(t *testing.T) {
+	rr := httptest.NewRecorder()
+	HandleLivez(rr, httptest.NewRequest("GET", "/livez", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rr.Code)
+	}
+}
+
+func TestHandleReadyz(t *testing.T) {
+	defer func() { database = nil }()
+	proxy.SetCurrent(&proxy.ProxySet{})
+
+	readyz := func(cfg *model.Config) (int, ReadinessResponse) {
+		rr := httptest.NewRecorder()
+		HandleReadyz(rr, httptest.NewRequest("GET", "/readyz", nil), cfg)
+		var response ReadinessResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return rr.Code, response
+	}
+
+	t.Run("Ready Without Database", func(t *testing.T) {
+		database = nil
+		code, response := readyz(&model.Config{Logger: zap.NewNop()})
+		if code != http.StatusOK || response.Status != "ready" {
+			t.Errorf("expected ready, got %d %+v", code, response)
+		}
+		if _, checked := response.Checks["database"]; checked {
+			t.Errorf("database should not be checked when none is configured")
+		}
+	})
+
+	t.Run("Database Not Connected", func(t *testing.T) {
+		database = nil
+		code, response := readyz(&model.Config{Logger: zap.NewNop(), DatabaseURL: "postgres://db"})
+		if code != http.StatusServiceUnavailable || response.Checks["database"] != "not connected" {
+			t.Errorf("expected 503 with database not connected, got %d %+v", code, response)
+		}
+	})
+
+	t.Run("Database Unreachable", func(t *testing.T) {
+		database = fakeDatabase{err: errors.New(`pq: password authentication failed for user "router" at db.internal:5432`)}
+		code, response := readyz(&model.Config{Logger: zap.NewNop(), DatabaseURL: "postgres://db"})
+		if code != http.StatusServiceUnavailable || response.Checks["database"] != "unreachable" {
+			t.Errorf("expected 503 without the driver error, got %d %+v", code, response)
+		}
+	})
+
+	t.Run("Database Reachable", func(t *testing.T) {
+		database = fakeDatabase{}
+		code, response := readyz(&model.Config{Logger: zap.NewNop(), DatabaseURL: "postgres://db"})
+		if code != http.StatusOK || response.Checks["database"] != "ok" || response.Checks["proxies"] != "ok" {
+			t.Errorf("expected ready, got %d %+v", code, response)
+		}
+	})
+}
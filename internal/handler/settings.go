@@ -1,17 +1,41 @@
 package handler
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 
+	"llm-router/internal/config"
 	"llm-router/internal/model"
 
 	"go.uber.org/zap"
 )
 
-// HandleGetSettings returns the current configuration (excluding sensitive runtime data)
-func HandleGetSettings(w http.ResponseWriter, r *http.Request, cfg *model.Config) {
+// redactedAPIKey replaces a backend's api_key in the settings response. Sending
+// it back in a PUT keeps the key currently stored for that backend. Entries of
+// api_keys are redacted as "[REDACTED:<index>]" instead, so each one finds its
+// stored key even after other entries are removed or reordered.
+const redactedAPIKey = "[REDACTED]"
+
+// settingsMu serializes settings updates so concurrent PUTs can't interleave
+// their writes and reloads
+var settingsMu sync.Mutex
+
+// renameFile moves the new config into place; replaced in tests to simulate a failed write
+var renameFile = os.Rename
+
+// HandleGetSettings returns the current configuration (excluding sensitive runtime data).
+// Backends and aliases are served as written in the config file, with
+// environment references unexpanded, so saving them back unchanged keeps the
+// references.
+func HandleGetSettings(w http.ResponseWriter, r *http.Request, cfg *model.Config, configFilePath string) {
 	logger := cfg.Logger
 
 	if r.Method != http.MethodGet {
@@ -21,6 +45,20 @@ func HandleGetSettings(w http.ResponseWriter, r *http.Request, cfg *model.Config
 
 	logger.Info("Handling GET /v1/settings request")
 
+	stored, err := storedSettings(configFilePath)
+	if err != nil {
+		logger.Error("Failed to read config file", zap.String("path", configFilePath), zap.Error(err))
+		http.Error(w, "Failed to read configuration file", http.StatusInternalServerError)
+		return
+	}
+	aliases := cfg.Aliases
+	if raw, ok := stored["aliases"]; ok {
+		var storedAliases map[string]string
+		if json.Unmarshal(raw, &storedAliases) == nil {
+			aliases = storedAliases
+		}
+	}
+
 	// Create a sanitized copy of the config for the response
 	// We'll exclude the Logger and UseGeneratedKey fields
 	response := struct {
@@ -30,9 +68,9 @@ func HandleGetSettings(w http.ResponseWriter, r *http.Request, cfg *model.Config
 		Aliases            map[string]string     `json:"aliases,omitempty"`
 	}{
 		ListeningPort:      cfg.ListeningPort,
-		Backends:           cfg.Backends,
+		Backends:           redactBackendKeys(storedBackends(stored, cfg)),
 		LLMRouterAPIKeyEnv: cfg.LLMRouterAPIKeyEnv,
-		Aliases:            cfg.Aliases,
+		Aliases:            aliases,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -45,7 +83,8 @@ func HandleGetSettings(w http.ResponseWriter, r *http.Request, cfg *model.Config
 	logger.Info("Successfully returned settings")
 }
 
-// HandlePutSettings updates the configuration and writes it to config.json
+// HandlePutSettings updates the configuration and writes it to config.json.
+// Only the fields in the request change; the rest of the file is kept.
 func HandlePutSettings(w http.ResponseWriter, r *http.Request, cfg *model.Config, configFilePath string) {
 	logger := cfg.Logger
 
@@ -56,16 +95,27 @@ func HandlePutSettings(w http.ResponseWriter, r *http.Request, cfg *model.Config
 
 	logger.Info("Handling PUT /v1/settings request")
 
-	// Parse the incoming configuration
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	// Parse the incoming configuration. Fields the client doesn't send are
+	// kept as they are in the file, so settings the UI doesn't edit survive a save.
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.Error("Failed to read settings request", zap.Error(err))
+		respondWithBodyReadError(w, err)
+		return
+	}
+	var fields map[string]json.RawMessage
 	var newConfig struct {
-		ListeningPort      int                   `json:"listening_port"`
-		Backends           []model.BackendConfig `json:"backends"`
-		LLMRouterAPIKeyEnv string                `json:"llmrouter_api_key_env,omitempty"`
-		LLMRouterAPIKey    string                `json:"llmrouter_api_key,omitempty"`
-		Aliases            map[string]string     `json:"aliases,omitempty"`
+		ListeningPort int                   `json:"listening_port"`
+		Backends      []model.BackendConfig `json:"backends"`
 	}
-
-	if err := json.NewDecoder(r.Body).Decode(&newConfig); err != nil {
+	err = json.Unmarshal(body, &fields)
+	if err == nil {
+		err = json.Unmarshal(body, &newConfig)
+	}
+	if err != nil {
 		logger.Error("Failed to decode settings request", zap.Error(err))
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
@@ -82,34 +132,46 @@ func HandlePutSettings(w http.ResponseWriter, r *http.Request, cfg *model.Config
 		return
 	}
 
-	// Validate each backend
-	for i, backend := range newConfig.Backends {
-		if backend.Name == "" {
-			logger.Error("Backend missing name", zap.Int("index", i))
-			http.Error(w, "Backend name is required", http.StatusBadRequest)
-			return
-		}
-		if backend.BaseURL == "" {
-			logger.Error("Backend missing base_url", zap.String("backend", backend.Name))
-			http.Error(w, "Backend base_url is required", http.StatusBadRequest)
-			return
-		}
-		if backend.Prefix == "" {
-			logger.Error("Backend missing prefix", zap.String("backend", backend.Name))
-			http.Error(w, "Backend prefix is required", http.StatusBadRequest)
-			return
-		}
+	stored, err := storedSettings(configFilePath)
+	if err != nil {
+		logger.Error("Failed to read config file", zap.String("path", configFilePath), zap.Error(err))
+		http.Error(w, "Failed to read configuration file", http.StatusInternalServerError)
+		return
+	}
+
+	// Put back keys the client left redacted, as they appear in the saved file
+	if err := restoreBackendKeys(newConfig.Backends, storedBackends(stored, cfg)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for key, value := range fields {
+		stored[key] = value
+	}
+	if stored["backends"], err = json.Marshal(newConfig.Backends); err != nil {
+		logger.Error("Failed to marshal backends", zap.Error(err))
+		http.Error(w, "Failed to serialize configuration", http.StatusInternalServerError)
+		return
+	}
+	// The file is written in the current shape whatever version the client sent
+	stored["config_version"] = json.RawMessage(strconv.Itoa(model.CurrentConfigVersion))
+
+	// Validate the whole file as it will be loaded
+	if err := validateSettings(stored, logger); err != nil {
+		logger.Error("Invalid settings", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	// Write the configuration to file
-	configData, err := json.MarshalIndent(newConfig, "", "  ")
+	configData, err := json.MarshalIndent(stored, "", "  ")
 	if err != nil {
 		logger.Error("Failed to marshal config", zap.Error(err))
 		http.Error(w, "Failed to serialize configuration", http.StatusInternalServerError)
 		return
 	}
 
-	if err := os.WriteFile(configFilePath, configData, 0644); err != nil {
+	if err := writeConfigFile(configFilePath, configData); err != nil {
 		logger.Error("Failed to write config file", zap.String("path", configFilePath), zap.Error(err))
 		http.Error(w, "Failed to write configuration file", http.StatusInternalServerError)
 		return
@@ -117,10 +179,193 @@ func HandlePutSettings(w http.ResponseWriter, r *http.Request, cfg *model.Config
 
 	logger.Info("Configuration saved successfully", zap.String("path", configFilePath))
 
+	message := "Configuration saved successfully. Please restart the server for changes to take effect."
+	if configReloader != nil {
+		if err := configReloader(); err != nil {
+			logger.Error("Failed to reload configuration", zap.Error(err))
+			http.Error(w, "Configuration saved but failed to reload: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		message = "Configuration saved and applied. Changes to the listening port require a restart."
+	}
+
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
-		"message": "Configuration saved successfully. Please restart the server for changes to take effect.",
+		"message": message,
 	})
 }
+
+// writeConfigFile replaces the config file atomically: data is written to a
+// temporary file in the same directory and renamed over the original, so a
+// crash mid-write can't leave a truncated config. The previous config is kept
+// alongside as <path>.bak.
+func writeConfigFile(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	previous, err := os.ReadFile(path)
+	if err == nil {
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if err := writeFileAtomic(path+".bak", previous, mode); err != nil {
+			return fmt.Errorf("failed to back up config: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	return writeFileAtomic(path, data, mode)
+}
+
+// writeFileAtomic writes data to path through a temporary file and a rename
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return renameFile(tmp.Name(), path)
+}
+
+// validateSettings runs the same validation as config loading on the
+// settings that will be written. Environment references are expanded first,
+// as they would be when the file is loaded.
+func validateSettings(settings map[string]json.RawMessage, logger *zap.Logger) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	// Decoding a copy means expansion doesn't modify the values being saved
+	candidate := model.Config{}
+	if err := json.Unmarshal(data, &candidate); err != nil {
+		return err
+	}
+
+	config.ExpandEnv(&candidate, logger)
+	return candidate.Validate()
+}
+
+// redactBackendKeys returns a copy of backends with every API key redacted
+func redactBackendKeys(backends []model.BackendConfig) []model.BackendConfig {
+	redacted := make([]model.BackendConfig, len(backends))
+	for i, backend := range backends {
+		if backend.APIKey != "" {
+			backend.APIKey = redactedAPIKey
+		}
+		if len(backend.APIKeys) > 0 {
+			keys := make([]string, len(backend.APIKeys))
+			for j := range keys {
+				keys[j] = redactedKeyAt(j)
+			}
+			backend.APIKeys = keys
+		}
+		redacted[i] = backend
+	}
+	return redacted
+}
+
+// storedSettings returns the top-level fields of the config file as written,
+// migrated to the current version. A missing or empty file has none.
+func storedSettings(configFilePath string) (map[string]json.RawMessage, error) {
+	stored := make(map[string]json.RawMessage)
+	data, err := os.ReadFile(configFilePath)
+	if os.IsNotExist(err) {
+		return stored, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return stored, nil
+	}
+	if data, err = config.MigrateConfig(data, zap.NewNop()); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// storedBackends returns the backends as written in the config file, so keys
+// given as environment references stay references when restored. The loaded
+// config is used when the file has none.
+func storedBackends(stored map[string]json.RawMessage, cfg *model.Config) []model.BackendConfig {
+	var backends []model.BackendConfig
+	raw, ok := stored["backends"]
+	if !ok || json.Unmarshal(raw, &backends) != nil {
+		return cfg.Backends
+	}
+	return backends
+}
+
+// redactedKeyAt returns the redacted form of the api_keys entry at index
+func redactedKeyAt(index int) string {
+	return fmt.Sprintf("[REDACTED:%d]", index)
+}
+
+// redactedKeyIndex returns the stored index carried by a redacted api_keys
+// entry, or false if key isn't one
+func redactedKeyIndex(key string) (int, bool) {
+	rest, ok := strings.CutPrefix(key, "[REDACTED:")
+	if !ok {
+		return 0, false
+	}
+	rest, ok = strings.CutSuffix(rest, "]")
+	if !ok {
+		return 0, false
+	}
+	index, err := strconv.Atoi(rest)
+	return index, err == nil && index >= 0
+}
+
+// restoreBackendKeys replaces redacted keys in backends with the stored keys of
+// the backend with the same name. A key in api_keys is matched by the stored
+// index its redacted form carries.
+func restoreBackendKeys(backends, stored []model.BackendConfig) error {
+	byName := make(map[string]model.BackendConfig, len(stored))
+	for _, backend := range stored {
+		byName[backend.Name] = backend
+	}
+
+	for i := range backends {
+		backend := &backends[i]
+		current := byName[backend.Name]
+		if backend.APIKey == redactedAPIKey {
+			if current.APIKey == "" {
+				return fmt.Errorf("backend %q has a redacted api_key but no stored key", backend.Name)
+			}
+			backend.APIKey = current.APIKey
+		}
+		for j, key := range backend.APIKeys {
+			if key == redactedAPIKey {
+				return fmt.Errorf("backend %q has a redacted api_keys entry without its index", backend.Name)
+			}
+			index, ok := redactedKeyIndex(key)
+			if !ok {
+				continue
+			}
+			if index >= len(current.APIKeys) {
+				return fmt.Errorf("backend %q has a redacted api_keys entry but no stored key", backend.Name)
+			}
+			backend.APIKeys[j] = current.APIKeys[index]
+		}
+	}
+	return nil
+}
@@ -3,9 +3,12 @@ package handler
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"llm-router/internal/model"
@@ -26,7 +29,7 @@ func TestHandleGetSettings(t *testing.T) {
 	req, _ := http.NewRequest("GET", "/v1/settings", nil)
 	rr := httptest.NewRecorder()
 
-	HandleGetSettings(rr, req, cfg)
+	HandleGetSettings(rr, req, cfg, "")
 
 	if rr.Code != http.StatusOK {
 		t.Errorf("expected 200, got %d", rr.Code)
@@ -40,6 +43,151 @@ func TestHandleGetSettings(t *testing.T) {
 	}
 }
 
+func TestHandleSettingsRedactsKeys(t *testing.T) {
+	cfg := &model.Config{
+		Logger:        zap.NewNop(),
+		ListeningPort: 8080,
+		Backends: []model.BackendConfig{
+			{Name: "openai", BaseURL: "http://openai", Prefix: "openai:", APIKey: "sk-plaintext-secret", APIKeys: []string{"sk-second-secret", "sk-third-secret"}},
+			{Name: "local", BaseURL: "http://local", Prefix: "local:"},
+		},
+	}
+
+	tempFile, err := os.CreateTemp("", "config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tempFile.Name())
+	defer os.Remove(tempFile.Name() + ".bak")
+	stored, _ := json.Marshal(map[string]interface{}{"listening_port": 8080, "backends": []model.BackendConfig{
+		{Name: "openai", BaseURL: "http://openai", Prefix: "openai:", APIKey: "sk-plaintext-secret", APIKeys: []string{"$SECOND_KEY", "sk-third-secret"}},
+	}})
+	os.WriteFile(tempFile.Name(), stored, 0644)
+
+	req, _ := http.NewRequest("GET", "/v1/settings", nil)
+	rr := httptest.NewRecorder()
+	HandleGetSettings(rr, req, cfg, tempFile.Name())
+
+	body := rr.Body.String()
+	for _, secret := range []string{"sk-plaintext-secret", "sk-second-secret", "sk-third-secret"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("settings response leaks %q: %s", secret, body)
+		}
+	}
+	if cfg.Backends[0].APIKey != "sk-plaintext-secret" {
+		t.Error("redacting the response modified the loaded config")
+	}
+
+	t.Run("Round Trip Keeps Keys", func(t *testing.T) {
+		req, _ := http.NewRequest("PUT", "/v1/settings", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		HandlePutSettings(rr, req, cfg, tempFile.Name())
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		var saved struct {
+			Backends []model.BackendConfig `json:"backends"`
+		}
+		content, _ := os.ReadFile(tempFile.Name())
+		json.Unmarshal(content, &saved)
+		openai := saved.Backends[0]
+		if openai.APIKey != "sk-plaintext-secret" || len(openai.APIKeys) != 2 ||
+			openai.APIKeys[0] != "$SECOND_KEY" || openai.APIKeys[1] != "sk-third-secret" {
+			t.Errorf("expected stored keys to be kept, got %+v", openai)
+		}
+	})
+
+	t.Run("Removed And Reordered Keys", func(t *testing.T) {
+		body := `{"listening_port": 8080, "backends": [{"name": "openai", "base_url": "http://openai", "prefix": "openai:", "api_key": "[REDACTED]", "api_keys": ["sk-added", "[REDACTED:1]"]}]}`
+		req, _ := http.NewRequest("PUT", "/v1/settings", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		HandlePutSettings(rr, req, cfg, tempFile.Name())
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		var saved struct {
+			Backends []model.BackendConfig `json:"backends"`
+		}
+		content, _ := os.ReadFile(tempFile.Name())
+		json.Unmarshal(content, &saved)
+		if keys := saved.Backends[0].APIKeys; len(keys) != 2 || keys[0] != "sk-added" || keys[1] != "sk-third-secret" {
+			t.Errorf("expected the redacted entry to keep its own key, got %v", keys)
+		}
+	})
+
+	t.Run("Redacted Key Without Index", func(t *testing.T) {
+		body := `{"listening_port": 8080, "backends": [{"name": "openai", "base_url": "http://openai", "prefix": "openai:", "api_keys": ["[REDACTED]"]}]}`
+		req, _ := http.NewRequest("PUT", "/v1/settings", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		HandlePutSettings(rr, req, cfg, tempFile.Name())
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("New Key Replaces Stored Key", func(t *testing.T) {
+		body := `{"listening_port": 8080, "backends": [{"name": "openai", "base_url": "http://openai", "prefix": "openai:", "api_key": "sk-new-key"}]}`
+		req, _ := http.NewRequest("PUT", "/v1/settings", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		HandlePutSettings(rr, req, cfg, tempFile.Name())
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		content, _ := os.ReadFile(tempFile.Name())
+		if !strings.Contains(string(content), "sk-new-key") {
+			t.Errorf("expected new key to be saved: %s", content)
+		}
+	})
+
+	t.Run("Redacted Key Without Stored Key", func(t *testing.T) {
+		body := `{"listening_port": 8080, "backends": [{"name": "local", "base_url": "http://local", "prefix": "local:", "api_key": "[REDACTED]"}]}`
+		req, _ := http.NewRequest("PUT", "/v1/settings", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		HandlePutSettings(rr, req, cfg, tempFile.Name())
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", rr.Code)
+		}
+	})
+}
+
+func TestHandleSettingsKeepsEnvReferences(t *testing.T) {
+	t.Setenv("SETTINGS_TEST_HOST", "http://resolved")
+	cfg := &model.Config{
+		Logger:        zap.NewNop(),
+		ListeningPort: 8080,
+		Backends:      []model.BackendConfig{{Name: "local", BaseURL: "http://resolved/v1", Prefix: "local:"}},
+		Aliases:       map[string]string{"fast": "http://resolved"},
+	}
+
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	stored := `{"listening_port": 8080, "aliases": {"fast": "${SETTINGS_TEST_HOST}"}, "backends": [{"name": "local", "base_url": "${SETTINGS_TEST_HOST}/v1", "prefix": "local:"}]}`
+	if err := os.WriteFile(configFile, []byte(stored), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", "/v1/settings", nil)
+	rr := httptest.NewRecorder()
+	HandleGetSettings(rr, req, cfg, configFile)
+	body := rr.Body.String()
+	if strings.Contains(body, "http://resolved") || !strings.Contains(body, "${SETTINGS_TEST_HOST}/v1") {
+		t.Fatalf("expected the unexpanded config, got %s", body)
+	}
+
+	req, _ = http.NewRequest("PUT", "/v1/settings", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	HandlePutSettings(rr, req, cfg, configFile)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	content, _ := os.ReadFile(configFile)
+	if strings.Contains(string(content), "http://resolved") {
+		t.Errorf("expected environment references to survive a round trip, got %s", content)
+	}
+}
+
 func TestHandlePutSettings(t *testing.T) {
 	logger := zap.NewNop()
 	cfg := &model.Config{Logger: logger}
@@ -49,6 +197,7 @@ func TestHandlePutSettings(t *testing.T) {
 		t.Fatal(err)
 	}
 	defer os.Remove(tempFile.Name())
+	defer os.Remove(tempFile.Name() + ".bak")
 
 	newConfig := map[string]interface{}{
 		"listening_port": 9090,
@@ -81,6 +230,136 @@ func TestHandlePutSettings(t *testing.T) {
 	}
 }
 
+func TestHandlePutSettingsKeepsOtherFields(t *testing.T) {
+	cfg := &model.Config{Logger: zap.NewNop()}
+	path := filepath.Join(t.TempDir(), "config.json")
+	original := `{
+		"config_version": 1,
+		"listening_port": 8080,
+		"backends": [{"name": "old", "base_url": "http://old", "prefix": "old:"}],
+		"allowed_origins": ["https://chat.example.com"],
+		"webhooks": [{"url": "https://hooks.example.com", "secret": "s"}],
+		"storage_quota": 1048576,
+		"compress_responses": true,
+		"title_model": "old:mini"
+	}`
+	os.WriteFile(path, []byte(original), 0600)
+
+	body := `{"listening_port": 9090, "backends": [{"name": "new", "base_url": "http://new", "prefix": "new:"}], "aliases": {"fast": "new:mini"}}`
+	req, _ := http.NewRequest("PUT", "/v1/settings", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	HandlePutSettings(rr, req, cfg, path)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var saved model.Config
+	content, _ := os.ReadFile(path)
+	if err := json.Unmarshal(content, &saved); err != nil {
+		t.Fatalf("failed to decode saved config: %v", err)
+	}
+	if saved.ListeningPort != 9090 || len(saved.Backends) != 1 || saved.Backends[0].Name != "new" || saved.Aliases["fast"] != "new:mini" {
+		t.Errorf("expected the sent fields to be saved, got %s", content)
+	}
+	if len(saved.AllowedOrigins) != 1 || len(saved.Webhooks) != 1 || saved.StorageQuota != 1048576 ||
+		!saved.CompressResponses || saved.TitleModel != "old:mini" {
+		t.Errorf("expected unrelated fields to be kept, got %s", content)
+	}
+
+	t.Run("Invalid Merged Config", func(t *testing.T) {
+		body := `{"listening_port": 9090, "backends": [{"name": "new", "base_url": "http://new", "prefix": "new:"}], "storage_quota": -1}`
+		req, _ := http.NewRequest("PUT", "/v1/settings", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		HandlePutSettings(rr, req, cfg, path)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", rr.Code)
+		}
+	})
+}
+
+func TestHandlePutSettingsReload(t *testing.T) {
+	cfg := &model.Config{Logger: zap.NewNop()}
+
+	tempFile, err := os.CreateTemp("", "config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tempFile.Name())
+	defer os.Remove(tempFile.Name() + ".bak")
+
+	reloads := 0
+	SetConfigReloader(func() error {
+		reloads++
+		return nil
+	})
+	defer SetConfigReloader(nil)
+
+	body := `{"listening_port": 9090, "backends": [{"name": "b", "base_url": "http://b", "prefix": "b:"}]}`
+	req, _ := http.NewRequest("PUT", "/v1/settings", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+
+	HandlePutSettings(rr, req, cfg, tempFile.Name())
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if reloads != 1 {
+		t.Errorf("expected config to be reloaded once, got %d", reloads)
+	}
+}
+
+func TestHandlePutSettingsAtomicWrite(t *testing.T) {
+	cfg := &model.Config{Logger: zap.NewNop()}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	original := `{"listening_port": 8080, "backends": [{"name": "old", "base_url": "http://old", "prefix": "old:"}]}`
+	os.WriteFile(path, []byte(original), 0600)
+
+	put := func() *httptest.ResponseRecorder {
+		body := `{"listening_port": 9090, "backends": [{"name": "new", "base_url": "http://new", "prefix": "new:"}]}`
+		req, _ := http.NewRequest("PUT", "/v1/settings", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		HandlePutSettings(rr, req, cfg, path)
+		return rr
+	}
+
+	t.Run("Failed Write Keeps Original", func(t *testing.T) {
+		renameFile = func(string, string) error { return errors.New("disk full") }
+		defer func() { renameFile = os.Rename }()
+
+		if rr := put(); rr.Code != http.StatusInternalServerError {
+			t.Fatalf("expected 500, got %d", rr.Code)
+		}
+		content, _ := os.ReadFile(path)
+		if string(content) != original {
+			t.Errorf("expected original config to be intact, got %s", content)
+		}
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			if strings.Contains(entry.Name(), ".tmp-") {
+				t.Errorf("temporary file %s was left behind", entry.Name())
+			}
+		}
+	})
+
+	t.Run("Backup", func(t *testing.T) {
+		if rr := put(); rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		backup, _ := os.ReadFile(path + ".bak")
+		if string(backup) != original {
+			t.Errorf("expected previous config in backup, got %s", backup)
+		}
+		content, _ := os.ReadFile(path)
+		if !strings.Contains(string(content), `"new"`) {
+			t.Errorf("expected new config to be written, got %s", content)
+		}
+		if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+			t.Errorf("expected file mode to be kept, got %v", info.Mode().Perm())
+		}
+	})
+}
+
 func TestHandlePutSettingsInvalid(t *testing.T) {
 	logger := zap.NewNop()
 	cfg := &model.Config{Logger: logger}
@@ -116,6 +395,17 @@ func TestHandlePutSettingsInvalid(t *testing.T) {
 			},
 			status: http.StatusBadRequest,
 		},
+		{
+			name: "Duplicate Prefix",
+			config: map[string]interface{}{
+				"listening_port": 8080,
+				"backends": []map[string]interface{}{
+					{"name": "a", "base_url": "http://a", "prefix": "x/"},
+					{"name": "b", "base_url": "http://b", "prefix": "x/"},
+				},
+			},
+			status: http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"llm-router/internal/model"
+)
+
+// titlePrompt asks the title model for a title and nothing else
+const titlePrompt = "Write a short title, at most six words, for a conversation that starts with the user's message below. Reply with the title only, without quotes or a trailing period."
+
+// maxTitleTokens caps the title model's reply
+const maxTitleTokens = 32
+
+// GenerateTitle asks cfg's title model for a title for a conversation that
+// starts with message. The request is routed like a client's chat request,
+// so aliases and backend settings apply.
+func GenerateTitle(ctx context.Context, cfg *model.Config, message string) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model": cfg.TitleModel,
+		"messages": []map[string]string{
+			{"role": "system", "content": titlePrompt},
+			{"role": "user", "content": message},
+		},
+		"max_tokens": maxTitleTokens,
+		"stream":     false,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", chatCompletionsV1Path, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+
+	resp := &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+	HandleChatCompletions(resp, req, cfg)
+	if resp.status != http.StatusOK {
+		return "", fmt.Errorf("title model %s answered %d", cfg.TitleModel, resp.status)
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(resp.body.Bytes(), &completion); err != nil {
+		return "", fmt.Errorf("failed to decode title completion: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return "", fmt.Errorf("title model %s returned no choices", cfg.TitleModel)
+	}
+	return completion.Choices[0].Message.Content, nil
+}
+
+// bufferedResponse holds a response generated for the router itself
+type bufferedResponse struct {
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(statusCode int) {
+	if b.wroteHeader {
+		return
+	}
+	b.status = statusCode
+	b.wroteHeader = true
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.wroteHeader = true
+	return b.body.Write(p)
+}
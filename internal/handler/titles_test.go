@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"llm-router/internal/model"
+	"llm-router/internal/proxy"
+
+	"go.uber.org/zap"
+)
+
+func TestGenerateTitle(t *testing.T) {
+	var received map[string]interface{}
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"Planning a Trip"}}]}`))
+	}))
+	defer server.Close()
+
+	backend := model.BackendConfig{Name: "test-backend", Prefix: "test:"}
+	serverURL, _ := url.Parse(server.URL)
+	proxy.SetCurrent(&proxy.ProxySet{Proxies: map[string]*proxy.ProxyGroup{
+		"test:": proxy.NewProxyGroup("", &proxy.Upstream{Backend: backend, Proxy: httputil.NewSingleHostReverseProxy(serverURL)}),
+	}})
+	cfg := &model.Config{
+		Logger:     zap.NewNop(),
+		Backends:   []model.BackendConfig{backend},
+		Aliases:    map[string]string{"titles": "test:small"},
+		TitleModel: "titles",
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		title, err := GenerateTitle(context.Background(), cfg, "Help me plan a trip to Japan")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if title != "Planning a Trip" {
+			t.Errorf("expected the model's reply, got %q", title)
+		}
+		if received["model"] != "small" {
+			t.Errorf("expected the alias to be resolved and the prefix stripped, got %v", received["model"])
+		}
+		messages, _ := received["messages"].([]interface{})
+		last, _ := messages[len(messages)-1].(map[string]interface{})
+		if !strings.Contains(last["content"].(string), "Japan") {
+			t.Errorf("expected the first message to be sent, got %v", messages)
+		}
+	})
+
+	t.Run("BackendError", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		defer func() { status = http.StatusOK }()
+
+		if _, err := GenerateTitle(context.Background(), cfg, "hello"); err == nil {
+			t.Error("expected an error when the title model fails")
+		}
+	})
+}
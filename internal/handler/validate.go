@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"net/http"
 
@@ -22,10 +23,9 @@ func HandleValidateAPIKey(w http.ResponseWriter, r *http.Request, cfg *model.Con
 
 	// Get the Authorization header
 	authHeader := r.Header.Get("Authorization")
-	expectedAuthHeader := "Bearer " + cfg.LLMRouterAPIKey
 
 	// Validate the API key
-	isValid := authHeader == expectedAuthHeader
+	isValid := routerKeyMatches(authHeader, cfg)
 
 	if !isValid {
 		logger.Warn("Invalid API key in validation request",
@@ -48,3 +48,11 @@ func HandleValidateAPIKey(w http.ResponseWriter, r *http.Request, cfg *model.Con
 
 	logger.Info("Successfully returned validation result", zap.Bool("valid", isValid))
 }
+
+// routerKeyMatches reports whether authHeader carries the router API key. The
+// comparison is constant-time so response timing doesn't reveal how much of
+// a guessed key was right.
+func routerKeyMatches(authHeader string, cfg *model.Config) bool {
+	expectedAuthHeader := "Bearer " + cfg.LLMRouterAPIKey
+	return subtle.ConstantTimeCompare([]byte(authHeader), []byte(expectedAuthHeader)) == 1
+}
@@ -76,3 +76,26 @@ func TestHandleValidateAPIKey(t *testing.T) {
 		})
 	}
 }
+
+// Router key checks go through routerKeyMatches, which compares in constant time
+func TestRouterKeyMatches(t *testing.T) {
+	cfg := &model.Config{LLMRouterAPIKey: "test-api-key"}
+
+	tests := []struct {
+		authHeader string
+		expected   bool
+	}{
+		{"Bearer test-api-key", true},
+		{"Bearer test-api-ke", false},
+		{"Bearer test-api-key-extra", false},
+		{"Bearer TEST-API-KEY", false},
+		{"test-api-key", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := routerKeyMatches(tt.authHeader, cfg); got != tt.expected {
+			t.Errorf("routerKeyMatches(%q) = %v, want %v", tt.authHeader, got, tt.expected)
+		}
+	}
+}
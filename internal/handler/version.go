@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"net/http"
+)
+
+// versionHeader carries the running build's version on every API response
+const versionHeader = "X-Router-Version"
+
+// BuildInfo identifies the running build
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+}
+
+var buildInfo = BuildInfo{Version: "dev", Commit: "unknown", BuildDate: "unknown"}
+
+// SetBuildInfo sets the build details reported by /v1/version and the version header
+func SetBuildInfo(info BuildInfo) {
+	buildInfo = info
+}
+
+// HandleVersion reports which build is running
+func HandleVersion(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, buildInfo)
+}
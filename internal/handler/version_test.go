@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"llm-router/internal/model"
+
+	"go.uber.org/zap"
+)
+
+func TestHandleVersion(t *testing.T) {
+	defer SetBuildInfo(buildInfo)
+	SetBuildInfo(BuildInfo{Version: "1.4.0", Commit: "abc1234", BuildDate: "2026-01-02T03:04:05Z"})
+
+	cfg := &model.Config{Logger: zap.NewNop(), LLMRouterAPIKey: "test-key"}
+	req := httptest.NewRequest("GET", "/v1/version", nil)
+	rr := httptest.NewRecorder()
+	HandleRequest(cfg, rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 without authentication, got %d", rr.Code)
+	}
+	var info BuildInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if info.Version != "1.4.0" || info.Commit != "abc1234" || info.BuildDate != "2026-01-02T03:04:05Z" {
+		t.Errorf("unexpected build info: %+v", info)
+	}
+	if got := rr.Header().Get(versionHeader); got != "1.4.0" {
+		t.Errorf("expected %s 1.4.0, got %q", versionHeader, got)
+	}
+}
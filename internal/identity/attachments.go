@@ -1,14 +1,25 @@
 package identity
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"mime"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"llm-router/internal/model"
 
 	"github.com/google/uuid"
+	"go.uber.org/zap"
 )
 
 // AttachmentStore defines the interface for storing and retrieving attachments
@@ -16,12 +27,101 @@ import (
 type AttachmentStore interface {
 	Save(data []byte, contentType string) (uuid string, err error)
 	Get(uuid string) (data []byte, contentType string, err error)
+	Stat(uuid string) (AttachmentInfo, error)
 	Delete(uuid string) error
 }
 
+// AttachmentInfo describes a stored attachment without its content
+type AttachmentInfo struct {
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// attachmentURLPrefix is the URL prefix used when rewriting images into attachment references
+const attachmentURLPrefix = "/api/v1/attachments/"
+
+var (
+	// ErrAttachmentTooLarge is returned for attachments over the size limit
+	ErrAttachmentTooLarge = errors.New("attachment too large")
+	// ErrAttachmentType is returned for attachments of a type that isn't allowed,
+	// or whose content doesn't match the claimed type
+	ErrAttachmentType = errors.New("attachment type not allowed")
+)
+
+// AttachmentLimits bounds the attachments that may be stored
+type AttachmentLimits struct {
+	MaxSize      int64    // decoded bytes
+	AllowedTypes []string // checked against the content's sniffed type
+}
+
+// globalAttachmentLimits applies to images extracted from synced conversations.
+// It is swapped on config reload, so it is read atomically.
+var globalAttachmentLimits atomic.Pointer[AttachmentLimits]
+
+// SetAttachmentLimits sets the limits applied to images extracted from synced conversations
+func SetAttachmentLimits(limits AttachmentLimits) {
+	globalAttachmentLimits.Store(&limits)
+}
+
+func attachmentLimits() AttachmentLimits {
+	if limits := globalAttachmentLimits.Load(); limits != nil {
+		return *limits
+	}
+	return AttachmentLimits{
+		MaxSize:      model.DefaultMaxAttachmentSize,
+		AllowedTypes: model.DefaultAttachmentTypes,
+	}
+}
+
+// CheckEncodedSize rejects a base64 data URI whose decoded content would be
+// over the size limit, so it can be refused before decoding
+func (l AttachmentLimits) CheckEncodedSize(dataURI string) error {
+	_, encoded, _ := strings.Cut(dataURI, ",")
+	if int64(base64.StdEncoding.DecodedLen(len(encoded))) > l.MaxSize+2 {
+		return ErrAttachmentTooLarge
+	}
+	return nil
+}
+
+// Check verifies data is within the size limit and is of an allowed type. The
+// claimed content type must match what the bytes sniff as, so a non-image
+// can't be stored by labelling it as one.
+func (l AttachmentLimits) Check(data []byte, contentType string) error {
+	if int64(len(data)) > l.MaxSize {
+		return ErrAttachmentTooLarge
+	}
+
+	claimed := normalizeContentType(contentType)
+	if !slices.Contains(l.AllowedTypes, claimed) {
+		return fmt.Errorf("%w: %s", ErrAttachmentType, contentType)
+	}
+	if sniffed := normalizeContentType(http.DetectContentType(data)); sniffed != claimed {
+		return fmt.Errorf("%w: content is %s, not %s", ErrAttachmentType, sniffed, claimed)
+	}
+	return nil
+}
+
+// normalizeContentType drops parameters and lowercases a content type
+func normalizeContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	if mediaType == "image/jpg" {
+		return "image/jpeg"
+	}
+	return mediaType
+}
+
+// contentIndexDir is the subdirectory of a content-addressed store mapping
+// SHA-256 content hashes to attachment IDs
+const contentIndexDir = "sha256"
+
 // LocalFileStore implements AttachmentStore using local filesystem
 type LocalFileStore struct {
 	baseDir string
+	dedup   bool
 	mu      sync.RWMutex
 }
 
@@ -41,11 +141,48 @@ func NewLocalFileStore(baseDir string) (*LocalFileStore, error) {
 	}, nil
 }
 
+// NewContentAddressedStore creates a local file store that deduplicates
+// attachments: saving content that is already stored returns the existing ID.
+// Files are still stored by UUID, with an index from content hash to ID.
+func NewContentAddressedStore(baseDir string) (*LocalFileStore, error) {
+	s, err := NewLocalFileStore(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(s.baseDir, contentIndexDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create attachments index directory: %w", err)
+	}
+	s.dedup = true
+	return s, nil
+}
+
+// contentIndexPath returns the index file for data's content hash
+func (s *LocalFileStore) contentIndexPath(data []byte) string {
+	hash := sha256.Sum256(data)
+	return filepath.Join(s.baseDir, contentIndexDir, hex.EncodeToString(hash[:]))
+}
+
 // Save stores the attachment data and returns a UUID
 func (s *LocalFileStore) Save(data []byte, contentType string) (string, error) {
+	id, _, err := s.saveNew(data, contentType)
+	return id, err
+}
+
+// saveNew is Save, also reporting whether the content was stored anew
+// rather than deduplicated into an existing attachment
+func (s *LocalFileStore) saveNew(data []byte, contentType string) (string, bool, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if s.dedup {
+		if id, err := os.ReadFile(s.contentIndexPath(data)); err == nil {
+			// The index can outlive its file if a delete was interrupted
+			if matches, _ := filepath.Glob(filepath.Join(s.baseDir, string(id)+".*")); len(matches) > 0 {
+				return string(id), false, nil
+			}
+		}
+	}
+
 	// Generate UUID for the file
 	id := uuid.New().String()
 
@@ -56,10 +193,16 @@ func (s *LocalFileStore) Save(data []byte, contentType string) (string, error) {
 	// Write file
 	filePath := filepath.Join(s.baseDir, filename)
 	if err := os.WriteFile(filePath, data, 0644); err != nil {
-		return "", fmt.Errorf("failed to write attachment file: %w", err)
+		return "", false, fmt.Errorf("failed to write attachment file: %w", err)
 	}
 
-	return id, nil
+	if s.dedup {
+		if err := os.WriteFile(s.contentIndexPath(data), []byte(id), 0644); err != nil {
+			return "", false, fmt.Errorf("failed to write attachment index: %w", err)
+		}
+	}
+
+	return id, true, nil
 }
 
 // Get retrieves the attachment data by UUID
@@ -91,6 +234,31 @@ func (s *LocalFileStore) Get(id string) ([]byte, string, error) {
 	return data, contentType, nil
 }
 
+// Stat returns an attachment's size, content type and modification time
+func (s *LocalFileStore) Stat(id string) (AttachmentInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matches, err := filepath.Glob(filepath.Join(s.baseDir, id+".*"))
+	if err != nil {
+		return AttachmentInfo{}, fmt.Errorf("failed to search for attachment: %w", err)
+	}
+	if len(matches) == 0 {
+		return AttachmentInfo{}, fmt.Errorf("attachment not found")
+	}
+
+	fi, err := os.Stat(matches[0])
+	if err != nil {
+		return AttachmentInfo{}, fmt.Errorf("failed to stat attachment: %w", err)
+	}
+
+	return AttachmentInfo{
+		Size:        fi.Size(),
+		ContentType: getContentTypeFromExtension(filepath.Ext(matches[0])),
+		ModTime:     fi.ModTime(),
+	}, nil
+}
+
 // Delete removes an attachment by UUID
 func (s *LocalFileStore) Delete(id string) error {
 	s.mu.Lock()
@@ -107,6 +275,16 @@ func (s *LocalFileStore) Delete(id string) error {
 		return fmt.Errorf("attachment not found")
 	}
 
+	if s.dedup {
+		// Drop the index entry so the content is stored afresh if saved again
+		if data, err := os.ReadFile(matches[0]); err == nil {
+			indexPath := s.contentIndexPath(data)
+			if indexed, err := os.ReadFile(indexPath); err == nil && string(indexed) == id {
+				os.Remove(indexPath)
+			}
+		}
+	}
+
 	if err := os.Remove(matches[0]); err != nil {
 		return fmt.Errorf("failed to delete attachment: %w", err)
 	}
@@ -143,25 +321,70 @@ func DecodeBase64Image(dataURI string) ([]byte, string, error) {
 	return data, contentType, nil
 }
 
+// newAttachmentSaver is implemented by stores that may answer Save with an
+// attachment stored earlier; saveNew reports whether the content is new
+type newAttachmentSaver interface {
+	saveNew(data []byte, contentType string) (id string, created bool, err error)
+}
+
+// saveAttachment saves data to store, reporting whether a new attachment was
+// created. Stores that don't deduplicate always create one.
+func saveAttachment(store AttachmentStore, data []byte, contentType string) (string, bool, error) {
+	if saver, ok := store.(newAttachmentSaver); ok {
+		return saver.saveNew(data, contentType)
+	}
+	id, err := store.Save(data, contentType)
+	return id, err == nil, err
+}
+
 // ExtractAndSaveImages recursively processes content to find and save base64 images
-// Returns the modified content with attachment URLs
+// Returns the modified content with attachment URLs. When an image can't be
+// saved, the ones already stored by this call are deleted again.
 func ExtractAndSaveImages(content interface{}, store AttachmentStore) (interface{}, error) {
+	var created []string
+	processed, err := extractAndSaveImages(content, store, &created)
+	if err != nil {
+		for _, id := range created {
+			if deleteErr := store.Delete(id); deleteErr != nil && globalLogger != nil {
+				globalLogger.Warn("Failed to delete attachment of unsaved content",
+					zap.String("attachment_id", id),
+					zap.Error(deleteErr))
+			}
+		}
+		return content, err
+	}
+	return processed, nil
+}
+
+// extractAndSaveImages does ExtractAndSaveImages' walk, adding the IDs of the
+// attachments it creates to created
+func extractAndSaveImages(content interface{}, store AttachmentStore, created *[]string) (interface{}, error) {
 	switch v := content.(type) {
 	case string:
 		// Check if this is a base64 image data URI
 		if strings.HasPrefix(v, "data:image/") {
+			limits := attachmentLimits()
+			if err := limits.CheckEncodedSize(v); err != nil {
+				return v, err
+			}
 			data, contentType, err := DecodeBase64Image(v)
 			if err != nil {
 				return v, err
 			}
+			if err := limits.Check(data, contentType); err != nil {
+				return v, err
+			}
 
-			uuid, err := store.Save(data, contentType)
+			uuid, isNew, err := saveAttachment(store, data, contentType)
 			if err != nil {
 				return v, err
 			}
+			if isNew {
+				*created = append(*created, uuid)
+			}
 
 			// Return the attachment URL with /api prefix for frontend compatibility
-			return fmt.Sprintf("/api/v1/attachments/%s", uuid), nil
+			return attachmentURLPrefix + uuid, nil
 		}
 		return v, nil
 
@@ -169,7 +392,7 @@ func ExtractAndSaveImages(content interface{}, store AttachmentStore) (interface
 		// Process each field in the map
 		result := make(map[string]interface{})
 		for key, val := range v {
-			processed, err := ExtractAndSaveImages(val, store)
+			processed, err := extractAndSaveImages(val, store, created)
 			if err != nil {
 				return v, err
 			}
@@ -181,7 +404,7 @@ func ExtractAndSaveImages(content interface{}, store AttachmentStore) (interface
 		// Process each item in the array
 		result := make([]interface{}, len(v))
 		for i, val := range v {
-			processed, err := ExtractAndSaveImages(val, store)
+			processed, err := extractAndSaveImages(val, store, created)
 			if err != nil {
 				return v, err
 			}
@@ -195,6 +418,37 @@ func ExtractAndSaveImages(content interface{}, store AttachmentStore) (interface
 	}
 }
 
+// ExtractAttachmentIDs recursively collects the IDs of attachments referenced in content
+func ExtractAttachmentIDs(content interface{}) []string {
+	var ids []string
+	seen := make(map[string]bool)
+
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch val := v.(type) {
+		case string:
+			if strings.HasPrefix(val, attachmentURLPrefix) {
+				id := strings.TrimPrefix(val, attachmentURLPrefix)
+				if id != "" && !seen[id] {
+					seen[id] = true
+					ids = append(ids, id)
+				}
+			}
+		case map[string]interface{}:
+			for _, item := range val {
+				walk(item)
+			}
+		case []interface{}:
+			for _, item := range val {
+				walk(item)
+			}
+		}
+	}
+
+	walk(content)
+	return ids
+}
+
 // getExtensionFromContentType returns the file extension for a content type
 func getExtensionFromContentType(contentType string) string {
 	switch contentType {
@@ -1,6 +1,7 @@
 package identity
 
 import (
+	"errors"
 	"os"
 	"testing"
 )
@@ -41,6 +42,15 @@ func TestLocalFileStore(t *testing.T) {
 		t.Errorf("expected application/octet-stream, got %s", ct)
 	}
 
+	// Test Stat
+	info, err := store.Stat(id)
+	if err != nil {
+		t.Fatalf("failed to stat: %v", err)
+	}
+	if info.Size != int64(len(testData)) || info.ModTime.IsZero() {
+		t.Errorf("unexpected info: %+v", info)
+	}
+
 	// Test Delete
 	err = store.Delete(id)
 	if err != nil {
@@ -53,6 +63,40 @@ func TestLocalFileStore(t *testing.T) {
 	}
 }
 
+func TestContentAddressedStore(t *testing.T) {
+	store, err := NewContentAddressedStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	first, _ := store.Save([]byte("screenshot"), "image/png")
+	second, _ := store.Save([]byte("screenshot"), "image/png")
+	if first != second {
+		t.Errorf("expected identical content to share an ID, got %s and %s", first, second)
+	}
+
+	other, _ := store.Save([]byte("another screenshot"), "image/png")
+	if other == first {
+		t.Error("expected different content to get a new ID")
+	}
+
+	t.Run("Saved Again After Delete", func(t *testing.T) {
+		if err := store.Delete(first); err != nil {
+			t.Fatalf("failed to delete: %v", err)
+		}
+		id, err := store.Save([]byte("screenshot"), "image/png")
+		if err != nil {
+			t.Fatalf("failed to save: %v", err)
+		}
+		if id == first {
+			t.Error("expected a new ID once the content was deleted")
+		}
+		if data, _, err := store.Get(id); err != nil || string(data) != "screenshot" {
+			t.Errorf("expected stored content, got %q, %v", data, err)
+		}
+	})
+}
+
 func TestDecodeBase64Image(t *testing.T) {
 	dataURI := "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mP8z8BQDwAEhQGAhKmMIQAAAABJRU5ErkJggg=="
 	data, ct, err := DecodeBase64Image(dataURI)
@@ -98,3 +142,60 @@ func TestExtractAndSaveImages(t *testing.T) {
 		}
 	}
 }
+
+func TestExtractAndSaveImagesCleanup(t *testing.T) {
+	dataURI := "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mP8z8BQDwAEhQGAhKmMIQAAAABJRU5ErkJggg=="
+	// Not really a GIF, so it fails the type check after the PNG is stored
+	content := []interface{}{dataURI, "data:image/gif;base64,aGVsbG8="}
+
+	t.Run("Deletes Stored Images", func(t *testing.T) {
+		dir := t.TempDir()
+		store, _ := NewLocalFileStore(dir)
+
+		if _, err := ExtractAndSaveImages(content, store); !errors.Is(err, ErrAttachmentType) {
+			t.Fatalf("expected a type error, got %v", err)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("expected the stored image to be deleted, found %d files", len(entries))
+		}
+	})
+
+	t.Run("Keeps Deduplicated Images", func(t *testing.T) {
+		dir := t.TempDir()
+		store, _ := NewContentAddressedStore(dir)
+		png, contentType, _ := DecodeBase64Image(dataURI)
+		existing, _ := store.Save(png, contentType)
+
+		if _, err := ExtractAndSaveImages(content, store); err == nil {
+			t.Fatal("expected an error")
+		}
+		if _, _, err := store.Get(existing); err != nil {
+			t.Errorf("expected the attachment stored earlier to be kept: %v", err)
+		}
+	})
+}
+
+func TestAttachmentLimits(t *testing.T) {
+	png, _, _ := DecodeBase64Image("data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mP8z8BQDwAEhQGAhKmMIQAAAABJRU5ErkJggg==")
+	limits := AttachmentLimits{MaxSize: 1024, AllowedTypes: []string{"image/png", "image/jpeg"}}
+
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		expected    error
+	}{
+		{"Valid", png, "image/png", nil},
+		{"Too Large", make([]byte, 2048), "image/png", ErrAttachmentTooLarge},
+		{"Not Allowed", []byte("hello"), "text/plain", ErrAttachmentType},
+		{"Mismatched Content", []byte("hello"), "image/jpeg", ErrAttachmentType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := limits.Check(tt.data, tt.contentType)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"llm-router/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// auditQueueSize bounds the events waiting to be written; events beyond it are dropped
+	auditQueueSize = 256
+
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+
+	// authFailureWindow is how often a failed request from one address gets
+	// its own audit entry; the failures in between are counted instead
+	authFailureWindow = time.Minute
+)
+
+// globalAuditRetention is how long audit events are kept; 0 keeps them
+// forever. It is swapped on config reload.
+var globalAuditRetention atomic.Int64
+
+// SetAuditRetention sets how long audit events are kept before they are
+// pruned. 0 keeps them forever.
+func SetAuditRetention(retention time.Duration) {
+	globalAuditRetention.Store(int64(retention))
+}
+
+type auditRecord struct {
+	userID int64
+	action string
+	ip     string
+	detail string
+}
+
+// auditLogger writes audit events from a background goroutine so the auth
+// path never waits on the database
+type auditLogger struct {
+	db    Database
+	queue chan auditRecord
+}
+
+func newAuditLogger(db Database) *auditLogger {
+	a := &auditLogger{
+		db:    db,
+		queue: make(chan auditRecord, auditQueueSize),
+	}
+	go a.run()
+	return a
+}
+
+func (a *auditLogger) run() {
+	for rec := range a.queue {
+		if err := a.db.AppendAuditEvent(rec.userID, rec.action, rec.ip, rec.detail); err != nil && globalLogger != nil {
+			globalLogger.Error("Failed to write audit event",
+				zap.String("action", rec.action),
+				zap.Error(err))
+		}
+	}
+}
+
+func (a *auditLogger) record(rec auditRecord) {
+	select {
+	case a.queue <- rec:
+	default:
+		if globalLogger != nil {
+			globalLogger.Warn("Audit queue full, dropping event", zap.String("action", rec.action))
+		}
+	}
+}
+
+// pruneAuditLog periodically removes audit events older than the configured retention
+func (am *AuthManager) pruneAuditLog() {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if retention := time.Duration(globalAuditRetention.Load()); retention > 0 {
+			am.pruneAuditLogOnce(time.Now().Add(-retention))
+		}
+	}
+}
+
+// pruneAuditLogOnce removes audit events recorded before olderThan
+func (am *AuthManager) pruneAuditLogOnce(olderThan time.Time) {
+	pruned, err := am.db.PruneAuditEvents(olderThan)
+	if err != nil {
+		if globalLogger != nil {
+			globalLogger.Error("Failed to prune audit log", zap.Error(err))
+		}
+		return
+	}
+	if pruned > 0 && globalLogger != nil {
+		globalLogger.Info("Pruned audit log", zap.Int64("count", pruned))
+	}
+}
+
+// authFailureThrottle keeps a flood of unauthenticated requests from writing
+// an audit row each: an address gets one entry per authFailureWindow, and
+// the failures in between are counted into its next entry
+type authFailureThrottle struct {
+	mu        sync.Mutex
+	addresses map[string]*authFailures
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type authFailures struct {
+	loggedAt    time.Time // when the address's last entry was written
+	lastFailure time.Time
+	suppressed  int // failures since loggedAt without an entry
+}
+
+func newAuthFailureThrottle() *authFailureThrottle {
+	return &authFailureThrottle{
+		addresses: make(map[string]*authFailures),
+		now:       time.Now,
+	}
+}
+
+// admit reports whether a failure from ip gets its own entry, and how many
+// failures from ip went without one before it. It also returns the addresses
+// that went quiet with failures still uncounted, and their counts, so they
+// can be written as summaries.
+func (t *authFailureThrottle) admit(ip string) (logged bool, suppressed int, quiet map[string]int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	// Sweep after counting this failure so ip's own count goes into its entry
+	defer func() { quiet = t.sweep(now) }()
+
+	f, ok := t.addresses[ip]
+	if !ok {
+		t.addresses[ip] = &authFailures{loggedAt: now, lastFailure: now}
+		return true, 0, nil
+	}
+	f.lastFailure = now
+	if now.Sub(f.loggedAt) < authFailureWindow {
+		f.suppressed++
+		return false, 0, nil
+	}
+	suppressed = f.suppressed
+	f.loggedAt, f.suppressed = now, 0
+	return true, suppressed, nil
+}
+
+// sweep evicts addresses without failures in the last window, returning the
+// suppressed counts of those that had any. The caller must hold t.mu.
+func (t *authFailureThrottle) sweep(now time.Time) map[string]int {
+	if now.Sub(t.lastSweep) < authFailureWindow {
+		return nil
+	}
+	t.lastSweep = now
+
+	var quiet map[string]int
+	for ip, f := range t.addresses {
+		if now.Sub(f.lastFailure) < authFailureWindow {
+			continue
+		}
+		if f.suppressed > 0 {
+			if quiet == nil {
+				quiet = make(map[string]int)
+			}
+			quiet[ip] = f.suppressed
+		}
+		delete(t.addresses, ip)
+	}
+	return quiet
+}
+
+// recordAudit queues an audit event for the request's client
+func (am *AuthManager) recordAudit(r *http.Request, userID int64, action, detail string) {
+	am.audit.record(auditRecord{
+		userID: userID,
+		action: action,
+		ip:     utils.ExtractClientIP(r.RemoteAddr),
+		detail: detail,
+	})
+}
+
+// RecordAuthFailure records a request rejected for missing or invalid
+// credentials. Repeated failures from one address are aggregated, see
+// authFailureThrottle.
+func (am *AuthManager) RecordAuthFailure(r *http.Request) {
+	ip := utils.ExtractClientIP(r.RemoteAddr)
+	logged, suppressed, quiet := am.authFailures.admit(ip)
+	for quietIP, count := range quiet {
+		am.audit.record(auditRecord{action: AuditAuthFailed, ip: quietIP, detail: fmt.Sprintf("%d more failed requests", count)})
+	}
+	if !logged {
+		return
+	}
+
+	detail := r.Method + " " + r.URL.Path
+	if suppressed > 0 {
+		detail += fmt.Sprintf(" (%d more failed requests since the last entry)", suppressed)
+	}
+	am.audit.record(auditRecord{action: AuditAuthFailed, ip: ip, detail: detail})
+}
+
+// RequireAdmin is middleware that requires an authenticated admin user
+func (am *AuthManager) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := am.GetSession(r)
+		if session == nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := am.db.GetUserByID(session.UserID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if user == nil || !user.IsAdmin {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// GetAuditLog returns a page of audit events, newest first. Use with RequireAdmin.
+func (am *AuthManager) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page, limit, err := parsePageParams(query.Get("page"), query.Get("limit"), defaultAuditPageSize, maxAuditPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, total, err := am.db.GetAuditEvents(limit, (page-1)*limit)
+	if err != nil {
+		http.Error(w, "failed to get audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuditPageResponse{
+		Items: events,
+		Total: total,
+		Page:  page,
+		Limit: limit,
+	})
+}
@@ -0,0 +1,219 @@
+package identity
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// waitForAuditEvents waits for the audit goroutine to write n events
+func waitForAuditEvents(t *testing.T, db *MockDatabase, n int) []AuditEvent {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		db.auditMu.Lock()
+		events := append([]AuditEvent(nil), db.auditEvents...)
+		db.auditMu.Unlock()
+		if len(events) >= n {
+			return events
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d audit events, got %d", n, len(events))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAuditEvents(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	user := &User{Username: "admin", PasswordHash: string(passwordHash)}
+	db.CreateUser(user)
+
+	login := func(password string) *httptest.ResponseRecorder {
+		reqBody, _ := json.Marshal(LoginRequest{Username: "admin", Password: password})
+		req, _ := http.NewRequest("POST", "/v1/auth/login", bytes.NewBuffer(reqBody))
+		req.RemoteAddr = "192.0.2.1:4321"
+		rr := httptest.NewRecorder()
+		am.Login(rr, req)
+		return rr
+	}
+
+	login("wrong")
+	rr := login("password123")
+	cookie := rr.Result().Cookies()[0]
+
+	reqBody, _ := json.Marshal(CreateAPIKeyRequest{Name: "ci"})
+	req, _ := http.NewRequest("POST", "/v1/auth/api-keys", bytes.NewBuffer(reqBody))
+	req.AddCookie(cookie)
+	am.CreateAPIKey(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("POST", "/v1/auth/logout", nil)
+	req.AddCookie(cookie)
+	am.Logout(httptest.NewRecorder(), req)
+
+	events := waitForAuditEvents(t, db, 4)
+	expected := []AuditEvent{
+		{UserID: user.ID, Action: AuditLoginFailed, IP: "192.0.2.1", Detail: "wrong password"},
+		{UserID: user.ID, Action: AuditLogin, IP: "192.0.2.1"},
+		{UserID: user.ID, Action: AuditAPIKeyCreated, Detail: "ci"},
+		{UserID: user.ID, Action: AuditLogout},
+	}
+	for i, want := range expected {
+		got := events[i]
+		if got.UserID != want.UserID || got.Action != want.Action || got.Detail != want.Detail {
+			t.Errorf("event %d: expected %+v, got %+v", i, want, got)
+		}
+		if want.IP != "" && got.IP != want.IP {
+			t.Errorf("event %d: expected IP %s, got %s", i, want.IP, got.IP)
+		}
+	}
+}
+
+func TestGetAuditLog(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	admin := &User{Username: "admin", IsAdmin: true}
+	db.CreateUser(admin)
+	other := &User{Username: "other"}
+	db.CreateUser(other)
+
+	for i := 0; i < 3; i++ {
+		db.AppendAuditEvent(admin.ID, AuditLogin, "127.0.0.1", "")
+	}
+
+	sessionCookie := func(user *User) *http.Cookie {
+		token, _ := generateSessionToken()
+		db.CreateSession(&Session{Token: token, UserID: user.ID, Username: user.Username, ExpiresAt: time.Now().Add(time.Hour)})
+		return &http.Cookie{Name: sessionCookieName, Value: token}
+	}
+
+	handler := am.RequireAdmin(am.GetAuditLog)
+
+	t.Run("Admin", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/v1/admin/audit?page=2&limit=2", nil)
+		req.AddCookie(sessionCookie(admin))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rr.Code)
+		}
+		var resp AuditPageResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		if resp.Total != 3 || resp.Page != 2 || resp.Limit != 2 || len(resp.Items) != 1 {
+			t.Errorf("unexpected page: %+v", resp)
+		}
+	})
+
+	t.Run("Not Admin", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/v1/admin/audit", nil)
+		req.AddCookie(sessionCookie(other))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected 403, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/v1/admin/audit", nil)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Invalid Page", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/v1/admin/audit?page=0", nil)
+		req.AddCookie(sessionCookie(admin))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Page Too Large", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/v1/admin/audit?page=9223372036854775807", nil)
+		req.AddCookie(sessionCookie(admin))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", rr.Code)
+		}
+	})
+}
+
+func TestRecordAuthFailureThrottle(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+	now := time.Now()
+	am.authFailures.now = func() time.Time { return now }
+
+	fail := func(ip string) {
+		req, _ := http.NewRequest("GET", "/v1/models", nil)
+		req.RemoteAddr = ip + ":1234"
+		am.RecordAuthFailure(req)
+	}
+
+	for range 5 {
+		fail("192.0.2.1")
+	}
+	fail("192.0.2.2")
+	events := waitForAuditEvents(t, db, 2)
+	if events[0].IP != "192.0.2.1" || events[0].Detail != "GET /v1/models" || events[1].IP != "192.0.2.2" {
+		t.Fatalf("expected one entry per address, got %+v", events)
+	}
+
+	now = now.Add(authFailureWindow)
+	fail("192.0.2.1")
+	events = waitForAuditEvents(t, db, 3)
+	if want := "GET /v1/models (4 more failed requests since the last entry)"; events[2].Detail != want {
+		t.Errorf("expected %q, got %q", want, events[2].Detail)
+	}
+
+	// An address that goes quiet has its remaining count written as a summary
+	fail("192.0.2.1")
+	now = now.Add(2 * authFailureWindow)
+	fail("192.0.2.3")
+	events = waitForAuditEvents(t, db, 5)
+	var summary *AuditEvent
+	for i := range events[3:] {
+		if events[3+i].IP == "192.0.2.1" {
+			summary = &events[3+i]
+		}
+	}
+	if summary == nil || summary.Detail != "1 more failed requests" {
+		t.Errorf("expected a summary for the quiet address, got %+v", events[3:])
+	}
+}
+
+func TestPruneAuditLog(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	db.AppendAuditEvent(0, AuditAuthFailed, "192.0.2.1", "old")
+	db.AppendAuditEvent(0, AuditAuthFailed, "192.0.2.1", "new")
+	db.auditEvents[0].CreatedAt = time.Now().Add(-48 * time.Hour)
+
+	am.pruneAuditLogOnce(time.Now().Add(-24 * time.Hour))
+
+	events, total, _ := db.GetAuditEvents(10, 0)
+	if total != 1 || events[0].Detail != "new" {
+		t.Errorf("expected only the recent event to be kept, got %+v", events)
+	}
+}
@@ -3,29 +3,50 @@ package identity
 import (
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 )
 
 const sessionCookieName = "chat_session"
 
+// trashRetention is how long soft-deleted conversations are kept before being purged
+const trashRetention = 30 * 24 * time.Hour
+
 // AuthManager handles authentication and authorization
 type AuthManager struct {
-	db Database
+	db           Database
+	syncHub      *SyncHub
+	loginLimiter *loginLimiter
+	audit        *auditLogger
+	webhooks     *webhookDispatcher
+	titles       *titleQueue
+	authFailures *authFailureThrottle
 }
 
 // NewAuthManager creates a new AuthManager
 func NewAuthManager(database Database) *AuthManager {
 	am := &AuthManager{
-		db: database,
+		db:           database,
+		syncHub:      NewSyncHub(),
+		loginLimiter: newLoginLimiter(),
+		audit:        newAuditLogger(database),
+		webhooks:     newWebhookDispatcher(database),
+		titles:       newTitleQueue(),
+		authFailures: newAuthFailureThrottle(),
 	}
 	go am.cleanupExpiredSessions()
+	go am.purgeTrash()
+	go am.pruneAuditLog()
 	return am
 }
 
@@ -39,6 +60,44 @@ func (am *AuthManager) cleanupExpiredSessions() {
 	}
 }
 
+// purgeTrash periodically removes conversations that have been in the trash longer than trashRetention
+func (am *AuthManager) purgeTrash() {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		am.purgeTrashOnce(time.Now().Add(-trashRetention))
+	}
+}
+
+// purgeTrashOnce purges conversations trashed before olderThan and deletes
+// the attachments no other conversation references
+func (am *AuthManager) purgeTrashOnce(olderThan time.Time) {
+	purged, orphaned, err := am.db.PurgeDeletedHistory(olderThan)
+	if err != nil {
+		if globalLogger != nil {
+			globalLogger.Error("Failed to purge trashed conversations", zap.Error(err))
+		}
+		return
+	}
+	if purged > 0 && globalLogger != nil {
+		globalLogger.Info("Purged trashed conversations",
+			zap.Int64("count", purged),
+			zap.Int("attachments", len(orphaned)))
+	}
+
+	if globalAttachmentStore == nil {
+		return
+	}
+	for _, id := range orphaned {
+		if err := globalAttachmentStore.Delete(id); err != nil && globalLogger != nil {
+			globalLogger.Warn("Failed to delete unreferenced attachment",
+				zap.String("attachment_id", id),
+				zap.Error(err))
+		}
+	}
+}
+
 // generateSessionToken generates a random session token
 func generateSessionToken() (string, error) {
 	b := make([]byte, 32)
@@ -76,6 +135,14 @@ func (am *AuthManager) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	limiterKeys := loginLimiterKeys(r, req.Username)
+	if wait := am.loginLimiter.lockedFor(limiterKeys...); wait > 0 {
+		am.recordAudit(r, 0, AuditLoginFailed, "locked out: "+req.Username)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "too many failed login attempts", http.StatusTooManyRequests)
+		return
+	}
+
 	user, err := am.db.GetUserByUsername(req.Username)
 	if err != nil {
 		http.Error(w, "internal server error", http.StatusInternalServerError)
@@ -83,14 +150,20 @@ func (am *AuthManager) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if user == nil {
+		am.loginLimiter.recordFailure(limiterKeys...)
+		am.recordAudit(r, 0, AuditLoginFailed, "unknown user: "+req.Username)
 		http.Error(w, "invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		am.loginLimiter.recordFailure(limiterKeys...)
+		am.recordAudit(r, user.ID, AuditLoginFailed, "wrong password")
 		http.Error(w, "invalid credentials", http.StatusUnauthorized)
 		return
 	}
+	am.loginLimiter.recordSuccess(limiterKeys[0])
+	am.recordAudit(r, user.ID, AuditLogin, "")
 
 	token, err := generateSessionToken()
 	if err != nil {
@@ -133,6 +206,9 @@ func (am *AuthManager) Login(w http.ResponseWriter, r *http.Request) {
 func (am *AuthManager) Logout(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie(sessionCookieName)
 	if err == nil {
+		if session, _ := am.db.GetSessionByToken(cookie.Value); session != nil {
+			am.recordAudit(r, session.UserID, AuditLogout, "")
+		}
 		am.db.DeleteSession(cookie.Value)
 	}
 
@@ -202,9 +278,11 @@ func (am *AuthManager) InitialSetup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The account created by initial setup administers the instance
 	user := &User{
 		Username:     req.Username,
 		PasswordHash: string(passwordHash),
+		IsAdmin:      true,
 	}
 
 	if err := am.db.CreateUser(user); err != nil {
@@ -231,6 +309,8 @@ func (am *AuthManager) InitialSetup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	am.recordAudit(r, user.ID, AuditLogin, "initial setup")
+
 	http.SetCookie(w, &http.Cookie{
 		Name:     sessionCookieName,
 		Value:    token,
@@ -280,7 +360,8 @@ func (am *AuthManager) GetSession(r *http.Request) (*Session, bool) {
 	if apiKey != "" {
 		keyHash := hashAPIKey(apiKey)
 		key, err := am.db.GetAPIKeyByHash(keyHash)
-		if err == nil && key != nil {
+		// Re-check the stored hash in constant time rather than trusting the store's match
+		if err == nil && key != nil && subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(keyHash)) == 1 {
 			// Update last used timestamp asynchronously
 			go am.db.UpdateAPIKeyLastUsed(key.ID)
 
@@ -288,9 +369,9 @@ func (am *AuthManager) GetSession(r *http.Request) (*Session, bool) {
 			user, err := am.db.GetUserByID(key.UserID)
 			if err == nil && user != nil {
 				return &Session{
-					UserID:    key.UserID,
-					Username:  user.Username,
-					ExpiresAt: time.Now().Add(24 * time.Hour),
+					UserID:   key.UserID,
+					Username: user.Username,
+					APIKeyID: key.ID,
 				}, true
 			}
 		}
@@ -307,6 +388,11 @@ func (am *AuthManager) GetSession(r *http.Request) (*Session, bool) {
 		return nil, false
 	}
 
+	// Don't rely on every store filtering expired rows
+	if !time.Now().Before(session.ExpiresAt) {
+		return nil, false
+	}
+
 	return session, false
 }
 
@@ -322,6 +408,25 @@ func (am *AuthManager) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// RequireCookieAuth is middleware that requires a cookie session. Requests
+// authenticated with an API key are refused, so a leaked key can't be used
+// to manage keys.
+func (am *AuthManager) RequireCookieAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, isAPIKey := am.GetSession(r)
+		if session == nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if isAPIKey {
+			am.recordAudit(r, session.UserID, AuditAuthFailed, "API key used on cookie-only "+r.URL.Path)
+			http.Error(w, "this endpoint requires a login session", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
 // OptionalAuth is middleware that allows access if no users exist
 func (am *AuthManager) OptionalAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -383,6 +488,7 @@ func (am *AuthManager) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	apiKey.Key = key
+	am.recordAudit(r, session.UserID, AuditAPIKeyCreated, apiKey.Name)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -451,6 +557,7 @@ func (am *AuthManager) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "failed to delete API key", http.StatusInternalServerError)
 		return
 	}
+	am.recordAudit(r, session.UserID, AuditAPIKeyDeleted, "key id "+strconv.FormatInt(req.ID, 10))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
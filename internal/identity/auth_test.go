@@ -112,3 +112,98 @@ func TestVerifyAPIKey(t *testing.T) {
 		t.Errorf("expected username user, got %s", session.Username)
 	}
 }
+
+func TestRequireCookieAuth(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("password"), 10)
+	user := &User{Username: "user", PasswordHash: string(passwordHash)}
+	db.CreateUser(user)
+
+	rawKey, _ := generateAPIKey()
+	db.CreateAPIKey(&APIKey{UserID: user.ID, Name: "key", KeyHash: hashAPIKey(rawKey)})
+
+	token, _ := generateSessionToken()
+	db.CreateSession(&Session{Token: token, UserID: user.ID, Username: user.Username, ExpiresAt: time.Now().Add(time.Hour)})
+
+	handler := am.RequireCookieAuth(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name     string
+		setup    func(req *http.Request)
+		expected int
+	}{
+		{"Cookie", func(req *http.Request) { req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token}) }, http.StatusNoContent},
+		{"API Key Header", func(req *http.Request) { req.Header.Set("X-API-Key", rawKey) }, http.StatusForbidden},
+		{"API Key Bearer", func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+rawKey) }, http.StatusForbidden},
+		{"Unauthenticated", func(req *http.Request) {}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/v1/auth/api-keys", nil)
+			tt.setup(req)
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if rr.Code != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, rr.Code)
+			}
+		})
+	}
+}
+
+func TestGetSessionExpiry(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("password"), 10)
+	user := &User{Username: "user", PasswordHash: string(passwordHash)}
+	db.CreateUser(user)
+
+	sessionFor := func(expiresAt time.Time) *Session {
+		token, _ := generateSessionToken()
+		db.CreateSession(&Session{Token: token, UserID: user.ID, Username: user.Username, ExpiresAt: expiresAt})
+
+		req, _ := http.NewRequest("GET", "/v1/test", nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+		session, _ := am.GetSession(req)
+		return session
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		if sessionFor(time.Now().Add(time.Hour)) == nil {
+			t.Error("expected unexpired session to be accepted")
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		if sessionFor(time.Now().Add(-time.Minute)) != nil {
+			t.Error("expected expired session to be rejected")
+		}
+	})
+
+	t.Run("No Expiry", func(t *testing.T) {
+		if sessionFor(time.Time{}) != nil {
+			t.Error("expected cookie session without an expiry to be rejected")
+		}
+	})
+
+	t.Run("API Key", func(t *testing.T) {
+		rawKey, _ := generateAPIKey()
+		db.CreateAPIKey(&APIKey{UserID: user.ID, Name: "key", KeyHash: hashAPIKey(rawKey)})
+
+		req, _ := http.NewRequest("GET", "/v1/test", nil)
+		req.Header.Set("X-API-Key", rawKey)
+		session, _ := am.GetSession(req)
+		if session == nil {
+			t.Fatal("expected API key session")
+		}
+		if !session.ExpiresAt.IsZero() {
+			t.Errorf("expected API key session to have no expiry, got %v", session.ExpiresAt)
+		}
+	})
+}
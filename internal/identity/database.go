@@ -1,18 +1,28 @@
 package identity
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"net/url"
 	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"llm-router/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
 )
 
 // Database interface defines all database operations for identity management
 type Database interface {
 	Close() error
+	Ping(ctx context.Context) error
+
+	// WithTx runs fn against a Database whose operations all happen in one
+	// transaction, committed when fn returns nil and rolled back otherwise
+	WithTx(fn func(tx Database) error) error
 
 	// User operations
 	CreateUser(user *User) error
@@ -36,20 +46,69 @@ type Database interface {
 	// History operations
 	SaveHistory(userID int64, history *ConversationHistory) error
 	GetAllHistory(userID int64) ([]ConversationHistory, error)
+	GetHistoryPage(userID int64, limit, offset int) ([]HistorySummary, int, error)
 	GetHistoryByID(userID int64, conversationID string) (*ConversationHistory, error)
+	GetHistoriesByIDs(userID int64, conversationIDs []string) ([]ConversationHistory, error)
+	GetHistoryChanges(userID int64, since time.Time) ([]HistorySummary, error)
 	DeleteHistory(userID int64, conversationID string) error
 	DeleteAllHistory(userID int64) error
+	GetDeletedHistory(userID int64) ([]HistorySummary, error)
+	RestoreHistory(userID int64, conversationID string) error
+	UpdateHistoryTitle(userID int64, history *ConversationHistory, previousHash string) (bool, error)
+	PurgeDeletedHistory(olderThan time.Time) (int64, []string, error)
+	ImportHistories(userID int64, histories []ConversationHistory, onConflict string) (*HistoryImportResult, error)
+
+	// Attachment operations
+	AddAttachmentRefs(userID int64, conversationID string, attachmentIDs []string) error
+	AddAttachmentUsage(userID int64, attachmentID string, size int64) error
+
+	// Storage operations
+	GetStorageUsage(userID int64) (*StorageUsage, error)
+	SetStorageQuota(userID int64, quota *int64) error
 
 	// Config operations
 	GetUserConfig(userID int64) (*UserConfig, error)
 	UpdateUserConfig(config *UserConfig) error
+
+	// Audit operations
+	AppendAuditEvent(userID int64, action, ip, detail string) error
+	GetAuditEvents(limit, offset int) ([]AuditEvent, int, error)
+	PruneAuditEvents(olderThan time.Time) (int64, error)
+
+	// Webhook operations
+	AddWebhookDeadLetter(letter *WebhookDeadLetter) error
 }
 
 // PostgresDB implements the Database interface using PostgreSQL
 type PostgresDB struct {
-	db *sql.DB
+	db   *sql.DB
+	conn querier // db, or tx for a PostgresDB handed to a WithTx callback
+	tx   *sql.Tx
+}
+
+// querier runs statements on a connection pool or in a transaction
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// txConn is a transaction as the operations that need one see it
+type txConn interface {
+	querier
+	Commit() error
+	Rollback() error
 }
 
+// joinedTx is a WithTx transaction used by an operation that needs its own.
+// The operation's work commits or rolls back with the rest of WithTx's.
+type joinedTx struct {
+	*sql.Tx
+}
+
+func (joinedTx) Commit() error   { return nil }
+func (joinedTx) Rollback() error { return nil }
+
 // normalizeConnString normalizes the connection string and disables SSL by default
 // if sslmode is not explicitly specified
 func normalizeConnString(connString string) string {
@@ -82,26 +141,74 @@ func normalizeConnString(connString string) string {
 	return connString
 }
 
-// NewPostgresDB creates a new PostgreSQL database connection
-func NewPostgresDB(connString string) (*PostgresDB, error) {
+// connectPingTimeout bounds each ping while waiting for the database, so an
+// unreachable host counts as a failed attempt rather than hanging startup
+const connectPingTimeout = 5 * time.Second
+
+// ConnectRetry bounds how long NewPostgresDB waits for the database to come up.
+// The wait between attempts starts at Interval and doubles up to MaxInterval.
+type ConnectRetry struct {
+	Attempts    int
+	Interval    time.Duration
+	MaxInterval time.Duration
+}
+
+// retryConnect calls connect until it succeeds or the retry's attempts run
+// out, logging each failure, and returns the last error
+func retryConnect(retry ConnectRetry, logger *zap.Logger, connect func() error) error {
+	attempts := max(retry.Attempts, 1)
+	wait := retry.Interval
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = connect(); err == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			return err
+		}
+		logger.Warn("Database not reachable, retrying",
+			zap.Int("attempt", attempt),
+			zap.Int("attempts", attempts),
+			zap.Duration("retry_in", wait),
+			zap.Error(err))
+		time.Sleep(wait)
+		wait = min(wait*2, max(retry.MaxInterval, retry.Interval))
+	}
+}
+
+// NewPostgresDB creates a new PostgreSQL database connection, waiting for the
+// database to accept connections as allowed by retry
+func NewPostgresDB(connString string, pool model.DatabasePool, retry ConnectRetry, logger *zap.Logger) (*PostgresDB, error) {
 	normalizedConnString := normalizeConnString(connString)
 	db, err := sql.Open("postgres", normalizedConnString)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open postgres connection: %w", err)
 	}
 
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(2)
-	db.SetConnMaxLifetime(5 * time.Minute)
-	db.SetConnMaxIdleTime(2 * time.Minute)
-
-	if err := db.Ping(); err != nil {
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+	logger.Info("Database connection pool configured",
+		zap.Int("max_open_conns", pool.MaxOpenConns),
+		zap.Int("max_idle_conns", pool.MaxIdleConns),
+		zap.Duration("conn_max_lifetime", pool.ConnMaxLifetime),
+		zap.Duration("conn_max_idle_time", pool.ConnMaxIdleTime))
+
+	err = retryConnect(retry, logger, func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), connectPingTimeout)
+		defer cancel()
+		return db.PingContext(ctx)
+	})
+	if err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping postgres: %w", err)
 	}
 
-	d := &PostgresDB{db: db}
-	if err := d.initSchema(); err != nil {
-		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	d := &PostgresDB{db: db, conn: db}
+	if err := d.migrate(logger); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
 	}
 
 	return d, nil
@@ -112,90 +219,60 @@ func (d *PostgresDB) Close() error {
 	return d.db.Close()
 }
 
-// initSchema initializes the database schema
-func (d *PostgresDB) initSchema() error {
-	schema := `
-	-- Users table
-	CREATE TABLE IF NOT EXISTS users (
-		id BIGSERIAL PRIMARY KEY,
-		username TEXT NOT NULL UNIQUE,
-		password_hash TEXT NOT NULL,
-		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
-	);
-
-	-- API Keys table
-	CREATE TABLE IF NOT EXISTS api_keys (
-		id BIGSERIAL PRIMARY KEY,
-		user_id BIGINT NOT NULL,
-		name TEXT NOT NULL,
-		key_hash TEXT NOT NULL UNIQUE,
-		last_used_at TIMESTAMP WITH TIME ZONE,
-		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-
-	-- Sessions table
-	CREATE TABLE IF NOT EXISTS sessions (
-		id BIGSERIAL PRIMARY KEY,
-		token TEXT NOT NULL UNIQUE,
-		user_id BIGINT NOT NULL,
-		username TEXT NOT NULL,
-		expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
-		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-	CREATE INDEX IF NOT EXISTS idx_sessions_token ON sessions(token);
-	CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
-
-	-- Conversation Histories table
-	CREATE TABLE IF NOT EXISTS conversation_histories (
-		id BIGSERIAL PRIMARY KEY,
-		user_id BIGINT NOT NULL,
-		conversation_id TEXT NOT NULL,
-		version BIGINT NOT NULL DEFAULT 1,
-		hash TEXT NOT NULL DEFAULT '',
-		title TEXT NOT NULL,
-		data JSONB NOT NULL,
-		updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-		UNIQUE(user_id, conversation_id)
-	);
-	CREATE INDEX IF NOT EXISTS idx_conversation_histories_user_id ON conversation_histories(user_id);
-	CREATE INDEX IF NOT EXISTS idx_conversation_histories_updated_at ON conversation_histories(updated_at);
-	
-	-- User Configs table
-	CREATE TABLE IF NOT EXISTS user_configs (
-		user_id BIGINT PRIMARY KEY,
-		default_model TEXT NOT NULL DEFAULT '',
-		data JSONB,
-		updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-	`
-
-	_, err := d.db.Exec(schema)
-	return err
+// Ping checks that the database can still be reached
+func (d *PostgresDB) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
+// WithTx runs fn in a transaction. Called within fn, it joins the
+// transaction already in progress.
+func (d *PostgresDB) WithTx(fn func(tx Database) error) error {
+	if d.tx != nil {
+		return fn(d)
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(&PostgresDB{db: d.db, conn: tx, tx: tx}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// begin starts a transaction for an operation that needs one, joining the
+// WithTx transaction when there is one
+func (d *PostgresDB) begin() (txConn, error) {
+	if d.tx != nil {
+		return joinedTx{d.tx}, nil
+	}
+	return d.db.Begin()
 }
 
 // User operations
 
 func (d *PostgresDB) CreateUser(user *User) error {
-	err := d.db.QueryRow(`
-		INSERT INTO users (username, password_hash)
-		VALUES ($1, $2)
+	err := d.conn.QueryRow(`
+		INSERT INTO users (username, password_hash, is_admin)
+		VALUES ($1, $2, $3)
 		RETURNING id, created_at
-	`, user.Username, user.PasswordHash).Scan(&user.ID, &user.CreatedAt)
+	`, user.Username, user.PasswordHash, user.IsAdmin).Scan(&user.ID, &user.CreatedAt)
 	return err
 }
 
 func (d *PostgresDB) GetUserByUsername(username string) (*User, error) {
 	var user User
-	err := d.db.QueryRow(`
-		SELECT id, username, password_hash, created_at
+	err := d.conn.QueryRow(`
+		SELECT id, username, password_hash, is_admin, created_at
 		FROM users
 		WHERE username = $1
-	`, username).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt)
+	`, username).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.CreatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -208,11 +285,11 @@ func (d *PostgresDB) GetUserByUsername(username string) (*User, error) {
 
 func (d *PostgresDB) GetUserByID(id int64) (*User, error) {
 	var user User
-	err := d.db.QueryRow(`
-		SELECT id, username, password_hash, created_at
+	err := d.conn.QueryRow(`
+		SELECT id, username, password_hash, is_admin, created_at
 		FROM users
 		WHERE id = $1
-	`, id).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt)
+	`, id).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.CreatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -225,7 +302,7 @@ func (d *PostgresDB) GetUserByID(id int64) (*User, error) {
 
 func (d *PostgresDB) HasUsers() (bool, error) {
 	var count int
-	err := d.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+	err := d.conn.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
 	if err != nil {
 		return false, err
 	}
@@ -235,7 +312,7 @@ func (d *PostgresDB) HasUsers() (bool, error) {
 // Session operations
 
 func (d *PostgresDB) CreateSession(session *Session) error {
-	err := d.db.QueryRow(`
+	err := d.conn.QueryRow(`
 		INSERT INTO sessions (token, user_id, username, expires_at)
 		VALUES ($1, $2, $3, $4)
 		RETURNING id, created_at
@@ -245,7 +322,7 @@ func (d *PostgresDB) CreateSession(session *Session) error {
 
 func (d *PostgresDB) GetSessionByToken(token string) (*Session, error) {
 	var session Session
-	err := d.db.QueryRow(`
+	err := d.conn.QueryRow(`
 		SELECT id, token, user_id, username, expires_at, created_at
 		FROM sessions
 		WHERE token = $1 AND expires_at > NOW()
@@ -261,19 +338,19 @@ func (d *PostgresDB) GetSessionByToken(token string) (*Session, error) {
 }
 
 func (d *PostgresDB) DeleteSession(token string) error {
-	_, err := d.db.Exec("DELETE FROM sessions WHERE token = $1", token)
+	_, err := d.conn.Exec("DELETE FROM sessions WHERE token = $1", token)
 	return err
 }
 
 func (d *PostgresDB) DeleteExpiredSessions() error {
-	_, err := d.db.Exec("DELETE FROM sessions WHERE expires_at < NOW()")
+	_, err := d.conn.Exec("DELETE FROM sessions WHERE expires_at < NOW()")
 	return err
 }
 
 // API Key operations
 
 func (d *PostgresDB) CreateAPIKey(key *APIKey) error {
-	err := d.db.QueryRow(`
+	err := d.conn.QueryRow(`
 		INSERT INTO api_keys (user_id, name, key_hash)
 		VALUES ($1, $2, $3)
 		RETURNING id, created_at
@@ -283,7 +360,7 @@ func (d *PostgresDB) CreateAPIKey(key *APIKey) error {
 
 func (d *PostgresDB) GetAPIKeyByHash(hash string) (*APIKey, error) {
 	var key APIKey
-	err := d.db.QueryRow(`
+	err := d.conn.QueryRow(`
 		SELECT id, user_id, name, key_hash, last_used_at, created_at
 		FROM api_keys
 		WHERE key_hash = $1
@@ -299,7 +376,7 @@ func (d *PostgresDB) GetAPIKeyByHash(hash string) (*APIKey, error) {
 }
 
 func (d *PostgresDB) GetAPIKeysByUserID(userID int64) ([]APIKey, error) {
-	rows, err := d.db.Query(`
+	rows, err := d.conn.Query(`
 		SELECT id, user_id, name, key_hash, last_used_at, created_at
 		FROM api_keys
 		WHERE user_id = $1
@@ -323,31 +400,42 @@ func (d *PostgresDB) GetAPIKeysByUserID(userID int64) ([]APIKey, error) {
 }
 
 func (d *PostgresDB) DeleteAPIKey(id int64) error {
-	_, err := d.db.Exec("DELETE FROM api_keys WHERE id = $1", id)
+	_, err := d.conn.Exec("DELETE FROM api_keys WHERE id = $1", id)
 	return err
 }
 
 func (d *PostgresDB) UpdateAPIKeyLastUsed(id int64) error {
-	_, err := d.db.Exec("UPDATE api_keys SET last_used_at = NOW() WHERE id = $1", id)
+	_, err := d.conn.Exec("UPDATE api_keys SET last_used_at = NOW() WHERE id = $1", id)
 	return err
 }
 
 // History operations
 
+// SaveHistory stores a conversation. Versions are assigned here, not taken
+// from the client: a new conversation is stored as version 1, and each save
+// that changes its title or data increments the version by one. Saving
+// unchanged content keeps the version and updated_at. history is updated
+// with what was stored.
 func (d *PostgresDB) SaveHistory(userID int64, history *ConversationHistory) error {
+	// The stored hash is always computed server-side so clients can't desync it
+	history.Hash = ComputeHistoryHash(history)
+
 	// Upsert: insert or update if exists
-	err := d.db.QueryRow(`
+	err := d.conn.QueryRow(`
 		INSERT INTO conversation_histories (user_id, conversation_id, version, hash, title, data, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		VALUES ($1, $2, 1, $3, $4, $5, NOW())
 		ON CONFLICT (user_id, conversation_id)
 		DO UPDATE SET
-			version = conversation_histories.version + 1,
+			version = CASE WHEN conversation_histories.hash = EXCLUDED.hash AND conversation_histories.deleted_at IS NULL
+				THEN conversation_histories.version ELSE conversation_histories.version + 1 END,
 			hash = EXCLUDED.hash,
 			title = EXCLUDED.title,
 			data = EXCLUDED.data,
-			updated_at = NOW()
+			updated_at = CASE WHEN conversation_histories.hash = EXCLUDED.hash AND conversation_histories.deleted_at IS NULL
+				THEN conversation_histories.updated_at ELSE NOW() END,
+			deleted_at = NULL
 		RETURNING id, version, hash, created_at, updated_at
-	`, userID, history.ConversationID, history.Version, history.Hash, history.Title, history.Data).Scan(
+	`, userID, history.ConversationID, history.Hash, history.Title, history.Data).Scan(
 		&history.ID, &history.Version, &history.Hash, &history.CreatedAt, &history.UpdatedAt)
 
 	if err != nil {
@@ -359,10 +447,10 @@ func (d *PostgresDB) SaveHistory(userID int64, history *ConversationHistory) err
 }
 
 func (d *PostgresDB) GetAllHistory(userID int64) ([]ConversationHistory, error) {
-	rows, err := d.db.Query(`
+	rows, err := d.conn.Query(`
 		SELECT id, user_id, conversation_id, version, hash, title, data, updated_at, created_at
 		FROM conversation_histories
-		WHERE user_id = $1
+		WHERE user_id = $1 AND deleted_at IS NULL
 		ORDER BY updated_at DESC
 	`, userID)
 	if err != nil {
@@ -390,12 +478,49 @@ func (d *PostgresDB) GetAllHistory(userID int64) ([]ConversationHistory, error)
 	return histories, nil
 }
 
+// GetHistoryPage returns one page of conversation metadata (without the data column) and the total count
+func (d *PostgresDB) GetHistoryPage(userID int64, limit, offset int) ([]HistorySummary, int, error) {
+	var total int
+	if err := d.conn.QueryRow(`
+		SELECT COUNT(*) FROM conversation_histories WHERE user_id = $1 AND deleted_at IS NULL
+	`, userID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count history: %w", err)
+	}
+
+	rows, err := d.conn.Query(`
+		SELECT conversation_id, title, version, hash, updated_at
+		FROM conversation_histories
+		WHERE user_id = $1 AND deleted_at IS NULL
+		ORDER BY updated_at DESC
+		LIMIT $2 OFFSET $3
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get history page: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := []HistorySummary{}
+	for rows.Next() {
+		var s HistorySummary
+		if err := rows.Scan(&s.ConversationID, &s.Title, &s.Version, &s.Hash, &s.UpdatedAt); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan history summary: %w", err)
+		}
+		summaries = append(summaries, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating history rows: %w", err)
+	}
+
+	return summaries, total, nil
+}
+
 func (d *PostgresDB) GetHistoryByID(userID int64, conversationID string) (*ConversationHistory, error) {
 	var h ConversationHistory
-	err := d.db.QueryRow(`
+	err := d.conn.QueryRow(`
 		SELECT id, user_id, conversation_id, version, hash, title, data, updated_at, created_at
 		FROM conversation_histories
-		WHERE user_id = $1 AND conversation_id = $2
+		WHERE user_id = $1 AND conversation_id = $2 AND deleted_at IS NULL
 	`, userID, conversationID).Scan(&h.ID, &h.UserID, &h.ConversationID, &h.Version, &h.Hash, &h.Title, &h.Data, &h.UpdatedAt, &h.CreatedAt)
 
 	if err == sql.ErrNoRows {
@@ -408,8 +533,76 @@ func (d *PostgresDB) GetHistoryByID(userID int64, conversationID string) (*Conve
 	return &h, nil
 }
 
+// GetHistoriesByIDs fetches several conversations in one query, most recently
+// updated first. IDs that don't exist or are in the trash are left out.
+func (d *PostgresDB) GetHistoriesByIDs(userID int64, conversationIDs []string) ([]ConversationHistory, error) {
+	histories := []ConversationHistory{}
+	if len(conversationIDs) == 0 {
+		return histories, nil
+	}
+
+	rows, err := d.conn.Query(`
+		SELECT id, user_id, conversation_id, version, hash, title, data, updated_at, created_at
+		FROM conversation_histories
+		WHERE user_id = $1 AND conversation_id = ANY($2) AND deleted_at IS NULL
+		ORDER BY updated_at DESC
+	`, userID, pq.Array(conversationIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get histories by id: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h ConversationHistory
+		if err := rows.Scan(&h.ID, &h.UserID, &h.ConversationID, &h.Version, &h.Hash, &h.Title, &h.Data, &h.UpdatedAt, &h.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan history: %w", err)
+		}
+		histories = append(histories, h)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating history rows: %w", err)
+	}
+
+	return histories, nil
+}
+
+// GetHistoryChanges returns the conversations saved, trashed or restored after
+// since, including those now in the trash, oldest change first
+func (d *PostgresDB) GetHistoryChanges(userID int64, since time.Time) ([]HistorySummary, error) {
+	rows, err := d.conn.Query(`
+		SELECT conversation_id, title, version, hash, updated_at, deleted_at
+		FROM conversation_histories
+		WHERE user_id = $1 AND updated_at > $2
+		ORDER BY updated_at
+	`, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history changes: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := []HistorySummary{}
+	for rows.Next() {
+		var s HistorySummary
+		if err := rows.Scan(&s.ConversationID, &s.Title, &s.Version, &s.Hash, &s.UpdatedAt, &s.DeletedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan history change: %w", err)
+		}
+		summaries = append(summaries, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating history change rows: %w", err)
+	}
+
+	return summaries, nil
+}
+
+// DeleteHistory moves a conversation to the trash; it can be restored until purged
 func (d *PostgresDB) DeleteHistory(userID int64, conversationID string) error {
-	result, err := d.db.Exec("DELETE FROM conversation_histories WHERE user_id = $1 AND conversation_id = $2", userID, conversationID)
+	result, err := d.conn.Exec(`
+		UPDATE conversation_histories SET deleted_at = NOW(), updated_at = NOW()
+		WHERE user_id = $1 AND conversation_id = $2 AND deleted_at IS NULL
+	`, userID, conversationID)
 	if err != nil {
 		return fmt.Errorf("failed to delete history: %w", err)
 	}
@@ -427,18 +620,292 @@ func (d *PostgresDB) DeleteHistory(userID int64, conversationID string) error {
 }
 
 func (d *PostgresDB) DeleteAllHistory(userID int64) error {
-	_, err := d.db.Exec("DELETE FROM conversation_histories WHERE user_id = $1", userID)
+	_, err := d.conn.Exec(`
+		UPDATE conversation_histories SET deleted_at = NOW(), updated_at = NOW()
+		WHERE user_id = $1 AND deleted_at IS NULL
+	`, userID)
 	if err != nil {
 		return fmt.Errorf("failed to delete all history: %w", err)
 	}
 	return nil
 }
 
+// GetDeletedHistory lists the conversations currently in the user's trash
+func (d *PostgresDB) GetDeletedHistory(userID int64) ([]HistorySummary, error) {
+	rows, err := d.conn.Query(`
+		SELECT conversation_id, title, version, hash, updated_at, deleted_at
+		FROM conversation_histories
+		WHERE user_id = $1 AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deleted history: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := []HistorySummary{}
+	for rows.Next() {
+		var s HistorySummary
+		if err := rows.Scan(&s.ConversationID, &s.Title, &s.Version, &s.Hash, &s.UpdatedAt, &s.DeletedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan deleted history: %w", err)
+		}
+		summaries = append(summaries, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating deleted history rows: %w", err)
+	}
+
+	return summaries, nil
+}
+
+// UpdateHistoryTitle stores history's title and hash as a new version, as
+// long as the conversation is still stored with previousHash and isn't
+// trashed. It reports false when the conversation changed in the meantime.
+// history is updated with the stored version and update time.
+func (d *PostgresDB) UpdateHistoryTitle(userID int64, history *ConversationHistory, previousHash string) (bool, error) {
+	err := d.conn.QueryRow(`
+		UPDATE conversation_histories
+		SET title = $3, hash = $4, version = version + 1, updated_at = NOW()
+		WHERE user_id = $1 AND conversation_id = $2 AND hash = $5 AND deleted_at IS NULL
+		RETURNING version, updated_at
+	`, userID, history.ConversationID, history.Title, history.Hash, previousHash).Scan(&history.Version, &history.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update history title: %w", err)
+	}
+	return true, nil
+}
+
+// RestoreHistory moves a conversation out of the trash
+func (d *PostgresDB) RestoreHistory(userID int64, conversationID string) error {
+	result, err := d.conn.Exec(`
+		UPDATE conversation_histories SET deleted_at = NULL, updated_at = NOW()
+		WHERE user_id = $1 AND conversation_id = $2 AND deleted_at IS NOT NULL
+	`, userID, conversationID)
+	if err != nil {
+		return fmt.Errorf("failed to restore history: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("conversation not found in trash")
+	}
+
+	return nil
+}
+
+// PurgeDeletedHistory permanently removes conversations trashed before olderThan.
+// It returns the number of conversations removed and the IDs of attachments
+// that are no longer referenced by any conversation.
+func (d *PostgresDB) PurgeDeletedHistory(olderThan time.Time) (int64, []string, error) {
+	tx, err := d.begin()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to begin purge transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var purged int64
+	var released []string
+	err = tx.QueryRow(`
+		WITH purged AS (
+			DELETE FROM conversation_histories
+			WHERE deleted_at IS NOT NULL AND deleted_at < $1
+			RETURNING user_id, conversation_id
+		), released AS (
+			DELETE FROM attachment_refs r USING purged p
+			WHERE r.user_id = p.user_id AND r.conversation_id = p.conversation_id
+			RETURNING r.attachment_id
+		)
+		SELECT (SELECT COUNT(*) FROM purged), ARRAY(SELECT DISTINCT attachment_id FROM released)
+	`, olderThan).Scan(&purged, pq.Array(&released))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to purge deleted history: %w", err)
+	}
+
+	// The same attachment can appear in several conversations; only report those now unused
+	rows, err := tx.Query(`
+		SELECT id FROM unnest($1::text[]) AS id
+		WHERE NOT EXISTS (SELECT 1 FROM attachment_refs WHERE attachment_id = id)
+	`, pq.Array(released))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to find unreferenced attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var orphaned []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return 0, nil, fmt.Errorf("failed to scan attachment id: %w", err)
+		}
+		orphaned = append(orphaned, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, fmt.Errorf("failed to find unreferenced attachments: %w", err)
+	}
+	rows.Close()
+
+	// Attachments about to be deleted stop counting towards their owners' storage
+	if _, err := tx.Exec(`DELETE FROM attachment_usage WHERE attachment_id = ANY($1)`, pq.Array(orphaned)); err != nil {
+		return 0, nil, fmt.Errorf("failed to release attachment usage: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, fmt.Errorf("failed to commit purge transaction: %w", err)
+	}
+	return purged, orphaned, nil
+}
+
+// Attachment operations
+
+// AddAttachmentRefs records that a conversation references the given attachments
+func (d *PostgresDB) AddAttachmentRefs(userID int64, conversationID string, attachmentIDs []string) error {
+	if len(attachmentIDs) == 0 {
+		return nil
+	}
+	_, err := d.conn.Exec(`
+		INSERT INTO attachment_refs (user_id, conversation_id, attachment_id)
+		SELECT $1, $2, unnest($3::text[])
+		ON CONFLICT DO NOTHING
+	`, userID, conversationID, pq.Array(attachmentIDs))
+	if err != nil {
+		return fmt.Errorf("failed to add attachment references: %w", err)
+	}
+	return nil
+}
+
+// AddAttachmentUsage counts an attachment's size towards a user's storage.
+// An attachment the user already stored isn't counted twice.
+func (d *PostgresDB) AddAttachmentUsage(userID int64, attachmentID string, size int64) error {
+	_, err := d.conn.Exec(`
+		INSERT INTO attachment_usage (user_id, attachment_id, size)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`, userID, attachmentID, size)
+	if err != nil {
+		return fmt.Errorf("failed to record attachment usage: %w", err)
+	}
+	return nil
+}
+
+// Storage operations
+
+// GetStorageUsage returns the bytes a user stores and their quota override.
+// Trashed conversations count until they are purged.
+func (d *PostgresDB) GetStorageUsage(userID int64) (*StorageUsage, error) {
+	var usage StorageUsage
+	var quota sql.NullInt64
+	err := d.conn.QueryRow(`
+		SELECT
+			(SELECT COALESCE(SUM(octet_length(data::text)), 0) FROM conversation_histories WHERE user_id = $1),
+			(SELECT COALESCE(SUM(size), 0) FROM attachment_usage WHERE user_id = $1),
+			(SELECT storage_quota FROM users WHERE id = $1)
+	`, userID).Scan(&usage.ConversationBytes, &usage.AttachmentBytes, &quota)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage usage: %w", err)
+	}
+	if quota.Valid {
+		usage.QuotaOverride = &quota.Int64
+	}
+	return &usage, nil
+}
+
+// SetStorageQuota sets a user's own storage quota in bytes, or clears it
+// when quota is nil so the configured default applies
+func (d *PostgresDB) SetStorageQuota(userID int64, quota *int64) error {
+	_, err := d.conn.Exec(`UPDATE users SET storage_quota = $2 WHERE id = $1`, userID, quota)
+	if err != nil {
+		return fmt.Errorf("failed to set storage quota: %w", err)
+	}
+	return nil
+}
+
+// ImportHistories inserts a batch of conversations in a single transaction.
+// onConflict controls what happens when a conversation ID already exists:
+// ImportConflictRename (default) assigns a new ID, ImportConflictSkip leaves
+// the existing row untouched and ImportConflictOverwrite replaces it.
+// Versions are assigned here as in SaveHistory: imported conversations start
+// at version 1 and an overwritten one moves to its next version. updated_at
+// is the import time, not the client's, so incremental syncs on other devices
+// pick the conversations up. A trashed
+// conversation doesn't count as existing: importing its ID replaces and
+// restores it whatever onConflict is.
+func (d *PostgresDB) ImportHistories(userID int64, histories []ConversationHistory, onConflict string) (*HistoryImportResult, error) {
+	tx, err := d.begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin import transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result := &HistoryImportResult{Renamed: make(map[string]string)}
+
+	for i := range histories {
+		h := &histories[i]
+
+		var exists bool
+		if err := tx.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM conversation_histories WHERE user_id = $1 AND conversation_id = $2 AND deleted_at IS NULL)
+		`, userID, h.ConversationID).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("failed to check existing history: %w", err)
+		}
+
+		if exists {
+			switch onConflict {
+			case ImportConflictSkip:
+				result.Skipped++
+				continue
+			case ImportConflictOverwrite:
+				// Upsert below replaces the existing row
+			default:
+				newID := uuid.New().String()
+				result.Renamed[h.ConversationID] = newID
+				h.ConversationID = newID
+			}
+		}
+
+		h.Hash = ComputeHistoryHash(h)
+		err := tx.QueryRow(`
+			INSERT INTO conversation_histories (user_id, conversation_id, version, hash, title, data, updated_at)
+			VALUES ($1, $2, 1, $3, $4, $5, NOW())
+			ON CONFLICT (user_id, conversation_id)
+			DO UPDATE SET
+				version = conversation_histories.version + 1,
+				hash = EXCLUDED.hash,
+				title = EXCLUDED.title,
+				data = EXCLUDED.data,
+				updated_at = NOW(),
+				deleted_at = NULL
+			RETURNING id, version, created_at, updated_at
+		`, userID, h.ConversationID, h.Hash, h.Title, h.Data).Scan(
+			&h.ID, &h.Version, &h.CreatedAt, &h.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import history %s: %w", h.ConversationID, err)
+		}
+
+		h.UserID = userID
+		result.Imported++
+		result.Conversations = append(result.Conversations, *h)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit import transaction: %w", err)
+	}
+
+	return result, nil
+}
+
 // Config operations
 
 func (d *PostgresDB) GetUserConfig(userID int64) (*UserConfig, error) {
 	var config UserConfig
-	err := d.db.QueryRow(`
+	err := d.conn.QueryRow(`
 		SELECT user_id, default_model, COALESCE(data, '{}'::jsonb)
 		FROM user_configs
 		WHERE user_id = $1
@@ -461,7 +928,7 @@ func (d *PostgresDB) UpdateUserConfig(config *UserConfig) error {
 		data = config.Data
 	}
 
-	_, err := d.db.Exec(`
+	_, err := d.conn.Exec(`
 		INSERT INTO user_configs (user_id, default_model, data, updated_at)
 		VALUES ($1, $2, $3, NOW())
 		ON CONFLICT (user_id)
@@ -477,3 +944,78 @@ func (d *PostgresDB) UpdateUserConfig(config *UserConfig) error {
 
 	return nil
 }
+
+// Audit operations
+
+// AppendAuditEvent records an authentication event. A zero userID is stored as NULL.
+func (d *PostgresDB) AppendAuditEvent(userID int64, action, ip, detail string) error {
+	var user sql.NullInt64
+	if userID != 0 {
+		user = sql.NullInt64{Int64: userID, Valid: true}
+	}
+	_, err := d.conn.Exec(`
+		INSERT INTO audit_log (user_id, action, ip, detail)
+		VALUES ($1, $2, $3, $4)
+	`, user, action, ip, detail)
+	return err
+}
+
+// GetAuditEvents returns one page of audit events, newest first, and the total count
+func (d *PostgresDB) GetAuditEvents(limit, offset int) ([]AuditEvent, int, error) {
+	var total int
+	if err := d.conn.QueryRow("SELECT COUNT(*) FROM audit_log").Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit events: %w", err)
+	}
+
+	rows, err := d.conn.Query(`
+		SELECT id, user_id, action, ip, detail, created_at
+		FROM audit_log
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []AuditEvent{}
+	for rows.Next() {
+		var e AuditEvent
+		var user sql.NullInt64
+		if err := rows.Scan(&e.ID, &user, &e.Action, &e.IP, &e.Detail, &e.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		e.UserID = user.Int64
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating audit rows: %w", err)
+	}
+
+	return events, total, nil
+}
+
+// PruneAuditEvents deletes audit events recorded before olderThan and returns how many were removed
+func (d *PostgresDB) PruneAuditEvents(olderThan time.Time) (int64, error) {
+	result, err := d.conn.Exec("DELETE FROM audit_log WHERE created_at < $1", olderThan)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune audit events: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// Webhook operations
+
+// AddWebhookDeadLetter stores an event that could not be delivered
+func (d *PostgresDB) AddWebhookDeadLetter(letter *WebhookDeadLetter) error {
+	err := d.conn.QueryRow(`
+		INSERT INTO webhook_dead_letters (delivery_id, url, event, payload, attempts, last_error)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, letter.DeliveryID, letter.URL, letter.Event, []byte(letter.Payload), letter.Attempts, letter.LastError).Scan(&letter.ID, &letter.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add webhook dead letter: %w", err)
+	}
+	return nil
+}
@@ -1,7 +1,11 @@
 package identity
 
 import (
+	"errors"
 	"testing"
+	"time"
+
+	"go.uber.org/zap"
 )
 
 func TestNormalizeConnString(t *testing.T) {
@@ -40,3 +44,49 @@ func TestNormalizeConnString(t *testing.T) {
 		})
 	}
 }
+
+func TestRetryConnect(t *testing.T) {
+	retry := ConnectRetry{Attempts: 4, Interval: time.Millisecond, MaxInterval: 2 * time.Millisecond}
+
+	t.Run("Succeeds After Failures", func(t *testing.T) {
+		calls := 0
+		err := retryConnect(retry, zap.NewNop(), func() error {
+			calls++
+			if calls < 3 {
+				return errors.New("connection refused")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("expected success, got %v", err)
+		}
+		if calls != 3 {
+			t.Errorf("expected 3 attempts, got %d", calls)
+		}
+	})
+
+	t.Run("Gives Up After Attempts", func(t *testing.T) {
+		calls := 0
+		err := retryConnect(retry, zap.NewNop(), func() error {
+			calls++
+			return errors.New("connection refused")
+		})
+		if err == nil || err.Error() != "connection refused" {
+			t.Fatalf("expected the last error, got %v", err)
+		}
+		if calls != 4 {
+			t.Errorf("expected 4 attempts, got %d", calls)
+		}
+	})
+
+	t.Run("Tries At Least Once", func(t *testing.T) {
+		calls := 0
+		retryConnect(ConnectRetry{}, zap.NewNop(), func() error {
+			calls++
+			return errors.New("connection refused")
+		})
+		if calls != 1 {
+			t.Errorf("expected 1 attempt, got %d", calls)
+		}
+	})
+}
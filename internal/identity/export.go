@@ -0,0 +1,93 @@
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ExportUserData returns everything stored about the authenticated user as a downloadable JSON document
+func (am *AuthManager) ExportUserData(w http.ResponseWriter, r *http.Request) {
+	session, _ := am.GetSession(r)
+	if session == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := am.db.GetUserByID(session.UserID)
+	if err != nil || user == nil {
+		http.Error(w, "failed to get user", http.StatusInternalServerError)
+		return
+	}
+
+	histories, err := am.db.GetAllHistory(session.UserID)
+	if err != nil {
+		http.Error(w, "failed to get history", http.StatusInternalServerError)
+		return
+	}
+
+	keys, err := am.db.GetAPIKeysByUserID(session.UserID)
+	if err != nil {
+		http.Error(w, "failed to get API keys", http.StatusInternalServerError)
+		return
+	}
+	if keys == nil {
+		keys = []APIKey{}
+	}
+
+	config, err := am.db.GetUserConfig(session.UserID)
+	if err != nil {
+		http.Error(w, "failed to get config", http.StatusInternalServerError)
+		return
+	}
+
+	export := UserExport{
+		ExportedAt:    time.Now().UTC(),
+		User:          user,
+		Conversations: histories,
+		APIKeys:       keys,
+		Config:        config,
+		Attachments:   collectAttachmentReferences(histories),
+	}
+
+	filename := fmt.Sprintf("chat-export-%s-%s.json", user.Username, export.ExportedAt.Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if err := json.NewEncoder(w).Encode(export); err != nil && globalLogger != nil {
+		globalLogger.Error("Failed to encode user export",
+			zap.Int64("user_id", session.UserID),
+			zap.Error(err))
+	}
+}
+
+// collectAttachmentReferences lists every attachment referenced across the given conversations
+func collectAttachmentReferences(histories []ConversationHistory) []AttachmentReference {
+	refs := make([]AttachmentReference, 0)
+	index := make(map[string]int)
+
+	for _, h := range histories {
+		var data interface{}
+		if err := json.Unmarshal(h.Data, &data); err != nil {
+			continue
+		}
+
+		for _, id := range ExtractAttachmentIDs(data) {
+			i, exists := index[id]
+			if !exists {
+				i = len(refs)
+				index[id] = i
+				refs = append(refs, AttachmentReference{
+					ID:  id,
+					URL: attachmentURLPrefix + id,
+				})
+			}
+			refs[i].ConversationIDs = append(refs[i].ConversationIDs, h.ConversationID)
+		}
+	}
+
+	return refs
+}
@@ -0,0 +1,68 @@
+package identity
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportUserData(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	user := &User{Username: "testuser", PasswordHash: "secret-hash"}
+	db.CreateUser(user)
+	token, _ := generateSessionToken()
+	db.CreateSession(&Session{Token: token, UserID: user.ID, Username: user.Username, ExpiresAt: time.Now().Add(time.Hour)})
+
+	db.CreateAPIKey(&APIKey{UserID: user.ID, Name: "cli", KeyHash: "key-hash"})
+	db.SaveHistory(user.ID, &ConversationHistory{
+		ConversationID: "c1",
+		Title:          "With image",
+		Data:           json.RawMessage(`{"messages":[{"image":"/api/v1/attachments/img-1"}]}`),
+	})
+	db.SaveHistory(user.ID, &ConversationHistory{
+		ConversationID: "c2",
+		Title:          "Same image",
+		Data:           json.RawMessage(`["/api/v1/attachments/img-1"]`),
+	})
+
+	req, _ := http.NewRequest("GET", "/v1/user/me/export", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	rr := httptest.NewRecorder()
+
+	am.ExportUserData(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if !strings.HasPrefix(rr.Header().Get("Content-Disposition"), "attachment;") {
+		t.Errorf("expected attachment disposition, got %q", rr.Header().Get("Content-Disposition"))
+	}
+	if strings.Contains(rr.Body.String(), "secret-hash") || strings.Contains(rr.Body.String(), "key-hash") {
+		t.Error("export must not contain password or API key hashes")
+	}
+
+	var export UserExport
+	if err := json.Unmarshal(rr.Body.Bytes(), &export); err != nil {
+		t.Fatalf("failed to decode export: %v", err)
+	}
+	if export.User == nil || export.User.Username != "testuser" {
+		t.Errorf("expected user testuser, got %+v", export.User)
+	}
+	if len(export.Conversations) != 2 {
+		t.Errorf("expected 2 conversations, got %d", len(export.Conversations))
+	}
+	if len(export.APIKeys) != 1 {
+		t.Errorf("expected 1 API key, got %d", len(export.APIKeys))
+	}
+	if len(export.Attachments) != 1 {
+		t.Fatalf("expected 1 attachment reference, got %d", len(export.Attachments))
+	}
+	if export.Attachments[0].ID != "img-1" || len(export.Attachments[0].ConversationIDs) != 2 {
+		t.Errorf("unexpected attachment reference: %+v", export.Attachments[0])
+	}
+}
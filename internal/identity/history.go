@@ -1,13 +1,30 @@
 package identity
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
-// GetHistory retrieves all conversation histories for the authenticated user
+const (
+	defaultHistoryPageSize = 50
+	maxHistoryPageSize     = 200
+
+	// maxPageOffset bounds how deep paged listings can go
+	maxPageOffset = 1_000_000
+)
+
+// GetHistory retrieves all conversation histories for the authenticated user.
+// When a page or limit query parameter is present, only a page of metadata is returned.
 func (am *AuthManager) GetHistory(w http.ResponseWriter, r *http.Request) {
 	session, _ := am.GetSession(r)
 	if session == nil {
@@ -15,6 +32,12 @@ func (am *AuthManager) GetHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	query := r.URL.Query()
+	if query.Has("page") || query.Has("limit") {
+		am.getHistoryPage(w, session.UserID, query.Get("page"), query.Get("limit"))
+		return
+	}
+
 	histories, err := am.db.GetAllHistory(session.UserID)
 	if err != nil {
 		http.Error(w, "failed to get history", http.StatusInternalServerError)
@@ -25,7 +48,60 @@ func (am *AuthManager) GetHistory(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(histories)
 }
 
-// SyncHistory syncs conversation histories with conflict resolution
+// getHistoryPage writes a page of conversation metadata for the user
+func (am *AuthManager) getHistoryPage(w http.ResponseWriter, userID int64, pageParam, limitParam string) {
+	page, limit, err := parsePageParams(pageParam, limitParam, defaultHistoryPageSize, maxHistoryPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, total, err := am.db.GetHistoryPage(userID, limit, (page-1)*limit)
+	if err != nil {
+		http.Error(w, "failed to get history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HistoryPageResponse{
+		Items: items,
+		Total: total,
+		Page:  page,
+		Limit: limit,
+	})
+}
+
+// parsePageParams parses 1-based page and limit query values, defaulting the
+// limit to defaultLimit and capping it at maxLimit. Pages whose offset would
+// exceed maxPageOffset are rejected so the offset can't overflow
+func parsePageParams(pageParam, limitParam string, defaultLimit, maxLimit int) (int, int, error) {
+	page := 1
+	if pageParam != "" {
+		p, err := strconv.Atoi(pageParam)
+		if err != nil || p < 1 {
+			return 0, 0, errors.New("page must be a positive integer")
+		}
+		page = p
+	}
+
+	limit := defaultLimit
+	if limitParam != "" {
+		l, err := strconv.Atoi(limitParam)
+		if err != nil || l < 1 {
+			return 0, 0, errors.New("limit must be a positive integer")
+		}
+		limit = l
+	}
+	limit = min(limit, maxLimit)
+	if page-1 > maxPageOffset/limit {
+		return 0, 0, errors.New("page is too large")
+	}
+	return page, limit, nil
+}
+
+// SyncHistory syncs conversation histories with conflict resolution. The
+// whole sync happens in one transaction, so a failure part way leaves the
+// stored histories as they were.
 func (am *AuthManager) SyncHistory(w http.ResponseWriter, r *http.Request) {
 	session, _ := am.GetSession(r)
 	if session == nil {
@@ -39,93 +115,159 @@ func (am *AuthManager) SyncHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var response HistorySyncResponse
-	response.Conversations = []ConversationHistory{}
-	response.Conflicts = []string{}
+	// Images are moved to the attachment store before the transaction starts,
+	// so it isn't held open while they are uploaded
+	for i := range req.Conversations {
+		am.processImagesBeforeSave(session.UserID, &req.Conversations[i])
+	}
 
-	// Process each conversation from the client
-	for _, clientConv := range req.Conversations {
-		// Process images in conversation data before saving
-		if err := am.processConversationImages(&clientConv); err != nil {
-			if globalLogger != nil {
-				globalLogger.Error("Failed to process conversation images",
-					zap.String("conversation_id", clientConv.ConversationID),
-					zap.Error(err))
-			}
-			// Continue with original data if image processing fails
+	var response HistorySyncResponse
+	var saved []ConversationHistory
+	err := am.db.WithTx(func(tx Database) error {
+		response = HistorySyncResponse{
+			Conversations:   []ConversationHistory{},
+			Conflicts:       []string{},
+			ConflictDetails: []ConflictDetail{},
 		}
+		saved = nil
 
-		// Get server version if it exists
-		serverConv, err := am.db.GetHistoryByID(session.UserID, clientConv.ConversationID)
+		budget, err := newStorageBudget(tx, session.UserID)
 		if err != nil {
-			http.Error(w, "failed to check server history", http.StatusInternalServerError)
-			return
+			return err
+		}
+		save := func(conv, previous *ConversationHistory) error {
+			if err := budget.save(conv, previous); err != nil {
+				return err
+			}
+			saved = append(saved, *conv)
+			return nil
 		}
 
-		var finalConv ConversationHistory
-
-		if serverConv == nil {
-			// New conversation, save it
-			finalConv = clientConv
-			if err := am.db.SaveHistory(session.UserID, &finalConv); err != nil {
-				http.Error(w, "failed to save history", http.StatusInternalServerError)
-				return
+		// Process each conversation from the client
+		for _, clientConv := range req.Conversations {
+			// Get server version if it exists
+			serverConv, err := tx.GetHistoryByID(session.UserID, clientConv.ConversationID)
+			if err != nil {
+				return fmt.Errorf("failed to check server history: %w", err)
 			}
-		} else {
-			// Conversation exists, check for conflicts
-			if clientConv.Version < serverConv.Version {
-				// Server is newer, client should update
-				finalConv = *serverConv
-			} else if clientConv.Version > serverConv.Version {
-				// Client is newer, update server
+
+			var finalConv ConversationHistory
+
+			if serverConv == nil {
+				// New conversation, save it
 				finalConv = clientConv
-				if err := am.db.SaveHistory(session.UserID, &finalConv); err != nil {
-					http.Error(w, "failed to save history", http.StatusInternalServerError)
-					return
+				if err := save(&finalConv, nil); err != nil {
+					return err
 				}
+			} else if ComputeHistoryHash(&clientConv) == serverConv.Hash {
+				// The client already has the stored content
+				finalConv = *serverConv
 			} else {
-				// Same version but different data = conflict
-				// Use last-write-wins based on UpdatedAt
-				if clientConv.UpdatedAt.After(serverConv.UpdatedAt) {
+				// Conversation exists, check for conflicts
+				if clientConv.Version < serverConv.Version {
+					// Server is newer, client should update
+					finalConv = *serverConv
+				} else if clientConv.Version > serverConv.Version {
+					// Client is newer, update server
 					finalConv = clientConv
-					if err := am.db.SaveHistory(session.UserID, &finalConv); err != nil {
-						http.Error(w, "failed to save history", http.StatusInternalServerError)
-						return
+					if err := save(&finalConv, serverConv); err != nil {
+						return err
 					}
-					response.Conflicts = append(response.Conflicts, clientConv.ConversationID)
 				} else {
-					finalConv = *serverConv
-					response.Conflicts = append(response.Conflicts, clientConv.ConversationID)
+					// Same version but different data = conflict
+					// Use last-write-wins based on UpdatedAt
+					if clientConv.UpdatedAt.After(serverConv.UpdatedAt) {
+						finalConv = clientConv
+						if err := save(&finalConv, serverConv); err != nil {
+							return err
+						}
+						response.Conflicts = append(response.Conflicts, clientConv.ConversationID)
+						response.ConflictDetails = append(response.ConflictDetails, ConflictDetail{
+							ID:     clientConv.ConversationID,
+							Winner: finalConv,
+							Loser:  *serverConv,
+						})
+					} else {
+						finalConv = *serverConv
+						response.Conflicts = append(response.Conflicts, clientConv.ConversationID)
+						response.ConflictDetails = append(response.ConflictDetails, ConflictDetail{
+							ID:     clientConv.ConversationID,
+							Winner: finalConv,
+							Loser:  clientConv,
+						})
+					}
 				}
 			}
+
+			response.Conversations = append(response.Conversations, finalConv)
 		}
 
-		response.Conversations = append(response.Conversations, finalConv)
-	}
+		// Get all server conversations to send back any the client doesn't have
+		allServerConvs, err := tx.GetAllHistory(session.UserID)
+		if err != nil {
+			return err
+		}
 
-	// Get all server conversations to send back any the client doesn't have
-	allServerConvs, err := am.db.GetAllHistory(session.UserID)
-	if err != nil {
-		http.Error(w, "failed to get all history", http.StatusInternalServerError)
+		// Add server conversations that weren't in the client request
+		clientConvIDs := make(map[string]bool)
+		for _, c := range req.Conversations {
+			clientConvIDs[c.ConversationID] = true
+		}
+
+		for _, serverConv := range allServerConvs {
+			if !clientConvIDs[serverConv.ConversationID] {
+				response.Conversations = append(response.Conversations, serverConv)
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, ErrStorageQuotaExceeded) {
+		http.Error(w, "storage quota exceeded", http.StatusRequestEntityTooLarge)
 		return
 	}
-
-	// Add server conversations that weren't in the client request
-	clientConvIDs := make(map[string]bool)
-	for _, c := range req.Conversations {
-		clientConvIDs[c.ConversationID] = true
+	if err != nil {
+		logSyncFailure(session.UserID, err)
+		http.Error(w, "failed to sync history", http.StatusInternalServerError)
+		return
 	}
 
-	for _, serverConv := range allServerConvs {
-		if !clientConvIDs[serverConv.ConversationID] {
-			response.Conversations = append(response.Conversations, serverConv)
+	if len(saved) > 0 {
+		ids := make([]string, len(saved))
+		for i, conv := range saved {
+			ids[i] = conv.ConversationID
 		}
+		am.publishHistoryChange(session.UserID, SyncEventUpdated, ids...)
+	}
+	am.notifyHistorySaved(session.UserID, saved...)
+	for _, conv := range saved {
+		am.GenerateTitle(conv)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// processImagesBeforeSave moves a conversation's inline images to the
+// attachment store. On failure the conversation is saved with its data as is.
+func (am *AuthManager) processImagesBeforeSave(userID int64, conv *ConversationHistory) {
+	if err := am.processConversationImages(userID, conv); err != nil {
+		if globalLogger != nil {
+			globalLogger.Error("Failed to process conversation images",
+				zap.String("conversation_id", conv.ConversationID),
+				zap.Error(err))
+		}
+	}
+}
+
+// logSyncFailure logs why a sync was rolled back
+func logSyncFailure(userID int64, err error) {
+	if globalLogger != nil {
+		globalLogger.Error("History sync failed, no changes were saved",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+	}
+}
+
 // DeleteHistoryItem deletes a specific conversation history
 func (am *AuthManager) DeleteHistoryItem(w http.ResponseWriter, r *http.Request) {
 	session, _ := am.GetSession(r)
@@ -152,19 +294,92 @@ func (am *AuthManager) DeleteHistoryItem(w http.ResponseWriter, r *http.Request)
 			http.Error(w, "failed to delete all history", http.StatusInternalServerError)
 			return
 		}
+		am.publishHistoryChange(session.UserID, SyncEventDeleted)
+		am.notifyHistoryDeleted(session.UserID)
 	} else {
 		if err := am.db.DeleteHistory(session.UserID, req.ConversationID); err != nil {
 			http.Error(w, "failed to delete history", http.StatusInternalServerError)
 			return
 		}
+		am.publishHistoryChange(session.UserID, SyncEventDeleted, req.ConversationID)
+		am.notifyHistoryDeleted(session.UserID, req.ConversationID)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
 }
 
+// GetTrash lists the user's soft-deleted conversations
+func (am *AuthManager) GetTrash(w http.ResponseWriter, r *http.Request) {
+	session, _ := am.GetSession(r)
+	if session == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	items, err := am.db.GetDeletedHistory(session.UserID)
+	if err != nil {
+		http.Error(w, "failed to get trash", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// RestoreHistoryItem moves a conversation out of the trash
+func (am *AuthManager) RestoreHistoryItem(w http.ResponseWriter, r *http.Request) {
+	session, _ := am.GetSession(r)
+	if session == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req RestoreHistoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if req.ConversationID == "" {
+		http.Error(w, "conversation_id is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := am.db.RestoreHistory(session.UserID, req.ConversationID); err != nil {
+		http.Error(w, "conversation not found in trash", http.StatusNotFound)
+		return
+	}
+
+	history, err := am.db.GetHistoryByID(session.UserID, req.ConversationID)
+	if err != nil || history == nil {
+		http.Error(w, "failed to get restored history", http.StatusInternalServerError)
+		return
+	}
+	am.publishHistoryChange(session.UserID, SyncEventUpdated, history.ConversationID)
+	am.webhooks.enqueue(WebhookPayload{
+		Event:          WebhookConversationUpdated,
+		UserID:         session.UserID,
+		ConversationID: history.ConversationID,
+		Conversation:   history,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// manifestCursorOverlap is how far a manifest's cursor trails the time it was
+// read. A change's updated_at is when its transaction started, so a sync still
+// running at read time can commit changes stamped before it; the overlap lets
+// the next incremental manifest list them, at the cost of repeating a few.
+const manifestCursorOverlap = time.Minute
+
 // GetHistoryManifest returns a lightweight list of conversation hashes for diff comparison
-// This allows the client to determine which conversations need to be synced
+// This allows the client to determine which conversations need to be synced.
+// With ?since=<unix_ms>, only conversations changed after since are listed,
+// along with those moved to the trash; the response's cursor is the since to
+// use next. A since older than the trash retention gets the full manifest,
+// since conversations purged in the meantime can't be reported as deleted.
 func (am *AuthManager) GetHistoryManifest(w http.ResponseWriter, r *http.Request) {
 	session, _ := am.GetSession(r)
 	if session == nil {
@@ -172,6 +387,45 @@ func (am *AuthManager) GetHistoryManifest(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	readAt := time.Now()
+	manifest := ManifestResponse{
+		Items:  []ManifestItem{},
+		Cursor: readAt.Add(-manifestCursorOverlap).UnixMilli(),
+	}
+
+	if sinceParam := r.URL.Query().Get("since"); sinceParam != "" {
+		sinceMS, err := strconv.ParseInt(sinceParam, 10, 64)
+		if err != nil || sinceMS < 0 {
+			http.Error(w, "since must be a unix timestamp in milliseconds", http.StatusBadRequest)
+			return
+		}
+		if since := time.UnixMilli(sinceMS); since.After(readAt.Add(-trashRetention)) {
+			changes, err := am.db.GetHistoryChanges(session.UserID, since)
+			if err != nil {
+				http.Error(w, "failed to get history", http.StatusInternalServerError)
+				return
+			}
+
+			manifest.Incremental = true
+			for _, c := range changes {
+				if c.DeletedAt != nil {
+					manifest.Deleted = append(manifest.Deleted, c.ConversationID)
+					continue
+				}
+				manifest.Items = append(manifest.Items, ManifestItem{
+					ConversationID: c.ConversationID,
+					Hash:           c.Hash,
+					UpdatedAt:      c.UpdatedAt.UnixMilli(),
+					Version:        c.Version,
+				})
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(manifest)
+			return
+		}
+	}
+
 	histories, err := am.db.GetAllHistory(session.UserID)
 	if err != nil {
 		http.Error(w, "failed to get history", http.StatusInternalServerError)
@@ -179,10 +433,6 @@ func (am *AuthManager) GetHistoryManifest(w http.ResponseWriter, r *http.Request
 	}
 
 	// Build manifest with just the essential info for comparison
-	manifest := ManifestResponse{
-		Items: make([]ManifestItem, 0, len(histories)),
-	}
-
 	for _, h := range histories {
 		manifest.Items = append(manifest.Items, ManifestItem{
 			ConversationID: h.ConversationID,
@@ -196,7 +446,8 @@ func (am *AuthManager) GetHistoryManifest(w http.ResponseWriter, r *http.Request
 	json.NewEncoder(w).Encode(manifest)
 }
 
-// DeltaSyncHistory handles optimized delta sync - only processes changed conversations
+// DeltaSyncHistory handles optimized delta sync - only processes changed
+// conversations. Pushes, pulls and deletions happen in one transaction.
 func (am *AuthManager) DeltaSyncHistory(w http.ResponseWriter, r *http.Request) {
 	session, _ := am.GetSession(r)
 	if session == nil {
@@ -210,84 +461,231 @@ func (am *AuthManager) DeltaSyncHistory(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	response := DeltaSyncResponse{
-		Pushed:    make([]string, 0),
-		Pulled:    make([]ConversationHistory, 0),
-		Conflicts: make([]string, 0),
+	for i := range req.Push {
+		am.processImagesBeforeSave(session.UserID, &req.Push[i])
 	}
 
-	// Process conversations to push (client -> server)
-	for _, clientConv := range req.Push {
-		// Process images before saving
-		if err := am.processConversationImages(&clientConv); err != nil {
-			if globalLogger != nil {
-				globalLogger.Error("Failed to process conversation images",
-					zap.String("conversation_id", clientConv.ConversationID),
-					zap.Error(err))
-			}
+	var response DeltaSyncResponse
+	var deleted []string
+	var saved []ConversationHistory
+	err := am.db.WithTx(func(tx Database) error {
+		response = DeltaSyncResponse{
+			Pushed:    make([]PushedConversation, 0),
+			Pulled:    make([]ConversationHistory, 0),
+			Conflicts: make([]string, 0),
 		}
+		deleted = nil
+		saved = nil
 
-		// Get server version if it exists
-		serverConv, err := am.db.GetHistoryByID(session.UserID, clientConv.ConversationID)
+		budget, err := newStorageBudget(tx, session.UserID)
 		if err != nil {
-			http.Error(w, "failed to check server history", http.StatusInternalServerError)
-			return
+			return err
 		}
 
-		shouldSave := false
+		// Process conversations to push (client -> server)
+		for _, clientConv := range req.Push {
+			// Get server version if it exists
+			serverConv, err := tx.GetHistoryByID(session.UserID, clientConv.ConversationID)
+			if err != nil {
+				return fmt.Errorf("failed to check server history: %w", err)
+			}
 
-		if serverConv == nil {
-			// New conversation, save it
-			shouldSave = true
-		} else if clientConv.Hash != serverConv.Hash {
-			// Hashes differ - check timestamps
-			if clientConv.UpdatedAt.After(serverConv.UpdatedAt) {
-				// Client is newer
-				shouldSave = true
-			} else if clientConv.UpdatedAt.Equal(serverConv.UpdatedAt) && clientConv.Version > serverConv.Version {
-				// Same time but higher version
+			shouldSave := false
+
+			if serverConv == nil {
+				// New conversation, save it
 				shouldSave = true
-			} else {
-				// Server is newer - this is a conflict, client should have pulled
-				response.Conflicts = append(response.Conflicts, clientConv.ConversationID)
+			} else if ComputeHistoryHash(&clientConv) != serverConv.Hash {
+				// Hashes differ - check timestamps
+				if clientConv.UpdatedAt.After(serverConv.UpdatedAt) {
+					// Client is newer
+					shouldSave = true
+				} else if clientConv.UpdatedAt.Equal(serverConv.UpdatedAt) && clientConv.Version > serverConv.Version {
+					// Same time but higher version
+					shouldSave = true
+				} else {
+					// Server is newer - this is a conflict, client should have pulled
+					response.Conflicts = append(response.Conflicts, clientConv.ConversationID)
+				}
 			}
-		}
-		// If hashes are the same, no need to save
+			// If hashes are the same, no need to save
 
-		if shouldSave {
-			if err := am.db.SaveHistory(session.UserID, &clientConv); err != nil {
-				http.Error(w, "failed to save history", http.StatusInternalServerError)
-				return
+			if shouldSave {
+				if err := budget.save(&clientConv, serverConv); err != nil {
+					return err
+				}
+				saved = append(saved, clientConv)
+				response.Pushed = append(response.Pushed, PushedConversation{
+					ConversationID: clientConv.ConversationID,
+					Version:        clientConv.Version,
+					Hash:           clientConv.Hash,
+					UpdatedAt:      clientConv.UpdatedAt,
+				})
 			}
-			response.Pushed = append(response.Pushed, clientConv.ConversationID)
 		}
-	}
 
-	// Process conversations to pull (server -> client)
-	for _, convID := range req.PullIDs {
-		serverConv, err := am.db.GetHistoryByID(session.UserID, convID)
+		// Process conversations to pull (server -> client)
+		pulled, err := tx.GetHistoriesByIDs(session.UserID, req.PullIDs)
 		if err != nil {
-			http.Error(w, "failed to get server history", http.StatusInternalServerError)
-			return
+			return fmt.Errorf("failed to get server history: %w", err)
+		}
+		response.Pulled = append(response.Pulled, pulled...)
+
+		// Process deletions (if client deleted conversations)
+		for _, convID := range req.DeleteIDs {
+			if err := tx.DeleteHistory(session.UserID, convID); err != nil {
+				// Log but don't fail the whole request
+				if globalLogger != nil {
+					globalLogger.Warn("Failed to delete conversation during delta sync",
+						zap.String("conversation_id", convID),
+						zap.Error(err))
+				}
+				continue
+			}
+			deleted = append(deleted, convID)
 		}
+		return nil
+	})
+	if errors.Is(err, ErrStorageQuotaExceeded) {
+		http.Error(w, "storage quota exceeded", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		logSyncFailure(session.UserID, err)
+		http.Error(w, "failed to sync history", http.StatusInternalServerError)
+		return
+	}
 
-		if serverConv != nil {
-			response.Pulled = append(response.Pulled, *serverConv)
+	if len(response.Pushed) > 0 {
+		pushed := make([]string, len(response.Pushed))
+		for i, p := range response.Pushed {
+			pushed[i] = p.ConversationID
 		}
+		am.publishHistoryChange(session.UserID, SyncEventUpdated, pushed...)
+	}
+	if len(deleted) > 0 {
+		am.publishHistoryChange(session.UserID, SyncEventDeleted, deleted...)
+		am.notifyHistoryDeleted(session.UserID, deleted...)
+	}
+	am.notifyHistorySaved(session.UserID, saved...)
+	for _, conv := range saved {
+		am.GenerateTitle(conv)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ImportHistory bulk-loads conversations, e.g. when migrating from another chat app
+func (am *AuthManager) ImportHistory(w http.ResponseWriter, r *http.Request) {
+	session, _ := am.GetSession(r)
+	if session == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
 	}
 
-	// Process deletions (if client deleted conversations)
-	for _, convID := range req.DeleteIDs {
-		if err := am.db.DeleteHistory(session.UserID, convID); err != nil {
-			// Log but don't fail the whole request
+	onConflict := r.URL.Query().Get("on_conflict")
+	if onConflict == "" {
+		onConflict = ImportConflictRename
+	}
+	if onConflict != ImportConflictRename && onConflict != ImportConflictSkip && onConflict != ImportConflictOverwrite {
+		http.Error(w, "on_conflict must be one of rename, skip, overwrite", http.StatusBadRequest)
+		return
+	}
+
+	var histories []ConversationHistory
+	if err := json.NewDecoder(r.Body).Decode(&histories); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	originalIDs := make([]string, len(histories))
+	seen := make(map[string]bool, len(histories))
+
+	for i := range histories {
+		if len(histories[i].Data) == 0 {
+			http.Error(w, "conversation data is required", http.StatusBadRequest)
+			return
+		}
+		if histories[i].ConversationID == "" {
+			histories[i].ConversationID = uuid.New().String()
+		}
+		// Renames are reported by original ID, so each ID may appear only once
+		if seen[histories[i].ConversationID] {
+			http.Error(w, "duplicate conversation_id in import: "+histories[i].ConversationID, http.StatusBadRequest)
+			return
+		}
+		seen[histories[i].ConversationID] = true
+		originalIDs[i] = histories[i].ConversationID
+
+		if err := am.processConversationImages(session.UserID, &histories[i]); err != nil {
 			if globalLogger != nil {
-				globalLogger.Warn("Failed to delete conversation during delta sync",
-					zap.String("conversation_id", convID),
+				globalLogger.Error("Failed to process conversation images",
+					zap.String("conversation_id", histories[i].ConversationID),
 					zap.Error(err))
 			}
 		}
 	}
 
+	var importBytes int64
+	for i := range histories {
+		importBytes += int64(len(histories[i].Data))
+	}
+	if err := am.CheckStorageQuota(session.UserID, importBytes); err != nil {
+		if errors.Is(err, ErrStorageQuotaExceeded) {
+			http.Error(w, "storage quota exceeded", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "failed to import history", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := am.db.ImportHistories(session.UserID, histories, onConflict)
+	if err != nil {
+		if globalLogger != nil {
+			globalLogger.Error("Failed to import history", zap.Error(err))
+		}
+		http.Error(w, "failed to import history", http.StatusInternalServerError)
+		return
+	}
+	// Image processing recorded references under the original IDs; renamed copies need their own
+	for i, originalID := range originalIDs {
+		newID, ok := result.Renamed[originalID]
+		if !ok {
+			continue
+		}
+		renamed := histories[i]
+		renamed.ConversationID = newID
+		if err := am.recordAttachmentRefs(session.UserID, &renamed); err != nil && globalLogger != nil {
+			globalLogger.Error("Failed to record attachment references",
+				zap.String("conversation_id", newID),
+				zap.Error(err))
+		}
+	}
+	if result.Imported > 0 {
+		am.publishHistoryChange(session.UserID, SyncEventUpdated)
+		am.notifyHistorySaved(session.UserID, result.Conversations...)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(result)
+}
+
+// ComputeHistoryHash returns a stable SHA-256 over a conversation's title and data.
+// The data is re-encoded before hashing so that key order and whitespace don't matter.
+func ComputeHistoryHash(h *ConversationHistory) string {
+	data := []byte(h.Data)
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(h.Data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err == nil {
+		if normalized, err := json.Marshal(v); err == nil {
+			data = normalized
+		}
+	}
+
+	hasher := sha256.New()
+	hasher.Write([]byte(h.Title))
+	hasher.Write([]byte{0})
+	hasher.Write(data)
+	return hex.EncodeToString(hasher.Sum(nil))
 }
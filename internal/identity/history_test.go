@@ -3,8 +3,10 @@ package identity
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -85,6 +87,236 @@ func TestHistorySync(t *testing.T) {
 			t.Errorf("expected version 2 (server), got %d", resp.Conversations[0].Version)
 		}
 	})
+
+	t.Run("SyncConflictDetails", func(t *testing.T) {
+		// Client sends the same version as the server but with an older timestamp
+		clientConv := ConversationHistory{
+			ConversationID: "conv1",
+			Version:        2,
+			Title:          "Client Edit",
+			Data:           json.RawMessage(`["client"]`),
+			UpdatedAt:      time.Now().Add(-time.Hour),
+		}
+		body, _ := json.Marshal(HistorySyncRequest{Conversations: []ConversationHistory{clientConv}})
+
+		req, _ := http.NewRequest("POST", "/v1/user/me/history", bytes.NewBuffer(body))
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+		rr := httptest.NewRecorder()
+
+		am.SyncHistory(rr, req)
+
+		var resp HistorySyncResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		if len(resp.ConflictDetails) != 1 {
+			t.Fatalf("expected 1 conflict detail, got %d", len(resp.ConflictDetails))
+		}
+		detail := resp.ConflictDetails[0]
+		if detail.ID != "conv1" {
+			t.Errorf("expected conflict on conv1, got %s", detail.ID)
+		}
+		if detail.Winner.Title != "Server Title" {
+			t.Errorf("expected server version to win, got %s", detail.Winner.Title)
+		}
+		if detail.Loser.Title != "Client Edit" || string(detail.Loser.Data) != `["client"]` {
+			t.Errorf("expected losing client data to be returned, got %+v", detail.Loser)
+		}
+	})
+
+	t.Run("FailedSyncSavesNothing", func(t *testing.T) {
+		db.failSaves = map[string]bool{"conv3": true}
+		defer func() { db.failSaves = nil }()
+
+		convs := []ConversationHistory{
+			{ConversationID: "conv2", Version: 1, Title: "Saved First", Data: json.RawMessage(`[]`), UpdatedAt: time.Now()},
+			{ConversationID: "conv3", Version: 1, Title: "Fails", Data: json.RawMessage(`[]`), UpdatedAt: time.Now()},
+		}
+		body, _ := json.Marshal(HistorySyncRequest{Conversations: convs})
+
+		req, _ := http.NewRequest("POST", "/v1/user/me/history", bytes.NewBuffer(body))
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+		rr := httptest.NewRecorder()
+
+		am.SyncHistory(rr, req)
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Fatalf("expected 500, got %d", rr.Code)
+		}
+		if saved, _ := db.GetHistoryByID(user.ID, "conv2"); saved != nil {
+			t.Errorf("expected conv2 to be rolled back with the failed sync")
+		}
+	})
+}
+
+func TestResyncIsStable(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	user := &User{Username: "testuser"}
+	db.CreateUser(user)
+	token, _ := generateSessionToken()
+	db.CreateSession(&Session{Token: token, UserID: user.ID, Username: user.Username, ExpiresAt: time.Now().Add(time.Hour)})
+
+	sync := func(conv ConversationHistory) HistorySyncResponse {
+		body, _ := json.Marshal(HistorySyncRequest{Conversations: []ConversationHistory{conv}})
+		req, _ := http.NewRequest("POST", "/v1/user/me/history", bytes.NewBuffer(body))
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+		rr := httptest.NewRecorder()
+		am.SyncHistory(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rr.Code)
+		}
+		var resp HistorySyncResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return resp
+	}
+
+	// A client that pushes version 1, then an edit as version 2, ends up with
+	// the versions the server stored
+	first := sync(ConversationHistory{ConversationID: "conv1", Version: 1, Title: "Title", Data: json.RawMessage(`["a"]`), UpdatedAt: time.Now()})
+	if first.Conversations[0].Version != 1 {
+		t.Fatalf("expected a new conversation to be stored as version 1, got %d", first.Conversations[0].Version)
+	}
+	edited := first.Conversations[0]
+	edited.Version++
+	edited.Data = json.RawMessage(`["a","b"]`)
+	edited.UpdatedAt = time.Now()
+	second := sync(edited)
+	stored := second.Conversations[0]
+	if stored.Version != 2 {
+		t.Fatalf("expected the edit to be stored as version 2, got %d", stored.Version)
+	}
+
+	// Sending back exactly what the server returned changes nothing
+	for i := 0; i < 2; i++ {
+		resp := sync(stored)
+		if len(resp.Conflicts) != 0 {
+			t.Errorf("resync %d: expected no conflicts, got %v", i+1, resp.Conflicts)
+		}
+		got := resp.Conversations[0]
+		if got.Version != stored.Version || got.Hash != stored.Hash || !got.UpdatedAt.Equal(stored.UpdatedAt) {
+			t.Errorf("resync %d: expected the stored conversation unchanged, got version %d", i+1, got.Version)
+		}
+	}
+
+	// Saving unchanged content directly keeps the version too
+	again := stored
+	db.SaveHistory(user.ID, &again)
+	if again.Version != stored.Version {
+		t.Errorf("expected saving unchanged content to keep version %d, got %d", stored.Version, again.Version)
+	}
+}
+
+func TestDeltaSyncReturnsStoredState(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	user := &User{Username: "testuser"}
+	db.CreateUser(user)
+	token, _ := generateSessionToken()
+	db.CreateSession(&Session{Token: token, UserID: user.ID, Username: user.Username, ExpiresAt: time.Now().Add(time.Hour)})
+	db.SaveHistory(user.ID, &ConversationHistory{ConversationID: "conv1", Title: "Before", Data: json.RawMessage(`[]`)})
+
+	push := []ConversationHistory{
+		{ConversationID: "conv1", Version: 7, Hash: "client-hash", Title: "After", Data: json.RawMessage(`["edit"]`), UpdatedAt: time.Now().Add(time.Hour)},
+	}
+	body, _ := json.Marshal(DeltaSyncRequest{Push: push})
+
+	req, _ := http.NewRequest("POST", "/v1/user/me/history/delta", bytes.NewBuffer(body))
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	rr := httptest.NewRecorder()
+
+	am.DeltaSyncHistory(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var resp DeltaSyncResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Pushed) != 1 {
+		t.Fatalf("expected 1 pushed conversation, got %d", len(resp.Pushed))
+	}
+
+	stored, _ := db.GetHistoryByID(user.ID, "conv1")
+	pushed := resp.Pushed[0]
+	if pushed.ConversationID != "conv1" || pushed.Version != stored.Version || pushed.Hash != stored.Hash || !pushed.UpdatedAt.Equal(stored.UpdatedAt) {
+		t.Errorf("expected the stored state %d/%s/%s, got %+v", stored.Version, stored.Hash, stored.UpdatedAt, pushed)
+	}
+	if pushed.Version != 2 || pushed.Hash == "client-hash" {
+		t.Errorf("expected the server's version and hash rather than the client's, got %+v", pushed)
+	}
+}
+
+func TestDeltaSyncBatchPull(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	user := &User{Username: "testuser"}
+	db.CreateUser(user)
+	token, _ := generateSessionToken()
+	db.CreateSession(&Session{Token: token, UserID: user.ID, Username: user.Username, ExpiresAt: time.Now().Add(time.Hour)})
+
+	var pullIDs []string
+	for i := 0; i < 200; i++ {
+		id := fmt.Sprintf("conv%d", i)
+		db.SaveHistory(user.ID, &ConversationHistory{ConversationID: id, Title: id, Data: json.RawMessage(`[]`)})
+		pullIDs = append(pullIDs, id)
+	}
+	db.DeleteHistory(user.ID, "conv0")
+	pullIDs = append(pullIDs, "missing")
+	db.historyQueries = 0
+
+	body, _ := json.Marshal(DeltaSyncRequest{PullIDs: pullIDs})
+	req, _ := http.NewRequest("POST", "/v1/user/me/history/delta", bytes.NewBuffer(body))
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	rr := httptest.NewRecorder()
+
+	am.DeltaSyncHistory(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var resp DeltaSyncResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if len(resp.Pulled) != 199 {
+		t.Errorf("expected 199 pulled conversations without the trashed and missing ones, got %d", len(resp.Pulled))
+	}
+	if db.historyQueries != 1 {
+		t.Errorf("expected the pull to take 1 query, took %d", db.historyQueries)
+	}
+}
+
+func TestDeltaSyncAtomic(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	user := &User{Username: "testuser"}
+	db.CreateUser(user)
+	token, _ := generateSessionToken()
+	db.CreateSession(&Session{Token: token, UserID: user.ID, Username: user.Username, ExpiresAt: time.Now().Add(time.Hour)})
+	db.SaveHistory(user.ID, &ConversationHistory{ConversationID: "existing", Title: "Before", Data: json.RawMessage(`[]`)})
+	db.failSaves = map[string]bool{"fails": true}
+
+	push := []ConversationHistory{
+		{ConversationID: "existing", Version: 5, Title: "After", Data: json.RawMessage(`["edit"]`), UpdatedAt: time.Now().Add(time.Hour)},
+		{ConversationID: "fails", Version: 1, Title: "Fails", Data: json.RawMessage(`[]`), UpdatedAt: time.Now()},
+	}
+	body, _ := json.Marshal(DeltaSyncRequest{Push: push})
+
+	req, _ := http.NewRequest("POST", "/v1/user/me/history/delta", bytes.NewBuffer(body))
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	rr := httptest.NewRecorder()
+
+	am.DeltaSyncHistory(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rr.Code)
+	}
+	existing, _ := db.GetHistoryByID(user.ID, "existing")
+	if existing == nil || existing.Title != "Before" {
+		t.Errorf("expected the earlier push to be rolled back, got %+v", existing)
+	}
 }
 
 func TestGetHistoryManifest(t *testing.T) {
@@ -96,7 +328,8 @@ func TestGetHistoryManifest(t *testing.T) {
 	token, _ := generateSessionToken()
 	db.CreateSession(&Session{Token: token, UserID: user.ID, Username: user.Username, ExpiresAt: time.Now().Add(time.Hour)})
 
-	db.SaveHistory(user.ID, &ConversationHistory{ConversationID: "c1", Hash: "h1", Version: 1})
+	conv := &ConversationHistory{ConversationID: "c1", Hash: "client-hash", Version: 1, Data: json.RawMessage(`{"a":1}`)}
+	db.SaveHistory(user.ID, conv)
 
 	req, _ := http.NewRequest("GET", "/v1/user/me/history/manifest", nil)
 	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
@@ -113,7 +346,313 @@ func TestGetHistoryManifest(t *testing.T) {
 	if len(resp.Items) != 1 {
 		t.Fatalf("expected 1 item, got %d", len(resp.Items))
 	}
-	if resp.Items[0].Hash != "h1" {
-		t.Errorf("expected hash h1, got %s", resp.Items[0].Hash)
+	if resp.Items[0].Hash != ComputeHistoryHash(conv) {
+		t.Errorf("expected server-computed hash, got %s", resp.Items[0].Hash)
+	}
+}
+
+func TestIncrementalManifest(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	user := &User{Username: "testuser"}
+	db.CreateUser(user)
+	token, _ := generateSessionToken()
+	db.CreateSession(&Session{Token: token, UserID: user.ID, Username: user.Username, ExpiresAt: time.Now().Add(time.Hour)})
+
+	for _, id := range []string{"old", "edited", "trashed"} {
+		db.SaveHistory(user.ID, &ConversationHistory{ConversationID: id, Title: id, Data: json.RawMessage(`[]`)})
+		db.histories[user.ID][id].UpdatedAt = time.Now().Add(-time.Hour)
+	}
+	since := time.Now().Add(-2 * time.Minute)
+	db.SaveHistory(user.ID, &ConversationHistory{ConversationID: "edited", Title: "edited", Data: json.RawMessage(`["new"]`)})
+	db.SaveHistory(user.ID, &ConversationHistory{ConversationID: "new", Title: "new", Data: json.RawMessage(`[]`)})
+	db.DeleteHistory(user.ID, "trashed")
+
+	manifest := func(query string) (int, ManifestResponse) {
+		req, _ := http.NewRequest("GET", "/v1/user/me/history/manifest"+query, nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+		rr := httptest.NewRecorder()
+		am.GetHistoryManifest(rr, req)
+		var resp ManifestResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	t.Run("ChangesSince", func(t *testing.T) {
+		code, resp := manifest(fmt.Sprintf("?since=%d", since.UnixMilli()))
+		if code != http.StatusOK || !resp.Incremental {
+			t.Fatalf("expected an incremental manifest, got %d %+v", code, resp)
+		}
+		var ids []string
+		for _, item := range resp.Items {
+			ids = append(ids, item.ConversationID)
+		}
+		if strings.Join(ids, ",") != "edited,new" {
+			t.Errorf("expected edited and new, got %v", ids)
+		}
+		if len(resp.Deleted) != 1 || resp.Deleted[0] != "trashed" {
+			t.Errorf("expected trashed to be reported deleted, got %v", resp.Deleted)
+		}
+		if resp.Cursor <= since.UnixMilli() || resp.Cursor > time.Now().UnixMilli() {
+			t.Errorf("expected a cursor between since and now, got %d", resp.Cursor)
+		}
+	})
+
+	t.Run("FullWithoutSince", func(t *testing.T) {
+		_, resp := manifest("")
+		if resp.Incremental || len(resp.Items) != 3 || len(resp.Deleted) != 0 {
+			t.Errorf("expected the full manifest of 3 live conversations, got %+v", resp)
+		}
+	})
+
+	t.Run("FullWhenSinceIsBeforeTrashRetention", func(t *testing.T) {
+		_, resp := manifest(fmt.Sprintf("?since=%d", time.Now().Add(-trashRetention-time.Hour).UnixMilli()))
+		if resp.Incremental || len(resp.Items) != 3 {
+			t.Errorf("expected the full manifest, got %+v", resp)
+		}
+	})
+
+	t.Run("InvalidSince", func(t *testing.T) {
+		if code, _ := manifest("?since=yesterday"); code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", code)
+		}
+	})
+}
+
+func TestImportHistory(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	user := &User{Username: "testuser"}
+	db.CreateUser(user)
+	token, _ := generateSessionToken()
+	db.CreateSession(&Session{Token: token, UserID: user.ID, Username: user.Username, ExpiresAt: time.Now().Add(time.Hour)})
+
+	db.SaveHistory(user.ID, &ConversationHistory{ConversationID: "existing", Title: "Original", Data: json.RawMessage(`[]`)})
+
+	doImport := func(query string) HistoryImportResult {
+		histories := []ConversationHistory{
+			{ConversationID: "existing", Title: "Imported", Data: json.RawMessage(`[]`)},
+			{ConversationID: "new", Version: 99, Title: "New", Data: json.RawMessage(`[]`)},
+		}
+		body, _ := json.Marshal(histories)
+		req, _ := http.NewRequest("POST", "/v1/user/me/history/import"+query, bytes.NewBuffer(body))
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+		rr := httptest.NewRecorder()
+
+		am.ImportHistory(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var result HistoryImportResult
+		json.Unmarshal(rr.Body.Bytes(), &result)
+		return result
+	}
+
+	t.Run("Skip", func(t *testing.T) {
+		result := doImport("?on_conflict=skip")
+		if result.Imported != 1 || result.Skipped != 1 {
+			t.Errorf("expected 1 imported and 1 skipped, got %+v", result)
+		}
+		existing, _ := db.GetHistoryByID(user.ID, "existing")
+		if existing.Title != "Original" {
+			t.Errorf("expected existing conversation to be untouched, got title %s", existing.Title)
+		}
+		imported, _ := db.GetHistoryByID(user.ID, "new")
+		if imported.Version != 1 {
+			t.Errorf("expected imported conversation to start at version 1, got %d", imported.Version)
+		}
+	})
+
+	t.Run("RenameByDefault", func(t *testing.T) {
+		result := doImport("")
+		if result.Imported != 2 {
+			t.Errorf("expected 2 imported, got %d", result.Imported)
+		}
+		if result.Renamed["existing"] == "" {
+			t.Error("expected colliding conversation to be renamed")
+		}
+	})
+
+	t.Run("Overwrite", func(t *testing.T) {
+		doImport("?on_conflict=overwrite")
+		existing, _ := db.GetHistoryByID(user.ID, "existing")
+		if existing.Title != "Imported" {
+			t.Errorf("expected existing conversation to be overwritten, got title %s", existing.Title)
+		}
+	})
+
+	t.Run("TrashedIsNotAConflict", func(t *testing.T) {
+		db.DeleteHistory(user.ID, "existing")
+		result := doImport("?on_conflict=skip")
+		if result.Imported != 1 || result.Skipped != 1 || result.Renamed["existing"] != "" {
+			t.Errorf("expected the trashed conversation to be imported, got %+v", result)
+		}
+		existing, err := db.GetHistoryByID(user.ID, "existing")
+		if err != nil || existing.Title != "Imported" {
+			t.Errorf("expected the trashed conversation to be replaced and restored, got %+v (%v)", existing, err)
+		}
+	})
+
+	t.Run("DuplicateIDsRejected", func(t *testing.T) {
+		body := `[{"conversation_id":"dup","title":"One","data":[]},{"conversation_id":"dup","title":"Two","data":[]}]`
+		req, _ := http.NewRequest("POST", "/v1/user/me/history/import", bytes.NewBufferString(body))
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+		rr := httptest.NewRecorder()
+
+		am.ImportHistory(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", rr.Code)
+		}
+		if h, _ := db.GetHistoryByID(user.ID, "dup"); h != nil {
+			t.Error("expected nothing to be imported")
+		}
+	})
+
+	t.Run("InvalidConflictMode", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/v1/user/me/history/import?on_conflict=merge", bytes.NewBufferString(`[]`))
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+		rr := httptest.NewRecorder()
+
+		am.ImportHistory(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", rr.Code)
+		}
+	})
+}
+
+func TestGetHistoryPage(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	user := &User{Username: "testuser"}
+	db.CreateUser(user)
+	token, _ := generateSessionToken()
+	db.CreateSession(&Session{Token: token, UserID: user.ID, Username: user.Username, ExpiresAt: time.Now().Add(time.Hour)})
+
+	for i := 0; i < 5; i++ {
+		db.SaveHistory(user.ID, &ConversationHistory{
+			ConversationID: fmt.Sprintf("c%d", i),
+			Data:           json.RawMessage(`{"messages":["large payload"]}`),
+		})
+	}
+
+	req, _ := http.NewRequest("GET", "/v1/user/me/history?page=2&limit=2", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	rr := httptest.NewRecorder()
+
+	am.GetHistory(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	var resp HistoryPageResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.Total != 5 {
+		t.Errorf("expected total 5, got %d", resp.Total)
+	}
+	if len(resp.Items) != 2 {
+		t.Errorf("expected 2 items, got %d", len(resp.Items))
+	}
+	if resp.Page != 2 || resp.Limit != 2 {
+		t.Errorf("expected page 2 limit 2, got page %d limit %d", resp.Page, resp.Limit)
+	}
+	if strings.Contains(rr.Body.String(), "large payload") {
+		t.Error("paged response should not include conversation data")
+	}
+}
+
+func TestTrashAndRestore(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	user := &User{Username: "testuser"}
+	db.CreateUser(user)
+	token, _ := generateSessionToken()
+	db.CreateSession(&Session{Token: token, UserID: user.ID, Username: user.Username, ExpiresAt: time.Now().Add(time.Hour)})
+
+	db.SaveHistory(user.ID, &ConversationHistory{ConversationID: "c1", Title: "Keep me"})
+
+	req, _ := http.NewRequest("DELETE", "/v1/user/me/history", strings.NewReader(`{"conversation_id":"c1"}`))
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	rr := httptest.NewRecorder()
+	am.DeleteHistoryItem(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 on delete, got %d", rr.Code)
+	}
+
+	if all, _ := db.GetAllHistory(user.ID); len(all) != 0 {
+		t.Errorf("expected deleted conversation to be hidden, got %d", len(all))
+	}
+
+	t.Run("Trash", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/v1/user/me/history/trash", nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+		rr := httptest.NewRecorder()
+		am.GetTrash(rr, req)
+
+		var items []HistorySummary
+		json.Unmarshal(rr.Body.Bytes(), &items)
+		if len(items) != 1 || items[0].ConversationID != "c1" || items[0].DeletedAt == nil {
+			t.Errorf("expected c1 in trash, got %+v", items)
+		}
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/v1/user/me/history/restore", strings.NewReader(`{"conversation_id":"c1"}`))
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+		rr := httptest.NewRecorder()
+		am.RestoreHistoryItem(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200 on restore, got %d", rr.Code)
+		}
+		if h, _ := db.GetHistoryByID(user.ID, "c1"); h == nil {
+			t.Error("expected conversation to be restored")
+		}
+
+		rr = httptest.NewRecorder()
+		req, _ = http.NewRequest("POST", "/v1/user/me/history/restore", strings.NewReader(`{"conversation_id":"c1"}`))
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+		am.RestoreHistoryItem(rr, req)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected 404 restoring a live conversation, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		db.DeleteHistory(user.ID, "c1")
+		if purged, _, _ := db.PurgeDeletedHistory(time.Now().Add(-trashRetention)); purged != 0 {
+			t.Errorf("expected recent trash to be kept, purged %d", purged)
+		}
+		if purged, _, _ := db.PurgeDeletedHistory(time.Now().Add(time.Second)); purged != 1 {
+			t.Errorf("expected 1 purged, got %d", purged)
+		}
+	})
+}
+
+func TestComputeHistoryHash(t *testing.T) {
+	a := &ConversationHistory{Title: "Chat", Data: json.RawMessage(`{"messages":[{"role":"user","content":"hi"}],"model":"gpt"}`)}
+	b := &ConversationHistory{Title: "Chat", Data: json.RawMessage(`{ "model": "gpt", "messages": [ {"content": "hi", "role": "user"} ] }`)}
+
+	if ComputeHistoryHash(a) != ComputeHistoryHash(b) {
+		t.Error("expected identical hashes regardless of key order and whitespace")
+	}
+	if len(ComputeHistoryHash(a)) != 64 {
+		t.Errorf("expected hex-encoded SHA-256, got %q", ComputeHistoryHash(a))
+	}
+
+	renamed := &ConversationHistory{Title: "Other", Data: a.Data}
+	if ComputeHistoryHash(a) == ComputeHistoryHash(renamed) {
+		t.Error("expected title to affect the hash")
+	}
+
+	changed := &ConversationHistory{Title: "Chat", Data: json.RawMessage(`{"messages":[],"model":"gpt"}`)}
+	if ComputeHistoryHash(a) == ComputeHistoryHash(changed) {
+		t.Error("expected data to affect the hash")
 	}
 }
@@ -20,8 +20,9 @@ func SetGlobalLogger(logger *zap.Logger) {
 	globalLogger = logger
 }
 
-// processConversationImages processes a conversation's data to extract and save base64 images
-func (am *AuthManager) processConversationImages(conv *ConversationHistory) error {
+// processConversationImages processes a conversation's data to extract and save base64 images,
+// and records which attachments the conversation references so they can be deleted with it
+func (am *AuthManager) processConversationImages(userID int64, conv *ConversationHistory) error {
 	if globalAttachmentStore == nil {
 		return fmt.Errorf("attachment store not initialized")
 	}
@@ -33,10 +34,16 @@ func (am *AuthManager) processConversationImages(conv *ConversationHistory) erro
 	}
 
 	// Process images in the data
-	processedData, err := ExtractAndSaveImages(data, globalAttachmentStore)
+	store := &usageRecordingStore{AttachmentStore: globalAttachmentStore, sizes: make(map[string]int64)}
+	processedData, err := ExtractAndSaveImages(data, store)
 	if err != nil {
 		return fmt.Errorf("failed to process images: %w", err)
 	}
+	for id, size := range store.sizes {
+		if err := am.db.AddAttachmentUsage(userID, id, size); err != nil {
+			return err
+		}
+	}
 
 	// Marshal back to JSON
 	processedJSON, err := json.Marshal(processedData)
@@ -46,5 +53,38 @@ func (am *AuthManager) processConversationImages(conv *ConversationHistory) erro
 
 	// Update the conversation data
 	conv.Data = json.RawMessage(processedJSON)
+
+	if err := am.db.AddAttachmentRefs(userID, conv.ConversationID, ExtractAttachmentIDs(processedData)); err != nil {
+		return fmt.Errorf("failed to record attachment references: %w", err)
+	}
 	return nil
 }
+
+// recordAttachmentRefs records the attachments referenced by an already processed conversation
+func (am *AuthManager) recordAttachmentRefs(userID int64, conv *ConversationHistory) error {
+	var data interface{}
+	if err := json.Unmarshal(conv.Data, &data); err != nil {
+		return fmt.Errorf("failed to unmarshal conversation data: %w", err)
+	}
+	return am.db.AddAttachmentRefs(userID, conv.ConversationID, ExtractAttachmentIDs(data))
+}
+
+// usageRecordingStore notes the size of each attachment saved through it, so
+// it can be counted towards the owner's storage quota
+type usageRecordingStore struct {
+	AttachmentStore
+	sizes map[string]int64
+}
+
+func (s *usageRecordingStore) Save(data []byte, contentType string) (string, error) {
+	id, _, err := s.saveNew(data, contentType)
+	return id, err
+}
+
+func (s *usageRecordingStore) saveNew(data []byte, contentType string) (string, bool, error) {
+	id, created, err := saveAttachment(s.AttachmentStore, data, contentType)
+	if err == nil {
+		s.sizes[id] = int64(len(data))
+	}
+	return id, created, err
+}
@@ -3,6 +3,7 @@ package identity
 import (
 	"encoding/json"
 	"testing"
+	"time"
 )
 
 func TestProcessConversationImages(t *testing.T) {
@@ -31,7 +32,7 @@ func TestProcessConversationImages(t *testing.T) {
 		Data:           json.RawMessage(dataBytes),
 	}
 
-	err := am.processConversationImages(conv)
+	err := am.processConversationImages(1, conv)
 	if err != nil {
 		t.Fatalf("failed to process: %v", err)
 	}
@@ -51,6 +52,44 @@ func TestProcessConversationImages(t *testing.T) {
 	}
 }
 
+func TestAttachmentRefsPurge(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	mockStore := &MockAttachmentStore{
+		data: make(map[string][]byte),
+		ct:   make(map[string]string),
+	}
+	SetGlobalAttachmentStore(mockStore)
+
+	// c1 uploads the image inline; c2 references the stored attachment
+	inline, _ := json.Marshal(map[string]interface{}{
+		"content": "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mP8z8BQDwAEhQGAhKmMIQAAAABJRU5ErkJggg==",
+	})
+	linked, _ := json.Marshal(map[string]interface{}{"content": attachmentURLPrefix + "uuid-1"})
+	for _, conv := range []*ConversationHistory{
+		{ConversationID: "c1", Data: inline},
+		{ConversationID: "c2", Data: linked},
+	} {
+		if err := am.processConversationImages(1, conv); err != nil {
+			t.Fatalf("failed to process %s: %v", conv.ConversationID, err)
+		}
+		db.SaveHistory(1, conv)
+	}
+
+	db.DeleteHistory(1, "c1")
+	am.purgeTrashOnce(time.Now().Add(time.Second))
+	if _, ok := mockStore.data["uuid-1"]; !ok {
+		t.Fatal("expected attachment still referenced by c2 to be kept")
+	}
+
+	db.DeleteHistory(1, "c2")
+	am.purgeTrashOnce(time.Now().Add(time.Second))
+	if _, ok := mockStore.data["uuid-1"]; ok {
+		t.Error("expected unreferenced attachment to be deleted")
+	}
+}
+
 // MockAttachmentStore defined in handler/attachments_test.go is not available here.
 // I'll redefine it or move it to a shared place if needed.
 // For now, I'll redefine it in mock_db_test.go or here.
@@ -71,6 +110,10 @@ func (m *MockAttachmentStore) Get(uuid string) ([]byte, string, error) {
 	return m.data[uuid], m.ct[uuid], nil
 }
 
+func (m *MockAttachmentStore) Stat(uuid string) (AttachmentInfo, error) {
+	return AttachmentInfo{Size: int64(len(m.data[uuid])), ContentType: m.ct[uuid]}, nil
+}
+
 func (m *MockAttachmentStore) Delete(uuid string) error {
 	delete(m.data, uuid)
 	return nil
@@ -0,0 +1,115 @@
+package identity
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"llm-router/internal/utils"
+)
+
+const (
+	// loginFailureLimit failed logins within loginFailureWindow lock the username or client out
+	loginFailureLimit  = 5
+	loginFailureWindow = 15 * time.Minute
+	// loginLockout is the first lockout; each further lockout doubles it up to loginMaxLockout
+	loginLockout    = time.Minute
+	loginMaxLockout = time.Hour
+	// loginSweepInterval is how often stale entries are evicted
+	loginSweepInterval = time.Minute
+)
+
+// loginLimiter tracks failed logins per username and per client IP in memory
+type loginLimiter struct {
+	mu        sync.Mutex
+	attempts  map[string]*loginAttempts
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type loginAttempts struct {
+	failures     int
+	firstFailure time.Time
+	lockouts     int // lockouts so far, for the progressive delay
+	lockedUntil  time.Time
+}
+
+func newLoginLimiter() *loginLimiter {
+	return &loginLimiter{
+		attempts: make(map[string]*loginAttempts),
+		now:      time.Now,
+	}
+}
+
+// loginLimiterKeys returns the keys a login attempt is tracked under
+func loginLimiterKeys(r *http.Request, username string) []string {
+	return []string{"user:" + strings.ToLower(username), "ip:" + utils.ExtractClientIP(r.RemoteAddr)}
+}
+
+// lockedFor returns how long the longest lockout among keys has left, or zero if none are locked
+func (l *loginLimiter) lockedFor(keys ...string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var wait time.Duration
+	for _, key := range keys {
+		if a, ok := l.attempts[key]; ok {
+			wait = max(wait, a.lockedUntil.Sub(now))
+		}
+	}
+	return wait
+}
+
+// recordFailure counts a failed login against each key, locking any that reach the limit
+func (l *loginLimiter) recordFailure(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	for _, key := range keys {
+		a, ok := l.attempts[key]
+		if !ok {
+			a = &loginAttempts{}
+			l.attempts[key] = a
+		}
+		if a.failures == 0 || now.Sub(a.firstFailure) > loginFailureWindow {
+			a.failures = 0
+			a.firstFailure = now
+		}
+		a.failures++
+
+		if a.failures >= loginFailureLimit {
+			a.lockedUntil = now.Add(min(loginLockout<<min(a.lockouts, 6), loginMaxLockout))
+			a.lockouts++
+			a.failures = 0
+		}
+	}
+}
+
+// recordSuccess clears the failures for key
+func (l *loginLimiter) recordSuccess(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.attempts, key)
+}
+
+// sweep evicts entries that are neither locked nor holding recent failures.
+// The caller must hold l.mu.
+func (l *loginLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < loginSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, a := range l.attempts {
+		// Keep the lockout count around for a while so repeat offenders keep escalating
+		if now.After(a.lockedUntil.Add(loginFailureWindow)) && now.Sub(a.firstFailure) > loginFailureWindow {
+			delete(l.attempts, key)
+		}
+	}
+}
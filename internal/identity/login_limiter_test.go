@@ -0,0 +1,100 @@
+package identity
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLoginBruteForceProtection(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	db.CreateUser(&User{Username: "admin", PasswordHash: string(passwordHash)})
+
+	now := time.Now()
+	am.loginLimiter.now = func() time.Time { return now }
+
+	login := func(username, password, remoteAddr string) *httptest.ResponseRecorder {
+		reqBody, _ := json.Marshal(LoginRequest{Username: username, Password: password})
+		req, _ := http.NewRequest("POST", "/v1/auth/login", bytes.NewBuffer(reqBody))
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		am.Login(rr, req)
+		return rr
+	}
+
+	for i := 0; i < loginFailureLimit; i++ {
+		if rr := login("admin", "wrong", "10.0.0.1:1234"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i+1, rr.Code)
+		}
+	}
+
+	t.Run("Locked Username", func(t *testing.T) {
+		// The right password from another client is refused while the username is locked
+		rr := login("admin", "password123", "10.0.0.2:1234")
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected 429, got %d", rr.Code)
+		}
+		if rr.Header().Get("Retry-After") != "60" {
+			t.Errorf("expected Retry-After 60, got %q", rr.Header().Get("Retry-After"))
+		}
+	})
+
+	t.Run("Locked IP", func(t *testing.T) {
+		if rr := login("someone-else", "whatever", "10.0.0.1:5678"); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("expected the client IP to be locked, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Lockout Expires", func(t *testing.T) {
+		now = now.Add(loginLockout + time.Second)
+		if rr := login("admin", "password123", "10.0.0.2:1234"); rr.Code != http.StatusOK {
+			t.Errorf("expected login to succeed after the lockout, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Progressive Lockout", func(t *testing.T) {
+		// The IP is still on its first lockout count, so its second lockout doubles
+		for i := 0; i < loginFailureLimit; i++ {
+			login("admin", "wrong", "10.0.0.1:1234")
+		}
+		if wait := am.loginLimiter.lockedFor("ip:10.0.0.1"); wait != 2*loginLockout {
+			t.Errorf("expected second lockout of %v, got %v", 2*loginLockout, wait)
+		}
+	})
+}
+
+func TestLoginLimiterWindow(t *testing.T) {
+	l := newLoginLimiter()
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < loginFailureLimit-1; i++ {
+		l.recordFailure("user:a")
+	}
+	now = now.Add(loginFailureWindow + time.Second)
+	l.recordFailure("user:a")
+
+	if wait := l.lockedFor("user:a"); wait != 0 {
+		t.Errorf("expected failures outside the window not to lock, got %v", wait)
+	}
+
+	t.Run("Eviction", func(t *testing.T) {
+		now = now.Add(2*loginFailureWindow + loginSweepInterval)
+		l.recordFailure("user:b")
+
+		l.mu.Lock()
+		_, ok := l.attempts["user:a"]
+		l.mu.Unlock()
+		if ok {
+			t.Error("expected stale entry to be evicted")
+		}
+	})
+}
@@ -0,0 +1,210 @@
+package identity
+
+import (
+	"database/sql"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// migrationLockID keys the advisory lock that keeps routers sharing a
+// database from migrating it at the same time
+const migrationLockID = 7283410561
+
+// migration is one step of the schema's history. Steps are applied in order
+// of version and each is recorded in schema_migrations, so a step runs once
+// per database. Published steps must never change; add a new one instead.
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// migrations is the schema's history, oldest first
+var migrations = []migration{
+	{version: 1, name: "initial schema", sql: schemaV1},
+	{version: 2, name: "index history by user and update time", sql: `
+		CREATE INDEX IF NOT EXISTS idx_conversation_histories_user_updated_at
+		ON conversation_histories(user_id, updated_at);
+	`},
+	{version: 3, name: "per-user storage quotas", sql: `
+		-- NULL uses the configured default quota
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS storage_quota BIGINT;
+		-- Bytes of attachments each user has stored, counted towards their quota
+		CREATE TABLE IF NOT EXISTS attachment_usage (
+			user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			attachment_id TEXT NOT NULL,
+			size BIGINT NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, attachment_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_attachment_usage_attachment_id ON attachment_usage(attachment_id);
+	`},
+	{version: 4, name: "webhook dead letters", sql: `
+		-- Webhook events that could not be delivered after every retry
+		CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+			id BIGSERIAL PRIMARY KEY,
+			delivery_id TEXT NOT NULL,
+			url TEXT NOT NULL,
+			event TEXT NOT NULL,
+			payload JSONB NOT NULL,
+			attempts INTEGER NOT NULL,
+			last_error TEXT NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+	`},
+}
+
+// schemaV1 is the schema as it was before migrations were versioned. It only
+// creates what is missing, so databases set up by earlier releases take it
+// as their first migration unchanged.
+const schemaV1 = `
+-- Users table
+CREATE TABLE IF NOT EXISTS users (
+	id BIGSERIAL PRIMARY KEY,
+	username TEXT NOT NULL UNIQUE,
+	password_hash TEXT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+-- The account created by initial setup is the admin; backfill it for existing installs
+UPDATE users SET is_admin = TRUE
+WHERE id = (SELECT MIN(id) FROM users) AND NOT EXISTS (SELECT 1 FROM users WHERE is_admin);
+
+-- API Keys table
+CREATE TABLE IF NOT EXISTS api_keys (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	name TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	last_used_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Sessions table
+CREATE TABLE IF NOT EXISTS sessions (
+	id BIGSERIAL PRIMARY KEY,
+	token TEXT NOT NULL UNIQUE,
+	user_id BIGINT NOT NULL,
+	username TEXT NOT NULL,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_token ON sessions(token);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+
+-- Conversation Histories table
+CREATE TABLE IF NOT EXISTS conversation_histories (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	conversation_id TEXT NOT NULL,
+	version BIGINT NOT NULL DEFAULT 1,
+	hash TEXT NOT NULL DEFAULT '',
+	title TEXT NOT NULL,
+	data JSONB NOT NULL,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	UNIQUE(user_id, conversation_id)
+);
+CREATE INDEX IF NOT EXISTS idx_conversation_histories_user_id ON conversation_histories(user_id);
+CREATE INDEX IF NOT EXISTS idx_conversation_histories_updated_at ON conversation_histories(updated_at);
+ALTER TABLE conversation_histories ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_conversation_histories_deleted_at ON conversation_histories(deleted_at);
+
+-- Attachment references, so attachments can be deleted once no conversation uses them
+CREATE TABLE IF NOT EXISTS attachment_refs (
+	user_id BIGINT NOT NULL,
+	conversation_id TEXT NOT NULL,
+	attachment_id TEXT NOT NULL,
+	PRIMARY KEY (user_id, conversation_id, attachment_id)
+);
+CREATE INDEX IF NOT EXISTS idx_attachment_refs_attachment_id ON attachment_refs(attachment_id);
+-- Backfill references for conversations stored before the table existed
+INSERT INTO attachment_refs (user_id, conversation_id, attachment_id)
+SELECT h.user_id, h.conversation_id, substr(v #>> '{}', length('` + attachmentURLPrefix + `') + 1)
+FROM conversation_histories h, jsonb_path_query(h.data, 'strict $.**') v
+WHERE jsonb_typeof(v) = 'string' AND starts_with(v #>> '{}', '` + attachmentURLPrefix + `')
+	AND NOT EXISTS (SELECT 1 FROM attachment_refs)
+ON CONFLICT DO NOTHING;
+
+-- User Configs table
+CREATE TABLE IF NOT EXISTS user_configs (
+	user_id BIGINT PRIMARY KEY,
+	default_model TEXT NOT NULL DEFAULT '',
+	data JSONB,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Audit log of authentication events, kept when the user is deleted
+CREATE TABLE IF NOT EXISTS audit_log (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT,
+	action TEXT NOT NULL,
+	ip TEXT NOT NULL DEFAULT '',
+	detail TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+`
+
+// migrate brings the schema up to date, applying every migration the database
+// hasn't recorded yet in one transaction
+func (d *PostgresDB) migrate(logger *zap.Logger) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("failed to lock schema_migrations: %w", err)
+	}
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	current, err := schemaVersion(tx)
+	if err != nil {
+		return err
+	}
+	for _, m := range pendingMigrations(current) {
+		if _, err := tx.Exec(m.sql); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.version, m.name); err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", m.version, err)
+		}
+		logger.Info("Applied database migration", zap.Int("version", m.version), zap.String("name", m.name))
+	}
+
+	return tx.Commit()
+}
+
+// schemaVersion returns the newest migration recorded, or 0 for a new database
+func schemaVersion(tx *sql.Tx) (int, error) {
+	var version sql.NullInt64
+	if err := tx.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
+
+// pendingMigrations returns the migrations newer than version, in order
+func pendingMigrations(version int) []migration {
+	for i, m := range migrations {
+		if m.version > version {
+			return migrations[i:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package identity
+
+import "testing"
+
+func TestMigrationsOrdered(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("migration %q has version %d, expected %d", m.name, m.version, i+1)
+		}
+		if m.name == "" || m.sql == "" {
+			t.Errorf("migration %d needs a name and SQL", m.version)
+		}
+	}
+}
+
+func TestPendingMigrations(t *testing.T) {
+	if pending := pendingMigrations(0); len(pending) != len(migrations) {
+		t.Errorf("expected every migration for a new database, got %d", len(pending))
+	}
+	if pending := pendingMigrations(len(migrations)); len(pending) != 0 {
+		t.Errorf("expected nothing pending for an up-to-date database, got %d", len(pending))
+	}
+}
@@ -1,6 +1,10 @@
 package identity
 
 import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 )
 
@@ -12,10 +16,26 @@ type MockDatabase struct {
 	apiKeysByID   map[int64]*APIKey
 	histories     map[int64]map[string]*ConversationHistory
 	configs       map[int64]*UserConfig
+	refs          map[attachmentRef]bool
+	usage         map[int64]map[string]int64 // attachment sizes by user
+	quotas        map[int64]int64
 	nextUserID    int64
 	nextSessionID int64
 	nextAPIKeyID  int64
 	nextHistoryID int64
+
+	// failSaves makes SaveHistory fail for these conversation IDs
+	failSaves map[string]bool
+	// historyQueries counts lookups of conversations by ID
+	historyQueries int
+
+	// Audit events are appended from the audit goroutine
+	auditMu     sync.Mutex
+	auditEvents []AuditEvent
+
+	// Dead letters are added from the webhook goroutines
+	deadLetterMu sync.Mutex
+	deadLetters  []WebhookDeadLetter
 }
 
 func NewMockDatabase() *MockDatabase {
@@ -27,6 +47,9 @@ func NewMockDatabase() *MockDatabase {
 		apiKeysByID:   make(map[int64]*APIKey),
 		histories:     make(map[int64]map[string]*ConversationHistory),
 		configs:       make(map[int64]*UserConfig),
+		refs:          make(map[attachmentRef]bool),
+		usage:         make(map[int64]map[string]int64),
+		quotas:        make(map[int64]int64),
 		nextUserID:    1,
 		nextSessionID: 1,
 		nextAPIKeyID:  1,
@@ -36,6 +59,32 @@ func NewMockDatabase() *MockDatabase {
 
 func (m *MockDatabase) Close() error { return nil }
 
+func (m *MockDatabase) Ping(ctx context.Context) error { return nil }
+
+// WithTx restores the histories and attachment references as they were when
+// fn fails, as rolling back a transaction would
+func (m *MockDatabase) WithTx(fn func(tx Database) error) error {
+	histories := make(map[int64]map[string]*ConversationHistory, len(m.histories))
+	for userID, convs := range m.histories {
+		histories[userID] = make(map[string]*ConversationHistory, len(convs))
+		for id, h := range convs {
+			saved := *h
+			histories[userID][id] = &saved
+		}
+	}
+	refs := make(map[attachmentRef]bool, len(m.refs))
+	for ref := range m.refs {
+		refs[ref] = true
+	}
+	nextHistoryID := m.nextHistoryID
+
+	if err := fn(m); err != nil {
+		m.histories, m.refs, m.nextHistoryID = histories, refs, nextHistoryID
+		return err
+	}
+	return nil
+}
+
 func (m *MockDatabase) CreateUser(user *User) error {
 	user.ID = m.nextUserID
 	m.nextUserID++
@@ -66,11 +115,8 @@ func (m *MockDatabase) CreateSession(session *Session) error {
 }
 
 func (m *MockDatabase) GetSessionByToken(token string) (*Session, error) {
-	s := m.sessions[token]
-	if s != nil && s.ExpiresAt.After(time.Now()) {
-		return s, nil
-	}
-	return nil, nil
+	// Expired rows are returned as-is; GetSession is responsible for rejecting them
+	return m.sessions[token], nil
 }
 
 func (m *MockDatabase) DeleteSession(token string) error {
@@ -129,47 +175,267 @@ func (m *MockDatabase) UpdateAPIKeyLastUsed(id int64) error {
 }
 
 func (m *MockDatabase) SaveHistory(userID int64, history *ConversationHistory) error {
+	if m.failSaves[history.ConversationID] {
+		return fmt.Errorf("failed to save history")
+	}
 	if m.histories[userID] == nil {
 		m.histories[userID] = make(map[string]*ConversationHistory)
 	}
-	if history.ID == 0 {
+	history.UserID = userID
+	history.Hash = ComputeHistoryHash(history)
+	if existing := m.histories[userID][history.ConversationID]; existing != nil {
+		history.ID = existing.ID
+		history.CreatedAt = existing.CreatedAt
+		if existing.Hash == history.Hash && existing.DeletedAt == nil {
+			history.Version = existing.Version
+			history.UpdatedAt = existing.UpdatedAt
+		} else {
+			history.Version = existing.Version + 1
+			history.UpdatedAt = time.Now()
+		}
+	} else {
 		history.ID = m.nextHistoryID
 		m.nextHistoryID++
+		history.Version = 1
 		history.CreatedAt = time.Now()
+		history.UpdatedAt = time.Now()
 	}
-	history.UpdatedAt = time.Now()
-	history.UserID = userID
-	m.histories[userID][history.ConversationID] = history
+	history.DeletedAt = nil
+	saved := *history
+	m.histories[userID][history.ConversationID] = &saved
 	return nil
 }
 
 func (m *MockDatabase) GetAllHistory(userID int64) ([]ConversationHistory, error) {
 	var list []ConversationHistory
 	for _, h := range m.histories[userID] {
-		list = append(list, *h)
+		if h.DeletedAt == nil {
+			list = append(list, *h)
+		}
 	}
 	return list, nil
 }
 
+func (m *MockDatabase) GetHistoryPage(userID int64, limit, offset int) ([]HistorySummary, int, error) {
+	list, _ := m.GetAllHistory(userID)
+	sort.Slice(list, func(i, j int) bool { return list[i].UpdatedAt.After(list[j].UpdatedAt) })
+
+	summaries := []HistorySummary{}
+	for i := offset; i < len(list) && i < offset+limit; i++ {
+		h := list[i]
+		summaries = append(summaries, HistorySummary{
+			ConversationID: h.ConversationID,
+			Title:          h.Title,
+			Version:        h.Version,
+			Hash:           h.Hash,
+			UpdatedAt:      h.UpdatedAt,
+		})
+	}
+	return summaries, len(list), nil
+}
+
 func (m *MockDatabase) GetHistoryByID(userID int64, conversationID string) (*ConversationHistory, error) {
-	if m.histories[userID] == nil {
+	m.historyQueries++
+	h := m.histories[userID][conversationID]
+	if h == nil || h.DeletedAt != nil {
 		return nil, nil
 	}
-	return m.histories[userID][conversationID], nil
+	return h, nil
+}
+
+func (m *MockDatabase) GetHistoriesByIDs(userID int64, conversationIDs []string) ([]ConversationHistory, error) {
+	m.historyQueries++
+	histories := []ConversationHistory{}
+	for _, id := range conversationIDs {
+		if h := m.histories[userID][id]; h != nil && h.DeletedAt == nil {
+			histories = append(histories, *h)
+		}
+	}
+	sort.Slice(histories, func(i, j int) bool { return histories[i].UpdatedAt.After(histories[j].UpdatedAt) })
+	return histories, nil
+}
+
+func (m *MockDatabase) GetHistoryChanges(userID int64, since time.Time) ([]HistorySummary, error) {
+	summaries := []HistorySummary{}
+	for _, h := range m.histories[userID] {
+		if h.UpdatedAt.After(since) {
+			summaries = append(summaries, HistorySummary{
+				ConversationID: h.ConversationID,
+				Title:          h.Title,
+				Version:        h.Version,
+				Hash:           h.Hash,
+				UpdatedAt:      h.UpdatedAt,
+				DeletedAt:      h.DeletedAt,
+			})
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].UpdatedAt.Before(summaries[j].UpdatedAt) })
+	return summaries, nil
 }
 
 func (m *MockDatabase) DeleteHistory(userID int64, conversationID string) error {
-	if m.histories[userID] != nil {
-		delete(m.histories[userID], conversationID)
+	h := m.histories[userID][conversationID]
+	if h == nil || h.DeletedAt != nil {
+		return fmt.Errorf("conversation not found")
 	}
+	now := time.Now()
+	h.DeletedAt = &now
+	h.UpdatedAt = now
 	return nil
 }
 
 func (m *MockDatabase) DeleteAllHistory(userID int64) error {
-	m.histories[userID] = make(map[string]*ConversationHistory)
+	now := time.Now()
+	for _, h := range m.histories[userID] {
+		if h.DeletedAt == nil {
+			h.DeletedAt = &now
+			h.UpdatedAt = now
+		}
+	}
 	return nil
 }
 
+func (m *MockDatabase) GetDeletedHistory(userID int64) ([]HistorySummary, error) {
+	summaries := []HistorySummary{}
+	for _, h := range m.histories[userID] {
+		if h.DeletedAt != nil {
+			summaries = append(summaries, HistorySummary{
+				ConversationID: h.ConversationID,
+				Title:          h.Title,
+				Version:        h.Version,
+				Hash:           h.Hash,
+				UpdatedAt:      h.UpdatedAt,
+				DeletedAt:      h.DeletedAt,
+			})
+		}
+	}
+	return summaries, nil
+}
+
+func (m *MockDatabase) RestoreHistory(userID int64, conversationID string) error {
+	h := m.histories[userID][conversationID]
+	if h == nil || h.DeletedAt == nil {
+		return fmt.Errorf("conversation not found in trash")
+	}
+	h.DeletedAt = nil
+	h.UpdatedAt = time.Now()
+	return nil
+}
+
+func (m *MockDatabase) PurgeDeletedHistory(olderThan time.Time) (int64, []string, error) {
+	var purged int64
+	released := make(map[string]bool)
+	for userID, convs := range m.histories {
+		for id, h := range convs {
+			if h.DeletedAt != nil && h.DeletedAt.Before(olderThan) {
+				delete(convs, id)
+				purged++
+				for ref := range m.refs {
+					if ref.userID == userID && ref.conversationID == id {
+						delete(m.refs, ref)
+						released[ref.attachmentID] = true
+					}
+				}
+			}
+		}
+	}
+	for ref := range m.refs {
+		delete(released, ref.attachmentID)
+	}
+
+	var orphaned []string
+	for id := range released {
+		orphaned = append(orphaned, id)
+		for _, sizes := range m.usage {
+			delete(sizes, id)
+		}
+	}
+	return purged, orphaned, nil
+}
+
+type attachmentRef struct {
+	userID         int64
+	conversationID string
+	attachmentID   string
+}
+
+func (m *MockDatabase) AddAttachmentRefs(userID int64, conversationID string, attachmentIDs []string) error {
+	for _, id := range attachmentIDs {
+		m.refs[attachmentRef{userID, conversationID, id}] = true
+	}
+	return nil
+}
+
+func (m *MockDatabase) UpdateHistoryTitle(userID int64, history *ConversationHistory, previousHash string) (bool, error) {
+	existing := m.histories[userID][history.ConversationID]
+	if existing == nil || existing.Hash != previousHash || existing.DeletedAt != nil {
+		return false, nil
+	}
+	existing.Title = history.Title
+	existing.Hash = history.Hash
+	existing.Version++
+	existing.UpdatedAt = time.Now()
+	history.Version, history.UpdatedAt = existing.Version, existing.UpdatedAt
+	return true, nil
+}
+
+func (m *MockDatabase) AddAttachmentUsage(userID int64, attachmentID string, size int64) error {
+	if m.usage[userID] == nil {
+		m.usage[userID] = make(map[string]int64)
+	}
+	if _, exists := m.usage[userID][attachmentID]; !exists {
+		m.usage[userID][attachmentID] = size
+	}
+	return nil
+}
+
+func (m *MockDatabase) GetStorageUsage(userID int64) (*StorageUsage, error) {
+	usage := &StorageUsage{}
+	for _, h := range m.histories[userID] {
+		usage.ConversationBytes += int64(len(h.Data))
+	}
+	for _, size := range m.usage[userID] {
+		usage.AttachmentBytes += size
+	}
+	if quota, ok := m.quotas[userID]; ok {
+		usage.QuotaOverride = &quota
+	}
+	return usage, nil
+}
+
+func (m *MockDatabase) SetStorageQuota(userID int64, quota *int64) error {
+	if quota == nil {
+		delete(m.quotas, userID)
+		return nil
+	}
+	m.quotas[userID] = *quota
+	return nil
+}
+
+func (m *MockDatabase) ImportHistories(userID int64, histories []ConversationHistory, onConflict string) (*HistoryImportResult, error) {
+	result := &HistoryImportResult{Renamed: make(map[string]string)}
+	for i := range histories {
+		h := histories[i]
+		if existing := m.histories[userID][h.ConversationID]; existing != nil && existing.DeletedAt == nil {
+			switch onConflict {
+			case ImportConflictSkip:
+				result.Skipped++
+				continue
+			case ImportConflictOverwrite:
+				h.ID = existing.ID
+			default:
+				newID := fmt.Sprintf("%s-imported-%d", h.ConversationID, m.nextHistoryID)
+				result.Renamed[h.ConversationID] = newID
+				h.ConversationID = newID
+			}
+		}
+		m.SaveHistory(userID, &h)
+		result.Imported++
+		result.Conversations = append(result.Conversations, *m.histories[userID][h.ConversationID])
+	}
+	return result, nil
+}
+
 func (m *MockDatabase) GetUserConfig(userID int64) (*UserConfig, error) {
 	c := m.configs[userID]
 	if c == nil {
@@ -182,3 +448,50 @@ func (m *MockDatabase) UpdateUserConfig(config *UserConfig) error {
 	m.configs[config.UserID] = config
 	return nil
 }
+
+func (m *MockDatabase) AppendAuditEvent(userID int64, action, ip, detail string) error {
+	m.auditMu.Lock()
+	defer m.auditMu.Unlock()
+	m.auditEvents = append(m.auditEvents, AuditEvent{
+		ID:        int64(len(m.auditEvents) + 1),
+		UserID:    userID,
+		Action:    action,
+		IP:        ip,
+		Detail:    detail,
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+func (m *MockDatabase) GetAuditEvents(limit, offset int) ([]AuditEvent, int, error) {
+	m.auditMu.Lock()
+	defer m.auditMu.Unlock()
+	events := []AuditEvent{}
+	for i := len(m.auditEvents) - 1 - offset; i >= 0 && len(events) < limit; i-- {
+		events = append(events, m.auditEvents[i])
+	}
+	return events, len(m.auditEvents), nil
+}
+
+func (m *MockDatabase) PruneAuditEvents(olderThan time.Time) (int64, error) {
+	m.auditMu.Lock()
+	defer m.auditMu.Unlock()
+	kept := m.auditEvents[:0]
+	for _, e := range m.auditEvents {
+		if !e.CreatedAt.Before(olderThan) {
+			kept = append(kept, e)
+		}
+	}
+	pruned := int64(len(m.auditEvents) - len(kept))
+	m.auditEvents = kept
+	return pruned, nil
+}
+
+func (m *MockDatabase) AddWebhookDeadLetter(letter *WebhookDeadLetter) error {
+	m.deadLetterMu.Lock()
+	defer m.deadLetterMu.Unlock()
+	letter.ID = int64(len(m.deadLetters) + 1)
+	letter.CreatedAt = time.Now()
+	m.deadLetters = append(m.deadLetters, *letter)
+	return nil
+}
@@ -10,16 +10,19 @@ type User struct {
 	ID           int64     `json:"id"`
 	Username     string    `json:"username"`
 	PasswordHash string    `json:"-"`
+	IsAdmin      bool      `json:"is_admin"`
 	CreatedAt    time.Time `json:"created_at"`
 }
 
-// Session represents an authenticated session
+// Session represents an authenticated session. Sessions built from an API
+// key have no expiry of their own, so ExpiresAt is left zero.
 type Session struct {
 	ID        int64     `json:"id"`
 	Token     string    `json:"token"`
 	UserID    int64     `json:"user_id"`
 	Username  string    `json:"username"`
-	ExpiresAt time.Time `json:"expires_at"`
+	APIKeyID  int64     `json:"api_key_id,omitempty"` // Set for sessions authenticated by API key
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
@@ -62,6 +65,79 @@ type ConversationHistory struct {
 	Data           json.RawMessage `json:"data"` // Stores the full conversation state (messages, checkpoints, etc.)
 	UpdatedAt      time.Time       `json:"updated_at"`
 	CreatedAt      time.Time       `json:"created_at"`
+	DeletedAt      *time.Time      `json:"deleted_at,omitempty"` // Set when the conversation is in the trash
+}
+
+// HistorySummary represents conversation metadata without the heavy data payload
+type HistorySummary struct {
+	ConversationID string     `json:"conversation_id"`
+	Title          string     `json:"title"`
+	Version        int64      `json:"version"`
+	Hash           string     `json:"hash"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+}
+
+// StorageUsage is the space a user's conversations and attachments take up
+type StorageUsage struct {
+	ConversationBytes int64  `json:"conversation_bytes"`
+	AttachmentBytes   int64  `json:"attachment_bytes"`
+	QuotaOverride     *int64 `json:"-"` // Set by an admin in place of the configured quota
+}
+
+// WebhookDeadLetter is a webhook event that failed every delivery attempt
+type WebhookDeadLetter struct {
+	ID         int64           `json:"id"`
+	DeliveryID string          `json:"delivery_id"`
+	URL        string          `json:"url"`
+	Event      string          `json:"event"`
+	Payload    json.RawMessage `json:"payload"`
+	Attempts   int             `json:"attempts"`
+	LastError  string          `json:"last_error"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// Audit event actions
+const (
+	AuditLogin         = "login"
+	AuditLoginFailed   = "login_failed"
+	AuditLogout        = "logout"
+	AuditAPIKeyCreated = "api_key_created"
+	AuditAPIKeyDeleted = "api_key_deleted"
+	AuditAuthFailed    = "auth_failed"
+	AuditQuotaChanged  = "storage_quota_changed"
+)
+
+// AuditEvent is a recorded authentication event. UserID is zero when the
+// event can't be tied to a user, such as a login for an unknown username.
+type AuditEvent struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id,omitempty"`
+	Action    string    `json:"action"`
+	IP        string    `json:"ip"`
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuditPageResponse represents a single page of audit events, newest first
+type AuditPageResponse struct {
+	Items []AuditEvent `json:"items"`
+	Total int          `json:"total"`
+	Page  int          `json:"page"`
+	Limit int          `json:"limit"`
+}
+
+// HistoryPageResponse represents a single page of conversation metadata
+type HistoryPageResponse struct {
+	Items []HistorySummary `json:"items"`
+	Total int              `json:"total"`
+	Page  int              `json:"page"`
+	Limit int              `json:"limit"`
+}
+
+// RestoreHistoryRequest represents a request to restore a conversation from the trash
+type RestoreHistoryRequest struct {
+	ConversationID string `json:"conversation_id"`
 }
 
 // HistorySyncRequest represents a request to sync conversation histories
@@ -71,8 +147,16 @@ type HistorySyncRequest struct {
 
 // HistorySyncResponse represents the response from a sync operation
 type HistorySyncResponse struct {
-	Conversations []ConversationHistory `json:"conversations"`
-	Conflicts     []string              `json:"conflicts,omitempty"` // IDs of conversations with conflicts
+	Conversations   []ConversationHistory `json:"conversations"`
+	Conflicts       []string              `json:"conflicts,omitempty"`        // IDs of conversations with conflicts
+	ConflictDetails []ConflictDetail      `json:"conflict_details,omitempty"` // Both sides of each conflict, for manual merging
+}
+
+// ConflictDetail describes how a same-version conflict was resolved
+type ConflictDetail struct {
+	ID     string              `json:"id"`
+	Winner ConversationHistory `json:"winner"` // The version now stored on the server
+	Loser  ConversationHistory `json:"loser"`  // The version that was discarded
 }
 
 // ManifestItem represents a lightweight conversation summary for diff comparison
@@ -83,9 +167,13 @@ type ManifestItem struct {
 	Version        int64  `json:"version"`
 }
 
-// ManifestResponse represents the list of conversation hashes
+// ManifestResponse represents the list of conversation hashes. When
+// Incremental is set it only lists what changed after the request's since.
 type ManifestResponse struct {
-	Items []ManifestItem `json:"items"`
+	Items       []ManifestItem `json:"items"`
+	Deleted     []string       `json:"deleted,omitempty"` // Conversations moved to the trash after since
+	Incremental bool           `json:"incremental"`
+	Cursor      int64          `json:"cursor"` // Unix timestamp milliseconds to pass as since next time
 }
 
 // DeltaSyncRequest represents a request to sync only changed conversations
@@ -97,15 +185,57 @@ type DeltaSyncRequest struct {
 
 // DeltaSyncResponse represents the response from a delta sync operation
 type DeltaSyncResponse struct {
-	Pushed        []string              `json:"pushed"`                   // IDs that were successfully pushed
+	Pushed        []PushedConversation  `json:"pushed"`                   // Stored state of each conversation saved from the push
 	Pulled        []ConversationHistory `json:"pulled"`                   // Conversations pulled from server
 	Conflicts     []string              `json:"conflicts,omitempty"`      // Conflict IDs (if any)
 	ServerDeleted []string              `json:"server_deleted,omitempty"` // IDs deleted on server
 }
 
+// PushedConversation is how a pushed conversation was stored, so the client
+// can record the server's version and hash and not push it again
+type PushedConversation struct {
+	ConversationID string    `json:"conversation_id"`
+	Version        int64     `json:"version"`
+	Hash           string    `json:"hash"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Conflict strategies for history import
+const (
+	ImportConflictRename    = "rename"
+	ImportConflictSkip      = "skip"
+	ImportConflictOverwrite = "overwrite"
+)
+
+// HistoryImportResult represents the outcome of a bulk history import
+type HistoryImportResult struct {
+	Imported int               `json:"imported"`
+	Skipped  int               `json:"skipped"`
+	Renamed  map[string]string `json:"renamed,omitempty"` // Original ID -> newly assigned ID
+
+	Conversations []ConversationHistory `json:"-"` // The imported conversations as stored
+}
+
 // UserConfig represents a user's configuration settings
 type UserConfig struct {
 	UserID       int64           `json:"user_id,omitempty"`
 	DefaultModel string          `json:"default_model"`
 	Data         json.RawMessage `json:"data,omitempty"`
 }
+
+// AttachmentReference lists an attachment referenced by one or more conversations
+type AttachmentReference struct {
+	ID              string   `json:"id"`
+	URL             string   `json:"url"`
+	ConversationIDs []string `json:"conversation_ids"`
+}
+
+// UserExport represents everything stored about a user, for data export
+type UserExport struct {
+	ExportedAt    time.Time             `json:"exported_at"`
+	User          *User                 `json:"user"`
+	Conversations []ConversationHistory `json:"conversations"`
+	APIKeys       []APIKey              `json:"api_keys"`
+	Config        *UserConfig           `json:"config"`
+	Attachments   []AttachmentReference `json:"attachments"`
+}
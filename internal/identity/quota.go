@@ -0,0 +1,181 @@
+package identity
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// ErrStorageQuotaExceeded is returned when a save would take a user over their storage quota
+var ErrStorageQuotaExceeded = errors.New("storage quota exceeded")
+
+// globalStorageQuota is the bytes each user may store unless an admin set
+// their own quota; 0 is unlimited. It is swapped on config reload.
+var globalStorageQuota atomic.Int64
+
+// SetDefaultStorageQuota sets the bytes of conversations and attachments each
+// user may store, for users without a quota of their own. 0 is unlimited.
+func SetDefaultStorageQuota(bytes int64) {
+	globalStorageQuota.Store(bytes)
+}
+
+// Total returns the bytes of conversations and attachments together
+func (u *StorageUsage) Total() int64 {
+	return u.ConversationBytes + u.AttachmentBytes
+}
+
+// Quota returns the bytes the user may store, 0 when unlimited
+func (u *StorageUsage) Quota() int64 {
+	if u.QuotaOverride != nil {
+		return *u.QuotaOverride
+	}
+	return globalStorageQuota.Load()
+}
+
+// StorageUsageResponse reports a user's storage against their quota
+type StorageUsageResponse struct {
+	StorageUsage
+	TotalBytes int64 `json:"total_bytes"`
+	QuotaBytes int64 `json:"quota_bytes"` // 0 when unlimited
+}
+
+// storageBudget tracks the space left in a user's quota while a sync saves
+// conversations
+type storageBudget struct {
+	db     Database
+	userID int64
+	quota  int64
+	used   int64
+}
+
+func newStorageBudget(db Database, userID int64) (*storageBudget, error) {
+	usage, err := db.GetStorageUsage(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &storageBudget{db: db, userID: userID, quota: usage.Quota(), used: usage.Total()}, nil
+}
+
+// reserve takes added bytes from the budget. Saves that don't grow the
+// user's storage are always allowed, so a user over quota can still shrink it.
+func (b *storageBudget) reserve(added int64) error {
+	if b.quota > 0 && added > 0 && b.used+added > b.quota {
+		return ErrStorageQuotaExceeded
+	}
+	b.used += added
+	return nil
+}
+
+// save stores conv if it fits the quota. previous is the stored conversation
+// conv replaces, nil when it is new.
+func (b *storageBudget) save(conv, previous *ConversationHistory) error {
+	added := int64(len(conv.Data))
+	if previous != nil {
+		added -= int64(len(previous.Data))
+	}
+	if err := b.reserve(added); err != nil {
+		return err
+	}
+	return b.db.SaveHistory(b.userID, conv)
+}
+
+// CheckStorageQuota returns ErrStorageQuotaExceeded if storing size more
+// bytes would take the user over their quota
+func (am *AuthManager) CheckStorageQuota(userID int64, size int64) error {
+	budget, err := newStorageBudget(am.db, userID)
+	if err != nil {
+		return err
+	}
+	return budget.reserve(size)
+}
+
+// RecordAttachmentUsage counts a stored attachment towards the user's quota
+func (am *AuthManager) RecordAttachmentUsage(userID int64, attachmentID string, size int64) error {
+	return am.db.AddAttachmentUsage(userID, attachmentID, size)
+}
+
+// GetStorageUsage reports the space the user's conversations and attachments take up
+func (am *AuthManager) GetStorageUsage(w http.ResponseWriter, r *http.Request) {
+	session, _ := am.GetSession(r)
+	if session == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	usage, err := am.db.GetStorageUsage(session.UserID)
+	if err != nil {
+		if globalLogger != nil {
+			globalLogger.Error("Failed to get storage usage", zap.Error(err))
+		}
+		http.Error(w, "failed to get storage usage", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StorageUsageResponse{
+		StorageUsage: *usage,
+		TotalBytes:   usage.Total(),
+		QuotaBytes:   usage.Quota(),
+	})
+}
+
+// SetUserStorageQuota sets the storage quota of the user named in the path,
+// /v1/admin/users/{id}/quota. A null quota_bytes clears the user's own quota
+// so the configured default applies; 0 makes the user unlimited.
+func (am *AuthManager) SetUserStorageQuota(w http.ResponseWriter, r *http.Request) {
+	session, _ := am.GetSession(r)
+	if session == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idPart := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/admin/users/"), "/quota")
+	userID, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		QuotaBytes *int64 `json:"quota_bytes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.QuotaBytes != nil && *req.QuotaBytes < 0 {
+		http.Error(w, "quota_bytes must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	user, err := am.db.GetUserByID(userID)
+	if err != nil {
+		http.Error(w, "failed to get user", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	if err := am.db.SetStorageQuota(userID, req.QuotaBytes); err != nil {
+		if globalLogger != nil {
+			globalLogger.Error("Failed to set storage quota", zap.Int64("user_id", userID), zap.Error(err))
+		}
+		http.Error(w, "failed to set storage quota", http.StatusInternalServerError)
+		return
+	}
+
+	detail := user.Username + ": default"
+	if req.QuotaBytes != nil {
+		detail = user.Username + ": " + strconv.FormatInt(*req.QuotaBytes, 10)
+	}
+	am.recordAudit(r, session.UserID, AuditQuotaChanged, detail)
+
+	w.WriteHeader(http.StatusNoContent)
+}
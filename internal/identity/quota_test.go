@@ -0,0 +1,138 @@
+package identity
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStorageQuota(t *testing.T) {
+	SetDefaultStorageQuota(100)
+	defer SetDefaultStorageQuota(0)
+
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	admin := &User{Username: "admin", IsAdmin: true}
+	db.CreateUser(admin)
+	user := &User{Username: "testuser"}
+	db.CreateUser(user)
+
+	sessionCookie := func(user *User) *http.Cookie {
+		token, _ := generateSessionToken()
+		db.CreateSession(&Session{Token: token, UserID: user.ID, Username: user.Username, ExpiresAt: time.Now().Add(time.Hour)})
+		return &http.Cookie{Name: sessionCookieName, Value: token}
+	}
+	cookie := sessionCookie(user)
+
+	sync := func(id string, size int) int {
+		data, _ := json.Marshal(string(bytes.Repeat([]byte("a"), size-2)))
+		body, _ := json.Marshal(HistorySyncRequest{Conversations: []ConversationHistory{
+			{ConversationID: id, Version: 1, Title: "Title", Data: data, UpdatedAt: time.Now()},
+		}})
+		req, _ := http.NewRequest("POST", "/v1/user/me/history", bytes.NewBuffer(body))
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		am.SyncHistory(rr, req)
+		return rr.Code
+	}
+	usage := func() StorageUsageResponse {
+		req, _ := http.NewRequest("GET", "/v1/user/me/usage/storage", nil)
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		am.GetStorageUsage(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rr.Code)
+		}
+		var resp StorageUsageResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return resp
+	}
+	setQuota := func(body string) int {
+		req, _ := http.NewRequest("PUT", "/v1/admin/users/2/quota", bytes.NewBufferString(body))
+		req.AddCookie(sessionCookie(admin))
+		rr := httptest.NewRecorder()
+		am.RequireAdmin(am.SetUserStorageQuota)(rr, req)
+		return rr.Code
+	}
+
+	t.Run("WithinQuota", func(t *testing.T) {
+		if code := sync("conv1", 60); code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", code)
+		}
+		db.AddAttachmentUsage(user.ID, "attachment1", 20)
+
+		got := usage()
+		if got.ConversationBytes != 60 || got.AttachmentBytes != 20 || got.TotalBytes != 80 || got.QuotaBytes != 100 {
+			t.Errorf("unexpected usage: %+v", got)
+		}
+	})
+
+	t.Run("OverQuota", func(t *testing.T) {
+		if code := sync("conv2", 30); code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("expected 413, got %d", code)
+		}
+		if db.histories[user.ID]["conv2"] != nil {
+			t.Error("expected the rejected conversation not to be saved")
+		}
+		if err := am.CheckStorageQuota(user.ID, 30); err != ErrStorageQuotaExceeded {
+			t.Errorf("expected an attachment over the quota to be refused, got %v", err)
+		}
+	})
+
+	t.Run("ShrinkingOverQuota", func(t *testing.T) {
+		SetDefaultStorageQuota(50)
+		defer SetDefaultStorageQuota(100)
+
+		// A conversation that gets smaller is saved even though the user is over quota
+		if code := sync("conv1", 40); code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", code)
+		}
+	})
+
+	t.Run("AdminOverride", func(t *testing.T) {
+		if code := setQuota(`{"quota_bytes": 1000}`); code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d", code)
+		}
+		if got := usage().QuotaBytes; got != 1000 {
+			t.Errorf("expected the user's own quota, got %d", got)
+		}
+		if code := sync("conv2", 30); code != http.StatusOK {
+			t.Errorf("expected 200 under the raised quota, got %d", code)
+		}
+
+		if code := setQuota(`{"quota_bytes": null}`); code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d", code)
+		}
+		if got := usage().QuotaBytes; got != 100 {
+			t.Errorf("expected the default quota once the override is cleared, got %d", got)
+		}
+	})
+
+	t.Run("AdminOverrideInvalid", func(t *testing.T) {
+		if code := setQuota(`{"quota_bytes": -1}`); code != http.StatusBadRequest {
+			t.Errorf("expected 400 for a negative quota, got %d", code)
+		}
+
+		req, _ := http.NewRequest("PUT", "/v1/admin/users/99/quota", bytes.NewBufferString(`{"quota_bytes": 1}`))
+		req.AddCookie(sessionCookie(admin))
+		rr := httptest.NewRecorder()
+		am.RequireAdmin(am.SetUserStorageQuota)(rr, req)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected 404 for an unknown user, got %d", rr.Code)
+		}
+	})
+
+	t.Run("NotAdmin", func(t *testing.T) {
+		req, _ := http.NewRequest("PUT", "/v1/admin/users/2/quota", bytes.NewBufferString(`{"quota_bytes": 1}`))
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		am.RequireAdmin(am.SetUserStorageQuota)(rr, req)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected 403, got %d", rr.Code)
+		}
+	})
+}
@@ -0,0 +1,257 @@
+package identity
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// s3ContentTypeMeta is the object metadata key holding the attachment's content type
+	s3ContentTypeMeta = "X-Amz-Meta-Content-Type"
+	s3RequestTimeout  = 30 * time.Second
+	s3DefaultRegion   = "us-east-1"
+)
+
+// S3StoreConfig configures an S3Store
+type S3StoreConfig struct {
+	Bucket          string
+	Region          string // defaults to us-east-1
+	Endpoint        string // for S3-compatible services such as MinIO; AWS when empty
+	Prefix          string // prepended to every object key
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// S3Store implements AttachmentStore using an S3-compatible object store.
+// Requests are signed with AWS Signature Version 4. A custom endpoint is
+// addressed path-style (endpoint/bucket/key), which MinIO and most
+// S3-compatible services expect; AWS itself is addressed virtual-hosted style.
+type S3Store struct {
+	cfg     S3StoreConfig
+	baseURL *url.URL
+	client  *http.Client
+	now     func() time.Time
+}
+
+// NewS3Store creates a new S3 storage instance
+func NewS3Store(cfg S3StoreConfig) (*S3Store, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 attachment store requires a bucket")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, fmt.Errorf("s3 attachment store requires an access key ID and secret access key")
+	}
+	if cfg.Region == "" {
+		cfg.Region = s3DefaultRegion
+	}
+
+	rawURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/", cfg.Bucket, cfg.Region)
+	if cfg.Endpoint != "" {
+		rawURL = strings.TrimSuffix(cfg.Endpoint, "/") + "/" + cfg.Bucket + "/"
+	}
+	baseURL, err := url.Parse(rawURL)
+	if err != nil || baseURL.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", cfg.Endpoint)
+	}
+
+	return &S3Store{
+		cfg:     cfg,
+		baseURL: baseURL,
+		client:  &http.Client{Timeout: s3RequestTimeout},
+		now:     time.Now,
+	}, nil
+}
+
+// Save stores the attachment data and returns a UUID
+func (s *S3Store) Save(data []byte, contentType string) (string, error) {
+	id := uuid.New().String()
+
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+		header.Set(s3ContentTypeMeta, contentType)
+	}
+
+	resp, err := s.do(http.MethodPut, id, header, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload attachment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to upload attachment: %s", s3Error(resp))
+	}
+	return id, nil
+}
+
+// Get retrieves the attachment data by UUID
+func (s *S3Store) Get(id string) ([]byte, string, error) {
+	resp, err := s.do(http.MethodGet, id, nil, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read attachment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", fmt.Errorf("attachment not found")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to read attachment: %s", s3Error(resp))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read attachment: %w", err)
+	}
+
+	contentType := resp.Header.Get(s3ContentTypeMeta)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return data, contentType, nil
+}
+
+// Stat returns an attachment's size, content type and modification time
+func (s *S3Store) Stat(id string) (AttachmentInfo, error) {
+	resp, err := s.do(http.MethodHead, id, nil, nil)
+	if err != nil {
+		return AttachmentInfo{}, fmt.Errorf("failed to stat attachment: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return AttachmentInfo{}, fmt.Errorf("attachment not found")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return AttachmentInfo{}, fmt.Errorf("failed to stat attachment: unexpected status %d", resp.StatusCode)
+	}
+
+	info := AttachmentInfo{
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get(s3ContentTypeMeta),
+	}
+	if info.ContentType == "" {
+		info.ContentType = "application/octet-stream"
+	}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = modTime
+	}
+	return info, nil
+}
+
+// Delete removes an attachment by UUID
+func (s *S3Store) Delete(id string) error {
+	// S3 deletes succeed for missing keys, so check first to report not-found like LocalFileStore
+	resp, err := s.do(http.MethodHead, id, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete attachment: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("attachment not found")
+	}
+
+	resp, err = s.do(http.MethodDelete, id, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete attachment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to delete attachment: %s", s3Error(resp))
+	}
+	return nil
+}
+
+// do sends a signed request for the object holding attachment id
+func (s *S3Store) do(method, id string, header http.Header, body []byte) (*http.Response, error) {
+	objectURL := s.baseURL.JoinPath(s.cfg.Prefix + id)
+	req, err := http.NewRequest(method, objectURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body == nil {
+		req.Body = http.NoBody
+		req.ContentLength = 0
+	}
+
+	payloadHash := sha256.Sum256(body)
+	signS3Request(req, hex.EncodeToString(payloadHash[:]), s.cfg.Region, s.cfg.AccessKeyID, s.cfg.SecretAccessKey, s.now())
+	return s.client.Do(req)
+}
+
+// s3Error summarizes an unexpected S3 response for an error message
+func s3Error(resp *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Sprintf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// signS3Request adds AWS Signature Version 4 headers to req. Host, Content-Type,
+// Range and every x-amz-* header are signed.
+func signS3Request(req *http.Request, payloadHash, region, accessKeyID, secretAccessKey string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,230 @@
+package identity
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	// SyncEventUpdated is sent when conversations were created or modified
+	SyncEventUpdated = "history_updated"
+	// SyncEventDeleted is sent when conversations were moved to the trash
+	SyncEventDeleted = "history_deleted"
+
+	syncSubscriberBuffer = 16
+	syncWriteTimeout     = 10 * time.Second
+	syncPingInterval     = 30 * time.Second
+	syncPongTimeout      = 60 * time.Second
+)
+
+// SyncEvent notifies connected clients that they should run a delta pull.
+// An empty ConversationIDs list means any conversation may have changed.
+type SyncEvent struct {
+	Type            string    `json:"type"`
+	ConversationIDs []string  `json:"conversation_ids"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// SyncHub is an in-process pub/sub of history changes keyed by user ID. It
+// also tracks the sync WebSockets, which http.Server.Shutdown neither waits
+// for nor closes once they are hijacked.
+type SyncHub struct {
+	mu          sync.RWMutex
+	subscribers map[int64]map[chan SyncEvent]struct{}
+
+	closing  bool
+	shutdown chan struct{} // closed when connections should close
+	conns    sync.WaitGroup
+}
+
+// NewSyncHub creates an empty SyncHub
+func NewSyncHub() *SyncHub {
+	return &SyncHub{
+		subscribers: make(map[int64]map[chan SyncEvent]struct{}),
+		shutdown:    make(chan struct{}),
+	}
+}
+
+// connect registers a live connection, reporting false once the hub is
+// shutting down. A registered connection must call disconnect when it ends.
+func (h *SyncHub) connect() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closing {
+		return false
+	}
+	h.conns.Add(1)
+	return true
+}
+
+func (h *SyncHub) disconnect() {
+	h.conns.Done()
+}
+
+// Shutdown tells every connection to send a close frame and end, then waits
+// until they have or ctx is done. Later connections are refused.
+func (h *SyncHub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	if !h.closing {
+		h.closing = true
+		close(h.shutdown)
+	}
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.conns.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Subscribe registers a listener for the user's events. The returned function
+// unregisters it and must be called once the listener is done.
+func (h *SyncHub) Subscribe(userID int64) (<-chan SyncEvent, func()) {
+	ch := make(chan SyncEvent, syncSubscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan SyncEvent]struct{})
+	}
+	h.subscribers[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers[userID], ch)
+			if len(h.subscribers[userID]) == 0 {
+				delete(h.subscribers, userID)
+			}
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish delivers an event to every listener of the user. Slow listeners that
+// have a full buffer miss the event; their next delta pull catches them up.
+func (h *SyncHub) Publish(userID int64, event SyncEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for ch := range h.subscribers[userID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// SubscriberCount returns the number of active listeners for a user
+func (h *SyncHub) SubscriberCount(userID int64) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subscribers[userID])
+}
+
+// CloseSyncConnections closes the sync WebSockets with a close frame, waiting
+// until they are closed or ctx is done
+func (am *AuthManager) CloseSyncConnections(ctx context.Context) error {
+	return am.syncHub.Shutdown(ctx)
+}
+
+// publishHistoryChange notifies the user's connected devices about changed conversations
+func (am *AuthManager) publishHistoryChange(userID int64, eventType string, conversationIDs ...string) {
+	am.syncHub.Publish(userID, SyncEvent{
+		Type:            eventType,
+		ConversationIDs: conversationIDs,
+		Timestamp:       time.Now().UTC(),
+	})
+}
+
+var syncUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// SyncWebSocket upgrades the connection and pushes a SyncEvent whenever the user's history changes
+func (am *AuthManager) SyncWebSocket(w http.ResponseWriter, r *http.Request) {
+	session, _ := am.GetSession(r)
+	if session == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if !am.syncHub.connect() {
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer am.syncHub.disconnect()
+
+	conn, err := syncUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written an error response
+		return
+	}
+	defer conn.Close()
+
+	events, unsubscribe := am.syncHub.Subscribe(session.UserID)
+	defer unsubscribe()
+
+	// The client never sends anything meaningful; reading is only needed to
+	// process pongs and notice when the connection goes away.
+	closed := make(chan struct{})
+	conn.SetReadDeadline(time.Now().Add(syncPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(syncPongTimeout))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(syncPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-am.syncHub.shutdown:
+			message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+			conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(syncWriteTimeout))
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(syncWriteTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				if globalLogger != nil {
+					globalLogger.Debug("Failed to write sync event",
+						zap.Int64("user_id", session.UserID),
+						zap.Error(err))
+				}
+				return
+			}
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(syncWriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package identity
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSyncHub(t *testing.T) {
+	hub := NewSyncHub()
+
+	a, unsubA := hub.Subscribe(1)
+	b, unsubB := hub.Subscribe(1)
+	other, unsubOther := hub.Subscribe(2)
+	defer unsubOther()
+
+	hub.Publish(1, SyncEvent{Type: SyncEventUpdated, ConversationIDs: []string{"c1"}})
+
+	for name, ch := range map[string]<-chan SyncEvent{"a": a, "b": b} {
+		select {
+		case event := <-ch:
+			if event.Type != SyncEventUpdated || len(event.ConversationIDs) != 1 {
+				t.Errorf("subscriber %s: unexpected event %+v", name, event)
+			}
+		default:
+			t.Errorf("subscriber %s: expected an event", name)
+		}
+	}
+
+	select {
+	case event := <-other:
+		t.Errorf("expected no event for another user, got %+v", event)
+	default:
+	}
+
+	unsubA()
+	unsubA()
+	unsubB()
+	if n := hub.SubscriberCount(1); n != 0 {
+		t.Errorf("expected subscribers to be cleaned up, got %d", n)
+	}
+}
+
+func TestSyncWebSocket(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	user := &User{Username: "testuser"}
+	db.CreateUser(user)
+	token, _ := generateSessionToken()
+	db.CreateSession(&Session{Token: token, UserID: user.ID, Username: user.Username, ExpiresAt: time.Now().Add(time.Hour)})
+	db.SaveHistory(user.ID, &ConversationHistory{ConversationID: "c1"})
+
+	server := httptest.NewServer(http.HandlerFunc(am.SyncWebSocket))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		_, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		if err == nil {
+			t.Fatal("expected dial to fail without a session")
+		}
+		if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %v", resp)
+		}
+	})
+
+	t.Run("ReceivesDelete", func(t *testing.T) {
+		header := http.Header{}
+		header.Add("Cookie", sessionCookieName+"="+token)
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		defer conn.Close()
+
+		// Wait for the handler to register its subscription
+		deadline := time.Now().Add(time.Second)
+		for am.syncHub.SubscriberCount(user.ID) == 0 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		req, _ := http.NewRequest("DELETE", "/v1/user/me/history", strings.NewReader(`{"conversation_id":"c1"}`))
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+		am.DeleteHistoryItem(httptest.NewRecorder(), req)
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		var event SyncEvent
+		if err := conn.ReadJSON(&event); err != nil {
+			t.Fatalf("failed to read event: %v", err)
+		}
+		if event.Type != SyncEventDeleted || len(event.ConversationIDs) != 1 || event.ConversationIDs[0] != "c1" {
+			t.Errorf("unexpected event: %+v", event)
+		}
+	})
+}
+
+func TestSyncWebSocketShutdown(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	user := &User{Username: "testuser"}
+	db.CreateUser(user)
+	token, _ := generateSessionToken()
+	db.CreateSession(&Session{Token: token, UserID: user.ID, Username: user.Username, ExpiresAt: time.Now().Add(time.Hour)})
+
+	server := httptest.NewServer(http.HandlerFunc(am.SyncWebSocket))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	header := http.Header{}
+	header.Add("Cookie", sessionCookieName+"="+token)
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(time.Second)
+	for am.syncHub.SubscriberCount(user.ID) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := am.CloseSyncConnections(ctx); err != nil {
+		t.Fatalf("expected the connection to close before the deadline: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("expected a going-away close frame, got %v", err)
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected new connections to be refused with 503, got %v", resp)
+	}
+}
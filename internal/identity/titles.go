@@ -0,0 +1,212 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// titleTimeout bounds how long a title is waited for
+	titleTimeout = 30 * time.Second
+
+	// maxTitleMessageLength caps the characters of the first message sent to the title model
+	maxTitleMessageLength = 2000
+
+	// maxTitleLength caps the characters of a generated title
+	maxTitleLength = 100
+
+	// maxConcurrentTitles caps the title model calls in flight at once
+	maxConcurrentTitles = 4
+)
+
+// TitleGenerator asks a model for a short title for a conversation that
+// starts with message
+type TitleGenerator func(ctx context.Context, message string) (string, error)
+
+// globalTitleGenerator titles untitled conversations; nil leaves them as they
+// are. It is swapped on config reload, so it is read atomically.
+var globalTitleGenerator atomic.Pointer[TitleGenerator]
+
+// SetTitleGenerator sets how untitled conversations are titled. nil turns
+// titling off.
+func SetTitleGenerator(generate TitleGenerator) {
+	if generate == nil {
+		globalTitleGenerator.Store(nil)
+		return
+	}
+	globalTitleGenerator.Store(&generate)
+}
+
+// titleQueue bounds title generation to maxConcurrentTitles model calls and
+// one per conversation
+type titleQueue struct {
+	slots    chan struct{}
+	mu       sync.Mutex
+	inFlight map[string]bool
+}
+
+func newTitleQueue() *titleQueue {
+	return &titleQueue{
+		slots:    make(chan struct{}, maxConcurrentTitles),
+		inFlight: make(map[string]bool),
+	}
+}
+
+// start reserves a slot for titling key, reporting false when the
+// conversation is already being titled or every slot is taken
+func (q *titleQueue) start(key string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.inFlight[key] {
+		return false
+	}
+	select {
+	case q.slots <- struct{}{}:
+	default:
+		return false
+	}
+	q.inFlight[key] = true
+	return true
+}
+
+// done frees the slot start reserved for key
+func (q *titleQueue) done(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inFlight, key)
+	<-q.slots
+}
+
+// GenerateTitle titles a conversation that was saved without one. The title
+// is generated in the background and stored as a new version, unless the
+// conversation changed in the meantime. It is best-effort: failures are
+// logged and the conversation stays untitled. A conversation already being
+// titled is skipped, as are all of them while maxConcurrentTitles are in
+// flight; they are tried again on their next untitled save.
+func (am *AuthManager) GenerateTitle(conv ConversationHistory) {
+	generate := globalTitleGenerator.Load()
+	if generate == nil || conv.Title != "" {
+		return
+	}
+	message := firstUserMessage(conv.Data)
+	if message == "" {
+		return
+	}
+
+	key := fmt.Sprintf("%d\x00%s", conv.UserID, conv.ConversationID)
+	if !am.titles.start(key) {
+		if globalLogger != nil {
+			globalLogger.Debug("Title generation busy, leaving conversation untitled for now",
+				zap.String("conversation_id", conv.ConversationID))
+		}
+		return
+	}
+
+	go func() {
+		defer am.titles.done(key)
+		ctx, cancel := context.WithTimeout(context.Background(), titleTimeout)
+		defer cancel()
+
+		title, err := (*generate)(ctx, message)
+		if err != nil {
+			if globalLogger != nil {
+				globalLogger.Warn("Failed to generate conversation title",
+					zap.String("conversation_id", conv.ConversationID),
+					zap.Error(err))
+			}
+			return
+		}
+		if title = cleanTitle(title); title == "" {
+			return
+		}
+
+		previousHash := conv.Hash
+		conv.Title = title
+		conv.Hash = ComputeHistoryHash(&conv)
+		updated, err := am.db.UpdateHistoryTitle(conv.UserID, &conv, previousHash)
+		if err != nil {
+			if globalLogger != nil {
+				globalLogger.Error("Failed to store conversation title",
+					zap.String("conversation_id", conv.ConversationID),
+					zap.Error(err))
+			}
+			return
+		}
+		if updated {
+			am.publishHistoryChange(conv.UserID, SyncEventUpdated, conv.ConversationID)
+			am.notifyHistorySaved(conv.UserID, conv)
+		}
+	}()
+}
+
+// firstUserMessage returns the text of the first user message in a
+// conversation's data, shortened to maxTitleMessageLength
+func firstUserMessage(data json.RawMessage) string {
+	var conv struct {
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &conv); err != nil {
+		return ""
+	}
+
+	for _, msg := range conv.Messages {
+		if msg.Role != "user" {
+			continue
+		}
+		text := messageText(msg.Content)
+		if text == "" {
+			continue
+		}
+		if runes := []rune(text); len(runes) > maxTitleMessageLength {
+			text = string(runes[:maxTitleMessageLength])
+		}
+		return text
+	}
+	return ""
+}
+
+// messageText returns a message's content as text, joining the text parts
+// of multi-part content
+func messageText(content json.RawMessage) string {
+	var text string
+	if json.Unmarshal(content, &text) == nil {
+		return strings.TrimSpace(text)
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(content, &parts) != nil {
+		return ""
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" && strings.TrimSpace(part.Text) != "" {
+			texts = append(texts, strings.TrimSpace(part.Text))
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// cleanTitle keeps the first line of a model's reply without surrounding
+// quotes or a trailing period, shortened to maxTitleLength
+func cleanTitle(title string) string {
+	title, _, _ = strings.Cut(strings.TrimSpace(title), "\n")
+	title = strings.TrimSpace(strings.Trim(strings.TrimSpace(title), `"'*`))
+	title = strings.TrimSuffix(title, ".")
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = strings.TrimSpace(string(runes[:maxTitleLength]))
+	}
+	return title
+}
@@ -0,0 +1,142 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGenerateTitle(t *testing.T) {
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+
+	user := &User{Username: "testuser"}
+	db.CreateUser(user)
+	token, _ := generateSessionToken()
+	db.CreateSession(&Session{Token: token, UserID: user.ID, Username: user.Username, ExpiresAt: time.Now().Add(time.Hour)})
+
+	sync := func(conv ConversationHistory) {
+		body, _ := json.Marshal(HistorySyncRequest{Conversations: []ConversationHistory{conv}})
+		req, _ := http.NewRequest("POST", "/v1/user/me/history", bytes.NewBuffer(body))
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+		rr := httptest.NewRecorder()
+		am.SyncHistory(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rr.Code)
+		}
+	}
+	data := json.RawMessage(`{"messages":[{"role":"system","content":"Be brief"},{"role":"user","content":"Help me plan a trip to Japan"}]}`)
+
+	t.Run("TitlesUntitled", func(t *testing.T) {
+		messages := make(chan string, 1)
+		SetTitleGenerator(func(ctx context.Context, message string) (string, error) {
+			messages <- message
+			return `"Japan Trip Planning."`, nil
+		})
+		defer SetTitleGenerator(nil)
+
+		events, unsubscribe := am.syncHub.Subscribe(user.ID)
+		defer unsubscribe()
+		sync(ConversationHistory{ConversationID: "conv1", Version: 1, Data: data, UpdatedAt: time.Now()})
+
+		if got := <-messages; got != "Help me plan a trip to Japan" {
+			t.Errorf("expected the first user message, got %q", got)
+		}
+		// The sync's own event comes first, then the one for the title
+		<-events
+		select {
+		case event := <-events:
+			if len(event.ConversationIDs) != 1 || event.ConversationIDs[0] != "conv1" {
+				t.Errorf("unexpected event: %+v", event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected an event once the title was stored")
+		}
+
+		stored := db.histories[user.ID]["conv1"]
+		if stored.Title != "Japan Trip Planning" {
+			t.Errorf("expected the cleaned title to be stored, got %q", stored.Title)
+		}
+		if stored.Version != 2 || stored.Hash != ComputeHistoryHash(stored) {
+			t.Errorf("expected the title to be stored as a new version with its hash, got version %d", stored.Version)
+		}
+	})
+
+	t.Run("KeepsClientTitle", func(t *testing.T) {
+		called := make(chan struct{}, 1)
+		SetTitleGenerator(func(ctx context.Context, message string) (string, error) {
+			called <- struct{}{}
+			return "Generated", nil
+		})
+		defer SetTitleGenerator(nil)
+
+		sync(ConversationHistory{ConversationID: "conv2", Version: 1, Title: "Mine", Data: data, UpdatedAt: time.Now()})
+		select {
+		case <-called:
+			t.Error("expected a titled conversation not to be sent to the title model")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("FailureLeavesUntitled", func(t *testing.T) {
+		failed := make(chan struct{})
+		SetTitleGenerator(func(ctx context.Context, message string) (string, error) {
+			defer close(failed)
+			return "", errors.New("backend down")
+		})
+		defer SetTitleGenerator(nil)
+
+		sync(ConversationHistory{ConversationID: "conv3", Version: 1, Data: data, UpdatedAt: time.Now()})
+		<-failed
+		if stored := db.histories[user.ID]["conv3"]; stored == nil || stored.Title != "" {
+			t.Error("expected the conversation to be saved untitled")
+		}
+	})
+}
+
+func TestTitleQueue(t *testing.T) {
+	q := newTitleQueue()
+
+	if !q.start("conv0") {
+		t.Fatal("expected the first title to start")
+	}
+	if q.start("conv0") {
+		t.Error("expected a conversation being titled to be skipped")
+	}
+	for i := 1; i < maxConcurrentTitles; i++ {
+		if !q.start(fmt.Sprintf("conv%d", i)) {
+			t.Fatalf("expected title %d to start", i)
+		}
+	}
+	if q.start("extra") {
+		t.Error("expected no more than maxConcurrentTitles at once")
+	}
+
+	q.done("conv0")
+	if !q.start("extra") {
+		t.Error("expected a finished title to free its slot")
+	}
+	if q.start("conv0") {
+		t.Error("expected the slots to be full again")
+	}
+}
+
+func TestCleanTitle(t *testing.T) {
+	tests := map[string]string{
+		"Trip to Japan":                "Trip to Japan",
+		`  "Trip to Japan."  `:         "Trip to Japan",
+		"**Trip to Japan**\nMore text": "Trip to Japan",
+		"":                             "",
+	}
+	for in, want := range tests {
+		if got := cleanTitle(in); got != want {
+			t.Errorf("cleanTitle(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
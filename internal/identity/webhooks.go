@@ -0,0 +1,296 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"llm-router/internal/model"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Webhook events
+const (
+	WebhookConversationCreated = "conversation.created"
+	WebhookConversationUpdated = "conversation.updated"
+	WebhookConversationDeleted = "conversation.deleted"
+)
+
+// Webhook request headers
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookTimestampHeader = "X-Webhook-Timestamp" // Unix seconds when the attempt was sent
+	WebhookSignatureHeader = "X-Webhook-Signature" // "sha256=" and the hex HMAC-SHA256 of the timestamp, ".", and the body
+)
+
+const (
+	// webhookQueueSize bounds the deliveries waiting to be sent; events beyond it are dropped
+	webhookQueueSize = 256
+	// webhookWorkers is how many deliveries are sent at once
+	webhookWorkers = 4
+	// webhookTimeout bounds a single delivery attempt
+	webhookTimeout = 10 * time.Second
+	// webhookRetryInterval is the wait before the first retry; it doubles after each failure
+	webhookRetryInterval = time.Second
+	// webhookMaxRetryInterval caps the wait between retries
+	webhookMaxRetryInterval = time.Minute
+)
+
+// globalWebhooks are the endpoints conversation events are sent to. They are
+// swapped on config reload, so they are read atomically.
+var globalWebhooks atomic.Pointer[[]model.WebhookConfig]
+
+// SetWebhooks sets the endpoints conversation events are sent to. Events
+// aren't sent when there are none.
+func SetWebhooks(hooks []model.WebhookConfig) {
+	globalWebhooks.Store(&hooks)
+}
+
+func webhooks() []model.WebhookConfig {
+	if hooks := globalWebhooks.Load(); hooks != nil {
+		return *hooks
+	}
+	return nil
+}
+
+// WebhookPayload is the JSON body posted for a conversation event
+type WebhookPayload struct {
+	ID             string               `json:"id"`
+	Event          string               `json:"event"`
+	UserID         int64                `json:"user_id"`
+	ConversationID string               `json:"conversation_id,omitempty"`
+	Conversation   *ConversationHistory `json:"conversation,omitempty"` // The stored conversation, for created and updated events
+	All            bool                 `json:"all,omitempty"`          // Every one of the user's conversations was deleted
+	Timestamp      time.Time            `json:"timestamp"`
+}
+
+// webhookDelivery is a payload on its way to one endpoint
+type webhookDelivery struct {
+	hook    model.WebhookConfig
+	id      string
+	event   string
+	payload []byte
+	attempt int           // attempts made so far
+	wait    time.Duration // wait before the next retry
+}
+
+// webhookDispatcher posts conversation events from background workers, so
+// saving a conversation never waits on an endpoint. Failed deliveries are
+// retried with backoff, then stored as dead letters. Workers never wait out
+// a backoff themselves, so a dead endpoint can't hold up the others.
+type webhookDispatcher struct {
+	db               Database
+	client           *http.Client
+	queue            chan webhookDelivery
+	start            sync.Once
+	retryInterval    time.Duration
+	maxRetryInterval time.Duration
+}
+
+// newWebhookDispatcher creates a dispatcher. Its workers start with the
+// first event, so nothing runs while no webhooks are configured.
+func newWebhookDispatcher(db Database) *webhookDispatcher {
+	return &webhookDispatcher{
+		db:               db,
+		client:           &http.Client{Timeout: webhookTimeout},
+		queue:            make(chan webhookDelivery, webhookQueueSize),
+		retryInterval:    webhookRetryInterval,
+		maxRetryInterval: webhookMaxRetryInterval,
+	}
+}
+
+func (d *webhookDispatcher) run() {
+	for delivery := range d.queue {
+		d.deliver(delivery)
+	}
+}
+
+// enqueue sends payload to every configured endpoint
+func (d *webhookDispatcher) enqueue(payload WebhookPayload) {
+	hooks := webhooks()
+	if len(hooks) == 0 {
+		return
+	}
+
+	payload.ID = uuid.New().String()
+	payload.Timestamp = time.Now().UTC()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		if globalLogger != nil {
+			globalLogger.Error("Failed to encode webhook payload", zap.String("event", payload.Event), zap.Error(err))
+		}
+		return
+	}
+
+	d.start.Do(func() {
+		for i := 0; i < webhookWorkers; i++ {
+			go d.run()
+		}
+	})
+	for _, hook := range hooks {
+		select {
+		case d.queue <- webhookDelivery{hook: hook, id: payload.ID, event: payload.Event, payload: body, wait: d.retryInterval}:
+		default:
+			if globalLogger != nil {
+				globalLogger.Warn("Webhook queue full, dropping event",
+					zap.String("event", payload.Event),
+					zap.String("url", hook.URL))
+			}
+		}
+	}
+}
+
+// deliver makes the next attempt of a delivery. A failed attempt is queued
+// again once its backoff has passed; when the attempts run out, or the queue
+// is full, the delivery is stored as a dead letter.
+func (d *webhookDispatcher) deliver(delivery webhookDelivery) {
+	attempts := delivery.hook.Attempts()
+	delivery.attempt++
+	start := time.Now()
+	err := d.post(delivery)
+	if err == nil {
+		if globalLogger != nil {
+			globalLogger.Info("Webhook delivered",
+				zap.String("delivery_id", delivery.id),
+				zap.String("event", delivery.event),
+				zap.String("url", delivery.hook.URL),
+				zap.Int("attempt", delivery.attempt),
+				zap.Duration("duration", time.Since(start)))
+		}
+		return
+	}
+	if globalLogger != nil {
+		globalLogger.Warn("Webhook delivery failed",
+			zap.String("delivery_id", delivery.id),
+			zap.String("event", delivery.event),
+			zap.String("url", delivery.hook.URL),
+			zap.Int("attempt", delivery.attempt),
+			zap.Int("max_attempts", attempts),
+			zap.Error(err))
+	}
+	if delivery.attempt >= attempts {
+		d.deadLetter(delivery, err)
+		return
+	}
+
+	wait := delivery.wait
+	delivery.wait = min(delivery.wait*2, d.maxRetryInterval)
+	time.AfterFunc(wait, func() {
+		select {
+		case d.queue <- delivery:
+		default:
+			d.deadLetter(delivery, fmt.Errorf("webhook queue full on retry after: %w", err))
+		}
+	})
+}
+
+// deadLetter stores a delivery that could not be made
+func (d *webhookDispatcher) deadLetter(delivery webhookDelivery, err error) {
+	letter := &WebhookDeadLetter{
+		DeliveryID: delivery.id,
+		URL:        delivery.hook.URL,
+		Event:      delivery.event,
+		Payload:    delivery.payload,
+		Attempts:   delivery.attempt,
+		LastError:  err.Error(),
+	}
+	if err := d.db.AddWebhookDeadLetter(letter); err != nil {
+		if globalLogger != nil {
+			globalLogger.Error("Failed to store webhook dead letter",
+				zap.String("delivery_id", delivery.id),
+				zap.Error(err))
+		}
+		return
+	}
+	if globalLogger != nil {
+		globalLogger.Error("Webhook dead-lettered after every attempt failed",
+			zap.String("delivery_id", delivery.id),
+			zap.String("event", delivery.event),
+			zap.String("url", delivery.hook.URL),
+			zap.Int64("dead_letter_id", letter.ID))
+	}
+}
+
+// post makes one delivery attempt. Any 2xx response counts as delivered.
+func (d *webhookDispatcher) post(delivery webhookDelivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", delivery.hook.URL, bytes.NewReader(delivery.payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, delivery.event)
+	req.Header.Set(WebhookDeliveryHeader, delivery.id)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(delivery.hook.Secret, timestamp, delivery.payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint answered %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SignWebhookPayload returns the signature header value for body sent at
+// timestamp: "sha256=" and the hex HMAC-SHA256 of the timestamp, ".", and the
+// body, keyed with secret. Receivers recompute it over the timestamp header
+// and the raw body to check a payload came from the router, and reject old
+// timestamps so a captured delivery can't be replayed.
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// notifyHistorySaved sends a created or updated event for each stored
+// conversation. Version 1 is a conversation stored for the first time.
+func (am *AuthManager) notifyHistorySaved(userID int64, convs ...ConversationHistory) {
+	for i := range convs {
+		conv := convs[i]
+		event := WebhookConversationUpdated
+		if conv.Version == 1 {
+			event = WebhookConversationCreated
+		}
+		am.webhooks.enqueue(WebhookPayload{
+			Event:          event,
+			UserID:         userID,
+			ConversationID: conv.ConversationID,
+			Conversation:   &conv,
+		})
+	}
+}
+
+// notifyHistoryDeleted sends a deleted event for each conversation, or one
+// event with All set when conversationIDs is empty
+func (am *AuthManager) notifyHistoryDeleted(userID int64, conversationIDs ...string) {
+	if len(conversationIDs) == 0 {
+		am.webhooks.enqueue(WebhookPayload{Event: WebhookConversationDeleted, UserID: userID, All: true})
+		return
+	}
+	for _, id := range conversationIDs {
+		am.webhooks.enqueue(WebhookPayload{Event: WebhookConversationDeleted, UserID: userID, ConversationID: id})
+	}
+}
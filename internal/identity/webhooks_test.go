@@ -0,0 +1,166 @@
+package identity
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"llm-router/internal/model"
+)
+
+func TestWebhookDelivery(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan received, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{header: r.Header, body: body}
+	}))
+	defer server.Close()
+
+	SetWebhooks([]model.WebhookConfig{{URL: server.URL, Secret: "s3cret"}})
+	defer SetWebhooks(nil)
+
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+	user := &User{Username: "testuser"}
+	db.CreateUser(user)
+	token, _ := generateSessionToken()
+	db.CreateSession(&Session{Token: token, UserID: user.ID, Username: user.Username, ExpiresAt: time.Now().Add(time.Hour)})
+
+	next := func() WebhookPayload {
+		t.Helper()
+		select {
+		case req := <-requests:
+			timestamp := req.header.Get(WebhookTimestampHeader)
+			if sent, err := strconv.ParseInt(timestamp, 10, 64); err != nil || time.Since(time.Unix(sent, 0)) > time.Minute {
+				t.Errorf("expected a current timestamp, got %q", timestamp)
+			}
+			if got, want := req.header.Get(WebhookSignatureHeader), SignWebhookPayload("s3cret", timestamp, req.body); got != want {
+				t.Errorf("expected signature %s, got %s", want, got)
+			}
+			var payload WebhookPayload
+			if err := json.Unmarshal(req.body, &payload); err != nil {
+				t.Fatalf("invalid payload: %v", err)
+			}
+			if req.header.Get(WebhookEventHeader) != payload.Event || req.header.Get(WebhookDeliveryHeader) != payload.ID {
+				t.Errorf("expected the headers to match the payload, got %v", req.header)
+			}
+			return payload
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected a webhook delivery")
+			return WebhookPayload{}
+		}
+	}
+
+	sync := func(conv ConversationHistory) {
+		body, _ := json.Marshal(HistorySyncRequest{Conversations: []ConversationHistory{conv}})
+		req, _ := http.NewRequest("POST", "/v1/user/me/history", bytes.NewBuffer(body))
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+		am.SyncHistory(httptest.NewRecorder(), req)
+	}
+
+	sync(ConversationHistory{ConversationID: "conv1", Version: 1, Title: "Title", Data: json.RawMessage(`["a"]`), UpdatedAt: time.Now()})
+	created := next()
+	if created.Event != WebhookConversationCreated || created.UserID != user.ID || created.Conversation == nil || created.Conversation.ConversationID != "conv1" {
+		t.Errorf("unexpected created event: %+v", created)
+	}
+
+	sync(ConversationHistory{ConversationID: "conv1", Version: 2, Title: "Title", Data: json.RawMessage(`["a","b"]`), UpdatedAt: time.Now()})
+	if updated := next(); updated.Event != WebhookConversationUpdated || updated.Conversation.Version != 2 {
+		t.Errorf("unexpected updated event: %+v", updated)
+	}
+
+	importBody, _ := json.Marshal([]ConversationHistory{{ConversationID: "conv2", Title: "Imported", Data: json.RawMessage(`["c"]`)}})
+	req, _ := http.NewRequest("POST", "/v1/user/me/history/import", bytes.NewBuffer(importBody))
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	am.ImportHistory(httptest.NewRecorder(), req)
+	if imported := next(); imported.Event != WebhookConversationCreated || imported.ConversationID != "conv2" {
+		t.Errorf("unexpected imported event: %+v", imported)
+	}
+
+	req, _ = http.NewRequest("DELETE", "/v1/user/me/history", bytes.NewBufferString(`{"conversation_id":"conv1"}`))
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	am.DeleteHistoryItem(httptest.NewRecorder(), req)
+	if deleted := next(); deleted.Event != WebhookConversationDeleted || deleted.ConversationID != "conv1" || deleted.Conversation != nil {
+		t.Errorf("unexpected deleted event: %+v", deleted)
+	}
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	SetWebhooks([]model.WebhookConfig{{URL: server.URL, Secret: "s3cret", MaxAttempts: 3}})
+	defer SetWebhooks(nil)
+
+	db := NewMockDatabase()
+	am := NewAuthManager(db)
+	am.webhooks.retryInterval = time.Millisecond
+
+	am.notifyHistoryDeleted(1, "conv1")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		db.deadLetterMu.Lock()
+		letters := append([]WebhookDeadLetter(nil), db.deadLetters...)
+		db.deadLetterMu.Unlock()
+		if len(letters) == 1 {
+			letter := letters[0]
+			if letter.Attempts != 3 || letter.Event != WebhookConversationDeleted || letter.URL != server.URL {
+				t.Errorf("unexpected dead letter: %+v", letter)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the event to be dead-lettered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := attempts.Load(); got != 3 {
+		t.Errorf("expected 3 delivery attempts, got %d", got)
+	}
+}
+
+func TestWebhookRetriesDontBlockWorkers(t *testing.T) {
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer dead.Close()
+	var delivered atomic.Int32
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered.Add(1)
+	}))
+	defer healthy.Close()
+
+	SetWebhooks([]model.WebhookConfig{{URL: dead.URL, Secret: "s"}, {URL: healthy.URL, Secret: "s"}})
+	defer SetWebhooks(nil)
+
+	am := NewAuthManager(NewMockDatabase())
+	am.webhooks.retryInterval = time.Hour
+
+	const events = webhookWorkers * 3
+	for i := 0; i < events; i++ {
+		am.notifyHistoryDeleted(1, "conv")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for delivered.Load() < events {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d deliveries to the healthy endpoint while the other backs off, got %d", events, delivered.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
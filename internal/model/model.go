@@ -3,36 +3,363 @@ package model
 import (
 	"encoding/json"
 	"strconv"
+	"time"
 
 	"go.uber.org/zap"
 )
 
+// Shapes of a backend's model list response
+const (
+	ModelsFormatOpenAI = "openai"
+	ModelsFormatOllama = "ollama"
+)
+
+// How a backend's system prompt combines with the client's system message
+const (
+	SystemPromptPrepend = "prepend"
+	SystemPromptReplace = "replace"
+)
+
+// Load balancing strategies for backends that share a prefix
+const (
+	LoadBalanceRoundRobin        = "round_robin"
+	LoadBalanceLeastRecentlyUsed = "least_recently_used"
+)
+
 type BackendConfig struct {
-	Name              string            `json:"name"`
-	BaseURL           string            `json:"base_url"`
-	Prefix            string            `json:"prefix"`
-	Default           bool              `json:"default"`
-	RequireAPIKey     bool              `json:"require_api_key"`
-	APIKey            string            `json:"api_key,omitempty"`  // Plaintext API key in config
-	KeyEnvVar         string            `json:"key_env_var"`        // Legacy single key support
-	APIKeys           []string          `json:"api_keys,omitempty"` // Multi-key support
-	RoleRewrites      map[string]string `json:"role_rewrites,omitempty"`
-	UnsupportedParams []string          `json:"unsupported_params,omitempty"`
+	Name                string                 `json:"name"`
+	BaseURL             string                 `json:"base_url"`
+	Prefix              string                 `json:"prefix"`
+	Default             bool                   `json:"default"`
+	RequireAPIKey       bool                   `json:"require_api_key"`
+	APIKey              string                 `json:"api_key,omitempty"`  // Plaintext API key in config
+	KeyEnvVar           string                 `json:"key_env_var"`        // Legacy single key support
+	APIKeys             []string               `json:"api_keys,omitempty"` // Multi-key support
+	RoleRewrites        map[string]string      `json:"role_rewrites,omitempty"`
+	UnsupportedParams   []string               `json:"unsupported_params,omitempty"`
+	Fallback            string                 `json:"fallback,omitempty"`                // Prefix of the backend to retry on when this one fails
+	LoadBalance         string                 `json:"load_balance,omitempty"`            // round_robin or least_recently_used; lets backends share a prefix
+	SystemPrompt        string                 `json:"system_prompt,omitempty"`           // Injected into every chat request sent to this backend
+	SystemPromptMode    string                 `json:"system_prompt_mode,omitempty"`      // prepend (default) or replace an existing system message
+	DefaultParams       map[string]interface{} `json:"default_params,omitempty"`          // Request params added when the client omits them
+	ParamLimits         map[string]ParamLimit  `json:"param_limits,omitempty"`            // Bounds numeric request params are clamped to
+	ModelsFormat        string                 `json:"models_format,omitempty"`           // openai (default) or ollama, for listing the backend's models
+	RateLimitHeaders    []string               `json:"rate_limit_headers,omitempty"`      // Upstream rate-limit headers passed to clients, as "x-ratelimit-*" style patterns; all when empty
+	ResponseHeaders     *HeaderRules           `json:"response_headers,omitempty"`        // Header changes applied to the backend's responses
+	CircuitBreaker      *CircuitBreakerConfig  `json:"circuit_breaker,omitempty"`         // Stop sending requests to the backend while it keeps failing
+	Enabled             *bool                  `json:"enabled,omitempty"`                 // Set to false to take the backend out of service without removing it
+	RetryableStatuses   []int                  `json:"retryable_statuses,omitempty"`      // Upstream statuses retried with the next key or sent to the fallback; replaces the default set, 401/403/429 key rotation included
+	EmulateTools        bool                   `json:"emulate_tools,omitempty"`           // Describe tools in the system prompt and parse calls from the reply, for backends without function calling
+	ToolFallbackPrompt  string                 `json:"tool_fallback_prompt,omitempty"`    // System note added when a request is retried without tools; a default is used when empty
+	UpstreamCompression *bool                  `json:"upstream_compression,omitempty"`    // true offers gzip and deflate, false asks for uncompressed responses; unset lets Go negotiate gzip
+	HTTP2               bool                   `json:"http2,omitempty"`                   // Only speak HTTP/2 to the backend, as h2c for http:// URLs; https:// backends without HTTP/2 support then fail, as HTTP/1.1 is turned off
+	MaxConnsPerHost     int                    `json:"max_conns_per_host,omitempty"`      // Most connections open to the backend at once; each HTTP/1.1 stream holds one
+	MaxIdleConns        int                    `json:"max_idle_conns,omitempty"`          // Most idle connections kept across all of the backend's hosts
+	MaxIdleConnsPerHost int                    `json:"max_idle_conns_per_host,omitempty"` // Most idle connections kept per host; at most max_idle_conns and max_conns_per_host
+}
+
+// IsEnabled reports whether the backend serves requests. Backends are enabled unless set otherwise.
+func (b BackendConfig) IsEnabled() bool {
+	return b.Enabled == nil || *b.Enabled
+}
+
+// CircuitBreakerConfig sets when a backend's circuit opens. Zero fields use the defaults.
+type CircuitBreakerConfig struct {
+	Threshold int `json:"threshold,omitempty"` // Consecutive failures that open the circuit, default 5
+	Window    int `json:"window,omitempty"`    // Seconds the failures must fall within, default 60
+	Cooldown  int `json:"cooldown,omitempty"`  // Seconds to stay open before probing the backend again, default 30
+}
+
+// HeaderRules rewrites response headers. Removals are applied before Set.
+type HeaderRules struct {
+	Remove []string          `json:"remove,omitempty"` // Header names to drop; a trailing "*" matches by prefix
+	Set    map[string]string `json:"set,omitempty"`    // Headers to add or overwrite
+}
+
+// Attachment store types
+const (
+	AttachmentStoreLocal = "local"
+	AttachmentStoreS3    = "s3"
+)
+
+// AttachmentsConfig selects and configures the attachment store
+type AttachmentsConfig struct {
+	Store        string    `json:"store,omitempty"` // AttachmentStoreLocal (default) or AttachmentStoreS3
+	Dir          string    `json:"dir,omitempty"`   // Directory for the local store, ./data/attachments when empty
+	Dedup        bool      `json:"dedup,omitempty"` // Store identical content once; local store only
+	S3           *S3Config `json:"s3,omitempty"`
+	MaxSize      int64     `json:"max_size,omitempty"`      // Largest decoded attachment in bytes, DefaultMaxAttachmentSize when unset
+	AllowedTypes []string  `json:"allowed_types,omitempty"` // Content types that may be stored, DefaultAttachmentTypes when empty
+}
+
+// S3Config configures an S3-compatible attachment store
+type S3Config struct {
+	Bucket          string `json:"bucket"`
+	Region          string `json:"region,omitempty"`   // us-east-1 when empty
+	Endpoint        string `json:"endpoint,omitempty"` // Set for S3-compatible services such as MinIO
+	Prefix          string `json:"prefix,omitempty"`   // Prepended to every object key
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+}
+
+// ParamLimit bounds a numeric request parameter. Either side may be left unset.
+type ParamLimit struct {
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
 }
 
 // Config is the structure for the proxy configuration
 type Config struct {
-	ListeningPort      int               `json:"listening_port"`
-	Logger             *zap.Logger       `json:"-"` // Exclude from JSON
-	Backends           []BackendConfig   `json:"backends"`
-	LLMRouterAPIKeyEnv string            `json:"llmrouter_api_key_env,omitempty"`
-	LLMRouterAPIKey    string            `json:"llmrouter_api_key,omitempty"` // Plaintext router API key
-	UseGeneratedKey    bool              `json:"-"`                           // Exclude from JSON
-	Aliases            map[string]string `json:"aliases,omitempty"`
-	ConfigFilePath     string            `json:"-"`                          // Path to config file, excluded from JSON
-	DatabaseURL        string            `json:"database_url"`               // Database URL for identity system
-	ExaAPIKey          string            `json:"exa_api_key,omitempty"`      // Exa API key for search tool
-	GeoapifyAPIKey     string            `json:"geoapify_api_key,omitempty"` // Geoapify API key for geo tool
+	ConfigVersion      int                `json:"config_version"` // Schema version of the config file; older files are migrated when loaded
+	ListeningPort      int                `json:"listening_port"`
+	Logger             *zap.Logger        `json:"-"` // Exclude from JSON
+	Backends           []BackendConfig    `json:"backends"`
+	LLMRouterAPIKeyEnv string             `json:"llmrouter_api_key_env,omitempty"`
+	LLMRouterAPIKey    string             `json:"llmrouter_api_key,omitempty"` // Plaintext router API key
+	UseGeneratedKey    bool               `json:"-"`                           // Exclude from JSON
+	Aliases            map[string]string  `json:"aliases,omitempty"`
+	ConfigFilePath     string             `json:"-"`                             // Path to config file, excluded from JSON
+	DatabaseURL        string             `json:"database_url"`                  // Database URL for identity system
+	DatabaseRetry      *DatabaseRetry     `json:"database_retry,omitempty"`      // How long to wait for the database at startup
+	ExaAPIKey          string             `json:"exa_api_key,omitempty"`         // Exa API key for search tool
+	GeoapifyAPIKey     string             `json:"geoapify_api_key,omitempty"`    // Geoapify API key for geo tool
+	ShutdownTimeout    int                `json:"shutdown_timeout,omitempty"`    // Seconds to let in-flight requests finish on shutdown
+	AllowedOrigins     []string           `json:"allowed_origins,omitempty"`     // CORS origins to allow; "*" or "https://*.example.com" patterns, all when empty
+	ModelsCacheTTL     int                `json:"models_cache_ttl,omitempty"`    // Seconds to cache each backend's model list; negative disables caching
+	Attachments        *AttachmentsConfig `json:"attachments,omitempty"`         // Where uploaded attachments are stored, local disk when unset
+	OTLPEndpoint       string             `json:"otlp_endpoint,omitempty"`       // OTLP/HTTP collector for trace export, e.g. http://collector:4318; tracing is off when empty
+	StreamHeartbeat    int                `json:"stream_heartbeat,omitempty"`    // Seconds of upstream silence before an SSE keepalive comment is sent; off when unset
+	StreamIdleTimeout  int                `json:"stream_idle_timeout,omitempty"` // Seconds a streamed response may go without upstream data before it is aborted; negative disables
+	CompressResponses  bool               `json:"compress_responses,omitempty"`  // Gzip responses for clients that accept it, except event streams and compressed content
+	TitleModel         string             `json:"title_model,omitempty"`         // Model or alias that titles untitled synced conversations; off when empty
+	Webhooks           []WebhookConfig    `json:"webhooks,omitempty"`            // Endpoints sent conversation created, updated and deleted events; off when empty
+	ProxyPaths         []string           `json:"proxy_paths,omitempty"`         // Extra /v1 paths passed through to the default backend; a trailing "*" matches by prefix
+	AuditRetention     int                `json:"audit_retention,omitempty"`     // Days audit log entries are kept, DefaultAuditRetention when unset; negative keeps them forever
+
+	MaxRequestBodySize    int64 `json:"max_request_body_size,omitempty"`    // Bytes a client request body may hold before it is rejected with 413
+	MaxLoggedResponseSize int   `json:"max_logged_response_size,omitempty"` // Bytes of a non-streaming upstream response kept for logging
+	MaxRequestTimeout     int   `json:"max_request_timeout,omitempty"`      // Seconds; upper bound for a client's X-Request-Timeout header
+	StorageQuota          int64 `json:"storage_quota,omitempty"`            // Bytes of conversations and attachments each user may store; unlimited when unset
+
+	DBMaxOpenConns    int `json:"db_max_open_conns,omitempty"`     // Most connections open to the database at once
+	DBMaxIdleConns    int `json:"db_max_idle_conns,omitempty"`     // Most idle connections kept open; at most db_max_open_conns
+	DBConnMaxLifetime int `json:"db_conn_max_lifetime,omitempty"`  // Seconds a database connection is reused before it is replaced
+	DBConnMaxIdleTime int `json:"db_conn_max_idle_time,omitempty"` // Seconds an idle database connection is kept before it is closed
+}
+
+// DatabaseRetry controls how startup waits for the database to accept connections
+type DatabaseRetry struct {
+	Attempts    int `json:"attempts,omitempty"`     // Connection attempts before giving up
+	Interval    int `json:"interval,omitempty"`     // Seconds before the first retry; doubles after each failure
+	MaxInterval int `json:"max_interval,omitempty"` // Seconds the wait between attempts grows to at most
+}
+
+// WebhookConfig is an endpoint that conversation events are posted to
+type WebhookConfig struct {
+	URL         string `json:"url"`
+	Secret      string `json:"secret"`                 // Key for the HMAC-SHA256 signature sent with each payload
+	MaxAttempts int    `json:"max_attempts,omitempty"` // Deliveries tried before the event is dead-lettered, DefaultWebhookAttempts when unset
+}
+
+// Attempts returns how many times an event is delivered before it is dead-lettered
+func (w WebhookConfig) Attempts() int {
+	if w.MaxAttempts > 0 {
+		return w.MaxAttempts
+	}
+	return DefaultWebhookAttempts
+}
+
+// CurrentConfigVersion is the config file schema version this build reads and writes
+const CurrentConfigVersion = 1
+
+// Defaults for the request limits when they are not set in the config
+const (
+	DefaultMaxRequestBodySize    = 32 << 20 // 32MB
+	DefaultMaxLoggedResponseSize = 1 << 20  // 1MB
+	DefaultMaxRequestTimeout     = 10 * time.Minute
+	DefaultModelsCacheTTL        = 5 * time.Minute
+	DefaultStreamIdleTimeout     = 5 * time.Minute
+	DefaultMaxAttachmentSize     = 10 << 20 // 10MB
+	DefaultWebhookAttempts       = 5
+	DefaultDatabaseAttempts      = 10
+	DefaultDatabaseRetryInterval = time.Second
+	DefaultDatabaseMaxInterval   = 30 * time.Second
+	DefaultDBMaxOpenConns        = 10
+	DefaultDBMaxIdleConns        = 2
+	DefaultDBConnMaxLifetime     = 5 * time.Minute
+	DefaultDBConnMaxIdleTime     = 2 * time.Minute
+	DefaultMaxConnsPerHost       = 20
+	DefaultMaxIdleConns          = 100
+	DefaultMaxIdleConnsPerHost   = 10
+	DefaultAuditRetention        = 90 * 24 * time.Hour
+)
+
+// DefaultAttachmentTypes are the attachment content types allowed when none
+// are configured. Each must be recognized by http.DetectContentType, since
+// uploads are checked against their sniffed type.
+var DefaultAttachmentTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+// RequestBodyLimit returns the configured max request body size, or the default when unset
+func (c *Config) RequestBodyLimit() int64 {
+	if c.MaxRequestBodySize > 0 {
+		return c.MaxRequestBodySize
+	}
+	return DefaultMaxRequestBodySize
+}
+
+// LoggedResponseLimit returns how much of a non-streaming upstream response is kept for logging
+func (c *Config) LoggedResponseLimit() int {
+	if c.MaxLoggedResponseSize > 0 {
+		return c.MaxLoggedResponseSize
+	}
+	return DefaultMaxLoggedResponseSize
+}
+
+// AttachmentSizeLimit returns the largest attachment that may be stored
+func (c *Config) AttachmentSizeLimit() int64 {
+	if c.Attachments != nil && c.Attachments.MaxSize > 0 {
+		return c.Attachments.MaxSize
+	}
+	return DefaultMaxAttachmentSize
+}
+
+// AttachmentTypes returns the content types that may be stored as attachments
+func (c *Config) AttachmentTypes() []string {
+	if c.Attachments != nil && len(c.Attachments.AllowedTypes) > 0 {
+		return c.Attachments.AllowedTypes
+	}
+	return DefaultAttachmentTypes
+}
+
+// RequestTimeoutLimit returns the longest timeout a client may ask for with X-Request-Timeout
+func (c *Config) RequestTimeoutLimit() time.Duration {
+	if c.MaxRequestTimeout > 0 {
+		return time.Duration(c.MaxRequestTimeout) * time.Second
+	}
+	return DefaultMaxRequestTimeout
+}
+
+// ModelsCacheDuration returns how long backend model lists are cached, or 0 when caching is disabled
+func (c *Config) ModelsCacheDuration() time.Duration {
+	switch {
+	case c.ModelsCacheTTL < 0:
+		return 0
+	case c.ModelsCacheTTL == 0:
+		return DefaultModelsCacheTTL
+	default:
+		return time.Duration(c.ModelsCacheTTL) * time.Second
+	}
+}
+
+// AuditRetentionPeriod returns how long audit log entries are kept, or 0 when they are kept forever
+func (c *Config) AuditRetentionPeriod() time.Duration {
+	switch {
+	case c.AuditRetention < 0:
+		return 0
+	case c.AuditRetention == 0:
+		return DefaultAuditRetention
+	default:
+		return time.Duration(c.AuditRetention) * 24 * time.Hour
+	}
+}
+
+// StreamHeartbeatInterval returns how long a streamed response may be silent before a keepalive comment is sent, or 0 when disabled
+func (c *Config) StreamHeartbeatInterval() time.Duration {
+	if c.StreamHeartbeat > 0 {
+		return time.Duration(c.StreamHeartbeat) * time.Second
+	}
+	return 0
+}
+
+// StreamIdleDuration returns how long a streamed response may go without upstream data, or 0 when the check is disabled
+func (c *Config) StreamIdleDuration() time.Duration {
+	switch {
+	case c.StreamIdleTimeout < 0:
+		return 0
+	case c.StreamIdleTimeout == 0:
+		return DefaultStreamIdleTimeout
+	default:
+		return time.Duration(c.StreamIdleTimeout) * time.Second
+	}
+}
+
+// DatabaseConnectAttempts returns how many times startup tries to reach the database
+func (c *Config) DatabaseConnectAttempts() int {
+	if c.DatabaseRetry != nil && c.DatabaseRetry.Attempts > 0 {
+		return c.DatabaseRetry.Attempts
+	}
+	return DefaultDatabaseAttempts
+}
+
+// DatabaseRetryIntervals returns the first and longest waits between attempts to reach the database
+func (c *Config) DatabaseRetryIntervals() (time.Duration, time.Duration) {
+	interval, maxInterval := DefaultDatabaseRetryInterval, DefaultDatabaseMaxInterval
+	if c.DatabaseRetry != nil {
+		if c.DatabaseRetry.Interval > 0 {
+			interval = time.Duration(c.DatabaseRetry.Interval) * time.Second
+		}
+		if c.DatabaseRetry.MaxInterval > 0 {
+			maxInterval = time.Duration(c.DatabaseRetry.MaxInterval) * time.Second
+		}
+	}
+	return interval, max(interval, maxInterval)
+}
+
+// ConnectionPool holds a backend's upstream connection pool settings
+type ConnectionPool struct {
+	MaxConnsPerHost     int
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+}
+
+// ConnectionPool returns the backend's connection pool settings, with defaults for those unset
+func (b BackendConfig) ConnectionPool() ConnectionPool {
+	pool := ConnectionPool{
+		MaxConnsPerHost:     DefaultMaxConnsPerHost,
+		MaxIdleConns:        DefaultMaxIdleConns,
+		MaxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+	}
+	if b.MaxConnsPerHost > 0 {
+		pool.MaxConnsPerHost = b.MaxConnsPerHost
+	}
+	if b.MaxIdleConns > 0 {
+		pool.MaxIdleConns = b.MaxIdleConns
+	}
+	if b.MaxIdleConnsPerHost > 0 {
+		pool.MaxIdleConnsPerHost = b.MaxIdleConnsPerHost
+	}
+	return pool
+}
+
+// DatabasePool holds the database connection pool settings
+type DatabasePool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// DatabasePool returns the configured connection pool settings, with defaults for those unset
+func (c *Config) DatabasePool() DatabasePool {
+	pool := DatabasePool{
+		MaxOpenConns:    DefaultDBMaxOpenConns,
+		MaxIdleConns:    DefaultDBMaxIdleConns,
+		ConnMaxLifetime: DefaultDBConnMaxLifetime,
+		ConnMaxIdleTime: DefaultDBConnMaxIdleTime,
+	}
+	if c.DBMaxOpenConns > 0 {
+		pool.MaxOpenConns = c.DBMaxOpenConns
+	}
+	if c.DBMaxIdleConns > 0 {
+		pool.MaxIdleConns = c.DBMaxIdleConns
+	}
+	if c.DBConnMaxLifetime > 0 {
+		pool.ConnMaxLifetime = time.Duration(c.DBConnMaxLifetime) * time.Second
+	}
+	if c.DBConnMaxIdleTime > 0 {
+		pool.ConnMaxIdleTime = time.Duration(c.DBConnMaxIdleTime) * time.Second
+	}
+	return pool
 }
 
 // FlexibleFloat64 handles both string and float64 JSON values
@@ -0,0 +1,205 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Validate checks the backend configuration and returns an error describing
+// every problem found, so a bad config is reported in full before any proxy
+// is built.
+func (c *Config) Validate() error {
+	var errs []error
+	var defaults []string
+	prefixOwners := make(map[string]BackendConfig)
+
+	for i, backend := range c.Backends {
+		name := backend.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+			errs = append(errs, fmt.Errorf("backend %s: name is required", name))
+		}
+
+		if err := validateBaseURL(backend.BaseURL); err != nil {
+			errs = append(errs, fmt.Errorf("backend %q: %w", name, err))
+		}
+
+		if backend.Default {
+			defaults = append(defaults, fmt.Sprintf("%q", name))
+		}
+
+		// Only the default backend may go without a prefix, since it catches
+		// every model that no other prefix matches
+		prefix := strings.TrimSpace(backend.Prefix)
+		if prefix == "" {
+			if !backend.Default {
+				errs = append(errs, fmt.Errorf("backend %q: prefix is required unless the backend is the default", name))
+			}
+		} else if owner, exists := prefixOwners[prefix]; exists {
+			// Backends may share a prefix only when they all opt into the same load balancing
+			if backend.LoadBalance == "" || backend.LoadBalance != owner.LoadBalance {
+				errs = append(errs, fmt.Errorf("backend %q: prefix %q is already used by backend %q (set the same load_balance on both to share it)", name, prefix, owner.Name))
+			}
+		} else {
+			prefixOwners[prefix] = backend
+		}
+
+		switch backend.LoadBalance {
+		case "", LoadBalanceRoundRobin, LoadBalanceLeastRecentlyUsed:
+		default:
+			errs = append(errs, fmt.Errorf("backend %q: unknown load_balance %q", name, backend.LoadBalance))
+		}
+
+		switch backend.SystemPromptMode {
+		case "", SystemPromptPrepend, SystemPromptReplace:
+		default:
+			errs = append(errs, fmt.Errorf("backend %q: unknown system_prompt_mode %q", name, backend.SystemPromptMode))
+		}
+
+		switch backend.ModelsFormat {
+		case "", ModelsFormatOpenAI, ModelsFormatOllama:
+		default:
+			errs = append(errs, fmt.Errorf("backend %q: unknown models_format %q", name, backend.ModelsFormat))
+		}
+
+		if cb := backend.CircuitBreaker; cb != nil && (cb.Threshold < 0 || cb.Window < 0 || cb.Cooldown < 0) {
+			errs = append(errs, fmt.Errorf("backend %q: circuit_breaker values must not be negative", name))
+		}
+
+		for _, status := range backend.RetryableStatuses {
+			if status < 100 || status > 599 {
+				errs = append(errs, fmt.Errorf("backend %q: retryable_statuses has invalid status code %d", name, status))
+			}
+		}
+
+		if backend.MaxConnsPerHost < 0 || backend.MaxIdleConns < 0 || backend.MaxIdleConnsPerHost < 0 {
+			errs = append(errs, fmt.Errorf("backend %q: connection pool settings must not be negative", name))
+		}
+		if pool := backend.ConnectionPool(); pool.MaxIdleConnsPerHost > pool.MaxIdleConns {
+			errs = append(errs, fmt.Errorf("backend %q: max_idle_conns_per_host %d is above max_idle_conns %d", name, pool.MaxIdleConnsPerHost, pool.MaxIdleConns))
+		} else if pool.MaxIdleConnsPerHost > pool.MaxConnsPerHost {
+			errs = append(errs, fmt.Errorf("backend %q: max_idle_conns_per_host %d is above max_conns_per_host %d", name, pool.MaxIdleConnsPerHost, pool.MaxConnsPerHost))
+		}
+
+		for param, limit := range backend.ParamLimits {
+			if limit.Min != nil && limit.Max != nil && *limit.Min > *limit.Max {
+				errs = append(errs, fmt.Errorf("backend %q: param_limits for %q has min %v above max %v", name, param, *limit.Min, *limit.Max))
+			}
+		}
+	}
+
+	errs = append(errs, validateFallbacks(c.Backends)...)
+
+	if a := c.Attachments; a != nil {
+		switch a.Store {
+		case "", AttachmentStoreLocal:
+		case AttachmentStoreS3:
+			if a.S3 == nil || a.S3.Bucket == "" {
+				errs = append(errs, errors.New("attachments: s3 store requires s3.bucket"))
+			} else if a.S3.Endpoint != "" {
+				if err := validateBaseURL(a.S3.Endpoint); err != nil {
+					errs = append(errs, fmt.Errorf("attachments: s3 endpoint: %w", err))
+				}
+			}
+			if a.Dedup {
+				errs = append(errs, errors.New("attachments: dedup is only supported by the local store"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("attachments: unknown store %q", a.Store))
+		}
+	}
+
+	for i, hook := range c.Webhooks {
+		if err := validateBaseURL(hook.URL); err != nil {
+			errs = append(errs, fmt.Errorf("webhooks[%d]: url: %w", i, err))
+		}
+		if hook.Secret == "" {
+			errs = append(errs, fmt.Errorf("webhooks[%d]: secret is required", i))
+		}
+		if hook.MaxAttempts < 0 {
+			errs = append(errs, fmt.Errorf("webhooks[%d]: max_attempts must not be negative", i))
+		}
+	}
+
+	for i, path := range c.ProxyPaths {
+		if !strings.HasPrefix(path, "/") {
+			errs = append(errs, fmt.Errorf("proxy_paths[%d]: %q must start with /", i, path))
+		}
+	}
+
+	if c.StorageQuota < 0 {
+		errs = append(errs, fmt.Errorf("storage_quota %d must not be negative", c.StorageQuota))
+	}
+
+	if c.DBMaxOpenConns < 0 || c.DBMaxIdleConns < 0 || c.DBConnMaxLifetime < 0 || c.DBConnMaxIdleTime < 0 {
+		errs = append(errs, errors.New("database pool settings must not be negative"))
+	}
+	if pool := c.DatabasePool(); pool.MaxIdleConns > pool.MaxOpenConns {
+		errs = append(errs, fmt.Errorf("db_max_idle_conns %d is above db_max_open_conns %d", pool.MaxIdleConns, pool.MaxOpenConns))
+	}
+
+	if len(defaults) > 1 {
+		errs = append(errs, fmt.Errorf("only one backend may be the default, got %s", strings.Join(defaults, ", ")))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func validateBaseURL(baseURL string) error {
+	if baseURL == "" {
+		return errors.New("base_url is required")
+	}
+
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("base_url %q is not a valid URL: %w", baseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("base_url %q must use http or https", baseURL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("base_url %q is missing a host", baseURL)
+	}
+	return nil
+}
+
+// validateFallbacks checks that every fallback names another backend's prefix
+// and that following fallbacks never leads back to where it started
+func validateFallbacks(backends []BackendConfig) []error {
+	var errs []error
+
+	byPrefix := make(map[string]BackendConfig)
+	for _, backend := range backends {
+		if prefix := strings.TrimSpace(backend.Prefix); prefix != "" {
+			byPrefix[prefix] = backend
+		}
+	}
+
+	for _, backend := range backends {
+		fallback := strings.TrimSpace(backend.Fallback)
+		if fallback == "" {
+			continue
+		}
+		if _, ok := byPrefix[fallback]; !ok {
+			errs = append(errs, fmt.Errorf("backend %q: fallback %q does not match any backend prefix", backend.Name, fallback))
+			continue
+		}
+
+		visited := map[string]bool{strings.TrimSpace(backend.Prefix): true}
+		for next, ok := byPrefix[fallback]; ok; next, ok = byPrefix[strings.TrimSpace(next.Fallback)] {
+			prefix := strings.TrimSpace(next.Prefix)
+			if visited[prefix] {
+				errs = append(errs, fmt.Errorf("backend %q: fallback chain loops back to prefix %q", backend.Name, prefix))
+				break
+			}
+			visited[prefix] = true
+		}
+	}
+
+	return errs
+}
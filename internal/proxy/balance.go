@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"net/http/httputil"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"llm-router/internal/model"
+)
+
+// Upstream is the proxy for a single backend
+type Upstream struct {
+	Backend model.BackendConfig
+	Proxy   *httputil.ReverseProxy
+}
+
+// ProxyGroup holds the upstreams serving one prefix and spreads requests
+// across them. A group with a single upstream always picks it.
+type ProxyGroup struct {
+	Upstreams []*Upstream
+	Strategy  string // model.LoadBalanceRoundRobin when empty
+
+	next     atomic.Uint64
+	mu       sync.Mutex
+	lastUsed map[*Upstream]time.Time
+}
+
+// NewProxyGroup creates a group that picks among upstreams using strategy
+func NewProxyGroup(strategy string, upstreams ...*Upstream) *ProxyGroup {
+	return &ProxyGroup{
+		Upstreams: upstreams,
+		Strategy:  strategy,
+	}
+}
+
+// Pick returns the upstream that should serve the next request, or nil if the group is empty
+func (g *ProxyGroup) Pick() *Upstream {
+	switch len(g.Upstreams) {
+	case 0:
+		return nil
+	case 1:
+		return g.Upstreams[0]
+	}
+
+	if g.Strategy == model.LoadBalanceLeastRecentlyUsed {
+		return g.pickLeastRecentlyUsed()
+	}
+	n := g.next.Add(1) - 1
+	return g.Upstreams[n%uint64(len(g.Upstreams))]
+}
+
+func (g *ProxyGroup) pickLeastRecentlyUsed() *Upstream {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.lastUsed == nil {
+		g.lastUsed = make(map[*Upstream]time.Time)
+	}
+
+	// Upstreams never used have a zero time, so they are picked first in order
+	picked := g.Upstreams[0]
+	for _, upstream := range g.Upstreams[1:] {
+		if g.lastUsed[upstream].Before(g.lastUsed[picked]) {
+			picked = upstream
+		}
+	}
+	g.lastUsed[picked] = time.Now()
+	return picked
+}
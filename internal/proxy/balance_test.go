@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"testing"
+
+	"llm-router/internal/model"
+)
+
+func TestProxyGroupPick(t *testing.T) {
+	a := &Upstream{Backend: model.BackendConfig{Name: "a"}}
+	b := &Upstream{Backend: model.BackendConfig{Name: "b"}}
+
+	t.Run("SingleUpstream", func(t *testing.T) {
+		group := NewProxyGroup("", a)
+		for i := 0; i < 3; i++ {
+			if got := group.Pick(); got != a {
+				t.Errorf("expected a, got %s", got.Backend.Name)
+			}
+		}
+	})
+
+	t.Run("RoundRobin", func(t *testing.T) {
+		group := NewProxyGroup(model.LoadBalanceRoundRobin, a, b)
+		expected := []*Upstream{a, b, a, b}
+		for i, want := range expected {
+			if got := group.Pick(); got != want {
+				t.Errorf("pick %d: expected %s, got %s", i, want.Backend.Name, got.Backend.Name)
+			}
+		}
+	})
+
+	t.Run("LeastRecentlyUsed", func(t *testing.T) {
+		group := NewProxyGroup(model.LoadBalanceLeastRecentlyUsed, a, b)
+		first, second, third := group.Pick(), group.Pick(), group.Pick()
+		if first != a || second != b || third != a {
+			t.Errorf("expected a, b, a, got %s, %s, %s", first.Backend.Name, second.Backend.Name, third.Backend.Name)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		if got := NewProxyGroup("").Pick(); got != nil {
+			t.Errorf("expected nil from an empty group, got %v", got)
+		}
+	})
+}
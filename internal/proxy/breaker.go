@@ -0,0 +1,177 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"llm-router/internal/model"
+)
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerWindow    = 60 * time.Second
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// CircuitBreaker stops requests to a backend after threshold consecutive
+// failures within window. Once cooldown has passed it lets a single probe
+// through: success closes the circuit, failure opens it again.
+type CircuitBreaker struct {
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+
+	mu           sync.Mutex
+	state        string
+	failures     int
+	firstFailure time.Time
+	openedAt     time.Time
+	probing      bool
+}
+
+// NewCircuitBreaker creates a closed breaker
+func NewCircuitBreaker(threshold int, window, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		window:    window,
+		cooldown:  cooldown,
+		state:     CircuitClosed,
+	}
+}
+
+// newCircuitBreaker builds the breaker for a backend, or nil when it has none configured
+func newCircuitBreaker(cfg *model.CircuitBreakerConfig) *CircuitBreaker {
+	if cfg == nil {
+		return nil
+	}
+
+	threshold := defaultBreakerThreshold
+	if cfg.Threshold > 0 {
+		threshold = cfg.Threshold
+	}
+	window := defaultBreakerWindow
+	if cfg.Window > 0 {
+		window = time.Duration(cfg.Window) * time.Second
+	}
+	cooldown := defaultBreakerCooldown
+	if cfg.Cooldown > 0 {
+		cooldown = time.Duration(cfg.Cooldown) * time.Second
+	}
+	return NewCircuitBreaker(threshold, window, cooldown)
+}
+
+// Allow reports whether a request may be sent to the backend
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		return true
+	case CircuitHalfOpen:
+		// Only one probe at a time while half-open
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// RecordSuccess closes the circuit
+func (b *CircuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = CircuitClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// RecordCanceled ends a request whose outcome says nothing about the
+// backend, freeing the half-open probe slot for the next request
+func (b *CircuitBreaker) RecordCanceled() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// RecordFailure counts a failure, opening the circuit once the threshold is
+// reached or straight away if the failure was a half-open probe
+func (b *CircuitBreaker) RecordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if b.state == CircuitHalfOpen {
+		b.open(now)
+		return
+	}
+
+	if b.failures == 0 || now.Sub(b.firstFailure) > b.window {
+		b.failures = 0
+		b.firstFailure = now
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.open(now)
+	}
+}
+
+func (b *CircuitBreaker) open(now time.Time) {
+	b.state = CircuitOpen
+	b.openedAt = now
+	b.failures = 0
+	b.probing = false
+}
+
+// carryOver takes on previous's state, so rebuilding a breaker on reload
+// doesn't close a circuit that is open. A probe still in flight reports to
+// previous, so the new breaker lets the next one through.
+func (b *CircuitBreaker) carryOver(previous *CircuitBreaker) {
+	previous.mu.Lock()
+	state, failures, firstFailure, openedAt := previous.state, previous.failures, previous.firstFailure, previous.openedAt
+	previous.mu.Unlock()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state, b.failures, b.firstFailure, b.openedAt = state, failures, firstFailure, openedAt
+	b.probing = false
+}
+
+// State returns the breaker's current state
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.cooldown {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// RetryAfter returns how long until an open circuit lets a probe through
+func (b *CircuitBreaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != CircuitOpen {
+		return 0
+	}
+	return max(b.cooldown-time.Since(b.openedAt), 0)
+}
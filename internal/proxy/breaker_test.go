@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"llm-router/internal/model"
+
+	"go.uber.org/zap"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("Opens After Threshold", func(t *testing.T) {
+		b := NewCircuitBreaker(3, time.Minute, time.Minute)
+		for i := 0; i < 2; i++ {
+			b.RecordFailure()
+		}
+		if b.State() != CircuitClosed || !b.Allow() {
+			t.Fatalf("expected circuit to stay closed below the threshold")
+		}
+
+		b.RecordFailure()
+		if b.State() != CircuitOpen {
+			t.Fatalf("expected circuit open, got %s", b.State())
+		}
+		if b.Allow() {
+			t.Errorf("expected open circuit to refuse requests")
+		}
+	})
+
+	t.Run("Success Resets Count", func(t *testing.T) {
+		b := NewCircuitBreaker(2, time.Minute, time.Minute)
+		b.RecordFailure()
+		b.RecordSuccess()
+		b.RecordFailure()
+		if b.State() != CircuitClosed {
+			t.Errorf("expected failures separated by a success not to open the circuit")
+		}
+	})
+
+	t.Run("Failures Outside Window", func(t *testing.T) {
+		b := NewCircuitBreaker(2, 10*time.Millisecond, time.Minute)
+		b.RecordFailure()
+		time.Sleep(20 * time.Millisecond)
+		b.RecordFailure()
+		if b.State() != CircuitClosed {
+			t.Errorf("expected failures outside the window not to open the circuit")
+		}
+	})
+
+	t.Run("Half Open Probe", func(t *testing.T) {
+		b := NewCircuitBreaker(1, time.Minute, 10*time.Millisecond)
+		b.RecordFailure()
+		time.Sleep(20 * time.Millisecond)
+
+		if b.State() != CircuitHalfOpen {
+			t.Fatalf("expected half-open after cooldown, got %s", b.State())
+		}
+		if !b.Allow() {
+			t.Fatalf("expected a probe to be allowed")
+		}
+		if b.Allow() {
+			t.Errorf("expected only one probe at a time")
+		}
+
+		b.RecordFailure()
+		if b.State() != CircuitOpen {
+			t.Fatalf("expected failed probe to reopen the circuit, got %s", b.State())
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		if !b.Allow() {
+			t.Fatalf("expected a second probe after cooldown")
+		}
+		b.RecordSuccess()
+		if b.State() != CircuitClosed || !b.Allow() {
+			t.Errorf("expected successful probe to close the circuit")
+		}
+	})
+
+	t.Run("Canceled Probe", func(t *testing.T) {
+		b := NewCircuitBreaker(1, time.Minute, 0)
+		b.RecordFailure()
+		b.Allow()
+		b.RecordCanceled()
+		if !b.Allow() {
+			t.Errorf("expected canceled probe to free the probe slot")
+		}
+	})
+}
+
+func TestCircuitBreakerProxy(t *testing.T) {
+	var hits atomic.Int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+
+	serve := func(set *ProxySet, prefix string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		rr := httptest.NewRecorder()
+		set.Proxies[prefix].Pick().Proxy.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Short Circuits", func(t *testing.T) {
+		hits.Store(0)
+		set := NewProxySet([]model.BackendConfig{{
+			Name:           "a",
+			BaseURL:        failing.URL,
+			Prefix:         "a/",
+			CircuitBreaker: &model.CircuitBreakerConfig{Threshold: 2, Cooldown: 60},
+		}}, zap.NewNop())
+
+		for i := 0; i < 2; i++ {
+			if rr := serve(set, "a/"); rr.Code != http.StatusInternalServerError {
+				t.Fatalf("expected upstream 500, got %d", rr.Code)
+			}
+		}
+
+		rr := serve(set, "a/")
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected 503 while open, got %d", rr.Code)
+		}
+		if rr.Header().Get("Retry-After") == "" {
+			t.Errorf("expected Retry-After on short-circuited response")
+		}
+		if hits.Load() != 2 {
+			t.Errorf("expected the upstream not to be called while open, got %d calls", hits.Load())
+		}
+		if state := set.Breakers["a"].State(); state != CircuitOpen {
+			t.Errorf("expected breaker open, got %s", state)
+		}
+	})
+
+	t.Run("Uses Fallback", func(t *testing.T) {
+		hits.Store(0)
+		set := NewProxySet([]model.BackendConfig{
+			{
+				Name:           "a",
+				BaseURL:        failing.URL,
+				Prefix:         "a/",
+				Fallback:       "b/",
+				CircuitBreaker: &model.CircuitBreakerConfig{Threshold: 1, Cooldown: 60},
+			},
+			{Name: "b", BaseURL: healthy.URL, Prefix: "b/"},
+		}, zap.NewNop())
+
+		for i := 0; i < 3; i++ {
+			if rr := serve(set, "a/"); rr.Code != http.StatusOK {
+				t.Fatalf("expected fallback to serve the request, got %d", rr.Code)
+			}
+		}
+		if hits.Load() != 1 {
+			t.Errorf("expected only the first request to reach the failing backend, got %d", hits.Load())
+		}
+	})
+}
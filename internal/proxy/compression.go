@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+
+	"llm-router/internal/model"
+)
+
+// upstreamEncodings is offered to backends that opt into upstream_compression
+const upstreamEncodings = "gzip, deflate"
+
+// createBackendTransport returns the transport for a backend. Go's transport
+// asks for gzip and decodes it on its own unless the backend turns
+// compression off; backends that opt in are offered gzip and deflate,
+// which decodeResponseBody handles.
+//
+// Backends with http2 set only get HTTP/2: over TLS without falling back to
+// HTTP/1.1, and for http:// URLs as h2c with prior knowledge, so concurrent
+// streams share a connection instead of queueing for max_conns_per_host.
+func createBackendTransport(backend model.BackendConfig) *http.Transport {
+	transport := createTransport(backend.ConnectionPool())
+	if backend.UpstreamCompression != nil && !*backend.UpstreamCompression {
+		transport.DisableCompression = true
+	}
+	if backend.HTTP2 {
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetHTTP2(true)
+		transport.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return transport
+}
+
+// setAcceptEncoding replaces the client's Accept-Encoding, since responses
+// are inspected and logged here, with the encodings the backend is offered
+func (t *debugTransport) setAcceptEncoding(req *http.Request) {
+	req.Header.Del("Accept-Encoding")
+	if compression := t.backendConf.UpstreamCompression; compression != nil && *compression {
+		req.Header.Set("Accept-Encoding", upstreamEncodings)
+	}
+}
+
+// decodeResponseBody replaces a gzip or deflate encoded body with its
+// decoded content, so it is logged, inspected and passed on uncompressed.
+// Decoding starts on the first read, so a streamed response isn't held up.
+func decodeResponseBody(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding != "gzip" && encoding != "deflate" {
+		return
+	}
+
+	resp.Body = &decodedBody{body: resp.Body, encoding: encoding}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+}
+
+// decodedBody decodes a compressed response body as it is read
+type decodedBody struct {
+	body     io.ReadCloser
+	encoding string
+	reader   io.Reader
+	err      error // error from setting up the decoder
+}
+
+func (b *decodedBody) Read(p []byte) (int, error) {
+	if b.reader == nil && b.err == nil {
+		b.reader, b.err = newDecoder(b.body, b.encoding)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.reader.Read(p)
+}
+
+func (b *decodedBody) Close() error {
+	if closer, ok := b.reader.(io.Closer); ok {
+		closer.Close()
+	}
+	return b.body.Close()
+}
+
+// newDecoder reads the encoding's header from body. "deflate" is meant to be
+// zlib-wrapped, but some servers send raw deflate data, so both are accepted.
+func newDecoder(body io.Reader, encoding string) (io.Reader, error) {
+	if encoding == "gzip" {
+		return gzip.NewReader(body)
+	}
+
+	buffered := bufio.NewReader(body)
+	header, err := buffered.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	// A zlib header names deflate as its method and is a multiple of 31
+	if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+	return flate.NewReader(buffered), nil
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"llm-router/internal/model"
+
+	"go.uber.org/zap"
+)
+
+func TestUpstreamCompression(t *testing.T) {
+	const payload = `{"object":"list","data":[{"id":"gpt-4o"}]}`
+	enabled, disabled := true, false
+
+	tests := []struct {
+		name        string
+		compression *bool
+		encoding    string // Content-Encoding the upstream replies with
+		wantOffered string
+	}{
+		{"Default", nil, "gzip", "gzip"},
+		{"Gzip", &enabled, "gzip", upstreamEncodings},
+		{"Deflate", &enabled, "deflate", upstreamEncodings},
+		{"Raw Deflate", &enabled, "raw-deflate", upstreamEncodings},
+		{"Disabled", &disabled, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var offered string
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				offered = r.Header.Get("Accept-Encoding")
+				w.Header().Set("Content-Type", "application/json")
+
+				var encoder io.WriteCloser
+				switch tt.encoding {
+				case "gzip":
+					w.Header().Set("Content-Encoding", "gzip")
+					encoder = gzip.NewWriter(w)
+				case "deflate":
+					w.Header().Set("Content-Encoding", "deflate")
+					encoder = zlib.NewWriter(w)
+				case "raw-deflate":
+					w.Header().Set("Content-Encoding", "deflate")
+					encoder, _ = flate.NewWriter(w, flate.DefaultCompression)
+				default:
+					w.Write([]byte(payload))
+					return
+				}
+				encoder.Write([]byte(payload))
+				encoder.Close()
+			}))
+			defer upstream.Close()
+
+			set := NewProxySet([]model.BackendConfig{
+				{Name: "a", BaseURL: upstream.URL, Prefix: "a/", UpstreamCompression: tt.compression},
+			}, zap.NewNop())
+
+			req := httptest.NewRequest("GET", "/models", nil)
+			req.Header.Set("Accept-Encoding", "br")
+			rr := httptest.NewRecorder()
+			set.Proxies["a/"].Pick().Proxy.ServeHTTP(rr, req)
+
+			if offered != tt.wantOffered {
+				t.Errorf("expected the backend to be offered %q, got %q", tt.wantOffered, offered)
+			}
+			if rr.Body.String() != payload {
+				t.Errorf("expected the decoded body, got %q", rr.Body.String())
+			}
+			if encoding := rr.Header().Get("Content-Encoding"); encoding != "" {
+				t.Errorf("expected no Content-Encoding toward the client, got %q", encoding)
+			}
+		})
+	}
+
+	t.Run("Corrupt Body", func(t *testing.T) {
+		resp := &http.Response{
+			Header: http.Header{"Content-Encoding": []string{"gzip"}},
+			Body:   io.NopCloser(strings.NewReader("not gzip")),
+		}
+		decodeResponseBody(resp)
+		if _, err := io.ReadAll(resp.Body); err == nil {
+			t.Error("expected an error reading a corrupt body")
+		}
+	})
+}
@@ -3,6 +3,8 @@ package proxy
 import (
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 )
@@ -10,13 +12,28 @@ import (
 const (
 	errNoKeys         = "at least one API key is required"
 	errAllKeysUnavail = "all API keys are currently unavailable due to failures"
+	errKeyNotFound    = "no API key matches"
+	errKeyAmbiguous   = "more than one API key matches"
+	maskedKeySuffix   = 4
 )
 
+// KeyStatus describes one key of a CredentialManager for admins. The key
+// itself is masked to its last few characters.
+type KeyStatus struct {
+	Index        int        `json:"index"`
+	Key          string     `json:"key"`
+	Available    bool       `json:"available"`
+	Disabled     bool       `json:"disabled"`               // taken out of rotation by an admin
+	FailedUntil  *time.Time `json:"failed_until,omitempty"` // when a failure for every model expires
+	FailedModels []string   `json:"failed_models,omitempty"`
+}
+
 type CredentialManager struct {
 	keys         []string
 	currentIndex int
 	// failedKeyModels maps "key|model" -> expiration time
 	failedKeyModels map[string]time.Time
+	disabled        map[string]bool // keys taken out of rotation until re-enabled
 	timeoutDur      time.Duration
 	mu              sync.Mutex
 }
@@ -30,10 +47,13 @@ func NewCredentialManager(keys []string, timeoutDuration time.Duration) (*Creden
 		keys:            keys,
 		currentIndex:    0,
 		failedKeyModels: make(map[string]time.Time),
+		disabled:        make(map[string]bool),
 		timeoutDur:      timeoutDuration,
 	}, nil
 }
 
+// GetNextKey returns the next key in round-robin order that is available for
+// model. A key that failed for one model is still handed out for others.
 func (cm *CredentialManager) GetNextKey(model string) (string, error) {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
@@ -61,7 +81,15 @@ func (cm *CredentialManager) GetNextKey(model string) (string, error) {
 	return "", errors.New(errAllKeysUnavail)
 }
 
+// MarkKeyFailed takes key out of rotation for model for the manager's timeout
 func (cm *CredentialManager) MarkKeyFailed(key, model string) {
+	cm.MarkKeyFailedFor(key, model, cm.timeoutDur)
+}
+
+// MarkKeyFailedFor takes key out of rotation for the model for duration d
+// instead of the manager's default timeout. An empty model disables the key
+// for every model.
+func (cm *CredentialManager) MarkKeyFailedFor(key, model string, d time.Duration) {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
@@ -70,9 +98,10 @@ func (cm *CredentialManager) MarkKeyFailed(key, model string) {
 		compositeKey = fmt.Sprintf("%s|%s", key, model)
 	}
 
-	cm.failedKeyModels[compositeKey] = time.Now().Add(cm.timeoutDur)
+	cm.failedKeyModels[compositeKey] = time.Now().Add(d)
 }
 
+// IsKeyAvailable reports whether key has no unexpired failure for model or for every model
 func (cm *CredentialManager) IsKeyAvailable(key, model string) bool {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
@@ -81,6 +110,10 @@ func (cm *CredentialManager) IsKeyAvailable(key, model string) bool {
 }
 
 func (cm *CredentialManager) isKeyAvailableUnlocked(key, model string) bool {
+	if cm.disabled[key] {
+		return false
+	}
+
 	// Check specific model failure
 	if model != "" {
 		compositeKey := fmt.Sprintf("%s|%s", key, model)
@@ -110,6 +143,14 @@ func (cm *CredentialManager) cleanupExpiredTimeouts() {
 	}
 }
 
+// KeyIndex returns the position of key in the key list, or -1 if it isn't one of them
+func (cm *CredentialManager) KeyIndex(key string) int {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	return slices.Index(cm.keys, key)
+}
+
 func (cm *CredentialManager) GetKeyCount() int {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
@@ -135,3 +176,107 @@ func (cm *CredentialManager) GetAvailableKeyCount() int {
 
 	return available
 }
+
+// Disable takes key out of rotation for every model until Enable is called
+func (cm *CredentialManager) Disable(key string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cm.disabled[key] = true
+}
+
+// Enable puts key back into rotation, clearing any failures recorded for it
+func (cm *CredentialManager) Enable(key string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	delete(cm.disabled, key)
+	for compositeKey := range cm.failedKeyModels {
+		if compositeKey == key || strings.HasPrefix(compositeKey, key+"|") {
+			delete(cm.failedKeyModels, compositeKey)
+		}
+	}
+}
+
+// DisabledKeys returns the keys an admin has disabled
+func (cm *CredentialManager) DisabledKeys() []string {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	keys := make([]string, 0, len(cm.disabled))
+	for _, key := range cm.keys {
+		if cm.disabled[key] {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// FindKey returns the key at index, or when index is negative the only key
+// ending in suffix, so admins can pick a key without sending it in full
+func (cm *CredentialManager) FindKey(index int, suffix string) (string, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if index >= 0 {
+		if index >= len(cm.keys) {
+			return "", errors.New(errKeyNotFound)
+		}
+		return cm.keys[index], nil
+	}
+
+	suffix = strings.TrimLeft(suffix, ".")
+	if suffix == "" {
+		return "", errors.New(errKeyNotFound)
+	}
+	var match string
+	for _, key := range cm.keys {
+		if strings.HasSuffix(key, suffix) {
+			if match != "" {
+				return "", errors.New(errKeyAmbiguous)
+			}
+			match = key
+		}
+	}
+	if match == "" {
+		return "", errors.New(errKeyNotFound)
+	}
+	return match, nil
+}
+
+// Status reports the state of every key
+func (cm *CredentialManager) Status() []KeyStatus {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cm.cleanupExpiredTimeouts()
+
+	statuses := make([]KeyStatus, len(cm.keys))
+	for i, key := range cm.keys {
+		status := KeyStatus{
+			Index:     i,
+			Key:       maskKey(key),
+			Available: cm.isKeyAvailableUnlocked(key, ""),
+			Disabled:  cm.disabled[key],
+		}
+		if until, ok := cm.failedKeyModels[key]; ok {
+			status.FailedUntil = &until
+		}
+		for compositeKey := range cm.failedKeyModels {
+			if model, ok := strings.CutPrefix(compositeKey, key+"|"); ok {
+				status.FailedModels = append(status.FailedModels, model)
+			}
+		}
+		slices.Sort(status.FailedModels)
+		statuses[i] = status
+	}
+	return statuses
+}
+
+// maskKey hides all but the last few characters of key
+func maskKey(key string) string {
+	if len(key) <= maskedKeySuffix*2 {
+		return strings.Repeat("*", len(key))
+	}
+	return "..." + key[len(key)-maskedKeySuffix:]
+}
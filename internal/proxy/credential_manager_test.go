@@ -244,3 +244,66 @@ func TestModelSpecificFailure(t *testing.T) {
 		t.Error("Expected key1 to be available globally")
 	}
 }
+
+func TestDisableEnable(t *testing.T) {
+	keys := []string{"sk-first-aaaa", "sk-second-bbbb"}
+	cm, _ := NewCredentialManager(keys, 60*time.Second)
+
+	cm.Disable("sk-first-aaaa")
+	if cm.IsKeyAvailable("sk-first-aaaa", "") || cm.IsKeyAvailable("sk-first-aaaa", "gpt-4") {
+		t.Error("Expected a disabled key to be unavailable for every model")
+	}
+	for i := 0; i < 3; i++ {
+		if key, _ := cm.GetNextKey("gpt-4"); key != "sk-second-bbbb" {
+			t.Errorf("Expected only the enabled key to be handed out, got %s", key)
+		}
+	}
+
+	status := cm.Status()
+	if !status[0].Disabled || status[0].Available || status[0].Key != "...aaaa" {
+		t.Errorf("Unexpected status for the disabled key: %+v", status[0])
+	}
+
+	cm.MarkKeyFailed("sk-first-aaaa", "gpt-4")
+	cm.Enable("sk-first-aaaa")
+	if !cm.IsKeyAvailable("sk-first-aaaa", "gpt-4") {
+		t.Error("Expected enabling a key to clear its failures")
+	}
+	if len(cm.DisabledKeys()) != 0 {
+		t.Errorf("Expected no disabled keys, got %v", cm.DisabledKeys())
+	}
+}
+
+func TestFindKey(t *testing.T) {
+	cm, _ := NewCredentialManager([]string{"sk-first-aaaa", "sk-second-bbbb", "sk-third-xbbbb"}, 60*time.Second)
+
+	tests := []struct {
+		name    string
+		index   int
+		suffix  string
+		want    string
+		wantErr string
+	}{
+		{"By Index", 1, "", "sk-second-bbbb", ""},
+		{"Index Out Of Range", 3, "", "", errKeyNotFound},
+		{"By Masked Suffix", -1, "...aaaa", "sk-first-aaaa", ""},
+		{"Ambiguous Suffix", -1, "bbbb", "", errKeyAmbiguous},
+		{"Longer Suffix", -1, "xbbbb", "sk-third-xbbbb", ""},
+		{"No Match", -1, "zzzz", "", errKeyNotFound},
+		{"Empty Suffix", -1, "", "", errKeyNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := cm.FindKey(tt.index, tt.suffix)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil || key != tt.want {
+				t.Errorf("Expected %s, got %s (%v)", tt.want, key, err)
+			}
+		})
+	}
+}
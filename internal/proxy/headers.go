@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"llm-router/internal/model"
+	"llm-router/internal/utils"
+)
+
+// makeModifyResponse returns the backend's ModifyResponse hook. Only headers
+// are changed, so streaming bodies pass through untouched.
+func makeModifyResponse(backend model.BackendConfig) func(*http.Response) error {
+	// Every rate-limit header is forwarded unless the backend lists the ones it wants
+	allowed := backend.RateLimitHeaders
+
+	rules := backend.ResponseHeaders
+
+	return func(resp *http.Response) error {
+		// A fallback backend's response already has that backend's rules applied
+		if isModifiedResponse(resp) {
+			return nil
+		}
+		// The router echoes its own request ID, which the backend was given
+		if resp.Request != nil && utils.RequestIDFrom(resp.Request.Context()) != "" {
+			resp.Header.Del(utils.RequestIDHeader)
+		}
+		if len(allowed) > 0 {
+			filterRateLimitHeaders(resp.Header, allowed)
+		}
+		if rules != nil {
+			applyHeaderRules(resp.Header, rules)
+		}
+		return nil
+	}
+}
+
+type modifiedResponseKey struct{}
+
+// markModifiedResponse records that resp has been through the ModifyResponse
+// of the backend that answered it, so the backends it fell back from leave
+// it alone
+func markModifiedResponse(resp *http.Response, req *http.Request) {
+	if resp.Request != nil {
+		req = resp.Request
+	}
+	resp.Request = req.WithContext(context.WithValue(req.Context(), modifiedResponseKey{}, true))
+}
+
+func isModifiedResponse(resp *http.Response) bool {
+	return resp.Request != nil && resp.Request.Context().Value(modifiedResponseKey{}) != nil
+}
+
+// applyHeaderRules removes the headers matching rules.Remove, then sets rules.Set
+func applyHeaderRules(header http.Header, rules *model.HeaderRules) {
+	if len(rules.Remove) > 0 {
+		for name := range header {
+			if headerMatchesAny(name, rules.Remove) {
+				header.Del(name)
+			}
+		}
+	}
+	for name, value := range rules.Set {
+		header.Set(name, value)
+	}
+}
+
+// filterRateLimitHeaders drops upstream rate-limit headers that don't match
+// one of the allowed patterns, leaving all other headers alone
+func filterRateLimitHeaders(header http.Header, allowed []string) {
+	for name := range header {
+		if isRateLimitHeader(name) && !headerMatchesAny(name, allowed) {
+			header.Del(name)
+		}
+	}
+}
+
+func isRateLimitHeader(name string) bool {
+	lowered := strings.ToLower(name)
+	return strings.Contains(lowered, "ratelimit") ||
+		strings.Contains(lowered, "rate-limit") ||
+		lowered == "retry-after"
+}
+
+// headerMatchesAny reports whether name matches a pattern, either exactly or,
+// for patterns ending in "*", by prefix. Matching ignores case.
+func headerMatchesAny(name string, patterns []string) bool {
+	lowered := strings.ToLower(name)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(lowered, prefix) {
+				return true
+			}
+		} else if lowered == pattern {
+			return true
+		}
+	}
+	return false
+}
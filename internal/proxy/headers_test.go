@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"llm-router/internal/model"
+
+	"go.uber.org/zap"
+)
+
+func TestRateLimitHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining-Requests", "42")
+		w.Header().Set("X-RateLimit-Reset-Tokens", "6s")
+		w.Header().Set("Anthropic-RateLimit-Requests-Remaining", "7")
+		w.Header().Set("Retry-After", "2")
+		w.Header().Set("X-Request-Id", "abc")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	serve := func(backend model.BackendConfig) http.Header {
+		set := NewProxySet([]model.BackendConfig{backend}, zap.NewNop())
+		req := httptest.NewRequest("GET", "/v1/models", nil)
+		rr := httptest.NewRecorder()
+		set.Proxies[backend.Prefix].Pick().Proxy.ServeHTTP(rr, req)
+		return rr.Header()
+	}
+
+	t.Run("Unset Forwards All", func(t *testing.T) {
+		header := serve(model.BackendConfig{Name: "a", BaseURL: upstream.URL, Prefix: "a/"})
+
+		for _, name := range []string{"X-Ratelimit-Remaining-Requests", "X-Ratelimit-Reset-Tokens", "Anthropic-Ratelimit-Requests-Remaining", "Retry-After", "X-Request-Id"} {
+			if header.Get(name) == "" {
+				t.Errorf("expected %s to be forwarded", name)
+			}
+		}
+	})
+
+	t.Run("Configured", func(t *testing.T) {
+		header := serve(model.BackendConfig{
+			Name:             "b",
+			BaseURL:          upstream.URL,
+			Prefix:           "b/",
+			RateLimitHeaders: []string{"anthropic-ratelimit-*", "X-RateLimit-Remaining-Requests"},
+		})
+
+		for _, name := range []string{"Anthropic-Ratelimit-Requests-Remaining", "X-Ratelimit-Remaining-Requests", "X-Request-Id"} {
+			if header.Get(name) == "" {
+				t.Errorf("expected %s to be forwarded", name)
+			}
+		}
+		for _, name := range []string{"X-Ratelimit-Reset-Tokens", "Retry-After"} {
+			if header.Get(name) != "" {
+				t.Errorf("expected %s to be dropped", name)
+			}
+		}
+	})
+}
+
+func TestResponseHeaderRules(t *testing.T) {
+	const stream = "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=upstream")
+		w.Header().Set("X-Internal-Trace", "1")
+		w.Header().Set("X-Internal-Region", "us")
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(stream))
+	}))
+	defer upstream.Close()
+
+	backend := model.BackendConfig{
+		Name:    "a",
+		BaseURL: upstream.URL,
+		Prefix:  "a/",
+		ResponseHeaders: &model.HeaderRules{
+			Remove: []string{"Set-Cookie", "x-internal-*"},
+			Set:    map[string]string{"Content-Type": "text/event-stream", "X-Served-By": "llm-router"},
+		},
+	}
+	set := NewProxySet([]model.BackendConfig{backend}, zap.NewNop())
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"m","stream":true}`))
+	rr := httptest.NewRecorder()
+	set.Proxies["a/"].Pick().Proxy.ServeHTTP(rr, req)
+
+	header := rr.Header()
+	for _, name := range []string{"Set-Cookie", "X-Internal-Trace", "X-Internal-Region"} {
+		if header.Get(name) != "" {
+			t.Errorf("expected %s to be removed", name)
+		}
+	}
+	if got := header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+	if got := header.Get("X-Served-By"); got != "llm-router" {
+		t.Errorf("X-Served-By = %q, want llm-router", got)
+	}
+	if rr.Body.String() != stream {
+		t.Errorf("expected streaming body to pass through unchanged, got %q", rr.Body.String())
+	}
+}
+
+func TestFallbackResponseHeaderRules(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream-Region", "eu")
+		w.Header().Set("X-Ratelimit-Remaining-Tokens", "100")
+		w.Header().Set("X-Internal-Trace", "1")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer secondary.Close()
+
+	set := NewProxySet([]model.BackendConfig{
+		{
+			Name: "a", BaseURL: primary.URL, Prefix: "a/", Fallback: "b/",
+			RateLimitHeaders: []string{"x-ratelimit-remaining-requests"},
+			ResponseHeaders: &model.HeaderRules{
+				Remove: []string{"x-upstream-*"},
+				Set:    map[string]string{"X-Served-By": "a"},
+			},
+		},
+		{
+			Name: "b", BaseURL: secondary.URL, Prefix: "b/",
+			ResponseHeaders: &model.HeaderRules{
+				Remove: []string{"x-internal-*"},
+				Set:    map[string]string{"X-Served-By": "b"},
+			},
+		},
+	}, zap.NewNop())
+
+	req := httptest.NewRequest("POST", "/chat/completions", strings.NewReader(`{"model":"m"}`))
+	rr := httptest.NewRecorder()
+	set.Proxies["a/"].Pick().Proxy.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the fallback response, got %d", rr.Code)
+	}
+	header := rr.Header()
+	if got := header.Get("X-Served-By"); got != "b" {
+		t.Errorf("X-Served-By = %q, want the fallback backend's b", got)
+	}
+	if header.Get("X-Internal-Trace") != "" {
+		t.Error("expected the fallback backend's removal rule to apply")
+	}
+	if header.Get("X-Upstream-Region") != "eu" {
+		t.Error("expected the failed backend's removal rule not to apply")
+	}
+	if header.Get("X-Ratelimit-Remaining-Tokens") != "100" {
+		t.Error("expected the failed backend's rate-limit filter not to apply")
+	}
+}
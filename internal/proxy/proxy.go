@@ -2,19 +2,30 @@ package proxy
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"llm-router/internal/events"
 	"llm-router/internal/model"
+	"llm-router/internal/tracing"
 	"llm-router/internal/utils"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -22,23 +33,39 @@ const (
 	defaultTimeout          = 30 * time.Second
 	tlsHandshakeTimeout     = 10 * time.Second
 	expectContinueTimeout   = 5 * time.Second
-	maxIdleConns            = 100
-	maxConnsPerHost         = 20
-	maxIdleConnsPerHost     = 10
-	credentialTimeout       = 60 * time.Second
+	credentialTimeout       = 60 * time.Second // a rate-limited key sits out this long for the model
+	authFailureTimeout      = 24 * time.Hour   // a rejected key sits out this long, or until the config is reloaded
 	maxRetryAttempts        = 5
 	chatCompletionsPath     = "/chat/completions"
-	streamTruePattern       = `"stream":true`
 	eventStreamContentType  = "text/event-stream"
 	chunkedTransferEncoding = "chunked"
 )
 
-var (
-	Proxies            map[string]*httputil.ReverseProxy
+// ProxySet holds the proxies built from one backend configuration. A set is
+// not modified once installed; a config reload builds a new set and swaps it
+// in, so in-flight requests keep using the set they started with.
+type ProxySet struct {
+	Proxies            map[string]*ProxyGroup
 	DefaultProxy       *httputil.ReverseProxy
 	CredentialManagers map[string]*CredentialManager
 	BackendConfigs     map[string]model.BackendConfig
-	retryableStatuses  = map[int]bool{
+	Breakers           map[string]*CircuitBreaker // only backends with a circuit_breaker configured
+}
+
+var (
+	current               atomic.Pointer[ProxySet]
+	maxLoggedResponseSize atomic.Int64
+	streamHeartbeat       atomic.Int64 // time.Duration; 0 disables heartbeats
+	streamIdleTimeout     atomic.Int64 // time.Duration; 0 disables the stall check
+	// keyFailureStatuses mean the upstream refused the API key itself, so the
+	// key is marked failed and the request retried with the next one
+	keyFailureStatuses = map[int]bool{
+		http.StatusUnauthorized:    true,
+		http.StatusForbidden:       true,
+		http.StatusTooManyRequests: true,
+	}
+	// retryableStatuses are retried for backends that don't set retryable_statuses
+	retryableStatuses = map[int]bool{
 		http.StatusTooManyRequests:     true,
 		http.StatusInternalServerError: true,
 		http.StatusBadGateway:          true,
@@ -69,14 +96,14 @@ func resolveAPIKeys(backend model.BackendConfig, logger *zap.Logger) []string {
 	return resolvedKeys
 }
 
-func initCredentialManager(backend model.BackendConfig, logger *zap.Logger) {
+func newCredentialManager(backend model.BackendConfig, logger *zap.Logger) *CredentialManager {
 	if len(backend.APIKeys) == 0 {
-		return
+		return nil
 	}
 
 	resolvedKeys := resolveAPIKeys(backend, logger)
 	if len(resolvedKeys) == 0 {
-		return
+		return nil
 	}
 
 	cm, err := NewCredentialManager(resolvedKeys, credentialTimeout)
@@ -84,42 +111,143 @@ func initCredentialManager(backend model.BackendConfig, logger *zap.Logger) {
 		logger.Error("Failed to create credential manager",
 			zap.String("backend", backend.Name),
 			zap.Error(err))
-		return
+		return nil
 	}
 
-	CredentialManagers[backend.Name] = cm
 	logger.Info("Initialized credential manager for backend",
 		zap.String("backend", backend.Name),
 		zap.Int("keyCount", cm.GetKeyCount()))
+	return cm
 }
 
-func createTransport() *http.Transport {
+// createTransport returns a transport with the router's timeouts and pool's
+// connection limits. Requests beyond MaxConnsPerHost wait for a connection to
+// free up, and a streamed response keeps its connection until the stream
+// ends, so the limit caps a backend's concurrent HTTP/1.1 streams.
+func createTransport(pool model.ConnectionPool) *http.Transport {
 	transport := http.DefaultTransport.(*http.Transport).Clone()
 	transport.ResponseHeaderTimeout = defaultTimeout
 	transport.TLSHandshakeTimeout = tlsHandshakeTimeout
 	transport.ExpectContinueTimeout = expectContinueTimeout
-	transport.MaxIdleConns = maxIdleConns
-	transport.MaxConnsPerHost = maxConnsPerHost
-	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	transport.MaxIdleConns = pool.MaxIdleConns
+	transport.MaxConnsPerHost = pool.MaxConnsPerHost
+	transport.MaxIdleConnsPerHost = pool.MaxIdleConnsPerHost
 	return transport
 }
 
+// Prefixes returns the configured model prefixes in sorted order
+func (s *ProxySet) Prefixes() []string {
+	prefixes := make([]string, 0, len(s.Proxies))
+	for prefix := range s.Proxies {
+		prefixes = append(prefixes, prefix)
+	}
+	slices.Sort(prefixes)
+	return prefixes
+}
+
+// Current returns the proxy set in use. It is never nil.
+func Current() *ProxySet {
+	if set := current.Load(); set != nil {
+		return set
+	}
+	return &ProxySet{}
+}
+
+// Initialized reports whether proxies have been built from the config yet
+func Initialized() bool {
+	return current.Load() != nil
+}
+
+// SetCurrent installs set for all new requests
+func SetCurrent(set *ProxySet) {
+	current.Store(set)
+}
+
+// SetMaxLoggedResponseSize caps how many bytes of a non-streaming upstream
+// response are kept for debug logging. Responses are still passed on in full.
+func SetMaxLoggedResponseSize(size int) {
+	maxLoggedResponseSize.Store(int64(size))
+}
+
+// SetStreamHeartbeat sets how long an event stream may be silent before a
+// keepalive comment is sent to the client. Zero disables heartbeats.
+func SetStreamHeartbeat(interval time.Duration) {
+	streamHeartbeat.Store(int64(interval))
+}
+
+// SetStreamIdleTimeout sets how long a streamed response may go without data
+// from the upstream before the stream is aborted. Zero disables the check.
+func SetStreamIdleTimeout(timeout time.Duration) {
+	streamIdleTimeout.Store(int64(timeout))
+}
+
+// InitializeProxies builds proxies for backends and makes them current. Keys an
+// admin disabled stay disabled in the new set, so a config reload doesn't put a
+// compromised key back into rotation. Circuit breakers of backends whose
+// config is unchanged keep their state, so a reload doesn't reopen the flood
+// to a backend that is down.
 func InitializeProxies(backends []model.BackendConfig, logger *zap.Logger) {
-	Proxies = make(map[string]*httputil.ReverseProxy)
-	CredentialManagers = make(map[string]*CredentialManager)
-	BackendConfigs = make(map[string]model.BackendConfig)
+	set := NewProxySet(backends, logger)
+	previousSet := Current()
+	for name, breaker := range set.Breakers {
+		previous, ok := previousSet.Breakers[name]
+		if ok && reflect.DeepEqual(previousSet.BackendConfigs[name], set.BackendConfigs[name]) {
+			breaker.carryOver(previous)
+		}
+	}
+	for name, previous := range previousSet.CredentialManagers {
+		cm, ok := set.CredentialManagers[name]
+		if !ok {
+			continue
+		}
+		for _, key := range previous.DisabledKeys() {
+			if cm.KeyIndex(key) >= 0 {
+				cm.Disable(key)
+			}
+		}
+	}
+	SetCurrent(set)
+}
+
+// NewProxySet builds a reverse proxy, and credential manager where configured,
+// for each backend. Backends sharing a prefix are grouped for load balancing.
+func NewProxySet(backends []model.BackendConfig, logger *zap.Logger) *ProxySet {
+	set := &ProxySet{
+		Proxies:            make(map[string]*ProxyGroup),
+		CredentialManagers: make(map[string]*CredentialManager),
+		BackendConfigs:     make(map[string]model.BackendConfig),
+		Breakers:           make(map[string]*CircuitBreaker),
+	}
+
+	var transports []*debugTransport
+	var first *Upstream
 
 	for _, backend := range backends {
-		BackendConfigs[backend.Name] = backend
-		initCredentialManager(backend, logger)
+		if !backend.IsEnabled() {
+			logger.Info("Skipping disabled backend", zap.String("backend", backend.Name))
+			continue
+		}
 
+		// URLs are checked by Config.Validate; skip rather than crash if one slips through
 		urlParsed, err := url.Parse(backend.BaseURL)
 		if err != nil {
-			logger.Fatal("Error parsing URL for backend", zap.String("backend", backend.Name), zap.Error(err))
+			logger.Error("Skipping backend with invalid URL", zap.String("backend", backend.Name), zap.Error(err))
+			continue
+		}
+
+		set.BackendConfigs[backend.Name] = backend
+		cm := newCredentialManager(backend, logger)
+		if cm != nil {
+			set.CredentialManagers[backend.Name] = cm
+		}
+		breaker := newCircuitBreaker(backend.CircuitBreaker)
+		if breaker != nil {
+			set.Breakers[backend.Name] = breaker
 		}
 
 		proxy := httputil.NewSingleHostReverseProxy(urlParsed)
-		proxy.Director = makeDirector(urlParsed, backend, logger)
+		proxy.Director = makeDirector(urlParsed, backend, cm, logger)
+		proxy.ModifyResponse = makeModifyResponse(backend)
 		proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
 			logger.Error("Proxy error",
 				zap.String("backend", backend.Name),
@@ -128,20 +256,68 @@ func InitializeProxies(backends []model.BackendConfig, logger *zap.Logger) {
 			http.Error(rw, fmt.Sprintf("Error communicating with backend service: %v", err), http.StatusBadGateway)
 		}
 
-		proxy.Transport = &debugTransport{
-			transport:   createTransport(),
+		transport := &debugTransport{
+			transport:   createBackendTransport(backend),
 			logger:      logger,
 			backend:     backend.Name,
 			backendConf: backend,
+			cm:          cm,
+			breaker:     breaker,
+		}
+		proxy.Transport = transport
+		transports = append(transports, transport)
+
+		upstream := &Upstream{Backend: backend, Proxy: proxy}
+		if first == nil {
+			first = upstream
 		}
 
-		Proxies[strings.TrimSpace(backend.Prefix)] = proxy
+		// A default backend without a prefix would match every model, so it is
+		// only reachable as the fallback
+		if prefix := strings.TrimSpace(backend.Prefix); prefix != "" {
+			if group, exists := set.Proxies[prefix]; exists {
+				group.Upstreams = append(group.Upstreams, upstream)
+				logger.Info("Load balancing backends sharing a prefix",
+					zap.String("prefix", prefix),
+					zap.Int("backends", len(group.Upstreams)),
+					zap.String("strategy", group.Strategy))
+			} else {
+				set.Proxies[prefix] = NewProxyGroup(backend.LoadBalance, upstream)
+			}
+		}
 
-		if backend.Default {
-			DefaultProxy = proxy
+		if backend.Default && set.DefaultProxy == nil {
+			set.DefaultProxy = proxy
 			logger.Debug("Default proxy set", zap.String("backend", backend.Name))
 		}
 	}
+
+	// Link each backend to its fallback once every group exists
+	for _, transport := range transports {
+		fallbackPrefix := strings.TrimSpace(transport.backendConf.Fallback)
+		if fallbackPrefix == "" {
+			continue
+		}
+		group, ok := set.Proxies[fallbackPrefix]
+		if !ok {
+			logger.Error("Fallback does not match any backend prefix",
+				zap.String("backend", transport.backend),
+				zap.String("fallback", fallbackPrefix))
+			continue
+		}
+		transport.fallback = group
+		logger.Debug("Fallback configured", zap.String("backend", transport.backend), zap.String("fallback", fallbackPrefix))
+	}
+
+	// Without an explicit default, fall back to the first backend rather than
+	// leaving unprefixed models unroutable
+	if set.DefaultProxy == nil && first != nil {
+		set.DefaultProxy = first.Proxy
+		logger.Info("No default backend configured, using the first backend",
+			zap.String("backend", first.Backend.Name))
+	}
+
+	return set
 }
 
 type debugTransport struct {
@@ -149,6 +325,131 @@ type debugTransport struct {
 	logger      *zap.Logger
 	backend     string
 	backendConf model.BackendConfig
+	cm          *CredentialManager // nil when the backend has a single key
+	fallback    *ProxyGroup        // nil when no fallback is configured
+	breaker     *CircuitBreaker    // nil when no circuit breaker is configured
+}
+
+// incomingRequest records the parts of a request that a director rewrites, so
+// the request can be rebuilt for a fallback backend
+type incomingRequest struct {
+	host         string
+	path         string
+	forwardedFor string
+	tried        map[string]bool // backends already attempted, to stop fallback cycles
+}
+
+type incomingRequestKey struct{}
+
+// BackendBody rebuilds the client's request body with a backend's own
+// settings applied
+type BackendBody func(backend model.BackendConfig) ([]byte, error)
+
+type backendBodyKey struct{}
+
+// WithBackendBody returns a context that tells a backend's fallback how to
+// rebuild the request, so it gets the client's request rewritten with its own
+// settings rather than the body rewritten for the backend that failed
+func WithBackendBody(ctx context.Context, body BackendBody) context.Context {
+	return context.WithValue(ctx, backendBodyKey{}, body)
+}
+
+// shouldFallBack reports whether a failed request should be retried on the fallback backend.
+// The response has not been handed to the client yet, so nothing has been streamed.
+func (t *debugTransport) shouldFallBack(req *http.Request, resp *http.Response, err error) bool {
+	if t.fallback == nil || req.Context().Err() != nil {
+		return false
+	}
+	return err != nil || (resp != nil && t.isRetryable(resp.StatusCode))
+}
+
+// isRetryable reports whether an upstream status is worth another attempt,
+// using the backend's retryable_statuses when it sets them
+func (t *debugTransport) isRetryable(statusCode int) bool {
+	if statuses := t.backendConf.RetryableStatuses; len(statuses) > 0 {
+		return slices.Contains(statuses, statusCode)
+	}
+	return retryableStatuses[statusCode]
+}
+
+// fallBack re-dispatches the request to an untried backend in the fallback group,
+// returning the original result if the request can't be rebuilt or every
+// fallback backend was already tried. The body is rebuilt for the fallback
+// backend when the request carries a BackendBody, and the response gets the
+// fallback backend's ModifyResponse instead of this backend's.
+func (t *debugTransport) fallBack(req *http.Request, bodyBytes []byte, resp *http.Response, err error) (*http.Response, error) {
+	incoming, ok := req.Context().Value(incomingRequestKey{}).(*incomingRequest)
+	if !ok {
+		return resp, err
+	}
+
+	incoming.tried[t.backend] = true
+	target := t.fallback.Pick()
+	if incoming.tried[target.Backend.Name] {
+		target = nil
+		for _, upstream := range t.fallback.Upstreams {
+			if !incoming.tried[upstream.Backend.Name] {
+				target = upstream
+				break
+			}
+		}
+	}
+	if target == nil {
+		t.logger.Warn("Fallback backends already tried, not falling back again",
+			zap.String("backend", t.backend),
+			zap.String("fallback", t.backendConf.Fallback))
+		return resp, err
+	}
+	if rebuild, ok := req.Context().Value(backendBodyKey{}).(BackendBody); ok {
+		body, rebuildErr := rebuild(target.Backend)
+		if rebuildErr != nil {
+			t.logger.Error("Failed to rebuild request for fallback backend",
+				zap.String("backend", t.backend),
+				zap.String("fallback", target.Backend.Name),
+				zap.Error(rebuildErr))
+			return resp, err
+		}
+		bodyBytes = body
+	}
+
+	t.logger.Warn("Backend failed, falling back",
+		zap.String("backend", t.backend),
+		zap.String("fallback", target.Backend.Name),
+		zap.Error(err))
+	fallback := events.Event{Type: events.Fallback, Target: target.Backend.Name}
+	if err != nil {
+		fallback.Error = err.Error()
+	} else if resp != nil {
+		fallback.Status = resp.StatusCode
+	}
+	t.publish(req, fallback)
+	closeResponseBody(resp)
+
+	fallbackReq := req.Clone(req.Context())
+	fallbackReq.Host = incoming.host
+	fallbackReq.URL.Path = incoming.path
+	fallbackReq.URL.RawPath = ""
+	if incoming.forwardedFor != "" {
+		fallbackReq.Header.Set("X-Forwarded-For", incoming.forwardedFor)
+	} else {
+		fallbackReq.Header.Del("X-Forwarded-For")
+	}
+	restoreRequestBody(fallbackReq, bodyBytes)
+
+	target.Proxy.Director(fallbackReq)
+	resp, err = target.Proxy.Transport.RoundTrip(fallbackReq)
+	if err != nil || isModifiedResponse(resp) {
+		return resp, err
+	}
+	// The client gets the response headers of the backend that answered
+	if modify := target.Proxy.ModifyResponse; modify != nil {
+		if err := modify(resp); err != nil {
+			closeResponseBody(resp)
+			return nil, err
+		}
+	}
+	markModifiedResponse(resp, fallbackReq)
+	return resp, nil
 }
 
 func formatRequestBody(bodyBytes []byte) string {
@@ -188,7 +489,7 @@ func (t *debugTransport) logOutgoingHeaders(req *http.Request) {
 	}
 }
 
-func isStreamingResponse(resp *http.Response, reqPath, reqBody string) bool {
+func isStreamingResponse(resp *http.Response, reqPath string, reqBody []byte) bool {
 	if resp == nil {
 		return false
 	}
@@ -196,7 +497,7 @@ func isStreamingResponse(resp *http.Response, reqPath, reqBody string) bool {
 	transferEncoding := resp.Header.Get("Transfer-Encoding")
 	return strings.Contains(contentType, eventStreamContentType) ||
 		transferEncoding == chunkedTransferEncoding ||
-		(reqPath == chatCompletionsPath && strings.Contains(reqBody, streamTruePattern))
+		(reqPath == chatCompletionsPath && utils.IsStreamRequest(reqBody))
 }
 
 func shouldRetryWithoutTools(resp *http.Response, respBody string) bool {
@@ -224,7 +525,13 @@ func shouldRetryWithoutTools(resp *http.Response, respBody string) bool {
 	return false
 }
 
-func removeToolsAndUpdatePrompt(bodyBytes []byte, logger *zap.Logger) ([]byte, error) {
+// defaultToolFallbackPrompt is added to the system prompt of a request retried
+// without tools when the backend sets no tool_fallback_prompt
+const defaultToolFallbackPrompt = "Note: This model does not support tool/function calling. Please answer the user's question directly without attempting to use any tools or functions."
+
+// removeToolsAndUpdatePrompt drops a request's tools and adds note to its
+// system prompt, or defaultToolFallbackPrompt when note is empty
+func removeToolsAndUpdatePrompt(bodyBytes []byte, note string, logger *zap.Logger) ([]byte, error) {
 	var chatReq map[string]interface{}
 	if err := json.Unmarshal(bodyBytes, &chatReq); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
@@ -248,31 +555,13 @@ func removeToolsAndUpdatePrompt(bodyBytes []byte, logger *zap.Logger) ([]byte, e
 		return json.Marshal(chatReq)
 	}
 
-	toolNotSupportedMsg := "Note: This model does not support tool/function calling. Please answer the user's question directly without attempting to use any tools or functions."
-
-	// Look for existing system message and append to it
-	foundSystem := false
-	for i, msg := range messages {
-		if msgMap, ok := msg.(map[string]interface{}); ok {
-			if role, ok := msgMap["role"].(string); ok && role == "system" {
-				if content, ok := msgMap["content"].(string); ok {
-					msgMap["content"] = content + "\n\n" + toolNotSupportedMsg
-					messages[i] = msgMap
-					foundSystem = true
-					logger.Info("Appended tool-not-supported message to existing system message")
-					break
-				}
-			}
-		}
+	if note == "" {
+		note = defaultToolFallbackPrompt
 	}
-
-	// If no system message found, prepend one
-	if !foundSystem {
-		systemMsg := map[string]interface{}{
-			"role":    "system",
-			"content": toolNotSupportedMsg,
-		}
-		messages = append([]interface{}{systemMsg}, messages...)
+	messages, appended := addSystemNote(messages, note)
+	if appended {
+		logger.Info("Appended tool-not-supported message to existing system message")
+	} else {
 		logger.Info("Prepended new system message about tool support")
 	}
 
@@ -281,6 +570,26 @@ func removeToolsAndUpdatePrompt(bodyBytes []byte, logger *zap.Logger) ([]byte, e
 	return json.Marshal(chatReq)
 }
 
+// addSystemNote appends note to the first system message, or prepends a new
+// system message when there is none. It reports whether an existing message
+// was extended.
+func addSystemNote(messages []interface{}, note string) ([]interface{}, bool) {
+	for _, msg := range messages {
+		if msgMap, ok := msg.(map[string]interface{}); ok && msgMap["role"] == "system" {
+			if content, ok := msgMap["content"].(string); ok {
+				msgMap["content"] = content + "\n\n" + note
+				return messages, true
+			}
+		}
+	}
+
+	systemMsg := map[string]interface{}{
+		"role":    "system",
+		"content": note,
+	}
+	return append([]interface{}{systemMsg}, messages...), false
+}
+
 func (t *debugTransport) logStreamingResponse(resp *http.Response, respBodyStr string) {
 	t.logger.Debug("Streaming response detected",
 		zap.Int("status", resp.StatusCode),
@@ -294,13 +603,36 @@ func (t *debugTransport) logStreamingResponse(resp *http.Response, respBodyStr s
 	}
 
 	if len(respBodyStr) > 0 {
-		t.logger.Debug("Streaming response preview", zap.String("content", respBodyStr))
+		t.logger.Debug("Streaming response preview", zap.String("content", utils.RedactSecrets(respBodyStr)))
 	}
 }
 
 func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if info := utils.RequestInfoFrom(req.Context()); info != nil {
+		info.Backend = t.backend
+		// Log with the request's ID; the transport itself is shared between requests
+		scoped := *t
+		scoped.logger = t.logger.With(zap.String("request_id", info.RequestID))
+		t = &scoped
+	}
+	if isMultipartRequest(req) {
+		t.publish(req, events.Event{Type: events.BackendSelected, Path: req.URL.Path})
+		return t.roundTripUpload(req)
+	}
+
 	bodyBytes, reqBodyStr := prepareRequestBody(req)
-	req.Header.Del("Accept-Encoding")
+	t.setAcceptEncoding(req)
+	if events.Active() {
+		t.publish(req, events.Event{Type: events.BackendSelected, Path: req.URL.Path, Model: extractModelFromRequest(bodyBytes)})
+	}
+
+	// A fallback backend gets the client's request, not one rewritten for this backend
+	originalBody := bodyBytes
+	emulated := t.emulateTools(req, bodyBytes)
+	if emulated != nil {
+		bodyBytes = emulated.body
+		restoreRequestBody(req, bodyBytes)
+	}
 
 	t.logger.Debug("Outgoing request to backend",
 		zap.String("backend", t.backend),
@@ -310,62 +642,256 @@ func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 
 	t.logOutgoingHeaders(req)
 
-	resp, err := t.executeWithRetry(req, bodyBytes)
+	resp, err := t.send(req, bodyBytes)
+	if err == nil {
+		// A backend that refuses tools gets the request once more without them,
+		// through the same key rotation as the first attempt
+		if toolless := t.withoutRejectedTools(resp, bodyBytes); toolless != nil {
+			bodyBytes, reqBodyStr = toolless, formatRequestBody(toolless)
+			resp, err = t.send(req, bodyBytes)
+		}
+	}
+	if t.shouldFallBack(req, resp, err) {
+		return t.fallBack(req, originalBody, resp, err)
+	}
 	if err != nil {
+		t.publish(req, events.Event{Type: events.Error, Error: err.Error()})
 		return nil, err
 	}
 
-	isStreaming := isStreamingResponse(resp, req.URL.Path, reqBodyStr)
+	isStreaming := isStreamingResponse(resp, req.URL.Path, bodyBytes)
 
 	var respBodyStr string
 	if resp.Body != nil {
-		resp.Body, respBodyStr = utils.DrainAndCapture(resp.Body, isStreaming)
+		resp.Body, respBodyStr = utils.DrainAndCapture(resp.Body, isStreaming, loggedResponseLimit())
+	}
+
+	if isStreaming {
+		t.logStreamingResponse(resp, respBodyStr)
+	} else {
+		utils.LogRequestResponse(t.logger, req, resp, reqBodyStr, respBodyStr)
+	}
+
+	if emulated != nil && !isStreaming {
+		t.emulateToolCalls(resp, emulated.clientStreams)
+	}
+
+	wrapResponseBody(req, resp, isStreaming)
+	return resp, nil
+}
+
+// send makes one request through the key rotation of executeWithRetry, or
+// answers for the backend while its circuit is open
+func (t *debugTransport) send(req *http.Request, bodyBytes []byte) (*http.Response, error) {
+	if t.circuitOpen(req) {
+		return t.circuitOpenResponse(req), nil
+	}
+	resp, err := t.executeWithRetry(req, bodyBytes)
+	t.recordResult(req, resp, err)
+	return resp, err
+}
+
+// withoutRejectedTools returns the request body to resend when the backend
+// refused the request for carrying tools, with the tools removed, and closes
+// resp. It returns nil, leaving resp readable, for any other response.
+func (t *debugTransport) withoutRejectedTools(resp *http.Response, bodyBytes []byte) []byte {
+	if resp.Body == nil || (resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusBadRequest) {
+		return nil
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	if err != nil || !shouldRetryWithoutTools(resp, string(respBody)) {
+		return nil
 	}
 
-	// Check if this is a tool-use error and retry without tools if needed
-	if shouldRetryWithoutTools(resp, respBodyStr) {
-		t.logger.Info("Detected tool-use error, retrying without tools",
+	modified, err := removeToolsAndUpdatePrompt(bodyBytes, t.backendConf.ToolFallbackPrompt, t.logger)
+	if err != nil {
+		t.logger.Error("Failed to modify request for tool-less retry",
 			zap.String("backend", t.backend),
-			zap.Int("statusCode", resp.StatusCode))
+			zap.Error(err))
+		return nil
+	}
+	if bytes.Equal(modified, bodyBytes) {
+		// The request had no tools, so the error isn't about them
+		return nil
+	}
 
-		// Close the error response
-		closeResponseBody(resp)
+	t.logger.Info("Detected tool-use error, retrying without tools",
+		zap.String("backend", t.backend),
+		zap.Int("statusCode", resp.StatusCode))
+	resp.Body.Close()
+	return modified
+}
 
-		// Modify request to remove tools and update system prompt
-		modifiedBodyBytes, err := removeToolsAndUpdatePrompt(bodyBytes, t.logger)
-		if err != nil {
-			t.logger.Error("Failed to modify request for tool-less retry",
-				zap.String("backend", t.backend),
-				zap.Error(err))
-			// Return the original error response
-			resp.Body = io.NopCloser(bytes.NewBuffer([]byte(respBodyStr)))
-			return resp, nil
-		}
+// isMultipartRequest reports whether req carries a multipart upload, which is
+// streamed through rather than buffered
+func isMultipartRequest(req *http.Request) bool {
+	return strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/")
+}
 
-		// Restore request body with modified content
-		restoreRequestBody(req, modifiedBodyBytes)
+// roundTripUpload sends a streamed upload in a single attempt. The body is
+// consumed as it is sent, so it can't be replayed with another key or on a
+// fallback backend.
+func (t *debugTransport) roundTripUpload(req *http.Request) (*http.Response, error) {
+	t.setAcceptEncoding(req)
 
-		// Retry the request
-		resp, err = t.transport.RoundTrip(req)
-		if err != nil {
-			return nil, err
-		}
+	t.logger.Debug("Outgoing upload to backend",
+		zap.String("backend", t.backend),
+		zap.String("method", req.Method),
+		zap.String("url", req.URL.String()))
 
-		// Capture the new response
-		if resp.Body != nil {
-			resp.Body, respBodyStr = utils.DrainAndCapture(resp.Body, isStreaming)
-		}
+	t.logOutgoingHeaders(req)
+
+	if t.circuitOpen(req) {
+		return t.circuitOpenResponse(req), nil
+	}
+
+	resp, err := t.transport.RoundTrip(req)
+	decodeResponseBody(resp)
+	t.recordResult(req, resp, err)
+	if err != nil {
+		return nil, err
+	}
+
+	isStreaming := isStreamingResponse(resp, req.URL.Path, nil)
+	var respBodyStr string
+	if resp.Body != nil {
+		resp.Body, respBodyStr = utils.DrainAndCapture(resp.Body, isStreaming, loggedResponseLimit())
 	}
 
 	if isStreaming {
 		t.logStreamingResponse(resp, respBodyStr)
 	} else {
-		utils.LogRequestResponse(t.logger, req, resp, reqBodyStr, respBodyStr)
+		utils.LogRequestResponse(t.logger, req, resp, "[multipart upload]", respBodyStr)
 	}
 
+	wrapResponseBody(req, resp, isStreaming)
 	return resp, nil
 }
 
+// publish sends a routing event for req from this backend
+func (t *debugTransport) publish(req *http.Request, event events.Event) {
+	if !events.Active() {
+		return
+	}
+	event.Backend = t.backend
+	if info := utils.RequestInfoFrom(req.Context()); info != nil {
+		event.RequestID = info.RequestID
+	}
+	events.Publish(event)
+}
+
+// keyIndex returns the position of key in the backend's list for an event
+func keyIndex(cm *CredentialManager, key string) *int {
+	index := cm.KeyIndex(key)
+	if index < 0 {
+		return nil
+	}
+	return &index
+}
+
+// circuitOpen reports whether the backend's circuit breaker is refusing requests
+func (t *debugTransport) circuitOpen(req *http.Request) bool {
+	if t.breaker == nil || t.breaker.Allow() {
+		return false
+	}
+	t.logger.Warn("Circuit open, not sending request to backend", zap.String("backend", t.backend))
+	t.publish(req, events.Event{Type: events.CircuitOpen})
+	return true
+}
+
+// recordResult feeds the outcome of a request to the circuit breaker.
+// Transport errors and 5xx responses count as failures; requests the client
+// gave up on say nothing about the backend.
+func (t *debugTransport) recordResult(req *http.Request, resp *http.Response, err error) {
+	if t.breaker == nil {
+		return
+	}
+	switch {
+	case req.Context().Err() != nil:
+		t.breaker.RecordCanceled()
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+		t.breaker.RecordFailure()
+		if t.breaker.State() == CircuitOpen {
+			t.logger.Warn("Circuit open for backend", zap.String("backend", t.backend))
+		}
+	default:
+		t.breaker.RecordSuccess()
+	}
+}
+
+// circuitOpenResponse is returned in place of the backend's response while
+// its circuit is open. It is a 503 so a configured fallback still takes over.
+func (t *debugTransport) circuitOpenResponse(req *http.Request) *http.Response {
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]string{
+			"message": fmt.Sprintf("Backend %s is temporarily unavailable", t.backend),
+			"type":    "circuit_open",
+		},
+	})
+
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	retryAfter := int(math.Ceil(t.breaker.RetryAfter().Seconds()))
+	header.Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+
+	return &http.Response{
+		Status:        "503 Service Unavailable",
+		StatusCode:    http.StatusServiceUnavailable,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// wrapResponseBody ends the body cleanly at the request's deadline and, for
+// streamed responses, watches the upstream for silence: event streams get
+// keepalive comments, and a stream that stalls is aborted
+func wrapResponseBody(req *http.Request, resp *http.Response, isStreaming bool) {
+	if resp.Body == nil {
+		return
+	}
+	resp.Body = &deadlineBody{ReadCloser: resp.Body, ctx: req.Context()}
+	if !isStreaming {
+		return
+	}
+
+	sse := strings.Contains(resp.Header.Get("Content-Type"), eventStreamContentType)
+	heartbeat := time.Duration(streamHeartbeat.Load())
+	idleTimeout := time.Duration(streamIdleTimeout.Load())
+	if (sse && heartbeat > 0) || idleTimeout > 0 {
+		resp.Body = newStreamBody(resp.Body, sse, heartbeat, idleTimeout)
+	}
+}
+
+// deadlineBody ends the response cleanly when the request's deadline passes,
+// so a client that set X-Request-Timeout gets a truncated but well-formed
+// stream instead of an aborted connection. Other errors pass through.
+type deadlineBody struct {
+	io.ReadCloser
+	ctx context.Context
+}
+
+func (b *deadlineBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && errors.Is(b.ctx.Err(), context.DeadlineExceeded) {
+		return n, io.EOF
+	}
+	return n, err
+}
+
+func loggedResponseLimit() int {
+	if size := maxLoggedResponseSize.Load(); size > 0 {
+		return int(size)
+	}
+	return model.DefaultMaxLoggedResponseSize
+}
+
 func extractCurrentKey(req *http.Request) string {
 	authHeader := req.Header.Get("Authorization")
 	if strings.HasPrefix(authHeader, "Bearer ") {
@@ -398,40 +924,83 @@ func extractModelFromRequest(bodyBytes []byte) string {
 	return body.Model
 }
 
-func (t *debugTransport) handleRetryableResponse(resp *http.Response, currentKey, model string, cm *CredentialManager, maxAttempts, attempt int) (*http.Response, bool) {
-	if !retryableStatuses[resp.StatusCode] {
-		return resp, false
-	}
+// retryAction is what executeWithRetry does after a failed attempt
+type retryAction int
 
-	t.logger.Warn("Received retryable error status from backend",
-		zap.String("backend", t.backend),
-		zap.Int("statusCode", resp.StatusCode),
-		zap.Int("attempt", attempt+1),
-		zap.Int("maxAttempts", maxAttempts),
-		zap.String("model", model))
+const (
+	retryNone    retryAction = iota // pass the response on
+	retrySameKey                    // transient failure, so the key isn't to blame
+	retryNextKey                    // the upstream refused the key
+)
 
-	if currentKey != "" {
-		cm.MarkKeyFailed(currentKey, model)
-		t.logger.Info("Marked API key as failed due to error response",
-			zap.String("backend", t.backend),
-			zap.Int("statusCode", resp.StatusCode),
-			zap.String("key", utils.RedactAuthorization("Bearer "+currentKey)),
-			zap.String("model", model))
+// classifyAttempt applies the key failure policy. Only statuses that mean the
+// key itself was refused (keyFailureStatuses) count against the key. Transport
+// errors and other retryable statuses are treated as transient and retried
+// with the same key before moving on. Anything else, including client errors
+// such as 400, is passed on without a retry. A backend's retryable_statuses
+// replaces the defaults, key failures included: statuses it leaves out are
+// passed on without rotating the key.
+func (t *debugTransport) classifyAttempt(resp *http.Response, err error) retryAction {
+	switch {
+	case err != nil:
+		return retrySameKey
+	case len(t.backendConf.RetryableStatuses) > 0 && !t.isRetryable(resp.StatusCode):
+		return retryNone
+	case keyFailureStatuses[resp.StatusCode]:
+		return retryNextKey
+	case t.isRetryable(resp.StatusCode):
+		return retrySameKey
+	default:
+		return retryNone
 	}
-
-	closeResponseBody(resp)
-	return resp, true
 }
 
-func (t *debugTransport) handleTransportError(err error, currentKey, model string, cm *CredentialManager) {
-	if currentKey != "" {
-		cm.MarkKeyFailed(currentKey, model)
-		t.logger.Warn("Marked API key as failed due to transport error",
+// markKeyFailed takes the key out of rotation. A rate-limited key is only
+// benched briefly for the model. A key the upstream rejects as unauthorized is
+// disabled for every model for authFailureTimeout, while a forbidden key is
+// disabled for the model only, as a 403 is often about the model ("no access
+// to model X") rather than the key. The backend's last available key is never
+// disabled for every model, so one rejection can't take the backend out of
+// service; it sits out the model for the usual timeout instead.
+func (t *debugTransport) markKeyFailed(cm *CredentialManager, currentKey, model string, statusCode int) {
+	if currentKey == "" {
+		return
+	}
+	redactedKey := utils.RedactAuthorization("Bearer " + currentKey)
+
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+		scope, timeout := "", authFailureTimeout
+		if statusCode == http.StatusForbidden {
+			scope = model
+		}
+		if scope == "" && cm.GetAvailableKeyCount() <= 1 {
+			if model == "" {
+				t.logger.Error("API key rejected by backend; kept in rotation as the backend's last available key",
+					zap.String("backend", t.backend),
+					zap.Int("statusCode", statusCode),
+					zap.String("key", redactedKey),
+					zap.Int("keyIndex", cm.KeyIndex(currentKey)))
+				return
+			}
+			scope, timeout = model, cm.timeoutDur
+		}
+		cm.MarkKeyFailedFor(currentKey, scope, timeout)
+		t.logger.Error("API key rejected by backend and disabled; replace it in the config",
 			zap.String("backend", t.backend),
-			zap.Error(err),
-			zap.String("key", utils.RedactAuthorization("Bearer "+currentKey)),
-			zap.String("model", model))
+			zap.Int("statusCode", statusCode),
+			zap.String("key", redactedKey),
+			zap.Int("keyIndex", cm.KeyIndex(currentKey)),
+			zap.String("model", scope),
+			zap.Duration("disabledFor", timeout))
+		return
 	}
+
+	cm.MarkKeyFailed(currentKey, model)
+	t.logger.Info("Marked API key as failed due to error response",
+		zap.String("backend", t.backend),
+		zap.Int("statusCode", statusCode),
+		zap.String("key", redactedKey),
+		zap.String("model", model))
 }
 
 func (t *debugTransport) getNextKeyForRetry(cm *CredentialManager, req *http.Request, attempt int, model string) bool {
@@ -453,44 +1022,97 @@ func (t *debugTransport) getNextKeyForRetry(cm *CredentialManager, req *http.Req
 	return true
 }
 
-func (t *debugTransport) executeWithRetry(req *http.Request, bodyBytes []byte) (*http.Response, error) {
-	cm, hasCredentialManager := CredentialManagers[t.backend]
+// executeWithRetry sends the request, retrying on failures as decided by
+// classifyAttempt: a transient failure is retried once with the same key
+// before the next key is tried, and a refused key is marked failed and
+// rotated out. The exchange is traced as one span with a child span per attempt.
+func (t *debugTransport) executeWithRetry(req *http.Request, bodyBytes []byte) (resp *http.Response, err error) {
+	ctx, span := tracing.Tracer().Start(req.Context(), "proxy "+t.backend,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("backend", t.backend)))
+	attempts := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("retries", max(attempts-1, 0)))
+		if resp != nil {
+			tracing.RecordResponse(span, resp.StatusCode, err)
+		} else {
+			tracing.RecordResponse(span, 0, err)
+		}
+		span.End()
+	}()
 
-	if !hasCredentialManager {
-		return t.transport.RoundTrip(req)
+	cm := t.cm
+	if cm == nil {
+		attempts++
+		return t.roundTripAttempt(ctx, req, -1, 0)
 	}
 
-	maxAttempts := cm.GetKeyCount()
-	if maxAttempts > maxRetryAttempts {
-		maxAttempts = maxRetryAttempts
-	}
+	// One attempt per key plus one for retrying a transient failure with the same key
+	maxAttempts := min(cm.GetKeyCount()+1, maxRetryAttempts)
 
 	modelName := extractModelFromRequest(bodyBytes)
 
 	var lastErr error
 	var lastResp *http.Response
+	retriedSameKey := false
 
 	for attempt := 0; attempt < maxAttempts; attempt++ {
 		restoreRequestBody(req, bodyBytes)
 		currentKey := extractCurrentKey(req)
 
-		resp, err := t.transport.RoundTrip(req)
+		attempts++
+		resp, err := t.roundTripAttempt(ctx, req, cm.KeyIndex(currentKey), attempt)
 
-		if err == nil && resp != nil {
-			var shouldRetry bool
-			lastResp, shouldRetry = t.handleRetryableResponse(resp, currentKey, modelName, cm, maxAttempts, attempt)
-			if !shouldRetry {
-				return resp, nil
-			}
+		action := t.classifyAttempt(resp, err)
+		if action == retryNone {
+			return resp, nil
+		}
+
+		if err != nil {
+			lastResp, lastErr = nil, err
+			t.logger.Warn("Transport error from backend",
+				zap.String("backend", t.backend),
+				zap.Error(err),
+				zap.Int("attempt", attempt+1),
+				zap.Int("maxAttempts", maxAttempts),
+				zap.String("model", modelName))
 		} else {
-			lastErr = err
-			t.handleTransportError(err, currentKey, modelName, cm)
+			lastResp, lastErr = resp, nil
+			t.logger.Warn("Received retryable error status from backend",
+				zap.String("backend", t.backend),
+				zap.Int("statusCode", resp.StatusCode),
+				zap.Int("attempt", attempt+1),
+				zap.Int("maxAttempts", maxAttempts),
+				zap.String("model", modelName))
+			closeResponseBody(resp)
 		}
 
-		if attempt < maxAttempts-1 {
-			if !t.getNextKeyForRetry(cm, req, attempt, modelName) {
-				break
-			}
+		if action == retryNextKey {
+			t.markKeyFailed(cm, currentKey, modelName, resp.StatusCode)
+			t.publish(req, events.Event{Type: events.KeyFailed, Model: modelName, Status: resp.StatusCode, KeyIndex: keyIndex(cm, currentKey)})
+		}
+
+		if attempt == maxAttempts-1 {
+			break
+		}
+		retry := events.Event{Type: events.Retry, Model: modelName, Attempt: attempt + 2}
+		if err != nil {
+			retry.Error = err.Error()
+		} else {
+			retry.Status = resp.StatusCode
+		}
+		t.publish(req, retry)
+		if action == retrySameKey && !retriedSameKey {
+			retriedSameKey = true
+			t.logger.Info("Retrying request with the same API key",
+				zap.String("backend", t.backend),
+				zap.Int("attempt", attempt+2),
+				zap.String("model", modelName))
+			continue
+		}
+		retriedSameKey = false
+		if !t.getNextKeyForRetry(cm, req, attempt, modelName) {
+			break
 		}
 	}
 
@@ -511,12 +1133,28 @@ func (t *debugTransport) executeWithRetry(req *http.Request, bodyBytes []byte) (
 	return nil, fmt.Errorf("all retry attempts exhausted for backend %s", t.backend)
 }
 
-func extractClientIP(remoteAddr string) string {
-	clientIP := remoteAddr
-	if idx := strings.LastIndex(clientIP, ":"); idx != -1 {
-		clientIP = clientIP[:idx]
+// roundTripAttempt sends one attempt under its own span. keyIndex is the
+// position of the API key used in the backend's key list, or -1 without one.
+func (t *debugTransport) roundTripAttempt(ctx context.Context, req *http.Request, keyIndex, attempt int) (*http.Response, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "attempt "+t.backend,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("backend", t.backend),
+			attribute.Int("attempt", attempt+1)))
+	defer span.End()
+	if keyIndex >= 0 {
+		span.SetAttributes(attribute.Int("key_index", keyIndex))
 	}
-	return strings.Trim(clientIP, "[]")
+
+	tracing.Inject(ctx, req.Header)
+	resp, err := t.transport.RoundTrip(req)
+	decodeResponseBody(resp)
+	if resp != nil {
+		tracing.RecordResponse(span, resp.StatusCode, err)
+	} else {
+		tracing.RecordResponse(span, 0, err)
+	}
+	return resp, err
 }
 
 func joinPaths(basePath, requestPath string) string {
@@ -531,13 +1169,16 @@ func joinPaths(basePath, requestPath string) string {
 	return cleanBase + "/" + cleanReq
 }
 
-func setProxyHeaders(req *http.Request, targetHost, originalHost, clientIP string) {
+func setProxyHeaders(req *http.Request, targetHost, originalHost, clientIP, requestID string) {
 	standardHeaders := map[string]string{
 		"Host":              targetHost,
 		"X-Real-IP":         clientIP,
 		"X-Forwarded-Proto": "https",
 		"X-Forwarded-Host":  originalHost,
 	}
+	if requestID != "" {
+		standardHeaders[utils.RequestIDHeader] = requestID
+	}
 
 	for name, value := range standardHeaders {
 		req.Header.Set(name, value)
@@ -548,11 +1189,14 @@ func setProxyHeaders(req *http.Request, targetHost, originalHost, clientIP strin
 	} else {
 		req.Header.Set("X-Forwarded-For", clientIP)
 	}
+
+	// Replace the client's traceparent with the router's span so the backend
+	// continues the trace beneath it
+	tracing.Inject(req.Context(), req.Header)
 }
 
-func getAPIKeyFromCredentialManager(backend model.BackendConfig, logger *zap.Logger, modelName string) string {
-	cm, exists := CredentialManagers[backend.Name]
-	if !exists {
+func getAPIKeyFromCredentialManager(backend model.BackendConfig, cm *CredentialManager, logger *zap.Logger, modelName string) string {
+	if cm == nil {
 		return ""
 	}
 
@@ -590,8 +1234,8 @@ func getSingleAPIKey(backend model.BackendConfig, logger *zap.Logger) string {
 	return ""
 }
 
-func setAuthorizationHeader(req *http.Request, backend model.BackendConfig, logger *zap.Logger, modelName string) {
-	apiKey := getAPIKeyFromCredentialManager(backend, logger, modelName)
+func setAuthorizationHeader(req *http.Request, backend model.BackendConfig, cm *CredentialManager, logger *zap.Logger, modelName string) {
+	apiKey := getAPIKeyFromCredentialManager(backend, cm, logger, modelName)
 	if apiKey == "" {
 		apiKey = getSingleAPIKey(backend, logger)
 	}
@@ -617,13 +1261,26 @@ func setAuthorizationHeader(req *http.Request, backend model.BackendConfig, logg
 	}
 }
 
-func makeDirector(urlParsed *url.URL, backend model.BackendConfig, logger *zap.Logger) func(req *http.Request) {
+func makeDirector(urlParsed *url.URL, backend model.BackendConfig, cm *CredentialManager, logger *zap.Logger) func(req *http.Request) {
 	return func(req *http.Request) {
+		logger := logger
+		if requestID := utils.RequestIDFrom(req.Context()); requestID != "" {
+			logger = logger.With(zap.String("request_id", requestID))
+		}
 		originalHost := req.Host
 		originalPath := req.URL.Path
 
+		if _, ok := req.Context().Value(incomingRequestKey{}).(*incomingRequest); !ok {
+			*req = *req.WithContext(context.WithValue(req.Context(), incomingRequestKey{}, &incomingRequest{
+				host:         originalHost,
+				path:         originalPath,
+				forwardedFor: req.Header.Get("X-Forwarded-For"),
+				tried:        make(map[string]bool),
+			}))
+		}
+
 		var bodyBytes []byte
-		if req.Body != nil && req.Method != "GET" {
+		if req.Body != nil && req.Method != "GET" && !isMultipartRequest(req) {
 			bodyBytes, _ = io.ReadAll(req.Body)
 			req.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 		}
@@ -639,13 +1296,13 @@ func makeDirector(urlParsed *url.URL, backend model.BackendConfig, logger *zap.L
 			zap.String("originalPath", originalPath),
 			zap.String("newPath", req.URL.Path))
 
-		clientIP := extractClientIP(req.RemoteAddr)
-		setProxyHeaders(req, urlParsed.Host, originalHost, clientIP)
+		clientIP := utils.ExtractClientIP(req.RemoteAddr)
+		setProxyHeaders(req, urlParsed.Host, originalHost, clientIP, utils.RequestIDFrom(req.Context()))
 
 		modelName := extractModelFromRequest(bodyBytes)
 
 		if backend.RequireAPIKey {
-			setAuthorizationHeader(req, backend, logger, modelName)
+			setAuthorizationHeader(req, backend, cm, logger, modelName)
 		} else {
 			req.Header.Del("Authorization")
 			logger.Info("Removed Authorization header for backend", zap.String("backend", backend.Name))
@@ -1,12 +1,26 @@
 package proxy
 
 import (
+	"context"
+	"encoding/json"
+	"io"
+	"llm-router/internal/events"
 	"llm-router/internal/model"
+	"llm-router/internal/utils"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestJoinPaths(t *testing.T) {
@@ -31,26 +45,6 @@ func TestJoinPaths(t *testing.T) {
 	}
 }
 
-func TestExtractClientIP(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected string
-	}{
-		{"1.2.3.4:1234", "1.2.3.4"},
-		{"[2001:db8::1]:1234", "2001:db8::1"},
-		{"127.0.0.1", "127.0.0.1"},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
-			result := extractClientIP(tt.input)
-			if result != tt.expected {
-				t.Errorf("extractClientIP(%s) = %s, want %s", tt.input, result, tt.expected)
-			}
-		})
-	}
-}
-
 func TestResolveAPIKeys(t *testing.T) {
 	os.Setenv("TEST_KEY_ENV", "env-value")
 	defer os.Unsetenv("TEST_KEY_ENV")
@@ -93,3 +87,612 @@ func TestShouldRetryWithoutTools(t *testing.T) {
 		}
 	}
 }
+
+func TestNewProxySetDefault(t *testing.T) {
+	logger := zap.NewNop()
+
+	t.Run("FirstBackendWhenNoneMarked", func(t *testing.T) {
+		set := NewProxySet([]model.BackendConfig{
+			{Name: "a", BaseURL: "http://a", Prefix: "a/"},
+			{Name: "b", BaseURL: "http://b", Prefix: "b/"},
+		}, logger)
+
+		if set.DefaultProxy == nil || set.DefaultProxy != set.Proxies["a/"].Pick().Proxy {
+			t.Errorf("expected the first backend to be the default")
+		}
+	})
+
+	t.Run("UnprefixedDefaultOnlyAsFallback", func(t *testing.T) {
+		set := NewProxySet([]model.BackendConfig{
+			{Name: "a", BaseURL: "http://a", Prefix: "a/"},
+			{Name: "b", BaseURL: "http://b", Default: true},
+		}, logger)
+
+		if _, exists := set.Proxies[""]; exists {
+			t.Errorf("expected an unprefixed default not to be routed by prefix")
+		}
+		if set.DefaultProxy == nil || set.DefaultProxy == set.Proxies["a/"].Pick().Proxy {
+			t.Errorf("expected the marked backend to be the default")
+		}
+	})
+
+	t.Run("DisabledBackendSkipped", func(t *testing.T) {
+		disabled := false
+		set := NewProxySet([]model.BackendConfig{
+			{Name: "a", BaseURL: "http://a", Prefix: "a/", Default: true, Enabled: &disabled},
+			{Name: "b", BaseURL: "http://b", Prefix: "b/"},
+		}, logger)
+
+		if _, exists := set.Proxies["a/"]; exists {
+			t.Errorf("expected a disabled backend's prefix to be unrouted")
+		}
+		if _, exists := set.BackendConfigs["a"]; exists {
+			t.Errorf("expected a disabled backend to be left out of the set")
+		}
+		if set.DefaultProxy == nil || set.DefaultProxy != set.Proxies["b/"].Pick().Proxy {
+			t.Errorf("expected the first enabled backend to be the default")
+		}
+	})
+}
+
+func TestFallback(t *testing.T) {
+	logger := zap.NewNop()
+
+	var primaryHits, secondaryHits int
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryHits++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	secondaryStatus := http.StatusOK
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondaryHits++
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("expected fallback path /v1/chat/completions, got %s", r.URL.Path)
+		}
+		w.WriteHeader(secondaryStatus)
+		io.WriteString(w, "from secondary")
+	}))
+	defer secondary.Close()
+
+	send := func(set *ProxySet) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`))
+		rr := httptest.NewRecorder()
+		set.Proxies["a/"].Pick().Proxy.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("UsesFallbackOnFailure", func(t *testing.T) {
+		primaryHits, secondaryHits = 0, 0
+		set := NewProxySet([]model.BackendConfig{
+			{Name: "a", BaseURL: primary.URL + "/v1", Prefix: "a/", Fallback: "b/"},
+			{Name: "b", BaseURL: secondary.URL + "/v1", Prefix: "b/"},
+		}, logger)
+
+		rr := send(set)
+		if rr.Code != http.StatusOK || rr.Body.String() != "from secondary" {
+			t.Errorf("expected fallback response, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if primaryHits != 1 || secondaryHits != 1 {
+			t.Errorf("expected one request to each backend, got %d and %d", primaryHits, secondaryHits)
+		}
+	})
+
+	t.Run("StopsOnCycle", func(t *testing.T) {
+		primaryHits, secondaryHits = 0, 0
+		secondaryStatus = http.StatusBadGateway
+		set := NewProxySet([]model.BackendConfig{
+			{Name: "a", BaseURL: primary.URL + "/v1", Prefix: "a/", Fallback: "b/"},
+			{Name: "b", BaseURL: secondary.URL + "/v1", Prefix: "b/", Fallback: "a/"},
+		}, logger)
+
+		rr := send(set)
+		if rr.Code != http.StatusBadGateway {
+			t.Errorf("expected the last backend's error, got %d", rr.Code)
+		}
+		if primaryHits != 1 || secondaryHits != 1 {
+			t.Errorf("expected one request to each backend, got %d and %d", primaryHits, secondaryHits)
+		}
+	})
+}
+
+func TestRetryTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	var traceparents []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents = append(traceparents, r.Header.Get("Traceparent"))
+		if r.Header.Get("Authorization") == "Bearer first" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	set := NewProxySet([]model.BackendConfig{
+		{Name: "a", BaseURL: upstream.URL, Prefix: "a/", RequireAPIKey: true, APIKeys: []string{"first", "second"}},
+	}, zap.NewNop())
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	req := httptest.NewRequest("POST", "/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`)).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	set.Proxies["a/"].Pick().Proxy.ServeHTTP(rr, req)
+	parent.End()
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the retry to succeed, got %d", rr.Code)
+	}
+
+	spans := make(map[string][]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+	proxySpans, attemptSpans := spans["proxy a"], spans["attempt a"]
+	if len(proxySpans) != 1 || len(attemptSpans) != 2 {
+		t.Fatalf("expected one proxy span and two attempt spans, got %d and %d", len(proxySpans), len(attemptSpans))
+	}
+
+	attrs := func(span sdktrace.ReadOnlySpan) map[string]int64 {
+		m := make(map[string]int64)
+		for _, kv := range span.Attributes() {
+			m[string(kv.Key)] = kv.Value.AsInt64()
+		}
+		return m
+	}
+	if a := attrs(proxySpans[0]); a["retries"] != 1 || a["http.response.status_code"] != http.StatusOK {
+		t.Errorf("unexpected proxy span attributes: %v", a)
+	}
+	if proxySpans[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("expected the proxy span to be a child of the request span")
+	}
+	for i, span := range attemptSpans {
+		a := attrs(span)
+		if a["key_index"] != int64(i) || a["attempt"] != int64(i+1) {
+			t.Errorf("attempt %d: unexpected attributes %v", i+1, a)
+		}
+		if span.Parent().SpanID() != proxySpans[0].SpanContext().SpanID() {
+			t.Errorf("attempt %d: expected the proxy span as parent", i+1)
+		}
+		if !strings.Contains(traceparents[i], span.SpanContext().SpanID().String()) {
+			t.Errorf("attempt %d: expected traceparent %q to carry the attempt span", i+1, traceparents[i])
+		}
+	}
+	if attemptSpans[0].Status().Code != codes.Unset || attrs(attemptSpans[0])["http.response.status_code"] != http.StatusTooManyRequests {
+		t.Errorf("unexpected first attempt: %v %v", attemptSpans[0].Status(), attrs(attemptSpans[0]))
+	}
+}
+
+func TestRetryableStatuses(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryable  []int
+		status     int
+		wantStatus int
+	}{
+		{"Default Retries 500", nil, http.StatusInternalServerError, http.StatusOK},
+		{"Default Does Not Retry 409", nil, http.StatusConflict, http.StatusConflict},
+		{"Backend Retries 409", []int{http.StatusConflict}, http.StatusConflict, http.StatusOK},
+		{"Backend Does Not Retry 500", []int{http.StatusConflict}, http.StatusInternalServerError, http.StatusInternalServerError},
+		{"Backend Does Not Rotate On 429", []int{http.StatusConflict}, http.StatusTooManyRequests, http.StatusTooManyRequests},
+		{"Backend Rotates On Listed 401", []int{http.StatusUnauthorized}, http.StatusUnauthorized, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") == "Bearer first" {
+					w.WriteHeader(tt.status)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer upstream.Close()
+
+			set := NewProxySet([]model.BackendConfig{{
+				Name: "a", BaseURL: upstream.URL, Prefix: "a/", RequireAPIKey: true,
+				APIKeys: []string{"first", "second"}, RetryableStatuses: tt.retryable,
+			}}, zap.NewNop())
+
+			req := httptest.NewRequest("POST", "/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`))
+			rr := httptest.NewRecorder()
+			set.Proxies["a/"].Pick().Proxy.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected %d, got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestKeyFailurePolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int // returned for the first key; 0 aborts the connection
+		wantKeys      []string
+		wantStatus    int
+		wantKeyFailed bool
+	}{
+		{"Client Error", http.StatusBadRequest, []string{"first"}, http.StatusBadRequest, false},
+		{"Unauthorized", http.StatusUnauthorized, []string{"first", "second"}, http.StatusOK, true},
+		{"Forbidden", http.StatusForbidden, []string{"first", "second"}, http.StatusOK, true},
+		{"Rate Limited", http.StatusTooManyRequests, []string{"first", "second"}, http.StatusOK, true},
+		{"Server Error", http.StatusServiceUnavailable, []string{"first", "first", "second"}, http.StatusOK, false},
+		{"Transport Error", 0, []string{"first", "first", "second"}, http.StatusOK, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var keys []string
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+				keys = append(keys, key)
+				if key != "first" {
+					w.WriteHeader(http.StatusOK)
+					return
+				}
+				if tt.status == 0 {
+					panic(http.ErrAbortHandler)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer upstream.Close()
+
+			set := NewProxySet([]model.BackendConfig{
+				{Name: "a", BaseURL: upstream.URL, Prefix: "a/", RequireAPIKey: true, APIKeys: []string{"first", "second"}},
+			}, zap.NewNop())
+
+			req := httptest.NewRequest("POST", "/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`))
+			rr := httptest.NewRecorder()
+			set.Proxies["a/"].Pick().Proxy.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected %d, got %d", tt.wantStatus, rr.Code)
+			}
+			if strings.Join(keys, ",") != strings.Join(tt.wantKeys, ",") {
+				t.Errorf("expected keys %v to be tried, got %v", tt.wantKeys, keys)
+			}
+			if failed := !set.CredentialManagers["a"].IsKeyAvailable("first", "gpt-4o"); failed != tt.wantKeyFailed {
+				t.Errorf("expected key failed to be %v, got %v", tt.wantKeyFailed, failed)
+			}
+		})
+	}
+}
+
+func TestBackendTransportPool(t *testing.T) {
+	transport := createBackendTransport(model.BackendConfig{Name: "a", MaxConnsPerHost: 500, MaxIdleConnsPerHost: 50})
+	if transport.MaxConnsPerHost != 500 || transport.MaxIdleConnsPerHost != 50 || transport.MaxIdleConns != model.DefaultMaxIdleConns {
+		t.Errorf("unexpected pool limits: conns %d, idle per host %d, idle %d",
+			transport.MaxConnsPerHost, transport.MaxIdleConnsPerHost, transport.MaxIdleConns)
+	}
+}
+
+func TestHTTP2Upstream(t *testing.T) {
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Proto", r.Proto)
+		w.WriteHeader(http.StatusOK)
+	}))
+	upstream.Config.Protocols = new(http.Protocols)
+	upstream.Config.Protocols.SetHTTP1(true)
+	upstream.Config.Protocols.SetUnencryptedHTTP2(true)
+	upstream.Start()
+	defer upstream.Close()
+
+	tests := []struct {
+		name      string
+		http2     bool
+		wantProto string
+	}{
+		{"Default", false, "HTTP/1.1"},
+		{"H2C", true, "HTTP/2.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := NewProxySet([]model.BackendConfig{
+				{Name: "a", BaseURL: upstream.URL, Prefix: "a/", HTTP2: tt.http2},
+			}, zap.NewNop())
+
+			req := httptest.NewRequest("POST", "/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`))
+			rr := httptest.NewRecorder()
+			set.Proxies["a/"].Pick().Proxy.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", rr.Code)
+			}
+			if proto := rr.Header().Get("X-Proto"); proto != tt.wantProto {
+				t.Errorf("expected the backend to be reached over %s, got %s", tt.wantProto, proto)
+			}
+		})
+	}
+}
+
+func TestRoutingEvents(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer first" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	set := NewProxySet([]model.BackendConfig{
+		{Name: "a", BaseURL: upstream.URL, Prefix: "a/", RequireAPIKey: true, APIKeys: []string{"first", "second"}},
+	}, zap.NewNop())
+
+	stream, unsubscribe := events.Default().Subscribe()
+	defer unsubscribe()
+
+	ctx, _ := utils.WithRequestInfo(context.Background(), "req-1")
+	req := httptest.NewRequest("POST", "/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`)).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	set.Proxies["a/"].Pick().Proxy.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the retry to succeed, got %d", rr.Code)
+	}
+
+	var got []events.Event
+	for len(stream) > 0 {
+		got = append(got, <-stream)
+	}
+	var types []string
+	for _, event := range got {
+		types = append(types, event.Type)
+		if event.Backend != "a" || event.RequestID != "req-1" {
+			t.Errorf("unexpected %s event: %+v", event.Type, event)
+		}
+	}
+	want := []string{events.BackendSelected, events.KeyFailed, events.Retry}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected events %v, got %v", want, types)
+	}
+	if got[0].Model != "gpt-4o" {
+		t.Errorf("expected the selected model, got %q", got[0].Model)
+	}
+	if got[1].KeyIndex == nil || *got[1].KeyIndex != 0 || got[1].Status != http.StatusTooManyRequests {
+		t.Errorf("unexpected key failure: %+v", got[1])
+	}
+	if got[2].Attempt != 2 {
+		t.Errorf("expected the retry to be attempt 2, got %d", got[2].Attempt)
+	}
+}
+
+func TestToolFallbackPrompt(t *testing.T) {
+	systemContent := func(t *testing.T, body []byte) []interface{} {
+		t.Helper()
+		var req map[string]interface{}
+		json.Unmarshal(body, &req)
+		if _, exists := req["tools"]; exists {
+			t.Error("expected tools to be removed")
+		}
+		return req["messages"].([]interface{})
+	}
+
+	t.Run("Default Appended To System Message", func(t *testing.T) {
+		body, err := removeToolsAndUpdatePrompt([]byte(`{"tools":[],"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"}]}`), "", zap.NewNop())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		messages := systemContent(t, body)
+		if len(messages) != 2 || messages[0].(map[string]interface{})["content"] != "Be brief.\n\n"+defaultToolFallbackPrompt {
+			t.Errorf("expected the default note appended to the system message, got %v", messages)
+		}
+	})
+
+	t.Run("Configured Prepended", func(t *testing.T) {
+		body, err := removeToolsAndUpdatePrompt([]byte(`{"tools":[],"messages":[{"role":"user","content":"Hi"}]}`), "Antworte ohne Werkzeuge.", zap.NewNop())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		messages := systemContent(t, body)
+		first := messages[0].(map[string]interface{})
+		if len(messages) != 2 || first["role"] != "system" || first["content"] != "Antworte ohne Werkzeuge." {
+			t.Errorf("expected the configured note as a new system message, got %v", messages)
+		}
+	})
+}
+
+func TestToolLessRetryRotatesKeys(t *testing.T) {
+	type attempt struct {
+		key      string
+		hasTools bool
+	}
+	var attempts []attempt
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		_, hasTools := body["tools"]
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		attempts = append(attempts, attempt{key, hasTools})
+
+		switch {
+		case hasTools:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"message":"No endpoints found that support tool use"}}`))
+		case key == "first":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer upstream.Close()
+
+	set := NewProxySet([]model.BackendConfig{
+		{Name: "a", BaseURL: upstream.URL, Prefix: "a/", RequireAPIKey: true, APIKeys: []string{"first", "second"}},
+	}, zap.NewNop())
+
+	req := httptest.NewRequest("POST", "/chat/completions", strings.NewReader(`{"model":"gpt-4o","tools":[{"type":"function","function":{"name":"f"}}],"messages":[]}`))
+	rr := httptest.NewRecorder()
+	set.Proxies["a/"].Pick().Proxy.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	expected := []attempt{{"first", true}, {"first", false}, {"second", false}}
+	if len(attempts) != len(expected) {
+		t.Fatalf("expected attempts %v, got %v", expected, attempts)
+	}
+	for i := range expected {
+		if attempts[i] != expected[i] {
+			t.Errorf("attempt %d: expected %v, got %v", i, expected[i], attempts[i])
+		}
+	}
+	if set.CredentialManagers["a"].IsKeyAvailable("first", "gpt-4o") {
+		t.Error("expected the rate-limited key to be marked failed")
+	}
+}
+
+func TestKeyFailureTimeouts(t *testing.T) {
+	tests := []struct {
+		name             string
+		status           int
+		wantOtherModel   bool // whether the key stays usable for other models
+		wantDisabledLogs int
+	}{
+		{"Rate Limit Benches Key For Model", http.StatusTooManyRequests, true, 0},
+		{"Auth Failure Disables Key", http.StatusUnauthorized, false, 1},
+		{"Forbidden Disables Key For Model", http.StatusForbidden, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") == "Bearer first" {
+					w.WriteHeader(tt.status)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer upstream.Close()
+
+			core, logs := observer.New(zapcore.InfoLevel)
+			set := NewProxySet([]model.BackendConfig{
+				{Name: "a", BaseURL: upstream.URL, Prefix: "a/", RequireAPIKey: true, APIKeys: []string{"first", "second"}},
+			}, zap.New(core))
+
+			req := httptest.NewRequest("POST", "/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`))
+			set.Proxies["a/"].Pick().Proxy.ServeHTTP(httptest.NewRecorder(), req)
+
+			cm := set.CredentialManagers["a"]
+			if cm.IsKeyAvailable("first", "gpt-4o") {
+				t.Error("expected the key to be unavailable for the failed model")
+			}
+			if got := cm.IsKeyAvailable("first", "other-model"); got != tt.wantOtherModel {
+				t.Errorf("expected availability for other models to be %v, got %v", tt.wantOtherModel, got)
+			}
+			disabled := logs.FilterMessage("API key rejected by backend and disabled; replace it in the config").All()
+			if len(disabled) != tt.wantDisabledLogs {
+				t.Fatalf("expected %d disabled key logs, got %d", tt.wantDisabledLogs, len(disabled))
+			}
+			if len(disabled) > 0 && disabled[0].Level != zapcore.ErrorLevel {
+				t.Errorf("expected a disabled key to be logged as an error, got %v", disabled[0].Level)
+			}
+		})
+	}
+}
+
+func TestLastKeyAuthFailure(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer only" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	set := NewProxySet([]model.BackendConfig{
+		{Name: "a", BaseURL: upstream.URL, Prefix: "a/", RequireAPIKey: true, APIKeys: []string{"only"}},
+	}, zap.NewNop())
+	cm := set.CredentialManagers["a"]
+
+	send := func(modelName string) {
+		req := httptest.NewRequest("POST", "/chat/completions", strings.NewReader(`{"model":"`+modelName+`"}`))
+		req.Header.Set("Authorization", "Bearer client-secret")
+		set.Proxies["a/"].Pick().Proxy.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	send("gpt-4o")
+	if cm.IsKeyAvailable("only", "gpt-4o") {
+		t.Error("expected the key to sit out the failed model")
+	}
+	if !cm.IsKeyAvailable("only", "other-model") {
+		t.Error("expected the backend's last key to stay available for other models")
+	}
+}
+
+func TestModelAwareKeySelection(t *testing.T) {
+	var keys []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		keys = append(keys, key)
+		if key == "first" && strings.Contains(string(body), `"gpt-4"`) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	set := NewProxySet([]model.BackendConfig{
+		{Name: "a", BaseURL: upstream.URL, Prefix: "a/", RequireAPIKey: true, APIKeys: []string{"first", "second"}},
+	}, zap.NewNop())
+
+	send := func(modelName string) {
+		req := httptest.NewRequest("POST", "/chat/completions", strings.NewReader(`{"model":"`+modelName+`"}`))
+		set.Proxies["a/"].Pick().Proxy.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	send("gpt-4") // first is rate limited for gpt-4, second serves it
+	keys = nil
+	send("gpt-4")
+	send("gpt-3.5-turbo")
+
+	if strings.Join(keys, ",") != "second,first" {
+		t.Errorf("expected gpt-4 to skip the failed key and gpt-3.5-turbo to still use it, got %v", keys)
+	}
+}
+
+func TestInitializeProxiesKeepsDisabledKeys(t *testing.T) {
+	defer SetCurrent(nil)
+	backends := []model.BackendConfig{
+		{Name: "a", BaseURL: "http://a", Prefix: "a/", RequireAPIKey: true, APIKeys: []string{"first", "second"}},
+	}
+
+	InitializeProxies(backends, zap.NewNop())
+	Current().CredentialManagers["a"].Disable("first")
+
+	InitializeProxies(backends, zap.NewNop())
+	if Current().CredentialManagers["a"].IsKeyAvailable("first", "") {
+		t.Error("expected a disabled key to stay disabled after a reload")
+	}
+}
+
+func TestInitializeProxiesKeepsCircuitState(t *testing.T) {
+	defer SetCurrent(nil)
+	backends := []model.BackendConfig{
+		{Name: "a", BaseURL: "http://a", Prefix: "a/", CircuitBreaker: &model.CircuitBreakerConfig{Threshold: 1}},
+	}
+
+	InitializeProxies(backends, zap.NewNop())
+	Current().Breakers["a"].RecordFailure()
+
+	InitializeProxies(backends, zap.NewNop())
+	if state := Current().Breakers["a"].State(); state != CircuitOpen {
+		t.Errorf("expected the open circuit to survive a reload, got %s", state)
+	}
+
+	changed := []model.BackendConfig{backends[0]}
+	changed[0].BaseURL = "http://a-replacement"
+	InitializeProxies(changed, zap.NewNop())
+	if state := Current().Breakers["a"].State(); state != CircuitClosed {
+		t.Errorf("expected a changed backend to start with a closed circuit, got %s", state)
+	}
+}
@@ -0,0 +1,183 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// sseHeartbeat is an SSE comment; clients ignore it, but it keeps idle
+// connections from being timed out by intermediaries
+var sseHeartbeat = []byte(": ping\n\n")
+
+// errStreamStalled ends a non-SSE stream whose upstream stopped sending
+var errStreamStalled = errors.New("upstream stream stalled")
+
+// streamChunk is one read from the upstream stream
+type streamChunk struct {
+	data []byte
+	err  error
+}
+
+// streamBody passes a streamed response through while watching for silence
+// from the upstream:
+//   - heartbeat: for event streams, a comment is written whenever the upstream
+//     has been silent this long. Comments only go between events, never inside
+//     a partly received one, so frames reach the client intact.
+//   - idleTimeout: when no bytes arrive for this long the upstream connection
+//     is closed. Event streams end with an error event so the client sees why;
+//     other streams end with errStreamStalled.
+//
+// Either may be zero to disable it. The upstream is read on its own goroutine,
+// which exits when the stream ends or the body is closed.
+type streamBody struct {
+	body        io.ReadCloser
+	sse         bool
+	heartbeat   time.Duration
+	idleTimeout time.Duration
+	chunks      chan streamChunk
+	done        chan struct{}
+	closeOnce   sync.Once
+
+	pending  []byte    // data already taken from chunks that didn't fit the caller's buffer
+	tail     []byte    // last bytes passed on, to tell whether an event just ended
+	lastData time.Time // when the upstream last sent bytes
+	err      error     // error to return once pending is drained
+}
+
+func newStreamBody(body io.ReadCloser, sse bool, heartbeat, idleTimeout time.Duration) *streamBody {
+	b := &streamBody{
+		body:        body,
+		sse:         sse,
+		heartbeat:   heartbeat,
+		idleTimeout: idleTimeout,
+		chunks:      make(chan streamChunk),
+		done:        make(chan struct{}),
+		lastData:    time.Now(),
+	}
+	go b.pump()
+	return b
+}
+
+func (b *streamBody) pump() {
+	for {
+		buf := make([]byte, 32<<10)
+		n, err := b.body.Read(buf)
+		select {
+		case b.chunks <- streamChunk{data: buf[:n], err: err}:
+		case <-b.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	if len(b.pending) > 0 {
+		return b.drain(p), nil
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	var heartbeatC, idleC <-chan time.Time
+	if b.heartbeat > 0 && b.sse {
+		// A ticker, since a heartbeat due mid-event is retried a period later
+		ticker := time.NewTicker(b.heartbeat)
+		defer ticker.Stop()
+		heartbeatC = ticker.C
+	}
+	if b.idleTimeout > 0 {
+		timer := time.NewTimer(time.Until(b.lastData.Add(b.idleTimeout)))
+		defer timer.Stop()
+		idleC = timer.C
+	}
+
+	for {
+		select {
+		case chunk := <-b.chunks:
+			b.err = chunk.err
+			if len(chunk.data) == 0 {
+				if b.err != nil {
+					return 0, b.err
+				}
+				continue
+			}
+			b.lastData = time.Now()
+			b.tail = append(b.tail, chunk.data...)
+			if len(b.tail) > 4 {
+				b.tail = b.tail[len(b.tail)-4:]
+			}
+			b.pending = chunk.data
+			return b.drain(p), nil
+		case <-heartbeatC:
+			if !b.betweenEvents() {
+				continue
+			}
+			b.pending = sseHeartbeat
+			return b.drain(p), nil
+		case <-idleC:
+			b.stall()
+			if len(b.pending) > 0 {
+				return b.drain(p), nil
+			}
+			return 0, b.err
+		}
+	}
+}
+
+// stall closes the silent upstream and queues the end of the stream
+func (b *streamBody) stall() {
+	b.Close()
+	if !b.sse {
+		b.err = errStreamStalled
+		return
+	}
+
+	// Finish a partly received event first so the error is parsed on its own
+	if !b.betweenEvents() {
+		b.pending = append(b.pending, "\n\n"...)
+	}
+	b.pending = append(b.pending, errorEvent(fmt.Sprintf("Upstream sent no data for %s", b.idleTimeout), "stream_stalled")...)
+	b.err = io.EOF
+}
+
+// errorEvent encodes an OpenAI-style error as a server-sent event, for
+// failures a streaming client must still be able to parse
+func errorEvent(message, errType string) []byte {
+	event, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]string{
+			"message": message,
+			"type":    errType,
+		},
+	})
+	return fmt.Appendf(nil, "data: %s\n\n", event)
+}
+
+// drain copies as much pending data into p as fits
+func (b *streamBody) drain(p []byte) int {
+	n := copy(p, b.pending)
+	b.pending = b.pending[n:]
+	return n
+}
+
+// betweenEvents reports whether everything passed on so far ends with a
+// complete event, or nothing has been passed on yet
+func (b *streamBody) betweenEvents() bool {
+	return len(b.tail) == 0 || bytes.HasSuffix(b.tail, []byte("\n\n")) || bytes.HasSuffix(b.tail, []byte("\r\n\r\n"))
+}
+
+func (b *streamBody) Close() error {
+	var err error
+	b.closeOnce.Do(func() {
+		close(b.done)
+		err = b.body.Close()
+	})
+	return err
+}
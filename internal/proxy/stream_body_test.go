@@ -0,0 +1,177 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"llm-router/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// slowStream writes parts to a pipe with a pause before each, then closes it
+func slowStream(pause time.Duration, parts ...string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		for _, part := range parts {
+			time.Sleep(pause)
+			if _, err := pw.Write([]byte(part)); err != nil {
+				return
+			}
+		}
+		pw.Close()
+	}()
+	return pr
+}
+
+func TestStreamBodyHeartbeat(t *testing.T) {
+	t.Run("Between Events", func(t *testing.T) {
+		body := newStreamBody(slowStream(120*time.Millisecond, "data: a\n\n", "data: b\n\n"), true, 30*time.Millisecond, 0)
+		defer body.Close()
+
+		out, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := string(out)
+		if !strings.Contains(got, "data: a\n\n: ping\n\n") {
+			t.Errorf("expected a heartbeat after the first event, got %q", got)
+		}
+		if strings.ReplaceAll(got, ": ping\n\n", "") != "data: a\n\ndata: b\n\n" {
+			t.Errorf("expected events to pass through intact, got %q", got)
+		}
+	})
+
+	t.Run("Not Inside An Event", func(t *testing.T) {
+		body := newStreamBody(slowStream(120*time.Millisecond, "data: a", "\n\n"), true, 30*time.Millisecond, 0)
+		defer body.Close()
+
+		out, _ := io.ReadAll(body)
+		if !strings.Contains(string(out), "data: a\n\n") {
+			t.Errorf("expected no heartbeat inside a partly sent event, got %q", out)
+		}
+	})
+
+	t.Run("Stops On Close", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		body := newStreamBody(pr, true, 10*time.Millisecond, 0)
+		buf := make([]byte, 64)
+		if n, _ := body.Read(buf); string(buf[:n]) != ": ping\n\n" {
+			t.Errorf("expected a heartbeat on a silent stream, got %q", buf[:n])
+		}
+		body.Close()
+		if _, err := pw.Write([]byte("data: late\n\n")); err != io.ErrClosedPipe {
+			t.Errorf("expected the upstream to be closed, got %v", err)
+		}
+	})
+}
+
+func TestStreamBodyStall(t *testing.T) {
+	stalled := func(t *testing.T, sse bool, sent string) (string, error, *io.PipeWriter) {
+		pr, pw := io.Pipe()
+		go pw.Write([]byte(sent))
+		body := newStreamBody(pr, sse, 0, 50*time.Millisecond)
+		out, err := io.ReadAll(body)
+		return string(out), err, pw
+	}
+	const errorEvent = `data: {"error":{"message":"Upstream sent no data for 50ms","type":"stream_stalled"}}` + "\n\n"
+
+	t.Run("Event Stream Ends With Error Event", func(t *testing.T) {
+		out, err, pw := stalled(t, true, "data: a\n\n")
+		if err != nil {
+			t.Fatalf("expected the stream to end cleanly, got %v", err)
+		}
+		if out != "data: a\n\n"+errorEvent {
+			t.Errorf("unexpected stream: %q", out)
+		}
+		if _, err := pw.Write([]byte("data: late\n\n")); err != io.ErrClosedPipe {
+			t.Errorf("expected the upstream to be closed, got %v", err)
+		}
+	})
+
+	t.Run("Partial Event Is Terminated", func(t *testing.T) {
+		out, _, _ := stalled(t, true, "data: a")
+		if out != "data: a\n\n"+errorEvent {
+			t.Errorf("unexpected stream: %q", out)
+		}
+	})
+
+	t.Run("Other Streams Fail", func(t *testing.T) {
+		out, err, _ := stalled(t, false, "chunk")
+		if out != "chunk" || err != errStreamStalled {
+			t.Errorf("expected the stream to fail after its data, got %q %v", out, err)
+		}
+	})
+
+	t.Run("Heartbeats Do Not Count As Data", func(t *testing.T) {
+		pr, _ := io.Pipe()
+		body := newStreamBody(pr, true, 10*time.Millisecond, 60*time.Millisecond)
+		out, err := io.ReadAll(body)
+		if err != nil || !strings.Contains(string(out), ": ping\n\n") || !strings.HasSuffix(string(out), "\"stream_stalled\"}}\n\n") {
+			t.Errorf("expected heartbeats followed by the stall error, got %q %v", out, err)
+		}
+	})
+}
+
+func TestStreamHeartbeat(t *testing.T) {
+	SetStreamHeartbeat(30 * time.Millisecond)
+	defer SetStreamHeartbeat(0)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"id\":1}\n\n"))
+		w.(http.Flusher).Flush()
+		time.Sleep(120 * time.Millisecond)
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+
+	set := NewProxySet([]model.BackendConfig{{Name: "a", BaseURL: upstream.URL, Prefix: "a/"}}, zap.NewNop())
+	req := httptest.NewRequest("POST", "/chat/completions", strings.NewReader(`{"model":"gpt-4o","stream":true}`))
+	rr := httptest.NewRecorder()
+	set.Proxies["a/"].Pick().Proxy.ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	if !strings.Contains(body, ": ping\n\n") {
+		t.Errorf("expected heartbeats in the stream, got %q", body)
+	}
+	if strings.ReplaceAll(body, ": ping\n\n", "") != "data: {\"id\":1}\n\ndata: [DONE]\n\n" {
+		t.Errorf("expected events to pass through intact, got %q", body)
+	}
+}
+
+func TestStreamIdleTimeout(t *testing.T) {
+	SetStreamIdleTimeout(50 * time.Millisecond)
+	defer SetStreamIdleTimeout(0)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"id\":1}\n\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done() // hold the connection open without sending anything
+	}))
+	defer upstream.Close()
+
+	set := NewProxySet([]model.BackendConfig{{Name: "a", BaseURL: upstream.URL, Prefix: "a/"}}, zap.NewNop())
+	req := httptest.NewRequest("POST", "/chat/completions", strings.NewReader(`{"model":"gpt-4o","stream":true}`))
+	rr := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		set.Proxies["a/"].Pick().Proxy.ServeHTTP(rr, req)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the stalled stream to be aborted")
+	}
+
+	if body := rr.Body.String(); !strings.HasPrefix(body, "data: {\"id\":1}\n\n") || !strings.Contains(body, `"type":"stream_stalled"`) {
+		t.Errorf("expected the stream to end with an error event, got %q", body)
+	}
+}
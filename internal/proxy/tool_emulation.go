@@ -0,0 +1,373 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// toolCallFence opens the block a model emulating function calling puts its
+// tool calls in
+const toolCallFence = "```tool_calls"
+
+// emulatedRequest is a chat request rewritten for a backend without native
+// function calling
+type emulatedRequest struct {
+	body          []byte
+	clientStreams bool // the client asked for a stream; the backend is asked for a single response
+}
+
+// emulateTools rewrites a chat request for a backend with emulate_tools set.
+// It returns nil when the request is sent as is.
+func (t *debugTransport) emulateTools(req *http.Request, bodyBytes []byte) *emulatedRequest {
+	if !t.backendConf.EmulateTools || !strings.HasSuffix(req.URL.Path, chatCompletionsPath) {
+		return nil
+	}
+	emulated, err := emulateToolsRequest(bodyBytes)
+	if err != nil {
+		t.logger.Warn("Failed to rewrite request for tool emulation; sending it as is",
+			zap.String("backend", t.backend),
+			zap.Error(err))
+		return nil
+	}
+	if emulated != nil {
+		t.logger.Info("Emulating tool calls for backend", zap.String("backend", t.backend))
+	}
+	return emulated
+}
+
+// emulateToolsRequest rewrites a chat request carrying tools so a backend
+// without function calling can still use them. The tool schemas go into the
+// system prompt with instructions to reply with a toolCallFence block, earlier
+// tool calls and results in the conversation are rewritten as plain messages,
+// and streaming is turned off so the reply can be parsed whole.
+// It returns nil when the request has no tools to emulate.
+func emulateToolsRequest(bodyBytes []byte) (*emulatedRequest, error) {
+	var chatReq map[string]interface{}
+	if err := json.Unmarshal(bodyBytes, &chatReq); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+
+	tools, _ := chatReq["tools"].([]interface{})
+	if len(tools) == 0 {
+		return nil, nil
+	}
+	toolChoice := chatReq["tool_choice"]
+	delete(chatReq, "tools")
+	delete(chatReq, "tool_choice")
+	delete(chatReq, "parallel_tool_calls")
+
+	messages, ok := chatReq["messages"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("request has no messages")
+	}
+	messages = flattenToolMessages(messages)
+	if toolChoice != "none" {
+		messages, _ = addSystemNote(messages, toolPrompt(tools, toolChoice))
+	}
+	chatReq["messages"] = messages
+
+	emulated := &emulatedRequest{}
+	if stream, _ := chatReq["stream"].(bool); stream {
+		emulated.clientStreams = true
+		chatReq["stream"] = false
+		delete(chatReq, "stream_options")
+	}
+
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return nil, err
+	}
+	emulated.body = body
+	return emulated, nil
+}
+
+// toolPrompt describes the tools and how to call them
+func toolPrompt(tools []interface{}, toolChoice interface{}) string {
+	var prompt strings.Builder
+	prompt.WriteString("You can call the following tools. Each is given as JSON with its name, description and JSON schema parameters:\n\n")
+	for _, tool := range tools {
+		toolMap, _ := tool.(map[string]interface{})
+		function, ok := toolMap["function"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		schema, _ := json.Marshal(map[string]interface{}{
+			"name":        function["name"],
+			"description": function["description"],
+			"parameters":  function["parameters"],
+		})
+		prompt.Write(schema)
+		prompt.WriteString("\n")
+	}
+
+	prompt.WriteString("\nTo call tools, reply with a block in exactly this format, listing one or more calls:\n\n")
+	prompt.WriteString(toolCallFence + "\n")
+	prompt.WriteString(`[{"name": "<tool name>", "arguments": {<arguments matching the tool's parameters>}}]` + "\n")
+	prompt.WriteString("```\n\n")
+	prompt.WriteString("Tool results will be sent to you in a later message. ")
+
+	switch choice := toolChoice.(type) {
+	case string:
+		if choice == "required" {
+			prompt.WriteString("You must call at least one tool.")
+			return prompt.String()
+		}
+	case map[string]interface{}:
+		if function, ok := choice["function"].(map[string]interface{}); ok {
+			prompt.WriteString(fmt.Sprintf("You must call the %v tool.", function["name"]))
+			return prompt.String()
+		}
+	}
+	prompt.WriteString("When no tool is needed, answer normally without the block.")
+	return prompt.String()
+}
+
+// flattenToolMessages rewrites assistant tool calls as toolCallFence blocks
+// and tool results as user messages, which any chat backend accepts
+func flattenToolMessages(messages []interface{}) []interface{} {
+	toolNames := make(map[string]string)
+	result := make([]interface{}, 0, len(messages))
+	for _, msg := range messages {
+		msgMap, ok := msg.(map[string]interface{})
+		if !ok {
+			result = append(result, msg)
+			continue
+		}
+
+		switch msgMap["role"] {
+		case "assistant":
+			toolCalls, _ := msgMap["tool_calls"].([]interface{})
+			if len(toolCalls) == 0 {
+				break
+			}
+			var calls []map[string]interface{}
+			for _, call := range toolCalls {
+				callMap, _ := call.(map[string]interface{})
+				function, _ := callMap["function"].(map[string]interface{})
+				name, _ := function["name"].(string)
+				if id, ok := callMap["id"].(string); ok {
+					toolNames[id] = name
+				}
+				var arguments interface{} = function["arguments"]
+				if raw, ok := arguments.(string); ok {
+					var decoded interface{}
+					if json.Unmarshal([]byte(raw), &decoded) == nil {
+						arguments = decoded
+					}
+				}
+				calls = append(calls, map[string]interface{}{"name": name, "arguments": arguments})
+			}
+			block, _ := json.Marshal(calls)
+
+			content, _ := msgMap["content"].(string)
+			if content != "" {
+				content += "\n\n"
+			}
+			msgMap = map[string]interface{}{
+				"role":    "assistant",
+				"content": content + toolCallFence + "\n" + string(block) + "\n```",
+			}
+		case "tool":
+			id, _ := msgMap["tool_call_id"].(string)
+			content, ok := msgMap["content"].(string)
+			if !ok {
+				raw, _ := json.Marshal(msgMap["content"])
+				content = string(raw)
+			}
+			msgMap = map[string]interface{}{
+				"role":    "user",
+				"content": fmt.Sprintf("Result of the %s tool call:\n%s", toolNames[id], content),
+			}
+		}
+		result = append(result, msgMap)
+	}
+	return result
+}
+
+// emulateToolCalls turns toolCallFence blocks in a successful completion into
+// OpenAI tool_calls, replacing resp's body. When the client asked for a stream
+// the completion is sent as one, and a reply that can't be converted becomes
+// an error event rather than a JSON body the client wouldn't parse.
+func (t *debugTransport) emulateToolCalls(resp *http.Response, clientStreams bool) {
+	if resp.StatusCode != http.StatusOK || resp.Body == nil {
+		return
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err == nil {
+		var out []byte
+		if out, err = emulateToolsResponse(body, clientStreams); err == nil {
+			body = out
+		}
+	}
+	if err != nil {
+		t.logger.Warn("Failed to convert emulated tool calls",
+			zap.String("backend", t.backend),
+			zap.Error(err))
+		if clientStreams {
+			body = errorEvent("Failed to convert the backend's reply into tool calls", "tool_emulation_error")
+		}
+	}
+	if clientStreams {
+		resp.Header.Set("Content-Type", eventStreamContentType)
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+}
+
+// emulateToolsResponse converts the tool call blocks in a chat completion
+// into tool_calls and, when stream is set, re-encodes the completion as
+// server-sent events
+func emulateToolsResponse(body []byte, stream bool) ([]byte, error) {
+	var completion map[string]interface{}
+	if err := json.Unmarshal(body, &completion); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal completion: %w", err)
+	}
+
+	choices, _ := completion["choices"].([]interface{})
+	for _, choice := range choices {
+		choiceMap, _ := choice.(map[string]interface{})
+		message, _ := choiceMap["message"].(map[string]interface{})
+		content, _ := message["content"].(string)
+		text, calls, found := extractToolCalls(content)
+		if !found {
+			continue
+		}
+		message["tool_calls"] = calls
+		if text != "" {
+			message["content"] = text
+		} else {
+			message["content"] = nil
+		}
+		choiceMap["finish_reason"] = "tool_calls"
+	}
+
+	if !stream {
+		return json.Marshal(completion)
+	}
+	return completionToEvents(completion)
+}
+
+// extractToolCalls finds a toolCallFence block in content and returns the
+// rest of the content and the calls as OpenAI tool_calls
+func extractToolCalls(content string) (string, []interface{}, bool) {
+	start := strings.Index(content, toolCallFence)
+	if start < 0 {
+		return content, nil, false
+	}
+	blockStart := start + len(toolCallFence)
+	length := strings.Index(content[blockStart:], "```")
+	if length < 0 {
+		return content, nil, false
+	}
+	block := strings.TrimSpace(content[blockStart : blockStart+length])
+
+	var raw []map[string]interface{}
+	if err := json.Unmarshal([]byte(block), &raw); err != nil {
+		var single map[string]interface{}
+		if json.Unmarshal([]byte(block), &single) != nil {
+			return content, nil, false
+		}
+		raw = []map[string]interface{}{single}
+	}
+
+	calls := make([]interface{}, 0, len(raw))
+	for _, call := range raw {
+		name, _ := call["name"].(string)
+		if name == "" {
+			return content, nil, false
+		}
+		arguments, ok := call["arguments"].(string)
+		if !ok {
+			encoded, _ := json.Marshal(call["arguments"])
+			arguments = string(encoded)
+			if call["arguments"] == nil {
+				arguments = "{}"
+			}
+		}
+		calls = append(calls, map[string]interface{}{
+			"id":   "call_" + strings.ReplaceAll(uuid.New().String(), "-", "")[:24],
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":      name,
+				"arguments": arguments,
+			},
+		})
+	}
+
+	text := strings.TrimSpace(content[:start] + content[blockStart+length+len("```"):])
+	return text, calls, true
+}
+
+// completionToEvents encodes a chat completion as the chunks a streamed
+// request would have received: one carrying each choice's message and a
+// final one with the finish reasons and usage
+func completionToEvents(completion map[string]interface{}) ([]byte, error) {
+	chunk := func(choices []interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"id":      completion["id"],
+			"object":  "chat.completion.chunk",
+			"created": completion["created"],
+			"model":   completion["model"],
+			"choices": choices,
+		}
+	}
+
+	choices, _ := completion["choices"].([]interface{})
+	var deltas, finishes []interface{}
+	for i, choice := range choices {
+		choiceMap, _ := choice.(map[string]interface{})
+		message, _ := choiceMap["message"].(map[string]interface{})
+		index := choiceMap["index"]
+		if index == nil {
+			index = i
+		}
+
+		delta := map[string]interface{}{"role": "assistant"}
+		if content, ok := message["content"].(string); ok {
+			delta["content"] = content
+		}
+		if calls, ok := message["tool_calls"].([]interface{}); ok {
+			indexed := make([]interface{}, len(calls))
+			for j, call := range calls {
+				callMap, _ := call.(map[string]interface{})
+				entry := map[string]interface{}{"index": j}
+				for key, value := range callMap {
+					entry[key] = value
+				}
+				indexed[j] = entry
+			}
+			delta["tool_calls"] = indexed
+		}
+		deltas = append(deltas, map[string]interface{}{"index": index, "delta": delta, "finish_reason": nil})
+		finishes = append(finishes, map[string]interface{}{"index": index, "delta": map[string]interface{}{}, "finish_reason": choiceMap["finish_reason"]})
+	}
+
+	final := chunk(finishes)
+	if usage, ok := completion["usage"]; ok {
+		final["usage"] = usage
+	}
+
+	var events bytes.Buffer
+	for _, event := range []map[string]interface{}{chunk(deltas), final} {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+		events.WriteString("data: ")
+		events.Write(data)
+		events.WriteString("\n\n")
+	}
+	events.WriteString("data: [DONE]\n\n")
+	return events.Bytes(), nil
+}
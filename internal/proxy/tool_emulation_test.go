@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"llm-router/internal/model"
+
+	"go.uber.org/zap"
+)
+
+func TestEmulateTools(t *testing.T) {
+	var upstreamReq map[string]interface{}
+	var malformed bool
+	reply := "Let me check.\n```tool_calls\n[{\"name\": \"get_weather\", \"arguments\": {\"city\": \"Paris\"}}]\n```"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamReq = nil
+		json.NewDecoder(r.Body).Decode(&upstreamReq)
+		w.Header().Set("Content-Type", "application/json")
+		if malformed {
+			w.Write([]byte(`{"choices": [`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":      "chatcmpl-1",
+			"object":  "chat.completion",
+			"created": 1,
+			"model":   "m",
+			"choices": []interface{}{map[string]interface{}{
+				"index":         0,
+				"message":       map[string]interface{}{"role": "assistant", "content": reply},
+				"finish_reason": "stop",
+			}},
+		})
+	}))
+	defer upstream.Close()
+
+	set := NewProxySet([]model.BackendConfig{{Name: "a", BaseURL: upstream.URL, Prefix: "a/", EmulateTools: true}}, zap.NewNop())
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/chat/completions", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		set.Proxies["a/"].Pick().Proxy.ServeHTTP(rr, req)
+		return rr
+	}
+	tools := `"tools":[{"type":"function","function":{"name":"get_weather","description":"Current weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}}]`
+
+	t.Run("Request Rewritten", func(t *testing.T) {
+		send(`{"model":"m",` + tools + `,"tool_choice":"auto","messages":[
+			{"role":"system","content":"Be brief."},
+			{"role":"user","content":"Weather?"},
+			{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Rome\"}"}}]},
+			{"role":"tool","tool_call_id":"call_1","content":"Sunny"}]}`)
+
+		if _, exists := upstreamReq["tools"]; exists {
+			t.Error("expected tools to be removed from the upstream request")
+		}
+		if _, exists := upstreamReq["tool_choice"]; exists {
+			t.Error("expected tool_choice to be removed from the upstream request")
+		}
+		messages := upstreamReq["messages"].([]interface{})
+		system := messages[0].(map[string]interface{})["content"].(string)
+		if !strings.HasPrefix(system, "Be brief.") || !strings.Contains(system, `"name":"get_weather"`) || !strings.Contains(system, toolCallFence) {
+			t.Errorf("expected the tools to be described in the system prompt, got %q", system)
+		}
+		assistant := messages[2].(map[string]interface{})
+		if _, exists := assistant["tool_calls"]; exists || !strings.Contains(assistant["content"].(string), `{"arguments":{"city":"Rome"},"name":"get_weather"}`) {
+			t.Errorf("expected the earlier tool call as a block, got %v", assistant)
+		}
+		result := messages[3].(map[string]interface{})
+		if result["role"] != "user" || result["content"] != "Result of the get_weather tool call:\nSunny" {
+			t.Errorf("expected the tool result as a user message, got %v", result)
+		}
+	})
+
+	t.Run("Tool Calls Parsed", func(t *testing.T) {
+		rr := send(`{"model":"m",` + tools + `,"messages":[{"role":"user","content":"Weather in Paris?"}]}`)
+
+		var resp struct {
+			Choices []struct {
+				Message struct {
+					Content   *string `json:"content"`
+					ToolCalls []struct {
+						ID       string `json:"id"`
+						Type     string `json:"type"`
+						Function struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"message"`
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("expected a JSON completion, got %q", rr.Body.String())
+		}
+		choice := resp.Choices[0]
+		if choice.FinishReason != "tool_calls" || len(choice.Message.ToolCalls) != 1 {
+			t.Fatalf("expected one tool call, got %s", rr.Body.String())
+		}
+		call := choice.Message.ToolCalls[0]
+		if !strings.HasPrefix(call.ID, "call_") || call.Type != "function" || call.Function.Name != "get_weather" || call.Function.Arguments != `{"city":"Paris"}` {
+			t.Errorf("unexpected tool call: %+v", call)
+		}
+		if choice.Message.Content == nil || *choice.Message.Content != "Let me check." {
+			t.Errorf("expected the text around the block to be kept, got %v", choice.Message.Content)
+		}
+	})
+
+	t.Run("Streamed To Client", func(t *testing.T) {
+		rr := send(`{"model":"m","stream":true,"stream_options":{"include_usage":true},` + tools + `,"messages":[{"role":"user","content":"Weather?"}]}`)
+
+		if upstreamReq["stream"] != false {
+			t.Errorf("expected the upstream request not to stream, got %v", upstreamReq["stream"])
+		}
+		if _, exists := upstreamReq["stream_options"]; exists {
+			t.Error("expected stream_options to be removed")
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("expected an event stream, got %q", ct)
+		}
+		body := rr.Body.String()
+		if !strings.Contains(body, `"tool_calls":[{"function":{"arguments":"{\"city\":\"Paris\"}","name":"get_weather"}`) ||
+			!strings.Contains(body, `"finish_reason":"tool_calls"`) || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+			t.Errorf("unexpected stream: %s", body)
+		}
+	})
+
+	t.Run("Unconvertible Reply Streamed As Error", func(t *testing.T) {
+		malformed = true
+		defer func() { malformed = false }()
+		rr := send(`{"model":"m","stream":true,` + tools + `,"messages":[{"role":"user","content":"Weather?"}]}`)
+
+		if ct := rr.Header().Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("expected an event stream, got %q", ct)
+		}
+		body := rr.Body.String()
+		if !strings.HasPrefix(body, "data: {\"error\":") || !strings.Contains(body, `"type":"tool_emulation_error"`) {
+			t.Errorf("expected an error event, got %q", body)
+		}
+	})
+
+	t.Run("No Tools", func(t *testing.T) {
+		send(`{"model":"m","stream":true,"messages":[{"role":"user","content":"Hi"}]}`)
+
+		if upstreamReq["stream"] != true || len(upstreamReq["messages"].([]interface{})) != 1 {
+			t.Errorf("expected a request without tools to be sent as is, got %v", upstreamReq)
+		}
+	})
+}
+
+func TestExtractToolCalls(t *testing.T) {
+	t.Run("Single Object", func(t *testing.T) {
+		text, calls, found := extractToolCalls("```tool_calls\n{\"name\": \"now\"}\n```")
+		if !found || text != "" || len(calls) != 1 {
+			t.Fatalf("expected one call, got %v %q", calls, text)
+		}
+		function := calls[0].(map[string]interface{})["function"].(map[string]interface{})
+		if function["name"] != "now" || function["arguments"] != "{}" {
+			t.Errorf("unexpected call: %v", function)
+		}
+	})
+
+	t.Run("Invalid Block", func(t *testing.T) {
+		content := "```tool_calls\nnot json\n```"
+		if text, _, found := extractToolCalls(content); found || text != content {
+			t.Errorf("expected an invalid block to be left as text, got %q", text)
+		}
+	})
+
+	t.Run("No Block", func(t *testing.T) {
+		if _, _, found := extractToolCalls("Hello"); found {
+			t.Error("expected no tool calls")
+		}
+	})
+}
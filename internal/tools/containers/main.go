@@ -4,8 +4,12 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -13,16 +17,51 @@ import (
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
 const (
-	DefaultImage = "ubuntu:latest"
+	DefaultImage    = "ubuntu:latest"
+	DefaultMemory   = 1024 * 1024 * 1024 // 1GB
+	DefaultNanoCPUs = 1000000000         // 1 CPU
 )
 
+// DefaultCmd keeps the container running so commands can be exec'd into it
+var DefaultCmd = []string{"tail", "-f", "/dev/null"}
+
+// ContainerConfig controls the image and resources of containers created by a Client.
+// Zero values fall back to the defaults above.
+type ContainerConfig struct {
+	Image    string   `json:"image,omitempty"`
+	Cmd      []string `json:"cmd,omitempty"`
+	Env      []string `json:"env,omitempty"`       // KEY=value pairs
+	Memory   int64    `json:"memory,omitempty"`    // Bytes
+	NanoCPUs int64    `json:"nano_cpus,omitempty"` // 1e9 = 1 CPU
+}
+
+// withDefaults fills unset fields with the default sandbox settings
+func (cfg ContainerConfig) withDefaults() ContainerConfig {
+	if cfg.Image == "" {
+		cfg.Image = DefaultImage
+	}
+	if len(cfg.Cmd) == 0 {
+		cfg.Cmd = DefaultCmd
+	}
+	if cfg.Memory <= 0 {
+		cfg.Memory = DefaultMemory
+	}
+	if cfg.NanoCPUs <= 0 {
+		cfg.NanoCPUs = DefaultNanoCPUs
+	}
+	return cfg
+}
+
 type Client struct {
 	cli    *client.Client
 	logger *zap.Logger
+	config ContainerConfig
 }
 
 type ContainerInfo struct {
@@ -35,6 +74,11 @@ type ContainerInfo struct {
 // host can be a unix socket path (unix:///var/run/docker.sock) or tcp endpoint (tcp://localhost:2375)
 // if host is empty, it attempts to use defaults from environment
 func NewClient(host string, logger *zap.Logger) (*Client, error) {
+	return NewClientWithConfig(host, logger, ContainerConfig{})
+}
+
+// NewClientWithConfig creates a new Docker client whose containers use the given image and resources
+func NewClientWithConfig(host string, logger *zap.Logger, config ContainerConfig) (*Client, error) {
 	var opts []client.Opt
 	opts = append(opts, client.WithAPIVersionNegotiation())
 
@@ -52,6 +96,7 @@ func NewClient(host string, logger *zap.Logger) (*Client, error) {
 	return &Client{
 		cli:    cli,
 		logger: logger,
+		config: config.withDefaults(),
 	}, nil
 }
 
@@ -127,9 +172,10 @@ func (c *Client) getContainerStatus(ctx context.Context, name string) (*Containe
 
 func (c *Client) createContainer(ctx context.Context, name string) (*ContainerInfo, error) {
 	// Ensure image exists
-	_, _, err := c.cli.ImageInspectWithRaw(ctx, DefaultImage)
+	_, _, err := c.cli.ImageInspectWithRaw(ctx, c.config.Image)
 	if client.IsErrNotFound(err) {
-		reader, err := c.cli.ImagePull(ctx, DefaultImage, image.PullOptions{})
+		c.logger.Info("Pulling image", zap.String("image", c.config.Image))
+		reader, err := c.cli.ImagePull(ctx, c.config.Image, image.PullOptions{})
 		if err != nil {
 			return nil, fmt.Errorf("failed to pull image: %w", err)
 		}
@@ -139,17 +185,18 @@ func (c *Client) createContainer(ctx context.Context, name string) (*ContainerIn
 
 	// ContainerCreate signature: ctx, config, hostConfig, networkingConfig, platform, containerName
 	resp, err := c.cli.ContainerCreate(ctx, &container.Config{
-		Image:        DefaultImage,
-		Cmd:          []string{"tail", "-f", "/dev/null"}, // Keep running
+		Image:        c.config.Image,
+		Cmd:          c.config.Cmd,
+		Env:          c.config.Env,
 		Tty:          true,
 		OpenStdin:    true,
 		AttachStdout: true,
 		AttachStderr: true,
 	}, &container.HostConfig{
 		Resources: container.Resources{
-			Memory:     1024 * 1024 * 1024, // 1GB
-			MemorySwap: -1,                 // Unlimited swap
-			NanoCPUs:   1000000000,         // 1 CPU
+			Memory:     c.config.Memory,
+			MemorySwap: -1, // Unlimited swap
+			NanoCPUs:   c.config.NanoCPUs,
 		},
 	}, nil, nil, name)
 
@@ -162,7 +209,7 @@ func (c *Client) createContainer(ctx context.Context, name string) (*ContainerIn
 	return &ContainerInfo{
 		ID:     resp.ID,
 		Status: "created",
-		Image:  DefaultImage,
+		Image:  c.config.Image,
 	}, nil
 }
 
@@ -281,16 +328,82 @@ func (c *Client) ensureContainerRunning(ctx context.Context, name string) error
 
 // Execute runs a command in the container and returns stdout/stderr and exit code
 func (c *Client) Execute(ctx context.Context, containerName string, cmd []string, workDir string) (string, int, error) {
+	var outBuf bytes.Buffer
+	exitCode, err := c.ExecuteStream(ctx, containerName, cmd, workDir, &outBuf)
+	return outBuf.String(), exitCode, err
+}
+
+// ExecuteStream runs a command in the container, copying its combined output to out
+// as it is produced, and returns the exit code once the command finishes
+func (c *Client) ExecuteStream(ctx context.Context, containerName string, cmd []string, workDir string, out io.Writer) (int, error) {
+	return c.runExec(ctx, containerName, cmd, workDir, execOptions{tty: true, stdout: out})
+}
+
+// ExecuteWithTimeout runs a command like Execute, but kills it and returns an
+// ErrExecTimeout error if it is still running after timeout
+func (c *Client) ExecuteWithTimeout(ctx context.Context, containerName string, cmd []string, workDir string, timeout time.Duration) (string, int, error) {
+	var outBuf bytes.Buffer
+	exitCode, err := c.runExec(ctx, containerName, cmd, workDir, execOptions{tty: true, stdout: &outBuf, timeout: timeout})
+	return outBuf.String(), exitCode, err
+}
+
+// ExecuteSeparate runs a command without a TTY so stdout and stderr can be told apart
+func (c *Client) ExecuteSeparate(ctx context.Context, containerName string, cmd []string, workDir string) (string, string, int, error) {
+	var stdout, stderr bytes.Buffer
+	exitCode, err := c.runExec(ctx, containerName, cmd, workDir, execOptions{stdout: &stdout, stderr: &stderr})
+	return stdout.String(), stderr.String(), exitCode, err
+}
+
+// ExecuteWithInput runs a command like Execute, feeding stdin to the command and
+// closing it afterwards so the command sees EOF. No TTY is used, since a terminal
+// would echo the input and never deliver the EOF.
+func (c *Client) ExecuteWithInput(ctx context.Context, containerName string, cmd []string, workDir string, stdin io.Reader) (string, int, error) {
+	var outBuf bytes.Buffer
+	exitCode, err := c.runExec(ctx, containerName, cmd, workDir, execOptions{stdout: &outBuf, stderr: &outBuf, stdin: stdin})
+	return outBuf.String(), exitCode, err
+}
+
+// execOptions controls how an exec is attached
+type execOptions struct {
+	// tty merges stdout and stderr into stdout, as an interactive terminal would.
+	// Without it, Docker multiplexes both streams and they are split apart again.
+	tty    bool
+	stdout io.Writer
+	stderr io.Writer
+	stdin  io.Reader // nil means stdin is not attached
+
+	// timeout kills the command if it runs longer; zero means no limit beyond ctx
+	timeout time.Duration
+}
+
+// ErrExecTimeout is returned when a command is killed for exceeding its timeout
+var ErrExecTimeout = errors.New("exec timed out")
+
+// execKillTimeout bounds the follow-up exec that kills a timed out or cancelled command
+const execKillTimeout = 5 * time.Second
+
+// runExec creates and attaches an exec, copies its output and returns the exit code
+func (c *Client) runExec(ctx context.Context, containerName string, cmd []string, workDir string, opts execOptions) (int, error) {
 	if err := c.ensureContainerRunning(ctx, containerName); err != nil {
-		return "", -1, err
+		return -1, err
 	}
 
 	c.logger.Info("Exec command", zap.String("container", containerName), zap.Strings("cmd", cmd), zap.String("workDir", workDir))
 
+	// Record the shell's PID so the command can be killed on timeout or when ctx
+	// is cancelled; Docker leaves it running when the attach is dropped. The shell
+	// stays as the command's parent so the PID file is removed on normal completion.
+	var pidFile string
+	if opts.timeout > 0 || ctx.Done() != nil {
+		pidFile = "/tmp/.llm-exec-" + uuid.New().String() + ".pid"
+		cmd = append([]string{"/bin/sh", "-c", `echo $$ > "$0"; "$@"; code=$?; rm -f "$0"; exit $code`, pidFile}, cmd...)
+	}
+
 	execConfig := container.ExecOptions{
+		AttachStdin:  opts.stdin != nil,
 		AttachStdout: true,
 		AttachStderr: true,
-		Tty:          true, // Combined output
+		Tty:          opts.tty,
 		WorkingDir:   workDir,
 		Cmd:          cmd,
 	}
@@ -299,46 +412,100 @@ func (c *Client) Execute(ctx context.Context, containerName string, cmd []string
 	execIDResp, err := c.cli.ContainerExecCreate(ctx, containerName, execConfig)
 	if err != nil {
 		c.logger.Error("Failed to create exec", zap.Error(err))
-		return "", -1, fmt.Errorf("failed to create exec: %w", err)
+		return -1, fmt.Errorf("failed to create exec: %w", err)
 	}
 
 	// Attach
 	resp, err := c.cli.ContainerExecAttach(ctx, execIDResp.ID, container.ExecStartOptions{
-		Tty: true,
+		Tty: opts.tty,
 	})
 	if err != nil {
 		c.logger.Error("Failed to attach exec", zap.Error(err))
-		return "", -1, fmt.Errorf("failed to attach exec: %w", err)
+		return -1, fmt.Errorf("failed to attach exec: %w", err)
 	}
 	defer resp.Close()
 
-	// Read output
-	var outBuf bytes.Buffer
-	outputDone := make(chan error)
+	// Stream output. The channel is buffered so the copy goroutine can always
+	// finish once resp is closed, even if nobody is waiting for it anymore.
+	outputDone := make(chan error, 1)
 
 	go func() {
-		_, err := io.Copy(&outBuf, resp.Reader)
+		var err error
+		if opts.tty {
+			_, err = io.Copy(opts.stdout, resp.Reader)
+		} else {
+			stderr := opts.stderr
+			if stderr == nil {
+				stderr = io.Discard
+			}
+			// Split the 8-byte-header framed stream into stdout and stderr
+			_, err = stdcopy.StdCopy(opts.stdout, stderr, resp.Reader)
+		}
 		outputDone <- err
 	}()
 
+	if opts.stdin != nil {
+		go func() {
+			if _, err := io.Copy(resp.Conn, opts.stdin); err != nil {
+				c.logger.Error("Error writing exec input", zap.Error(err))
+			}
+			// Half-close so the command reads EOF while output keeps flowing
+			if err := resp.CloseWrite(); err != nil {
+				c.logger.Error("Failed to close exec input", zap.Error(err))
+			}
+		}()
+	}
+
+	var timeout <-chan time.Time
+	if opts.timeout > 0 {
+		timer := time.NewTimer(opts.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
 	select {
 	case err := <-outputDone:
 		if err != nil {
 			c.logger.Error("Error reading exec output", zap.Error(err))
-			return "", -1, err
+			return -1, err
 		}
+	case <-timeout:
+		c.logger.Warn("Exec timed out, killing command", zap.String("container", containerName), zap.Duration("timeout", opts.timeout))
+		c.killExec(containerName, pidFile)
+		return -1, fmt.Errorf("%w after %s", ErrExecTimeout, opts.timeout)
 	case <-ctx.Done():
-		return "", -1, ctx.Err()
+		c.logger.Warn("Exec cancelled, killing command", zap.String("container", containerName), zap.Error(ctx.Err()))
+		c.killExec(containerName, pidFile)
+		return -1, ctx.Err()
 	}
 
 	// Inspect to get exit code
 	inspectResp, err := c.cli.ContainerExecInspect(ctx, execIDResp.ID)
 	if err != nil {
 		c.logger.Error("Failed to inspect exec", zap.Error(err))
-		return outBuf.String(), -1, fmt.Errorf("failed to inspect exec: %w", err)
+		return -1, fmt.Errorf("failed to inspect exec: %w", err)
 	}
 
-	return outBuf.String(), inspectResp.ExitCode, nil
+	return inspectResp.ExitCode, nil
+}
+
+// killExec kills the process group (or, failing that, the process and its
+// children) recorded in pidFile by a timed or cancellable exec
+func (c *Client) killExec(containerName, pidFile string) {
+	// The caller's context may already be cancelled, so use a fresh one
+	ctx, cancel := context.WithTimeout(context.Background(), execKillTimeout)
+	defer cancel()
+
+	script := `pid=$(cat "$0" 2>/dev/null) || exit 0; kill -9 -"$pid" 2>/dev/null || { pkill -9 -P "$pid" 2>/dev/null; kill -9 "$pid"; }; rm -f "$0"`
+	execResp, err := c.cli.ContainerExecCreate(ctx, containerName, container.ExecOptions{
+		Cmd: []string{"/bin/sh", "-c", script, pidFile},
+	})
+	if err == nil {
+		err = c.cli.ContainerExecStart(ctx, execResp.ID, container.ExecStartOptions{Detach: true})
+	}
+	if err != nil {
+		c.logger.Error("Failed to kill exec", zap.String("container", containerName), zap.Error(err))
+	}
 }
 
 // WriteFile writes content to a file in the container
@@ -390,41 +557,196 @@ func (c *Client) WriteFile(ctx context.Context, containerName, path string, cont
 	return c.cli.CopyToContainer(ctx, containerName, dirPath, buf, container.CopyToContainerOptions{})
 }
 
-// ReadFile reads a file from the container
+// WriteDir copies the local directory tree at localDir into destPath in the container
+// with a single tar upload, preserving relative paths, file modes and empty directories.
+// Symlinks are skipped unless followSymlinks is set, in which case their targets are
+// copied in their place (directory cycles are detected and skipped).
+func (c *Client) WriteDir(ctx context.Context, containerName, localDir, destPath string, followSymlinks bool) error {
+	if err := c.EnsureDirectory(ctx, containerName, destPath); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(localDir)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", localDir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", localDir)
+	}
+
+	c.logger.Info("Writing directory", zap.String("container", containerName), zap.String("src", localDir), zap.String("dest", destPath))
+
+	// Stream the archive so large trees aren't held in memory
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		w := &dirTarWriter{tw: tw, followSymlinks: followSymlinks, visited: make(map[string]bool)}
+		err := w.addDir(localDir, "")
+		if closeErr := tw.Close(); err == nil {
+			err = closeErr
+		}
+		pw.CloseWithError(err)
+	}()
+
+	err = c.cli.CopyToContainer(ctx, containerName, destPath, pr, container.CopyToContainerOptions{})
+	pr.CloseWithError(err)
+	return err
+}
+
+// dirTarWriter adds a local directory tree to a tar archive
+type dirTarWriter struct {
+	tw             *tar.Writer
+	followSymlinks bool
+	visited        map[string]bool // Real paths of directories already added, to break cycles
+}
+
+// addDir adds the contents of dir under the archive prefix rel
+func (w *dirTarWriter) addDir(dir, rel string) error {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	w.visited[realDir] = true
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		fsPath := filepath.Join(dir, entry.Name())
+		name := path.Join(rel, entry.Name())
+
+		info, err := os.Lstat(fsPath)
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			if !w.followSymlinks {
+				continue
+			}
+			if info, err = os.Stat(fsPath); err != nil {
+				// Dangling link
+				continue
+			}
+		}
+
+		switch {
+		case info.IsDir():
+			if realDir, err := filepath.EvalSymlinks(fsPath); err != nil || w.visited[realDir] {
+				// A followed symlink leading back into the tree
+				continue
+			}
+			if err := w.writeHeader(info, name+"/"); err != nil {
+				return err
+			}
+			if err := w.addDir(fsPath, name); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			if err := w.addFile(fsPath, name, info); err != nil {
+				return err
+			}
+		}
+		// Sockets, devices and other special files are skipped
+	}
+
+	return nil
+}
+
+func (w *dirTarWriter) addFile(fsPath, name string, info os.FileInfo) error {
+	f, err := os.Open(fsPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := w.writeHeader(info, name); err != nil {
+		return err
+	}
+	_, err = io.Copy(w.tw, f)
+	return err
+}
+
+func (w *dirTarWriter) writeHeader(info os.FileInfo, name string) error {
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	// Files belong to the container's root user, like WriteFile
+	hdr.Uid, hdr.Gid = 0, 0
+	hdr.Uname, hdr.Gname = "", ""
+	return w.tw.WriteHeader(hdr)
+}
+
+// MaxReadFileSize is the largest file ReadFile will load into memory.
+// Use ReadFileStream for anything bigger.
+const MaxReadFileSize = 10 << 20 // 10MB
+
+// ErrFileTooLarge is returned by ReadFile for files over MaxReadFileSize
+var ErrFileTooLarge = errors.New("file too large to read into memory")
+
+// ReadFile reads a small file (up to MaxReadFileSize) from the container
 func (c *Client) ReadFile(ctx context.Context, containerName, path string) ([]byte, error) {
-	if err := c.ensureContainerRunning(ctx, containerName); err != nil {
+	tr, header, closeFn, err := c.openFile(ctx, containerName, path)
+	if err != nil {
 		return nil, err
 	}
+	defer closeFn()
+
+	if header.Size > MaxReadFileSize {
+		return nil, fmt.Errorf("%w: %d bytes, the limit is %d", ErrFileTooLarge, header.Size, MaxReadFileSize)
+	}
+	return io.ReadAll(tr)
+}
+
+// ReadFileStream copies a file from the container to w without buffering it in memory
+func (c *Client) ReadFileStream(ctx context.Context, containerName, path string, w io.Writer) error {
+	tr, _, closeFn, err := c.openFile(ctx, containerName, path)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	_, err = io.Copy(w, tr)
+	return err
+}
+
+// openFile positions a tar reader at the regular file at path. The caller must call closeFn.
+func (c *Client) openFile(ctx context.Context, containerName, path string) (*tar.Reader, *tar.Header, func() error, error) {
+	if err := c.ensureContainerRunning(ctx, containerName); err != nil {
+		return nil, nil, nil, err
+	}
 
 	c.logger.Info("Reading file", zap.String("container", containerName), zap.String("path", path))
 
 	// CopyFromContainer signature: ctx, container, path
 	reader, _, err := c.cli.CopyFromContainer(ctx, containerName, path)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
-	defer reader.Close()
 
+	// CopyFromContainer returns a tar stream; the first regular entry is the file
 	tr := tar.NewReader(reader)
-
-	// We expect the first entry to be the file (or the file itself if we asked for a file)
-	// CopyFromContainer returns a tar stream.
-
 	for {
 		header, err := tr.Next()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return nil, err
+			reader.Close()
+			return nil, nil, nil, err
 		}
 
 		if header.Typeflag == tar.TypeReg {
-			return io.ReadAll(tr)
+			return tr, header, reader.Close, nil
 		}
 	}
 
-	return nil, fmt.Errorf("file not found in tar stream")
+	reader.Close()
+	return nil, nil, nil, fmt.Errorf("file not found in tar stream")
 }
 
 // EnsureDirectory creates a directory in the container if it doesn't exist
@@ -448,83 +770,71 @@ func (c *Client) EnsureDirectory(ctx context.Context, containerName, path string
 type FileEntry struct {
 	Name    string `json:"name"`
 	Size    int64  `json:"size"`
-	Mode    string `json:"mode"`
+	Mode    uint32 `json:"mode"` // Unix st_mode, including file type bits
 	IsDir   bool   `json:"is_dir"`
-	ModTime string `json:"mod_time"` // output from ls --time-style=iso
+	ModTime string `json:"mod_time"` // RFC 3339, UTC
 }
 
+// st_mode file type bits (Linux), independent of the platform we're built for
+const (
+	modeTypeMask = 0170000
+	modeTypeDir  = 0040000
+)
+
+// listFilesScript prints one "<hex mode> <size> <mtime>\t<name>\0" record per
+// entry in $1. Records are NUL-terminated so names may contain any character,
+// and only POSIX sh and stat -c are needed, which busybox also provides.
+const listFilesScript = `cd -- "$1" || exit 1
+for f in * .[!.]* ..?*; do
+	[ -e "$f" ] || [ -L "$f" ] || continue
+	printf '%s\t%s\0' "$(stat -c '%f %s %Y' -- "$f")" "$f"
+done`
+
 // ListFiles lists files in a directory in the container
 func (c *Client) ListFiles(ctx context.Context, containerName, path string) ([]FileEntry, error) {
 	if err := c.ensureContainerRunning(ctx, containerName); err != nil {
 		return nil, err
 	}
 
-	// ls -l --time-style=long-iso
-	// output format: permissions links owner group size date time name
-	// but busybox ls might be different.
-	// Let's stick to standard `ls -l` and parse carefully, or `stat`.
-	// Ideally we run a small script to output JSON or CSV.
-	// "find . -maxdepth 1 -printf ..." is great but might not be available if minimal image.
-	// Let's use `ls -la`.
-
-	cmd := []string{"ls", "-la", "--time-style=long-iso", path}
-	output, exitCode, err := c.Execute(ctx, containerName, cmd, "/")
-	if err != nil || exitCode != 0 {
-		// Fallback to simpler ls if long-iso not supported?
-		// Ubuntu usually has it.
-		// If fails, try just ls -la
-		if exitCode != 0 {
-			cmd = []string{"ls", "-la", path}
-			output, exitCode, err = c.Execute(ctx, containerName, cmd, "/")
-		}
-	}
-
+	// Run without a TTY so the output isn't rewritten by terminal line handling
+	cmd := []string{"/bin/sh", "-c", listFilesScript, "sh", path}
+	stdout, stderr, exitCode, err := c.ExecuteSeparate(ctx, containerName, cmd, "/")
 	if err != nil {
 		return nil, err
 	}
 	if exitCode != 0 {
-		return nil, fmt.Errorf("ls failed: %s", output)
+		return nil, fmt.Errorf("listing %s failed: %s", path, strings.TrimSpace(stderr))
 	}
 
-	var entries []FileEntry
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "total") {
-			continue
-		}
+	return parseFileEntries(stdout)
+}
 
-		// Parsing is fragile.
-		// drwxr-xr-x 2 root root 4096 2024-01-01 12:00 .
-		fields := strings.Fields(line)
-		if len(fields) < 8 {
+// parseFileEntries parses the records printed by listFilesScript
+func parseFileEntries(output string) ([]FileEntry, error) {
+	entries := []FileEntry{}
+	for _, record := range strings.Split(output, "\x00") {
+		if record == "" {
 			continue
 		}
 
-		// Basic parsing
-		isDir := strings.HasPrefix(fields[0], "d")
-		name := strings.Join(fields[7:], " ") // Valid for long-iso which has date time
-		// If fallback ls -la (no --time-style), fields might differ.
-		// Let's refine:
-		// [perms] [links] [owner] [group] [size] [date] [time] [name...]
-
-		// Skip . and ..
-		if name == "." || name == ".." {
-			continue
+		meta, name, ok := strings.Cut(record, "\t")
+		if !ok {
+			return nil, fmt.Errorf("malformed file record: %q", record)
 		}
 
-		entry := FileEntry{
-			Name:    name,
-			Mode:    fields[0],
-			IsDir:   isDir,
-			ModTime: fmt.Sprintf("%s %s", fields[5], fields[6]),
+		var mode uint32
+		var size, mtime int64
+		if _, err := fmt.Sscanf(meta, "%x %d %d", &mode, &size, &mtime); err != nil {
+			return nil, fmt.Errorf("malformed file metadata %q: %w", meta, err)
 		}
 
-		// Parse size?
-		// fields[4] is usually size
-		fmt.Sscanf(fields[4], "%d", &entry.Size)
-
-		entries = append(entries, entry)
+		entries = append(entries, FileEntry{
+			Name:    name,
+			Size:    size,
+			Mode:    mode,
+			IsDir:   mode&modeTypeMask == modeTypeDir,
+			ModTime: time.Unix(mtime, 0).UTC().Format(time.RFC3339),
+		})
 	}
 
 	return entries, nil
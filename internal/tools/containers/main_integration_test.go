@@ -0,0 +1,257 @@
+//go:build integration
+
+package containers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// newTestContainer starts a throwaway container; run with `go test -tags integration`
+// against a reachable Docker daemon.
+func newTestContainer(t *testing.T) (*Client, string) {
+	t.Helper()
+
+	cli, err := NewClient("", zap.NewNop())
+	if err != nil {
+		t.Skipf("docker not available: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	name := fmt.Sprintf("llm-sandbox-test-%d", time.Now().UnixNano())
+	if _, err := cli.Manage(ctx, "start", name); err != nil {
+		cli.Close()
+		t.Skipf("failed to start container: %v", err)
+	}
+
+	t.Cleanup(func() {
+		cli.Manage(context.Background(), "remove", name)
+		cli.Close()
+	})
+	return cli, name
+}
+
+func TestListFiles(t *testing.T) {
+	cli, name := newTestContainer(t)
+	ctx := context.Background()
+
+	files := map[string]string{
+		"/work/plain.txt":         "hello",
+		"/work/with space.txt":    "spaced out",
+		"/work/ünïcødé 文件.txt":    "unicode",
+		"/work/.hidden":           "",
+		"/work/sub dir/inner.txt": "nested",
+	}
+	for path, content := range files {
+		if err := cli.EnsureDirectory(ctx, name, filepath.Dir(path)); err != nil {
+			t.Fatalf("failed to create parent of %s: %v", path, err)
+		}
+		if err := cli.WriteFile(ctx, name, path, []byte(content)); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+
+	entries, err := cli.ListFiles(ctx, name, "/work")
+	if err != nil {
+		t.Fatalf("ListFiles failed: %v", err)
+	}
+
+	byName := make(map[string]FileEntry)
+	for _, e := range entries {
+		byName[e.Name] = e
+	}
+
+	expected := map[string]struct {
+		size  int64
+		isDir bool
+	}{
+		"plain.txt":      {5, false},
+		"with space.txt": {10, false},
+		"ünïcødé 文件.txt": {7, false},
+		".hidden":        {0, false},
+		"sub dir":        {-1, true},
+	}
+	if len(entries) != len(expected) {
+		t.Errorf("expected %d entries, got %d: %+v", len(expected), len(entries), entries)
+	}
+
+	for fileName, want := range expected {
+		entry, ok := byName[fileName]
+		if !ok {
+			t.Errorf("missing entry %q", fileName)
+			continue
+		}
+		if entry.IsDir != want.isDir {
+			t.Errorf("%q: expected is_dir %v, got %v", fileName, want.isDir, entry.IsDir)
+		}
+		if want.size >= 0 && entry.Size != want.size {
+			t.Errorf("%q: expected size %d, got %d", fileName, want.size, entry.Size)
+		}
+		if entry.Mode == 0 {
+			t.Errorf("%q: expected a mode", fileName)
+		}
+		if _, err := time.Parse(time.RFC3339, entry.ModTime); err != nil {
+			t.Errorf("%q: expected RFC 3339 mod time, got %q", fileName, entry.ModTime)
+		}
+	}
+}
+
+func TestPool(t *testing.T) {
+	cli, err := NewClient("", zap.NewNop())
+	if err != nil {
+		t.Skipf("docker not available: %v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	pool := NewPool(cli, 1, "/work")
+	defer pool.Close()
+	if err := pool.Warm(ctx); err != nil {
+		t.Skipf("failed to warm pool: %v", err)
+	}
+	if n := pool.Idle(); n != 1 {
+		t.Fatalf("expected 1 idle container, got %d", n)
+	}
+
+	pc, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	if n := pool.Idle(); n != 0 {
+		t.Errorf("expected no idle containers after Acquire, got %d", n)
+	}
+	if err := cli.WriteFile(ctx, pc.Name, "/work/leftover.txt", []byte("x")); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if err := pool.Release(ctx, pc); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+
+	again, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("second Acquire failed: %v", err)
+	}
+	defer pool.Release(ctx, again)
+	if again.Name != pc.Name {
+		t.Errorf("expected the released container %s to be reused, got %s", pc.Name, again.Name)
+	}
+
+	entries, err := cli.ListFiles(ctx, again.Name, "/work")
+	if err != nil {
+		t.Fatalf("ListFiles failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected working dir to be cleared on release, got %+v", entries)
+	}
+}
+
+func TestExecuteWithInput(t *testing.T) {
+	cli, name := newTestContainer(t)
+	ctx := context.Background()
+
+	output, exitCode, err := cli.ExecuteWithInput(ctx, name, []string{"/bin/sh", "-c", "wc -l; exit 3"}, "/", strings.NewReader("one\ntwo\nthree\n"))
+	if err != nil {
+		t.Fatalf("ExecuteWithInput failed: %v", err)
+	}
+	if strings.TrimSpace(output) != "3" {
+		t.Errorf("expected 3 lines counted, got %q", output)
+	}
+	if exitCode != 3 {
+		t.Errorf("expected exit code 3, got %d", exitCode)
+	}
+}
+
+func TestExecuteSeparate(t *testing.T) {
+	cli, name := newTestContainer(t)
+
+	stdout, stderr, exitCode, err := cli.ExecuteSeparate(context.Background(), name, []string{"/bin/sh", "-c", "echo out; echo err >&2; exit 4"}, "/")
+	if err != nil {
+		t.Fatalf("ExecuteSeparate failed: %v", err)
+	}
+	if strings.TrimSpace(stdout) != "out" {
+		t.Errorf("expected stdout %q, got %q", "out", stdout)
+	}
+	if strings.TrimSpace(stderr) != "err" {
+		t.Errorf("expected stderr %q, got %q", "err", stderr)
+	}
+	if exitCode != 4 {
+		t.Errorf("expected exit code 4, got %d", exitCode)
+	}
+}
+
+func TestExecuteStream(t *testing.T) {
+	cli, name := newTestContainer(t)
+
+	var out strings.Builder
+	exitCode, err := cli.ExecuteStream(context.Background(), name, []string{"/bin/sh", "-c", "echo streamed; exit 7"}, "/", &out)
+	if err != nil {
+		t.Fatalf("ExecuteStream failed: %v", err)
+	}
+	if strings.TrimSpace(out.String()) != "streamed" {
+		t.Errorf("expected streamed output, got %q", out.String())
+	}
+	if exitCode != 7 {
+		t.Errorf("expected exit code 7, got %d", exitCode)
+	}
+}
+
+// waitForExit polls the container's processes until none has marker in its
+// command line, reporting whether that happened before the deadline
+func waitForExit(t *testing.T, cli *Client, name, marker string) bool {
+	t.Helper()
+	// The bracket keeps grep from matching its own command line
+	pattern := "[" + marker[:1] + "]" + marker[1:]
+	script := `for p in /proc/[0-9]*; do tr '\0' ' ' < "$p/cmdline" 2>/dev/null; echo; done | grep -c "$0"`
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		output, _, err := cli.Execute(context.Background(), name, []string{"/bin/sh", "-c", script, pattern}, "/")
+		if err != nil {
+			t.Fatalf("listing processes failed: %v", err)
+		}
+		if strings.TrimSpace(output) == "0" {
+			return true
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return false
+}
+
+func TestExecuteKillsCommand(t *testing.T) {
+	cli, name := newTestContainer(t)
+
+	t.Run("Timeout", func(t *testing.T) {
+		_, _, err := cli.ExecuteWithTimeout(context.Background(), name, []string{"sleep", "1234"}, "/", time.Second)
+		if !errors.Is(err, ErrExecTimeout) {
+			t.Fatalf("expected ErrExecTimeout, got %v", err)
+		}
+		if !waitForExit(t, cli, name, "sleep 1234") {
+			t.Error("expected the timed out command to be killed")
+		}
+	})
+
+	t.Run("Cancelled Context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		_, _, err := cli.Execute(ctx, name, []string{"sleep", "4321"}, "/")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the context error, got %v", err)
+		}
+		if !waitForExit(t, cli, name, "sleep 4321") {
+			t.Error("expected the cancelled command to be killed")
+		}
+	})
+}
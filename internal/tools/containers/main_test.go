@@ -0,0 +1,117 @@
+package containers
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDirTarWriter(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "src")
+	outside := filepath.Join(tmp, "outside")
+
+	for _, dir := range []string{filepath.Join(root, "a", "b"), filepath.Join(root, "empty"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]os.FileMode{
+		filepath.Join(root, "a", "b", "c.txt"): 0640,
+		filepath.Join(root, "run.sh"):          0755,
+		filepath.Join(outside, "secret.txt"):   0600,
+	}
+	for name, mode := range files {
+		if err := os.WriteFile(name, []byte(filepath.Base(name)), mode); err != nil {
+			t.Fatal(err)
+		}
+		os.Chmod(name, mode) // Not subject to the umask
+	}
+	links := map[string]string{
+		"link":     "run.sh",
+		"loop":     ".",
+		"escape":   filepath.Join("..", "outside"),
+		"dangling": "missing",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	archive := func(t *testing.T, followSymlinks bool) map[string]*tar.Header {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		w := &dirTarWriter{tw: tw, followSymlinks: followSymlinks, visited: make(map[string]bool)}
+		if err := w.addDir(root, ""); err != nil {
+			t.Fatalf("addDir failed: %v", err)
+		}
+		tw.Close()
+
+		headers := make(map[string]*tar.Header)
+		tr := tar.NewReader(&buf)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("reading archive: %v", err)
+			}
+			content, _ := io.ReadAll(tr)
+			if hdr.Typeflag == tar.TypeReg && string(content) != path.Base(hdr.Name) && hdr.Name != "link" {
+				t.Errorf("%s: unexpected content %q", hdr.Name, content)
+			}
+			headers[hdr.Name] = hdr
+		}
+		return headers
+	}
+
+	tests := []struct {
+		name           string
+		followSymlinks bool
+		want           []string
+	}{
+		{"Symlinks Skipped", false, []string{"a/", "a/b/", "a/b/c.txt", "empty/", "run.sh"}},
+		{"Symlinks Followed", true, []string{"a/", "a/b/", "a/b/c.txt", "empty/", "escape/", "escape/secret.txt", "link", "run.sh"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := archive(t, tt.followSymlinks)
+
+			var names []string
+			for name, hdr := range headers {
+				names = append(names, name)
+				// Every entry stays inside the destination, even through a link out of the tree
+				clean := strings.TrimSuffix(name, "/")
+				if path.IsAbs(name) || path.Clean(clean) != clean || strings.HasPrefix(clean, "..") {
+					t.Errorf("entry %q escapes the destination", name)
+				}
+				if hdr.Uid != 0 || hdr.Gid != 0 {
+					t.Errorf("%s: expected root ownership, got %d:%d", name, hdr.Uid, hdr.Gid)
+				}
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("entries = %v, want %v", names, tt.want)
+			}
+
+			if hdr := headers["a/b/c.txt"]; hdr == nil || os.FileMode(hdr.Mode).Perm() != 0640 {
+				t.Errorf("expected a/b/c.txt to keep mode 0640, got %+v", hdr)
+			}
+			if hdr := headers["run.sh"]; hdr == nil || os.FileMode(hdr.Mode).Perm() != 0755 {
+				t.Errorf("expected run.sh to keep mode 0755, got %+v", hdr)
+			}
+			if hdr := headers["a/b/"]; hdr == nil || hdr.Typeflag != tar.TypeDir {
+				t.Errorf("expected a/b/ to be a directory entry, got %+v", hdr)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package containers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// poolContainerPrefix names containers owned by a Pool so they are easy to spot and clean up
+	poolContainerPrefix = "llm-pool-"
+	// poolRemoveTimeout bounds removing a container that is leaving the pool
+	poolRemoveTimeout = 30 * time.Second
+)
+
+// ErrPoolClosed is returned by Acquire after the pool has been closed
+var ErrPoolClosed = errors.New("container pool is closed")
+
+// Pool keeps a set of idle, already-running containers so sessions don't pay
+// the create+start latency. Containers are handed out with Acquire and given
+// back with Release, which clears the working directory before reuse.
+type Pool struct {
+	client  *Client
+	size    int
+	workDir string
+
+	mu     sync.Mutex
+	idle   []*PooledContainer
+	closed bool
+}
+
+// PooledContainer is a container checked out of a Pool
+type PooledContainer struct {
+	Name    string
+	WorkDir string
+}
+
+// NewPool creates a pool that keeps up to size idle containers from the client's
+// configured image. Call Warm to start them ahead of the first Acquire.
+func NewPool(client *Client, size int, workDir string) *Pool {
+	if size < 0 {
+		size = 0
+	}
+	return &Pool{
+		client:  client,
+		size:    size,
+		workDir: workDir,
+	}
+}
+
+// Warm starts containers until the pool holds size idle ones
+func (p *Pool) Warm(ctx context.Context) error {
+	p.mu.Lock()
+	missing := p.size - len(p.idle)
+	p.mu.Unlock()
+	if missing <= 0 {
+		return nil
+	}
+
+	p.client.logger.Info("Warming container pool", zap.Int("count", missing))
+
+	var wg sync.WaitGroup
+	errs := make([]error, missing)
+	for i := 0; i < missing; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pc, err := p.startContainer(ctx)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if !p.putIdle(pc) {
+				p.remove(pc)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// Acquire returns an idle container, or starts a new one if none are idle.
+// The caller must Release it when the session ends.
+func (p *Pool) Acquire(ctx context.Context) (*PooledContainer, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+	if n := len(p.idle); n > 0 {
+		pc := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return pc, nil
+	}
+	p.mu.Unlock()
+
+	p.client.logger.Info("Container pool empty, starting a cold container")
+	return p.startContainer(ctx)
+}
+
+// Release resets the container's working directory and returns it to the pool.
+// Containers that fail to reset, or that don't fit in the pool, are removed.
+func (p *Pool) Release(ctx context.Context, pc *PooledContainer) error {
+	if err := p.reset(ctx, pc); err != nil {
+		p.remove(pc)
+		return fmt.Errorf("failed to reset pooled container: %w", err)
+	}
+
+	if !p.putIdle(pc) {
+		p.remove(pc)
+	}
+	return nil
+}
+
+// Close removes all idle containers. Containers still checked out are removed
+// when they are released.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.closed = true
+	p.mu.Unlock()
+
+	for _, pc := range idle {
+		p.remove(pc)
+	}
+	return nil
+}
+
+// Idle returns the number of idle containers in the pool
+func (p *Pool) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle)
+}
+
+// putIdle adds pc to the idle list, reporting false if the pool is closed or full
+func (p *Pool) putIdle(pc *PooledContainer) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed || len(p.idle) >= p.size {
+		return false
+	}
+	p.idle = append(p.idle, pc)
+	return true
+}
+
+func (p *Pool) startContainer(ctx context.Context) (*PooledContainer, error) {
+	name := poolContainerPrefix + uuid.New().String()
+
+	if _, err := p.client.createContainer(ctx, name); err != nil {
+		return nil, err
+	}
+	if _, err := p.client.startContainer(ctx, name); err != nil {
+		p.remove(&PooledContainer{Name: name})
+		return nil, err
+	}
+
+	pc := &PooledContainer{Name: name, WorkDir: p.workDir}
+	if err := p.reset(ctx, pc); err != nil {
+		p.remove(pc)
+		return nil, fmt.Errorf("failed to prepare pooled container: %w", err)
+	}
+	return pc, nil
+}
+
+// reset empties the working directory, recreating it if needed
+func (p *Pool) reset(ctx context.Context, pc *PooledContainer) error {
+	if p.workDir == "" {
+		return nil
+	}
+
+	_, stderr, exitCode, err := p.client.ExecuteSeparate(ctx, pc.Name, []string{
+		"/bin/sh", "-c", `rm -rf -- "$0" && mkdir -p -- "$0"`, p.workDir,
+	}, "/")
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("reset exited with code %d: %s", exitCode, stderr)
+	}
+	return nil
+}
+
+// remove deletes a pooled container, using a fresh context since the caller's may be done
+func (p *Pool) remove(pc *PooledContainer) {
+	ctx, cancel := context.WithTimeout(context.Background(), poolRemoveTimeout)
+	defer cancel()
+
+	if _, err := p.client.removeContainer(ctx, pc.Name); err != nil {
+		p.client.logger.Error("Failed to remove pooled container", zap.String("container", pc.Name), zap.Error(err))
+	}
+}
@@ -1,12 +1,17 @@
 package exa
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
+
+	"llm-router/internal/tools/httputil"
 )
 
 const (
@@ -16,15 +21,32 @@ const (
 type Client struct {
 	APIKey     string
 	HTTPClient *http.Client
+	Retrier    *httputil.Retrier
 }
 
 func NewClient(apiKey string) *Client {
+	return NewClientWithRetries(apiKey, httputil.DefaultMaxAttempts)
+}
+
+// NewClientWithRetries creates a client that makes up to maxAttempts attempts on 429/5xx responses
+func NewClientWithRetries(apiKey string, maxAttempts int) *Client {
 	return &Client{
 		APIKey: apiKey,
 		HTTPClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		Retrier: httputil.NewRetrier(maxAttempts),
+	}
+}
+
+// do sends a request, retrying if the client has a Retrier.
+// Exa's endpoints are read-only, so every request is safe to retry.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.Retrier == nil {
+		return c.HTTPClient.Do(req)
 	}
+	httputil.MarkIdempotent(req)
+	return c.Retrier.Do(c.HTTPClient, req)
 }
 
 type SearchRequest struct {
@@ -43,6 +65,7 @@ type SearchRequest struct {
 	IncludeText        []string               `json:"includeText,omitempty"`
 	ExcludeText        []string               `json:"excludeText,omitempty"`
 	Contents           map[string]interface{} `json:"contents,omitempty"`
+	Stream             bool                   `json:"stream,omitempty"` // Set by SearchStream
 }
 
 type FindSimilarRequest struct {
@@ -58,6 +81,12 @@ type GetContentsRequest struct {
 	Subpages int                    `json:"subpages,omitempty"`
 }
 
+type AnswerRequest struct {
+	Query string `json:"query"`
+	Text  bool   `json:"text,omitempty"`  // Include the full text of each citation
+	Model string `json:"model,omitempty"` // e.g. "exa" or "exa-pro"
+}
+
 type Result struct {
 	ID            string   `json:"id"`
 	URL           string   `json:"url"`
@@ -88,7 +117,13 @@ type GetContentsResponse struct {
 	Results   []Result `json:"results"`
 }
 
-func (c *Client) doRequest(method, path string, body interface{}, response interface{}) error {
+type AnswerResponse struct {
+	RequestID string   `json:"requestId,omitempty"`
+	Answer    string   `json:"answer"`
+	Citations []Result `json:"citations"`
+}
+
+func (c *Client) doRequest(ctx context.Context, method, path string, body interface{}, response interface{}) error {
 	var reqBody io.Reader
 	if body != nil {
 		jsonData, err := json.Marshal(body)
@@ -98,7 +133,7 @@ func (c *Client) doRequest(method, path string, body interface{}, response inter
 		reqBody = bytes.NewReader(jsonData)
 	}
 
-	req, err := http.NewRequest(method, baseURL+path, reqBody)
+	req, err := http.NewRequestWithContext(ctx, method, baseURL+path, reqBody)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -106,7 +141,7 @@ func (c *Client) doRequest(method, path string, body interface{}, response inter
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("x-api-key", c.APIKey)
 
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
@@ -126,26 +161,166 @@ func (c *Client) doRequest(method, path string, body interface{}, response inter
 	return nil
 }
 
-func (c *Client) Search(req SearchRequest) (*SearchResponse, error) {
+func (c *Client) SearchContext(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
 	var resp SearchResponse
-	if err := c.doRequest("POST", "/search", req, &resp); err != nil {
+	if err := c.doRequest(ctx, "POST", "/search", req, &resp); err != nil {
 		return nil, err
 	}
 	return &resp, nil
 }
 
-func (c *Client) FindSimilar(req FindSimilarRequest) (*FindSimilarResponse, error) {
+// Search is like SearchContext but uses context.Background()
+func (c *Client) Search(req SearchRequest) (*SearchResponse, error) {
+	return c.SearchContext(context.Background(), req)
+}
+
+// SearchStreamContext runs a search with streaming requested and invokes cb
+// for each result as soon as it has been decoded, instead of waiting for the
+// whole response body. Server-sent event responses are handled one event at a
+// time; a server that doesn't stream answers with plain JSON, which is decoded
+// incrementally from the "results" array.
+func (c *Client) SearchStreamContext(ctx context.Context, req SearchRequest, cb func(Result)) error {
+	req.Stream = true
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/search", bytes.NewReader(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream, application/json")
+	httpReq.Header.Set("x-api-key", c.APIKey)
+
+	resp, err := c.do(httpReq)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return decodeResultEvents(resp.Body, cb)
+	}
+	return decodeResultArray(resp.Body, cb)
+}
+
+// SearchStream is like SearchStreamContext but uses context.Background()
+func (c *Client) SearchStream(req SearchRequest, cb func(Result)) error {
+	return c.SearchStreamContext(context.Background(), req, cb)
+}
+
+// decodeResultEvents reads SSE "data:" lines, each carrying a single result
+func decodeResultEvents(body io.Reader, cb func(Result)) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+
+		var result Result
+		if err := json.Unmarshal([]byte(data), &result); err != nil {
+			return fmt.Errorf("failed to decode streamed result: %w", err)
+		}
+		cb(result)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	return nil
+}
+
+// decodeResultArray walks a SearchResponse body token by token, handing each
+// element of "results" to cb as soon as it is complete
+func decodeResultArray(body io.Reader, cb func(Result)) error {
+	dec := json.NewDecoder(body)
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return fmt.Errorf("failed to decode response: expected object")
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+
+		if key, _ := tok.(string); key != "results" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fmt.Errorf("failed to decode response: %w", err)
+			}
+			continue
+		}
+
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return fmt.Errorf("failed to decode response: expected results array")
+		}
+		for dec.More() {
+			var result Result
+			if err := dec.Decode(&result); err != nil {
+				return fmt.Errorf("failed to decode result: %w", err)
+			}
+			cb(result)
+		}
+		if _, err := dec.Token(); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) FindSimilarContext(ctx context.Context, req FindSimilarRequest) (*FindSimilarResponse, error) {
 	var resp FindSimilarResponse
-	if err := c.doRequest("POST", "/findSimilar", req, &resp); err != nil {
+	if err := c.doRequest(ctx, "POST", "/findSimilar", req, &resp); err != nil {
 		return nil, err
 	}
 	return &resp, nil
 }
 
-func (c *Client) GetContents(req GetContentsRequest) (*GetContentsResponse, error) {
+// FindSimilar is like FindSimilarContext but uses context.Background()
+func (c *Client) FindSimilar(req FindSimilarRequest) (*FindSimilarResponse, error) {
+	return c.FindSimilarContext(context.Background(), req)
+}
+
+func (c *Client) GetContentsContext(ctx context.Context, req GetContentsRequest) (*GetContentsResponse, error) {
 	var resp GetContentsResponse
-	if err := c.doRequest("POST", "/contents", req, &resp); err != nil {
+	if err := c.doRequest(ctx, "POST", "/contents", req, &resp); err != nil {
 		return nil, err
 	}
 	return &resp, nil
 }
+
+// GetContents is like GetContentsContext but uses context.Background()
+func (c *Client) GetContents(req GetContentsRequest) (*GetContentsResponse, error) {
+	return c.GetContentsContext(context.Background(), req)
+}
+
+func (c *Client) AnswerContext(ctx context.Context, req AnswerRequest) (*AnswerResponse, error) {
+	var resp AnswerResponse
+	if err := c.doRequest(ctx, "POST", "/answer", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Answer is like AnswerContext but uses context.Background()
+func (c *Client) Answer(req AnswerRequest) (*AnswerResponse, error) {
+	return c.AnswerContext(context.Background(), req)
+}
@@ -0,0 +1,96 @@
+package exa
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// fakeTransport answers every request with a fixed body and content type,
+// recording the last request body
+type fakeTransport struct {
+	contentType string
+	body        string
+	status      int
+	sent        []byte
+}
+
+func (t *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.sent, _ = io.ReadAll(req.Body)
+	status := t.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{t.contentType}},
+		Body:       io.NopCloser(strings.NewReader(t.body)),
+		Request:    req,
+	}, nil
+}
+
+func TestSearchStream(t *testing.T) {
+	search := func(t *testing.T, transport *fakeTransport) ([]string, error) {
+		client := NewClientWithRetries("test-key", 1)
+		client.HTTPClient.Transport = transport
+
+		var urls []string
+		err := client.SearchStream(SearchRequest{Query: "go"}, func(r Result) {
+			urls = append(urls, r.URL)
+		})
+
+		var sent map[string]interface{}
+		if jsonErr := json.Unmarshal(transport.sent, &sent); jsonErr != nil || sent["stream"] != true {
+			t.Errorf("expected the request to ask for streaming, got %s", transport.sent)
+		}
+		return urls, err
+	}
+
+	t.Run("Event Stream", func(t *testing.T) {
+		urls, err := search(t, &fakeTransport{
+			contentType: "text/event-stream",
+			body:        "data: {\"url\":\"https://a\"}\n\n: keepalive\n\ndata: {\"url\":\"https://b\"}\n\ndata: [DONE]\n\n",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if strings.Join(urls, ",") != "https://a,https://b" {
+			t.Errorf("expected both results in order, got %v", urls)
+		}
+	})
+
+	t.Run("Buffered Fallback", func(t *testing.T) {
+		urls, err := search(t, &fakeTransport{
+			contentType: "application/json",
+			body:        `{"requestId":"r1","results":[{"url":"https://a","highlights":["x"]},{"url":"https://b"}],"searchType":"neural"}`,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if strings.Join(urls, ",") != "https://a,https://b" {
+			t.Errorf("expected both results in order, got %v", urls)
+		}
+	})
+
+	t.Run("API Error", func(t *testing.T) {
+		_, err := search(t, &fakeTransport{status: http.StatusUnauthorized, body: "bad key"})
+		if err == nil || !strings.Contains(err.Error(), "status 401") {
+			t.Errorf("expected the API error, got %v", err)
+		}
+	})
+
+	t.Run("Malformed Event", func(t *testing.T) {
+		urls, err := search(t, &fakeTransport{
+			contentType: "text/event-stream",
+			body:        "data: {\"url\":\"https://a\"}\n\ndata: {broken\n\n",
+		})
+		if err == nil {
+			t.Error("expected an error for the malformed event")
+		}
+		if len(urls) != 1 {
+			t.Errorf("expected the result before the malformed event, got %v", urls)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package geo
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// responseCache is a size-bounded LRU cache of geocoding responses with a fixed TTL
+type responseCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key       string
+	value     GeocodeResponse
+	expiresAt time.Time
+}
+
+func newResponseCache(size int, ttl time.Duration) *responseCache {
+	return &responseCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns a copy of the cached response, or nil if it is missing or expired
+func (c *responseCache) get(key string) *GeocodeResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil
+	}
+
+	c.order.MoveToFront(elem)
+	value := entry.value
+	return &value
+}
+
+// set stores a response, evicting the least recently used entry when full
+func (c *responseCache) set(key string, value *GeocodeResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.value = *value
+		entry.expiresAt = time.Now().Add(c.ttl)
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{
+		key:       key,
+		value:     *value,
+		expiresAt: time.Now().Add(c.ttl),
+	})
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
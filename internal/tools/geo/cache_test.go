@@ -0,0 +1,102 @@
+package geo
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingTransport struct {
+	calls atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls.Add(1)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"type":"FeatureCollection","features":[{"type":"Feature","properties":{"name":"London"}}]}`)),
+		Request:    req,
+	}, nil
+}
+
+func TestGeocodeSearchCache(t *testing.T) {
+	transport := &countingTransport{}
+	client := NewClientWithCache("test-key", 10, time.Minute)
+	client.HTTPClient.Transport = transport
+
+	req := GeocodeSearchRequest{Text: "London", Lang: "en"}
+	first, err := client.GeocodeSearch(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := client.GeocodeSearch(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if calls := transport.calls.Load(); calls != 1 {
+		t.Errorf("expected 1 HTTP call, got %d", calls)
+	}
+	if len(second.Features) != 1 || second.Features[0].Properties["name"] != first.Features[0].Properties["name"] {
+		t.Errorf("expected cached response to match, got %+v", second)
+	}
+
+	// A different filter is a different request
+	client.GeocodeSearch(GeocodeSearchRequest{Text: "London", Lang: "en", Filter: "countrycode:gb"})
+	if calls := transport.calls.Load(); calls != 2 {
+		t.Errorf("expected 2 HTTP calls, got %d", calls)
+	}
+
+	// Reverse geocoding is cached as well
+	client.GeocodeReverse(GeocodeReverseRequest{Lat: 51.5, Lon: -0.12})
+	client.GeocodeReverse(GeocodeReverseRequest{Lat: 51.5, Lon: -0.12})
+	if calls := transport.calls.Load(); calls != 3 {
+		t.Errorf("expected 3 HTTP calls, got %d", calls)
+	}
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	cache := newResponseCache(2, time.Minute)
+	cache.set("a", &GeocodeResponse{Type: "a"})
+	cache.set("b", &GeocodeResponse{Type: "b"})
+	cache.get("a") // a is now most recently used
+	cache.set("c", &GeocodeResponse{Type: "c"})
+
+	if cache.get("b") != nil {
+		t.Error("expected least recently used entry to be evicted")
+	}
+	if cache.get("a") == nil || cache.get("c") == nil {
+		t.Error("expected recent entries to be kept")
+	}
+
+	expiring := newResponseCache(2, time.Millisecond)
+	expiring.set("a", &GeocodeResponse{Type: "a"})
+	time.Sleep(5 * time.Millisecond)
+	if expiring.get("a") != nil {
+		t.Error("expected expired entry to be dropped")
+	}
+}
+
+func TestResponseCacheConcurrent(t *testing.T) {
+	cache := newResponseCache(8, time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := string(rune('a' + i%10))
+			cache.set(key, &GeocodeResponse{Type: key})
+			cache.get(key)
+		}(i)
+	}
+	wg.Wait()
+
+	if cache.order.Len() > 8 {
+		t.Errorf("expected at most 8 entries, got %d", cache.order.Len())
+	}
+}
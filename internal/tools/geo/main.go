@@ -1,6 +1,8 @@
 package geo
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -8,6 +10,8 @@ import (
 	"net/url"
 	"strings"
 	"time"
+
+	"llm-router/internal/tools/httputil"
 )
 
 const (
@@ -17,15 +21,57 @@ const (
 type Client struct {
 	APIKey     string
 	HTTPClient *http.Client
+	Retrier    *httputil.Retrier
+
+	// BatchPollInterval and BatchPollTimeout control how batch jobs are awaited
+	BatchPollInterval time.Duration
+	BatchPollTimeout  time.Duration
+
+	cache *responseCache // nil disables caching
 }
 
 func NewClient(apiKey string) *Client {
+	return NewClientWithRetries(apiKey, httputil.DefaultMaxAttempts)
+}
+
+// NewClientWithRetries creates a client that makes up to maxAttempts attempts on 429/5xx responses
+func NewClientWithRetries(apiKey string, maxAttempts int) *Client {
 	return &Client{
 		APIKey: apiKey,
 		HTTPClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		Retrier:           httputil.NewRetrier(maxAttempts),
+		BatchPollInterval: 2 * time.Second,
+		BatchPollTimeout:  5 * time.Minute,
+	}
+}
+
+// NewClientWithCache creates a client that caches up to size geocoding responses for ttl
+func NewClientWithCache(apiKey string, size int, ttl time.Duration) *Client {
+	c := NewClient(apiKey)
+	if size > 0 && ttl > 0 {
+		c.cache = newResponseCache(size, ttl)
+	}
+	return c
+}
+
+// do sends a request, retrying idempotent ones if the client has a Retrier
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.Retrier == nil {
+		return c.HTTPClient.Do(req)
 	}
+	return c.Retrier.Do(c.HTTPClient, req)
+}
+
+// WithTimeout returns a copy of the client that uses a different request timeout.
+// The copy shares the original's cache.
+func (c *Client) WithTimeout(timeout time.Duration) *Client {
+	clone := *c
+	httpClient := *c.HTTPClient
+	httpClient.Timeout = timeout
+	clone.HTTPClient = &httpClient
+	return &clone
 }
 
 // GeocodeSearchRequest represents a forward geocoding request
@@ -91,6 +137,64 @@ type RoutingResponse struct {
 	Properties map[string]interface{} `json:"properties,omitempty"`
 }
 
+// IsolineRequest represents a request for reachability areas (isochrones/isodistances)
+type IsolineRequest struct {
+	Lat   float64 `json:"lat"`
+	Lon   float64 `json:"lon"`
+	Type  string  `json:"type"`           // time (seconds) or distance (meters)
+	Mode  string  `json:"mode,omitempty"` // drive, truck, bicycle, walk, etc.
+	Range []int   `json:"range"`          // One polygon is returned per range value
+}
+
+// IsolineResponse represents the response from isoline endpoint
+type IsolineResponse struct {
+	Type       string                 `json:"type"`
+	Features   []Feature              `json:"features"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// MatrixRequest represents a many-to-many routing request
+type MatrixRequest struct {
+	Sources []Waypoint `json:"sources"`
+	Targets []Waypoint `json:"targets"`
+	Mode    string     `json:"mode,omitempty"` // drive, truck, bicycle, walk, etc.
+}
+
+// MatrixCell holds the travel distance (meters) and time (seconds) between a source and a target.
+// Distance and Time are nil when the target is unreachable from the source.
+type MatrixCell struct {
+	Distance    *float64 `json:"distance"`
+	Time        *float64 `json:"time"`
+	SourceIndex int      `json:"source_index"`
+	TargetIndex int      `json:"target_index"`
+}
+
+// MatrixResponse represents the response from routematrix endpoint.
+// SourcesToTargets is indexed [source][target]; a nil cell means no route was found.
+type MatrixResponse struct {
+	Mode             string          `json:"mode"`
+	Units            string          `json:"units,omitempty"`
+	SourcesToTargets [][]*MatrixCell `json:"sources_to_targets"`
+}
+
+// matrixLocation is the request body shape Geoapify expects for matrix points
+type matrixLocation struct {
+	Location [2]float64 `json:"location"` // lon, lat
+}
+
+// BatchGeocodeResult pairs an input address with its geocoding result
+type BatchGeocodeResult struct {
+	Address string                 `json:"address"`
+	Result  map[string]interface{} `json:"result,omitempty"` // nil if the address could not be geocoded
+}
+
+// batchJob represents a pending Geoapify batch job
+type batchJob struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	URL    string `json:"url"`
+}
+
 // PlacesRequest represents a request for nearby places
 type PlacesRequest struct {
 	Categories []string `json:"categories,omitempty"` // e.g., "commercial.supermarket", "catering.restaurant"
@@ -107,7 +211,7 @@ type PlacesResponse struct {
 	Features []Feature `json:"features"`
 }
 
-func (c *Client) doRequest(method, path string, params url.Values, response interface{}) error {
+func (c *Client) doRequest(ctx context.Context, method, path string, params url.Values, response interface{}) error {
 	// Add API key to params
 	if params == nil {
 		params = url.Values{}
@@ -116,12 +220,12 @@ func (c *Client) doRequest(method, path string, params url.Values, response inte
 
 	fullURL := baseURL + path + "?" + params.Encode()
 
-	req, err := http.NewRequest(method, fullURL, nil)
+	req, err := http.NewRequestWithContext(ctx, method, fullURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
@@ -141,8 +245,32 @@ func (c *Client) doRequest(method, path string, params url.Values, response inte
 	return nil
 }
 
-// GeocodeSearch performs forward geocoding (address to coordinates)
+// GeocodeSearchContext performs forward geocoding (address to coordinates)
+func (c *Client) GeocodeSearchContext(ctx context.Context, req GeocodeSearchRequest) (*GeocodeResponse, error) {
+	return c.cachedGeocode(ctx, "/geocode/search", geocodeSearchParams(req))
+}
+
+// GeocodeSearch is like GeocodeSearchContext but uses context.Background()
 func (c *Client) GeocodeSearch(req GeocodeSearchRequest) (*GeocodeResponse, error) {
+	return c.GeocodeSearchContext(context.Background(), req)
+}
+
+// GeocodeAutocompleteContext returns type-ahead suggestions for partially entered addresses
+func (c *Client) GeocodeAutocompleteContext(ctx context.Context, req GeocodeSearchRequest) (*GeocodeResponse, error) {
+	var resp GeocodeResponse
+	if err := c.doRequest(ctx, "GET", "/geocode/autocomplete", geocodeSearchParams(req), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GeocodeAutocomplete is like GeocodeAutocompleteContext but uses context.Background()
+func (c *Client) GeocodeAutocomplete(req GeocodeSearchRequest) (*GeocodeResponse, error) {
+	return c.GeocodeAutocompleteContext(context.Background(), req)
+}
+
+// geocodeSearchParams builds the query parameters shared by search and autocomplete
+func geocodeSearchParams(req GeocodeSearchRequest) url.Values {
 	params := url.Values{}
 	params.Set("text", req.Text)
 	if req.Lang != "" {
@@ -157,16 +285,11 @@ func (c *Client) GeocodeSearch(req GeocodeSearchRequest) (*GeocodeResponse, erro
 	if req.Bias != "" {
 		params.Set("bias", req.Bias)
 	}
-
-	var resp GeocodeResponse
-	if err := c.doRequest("GET", "/geocode/search", params, &resp); err != nil {
-		return nil, err
-	}
-	return &resp, nil
+	return params
 }
 
-// GeocodeReverse performs reverse geocoding (coordinates to address)
-func (c *Client) GeocodeReverse(req GeocodeReverseRequest) (*GeocodeResponse, error) {
+// GeocodeReverseContext performs reverse geocoding (coordinates to address)
+func (c *Client) GeocodeReverseContext(ctx context.Context, req GeocodeReverseRequest) (*GeocodeResponse, error) {
 	params := url.Values{}
 	params.Set("lat", fmt.Sprintf("%f", req.Lat))
 	params.Set("lon", fmt.Sprintf("%f", req.Lon))
@@ -177,15 +300,37 @@ func (c *Client) GeocodeReverse(req GeocodeReverseRequest) (*GeocodeResponse, er
 		params.Set("type", req.Type)
 	}
 
+	return c.cachedGeocode(ctx, "/geocode/reverse", params)
+}
+
+// GeocodeReverse is like GeocodeReverseContext but uses context.Background()
+func (c *Client) GeocodeReverse(req GeocodeReverseRequest) (*GeocodeResponse, error) {
+	return c.GeocodeReverseContext(context.Background(), req)
+}
+
+// cachedGeocode serves a geocoding request from the cache when possible.
+// The key is the path plus the encoded query, so every request parameter is part of it.
+func (c *Client) cachedGeocode(ctx context.Context, path string, params url.Values) (*GeocodeResponse, error) {
+	key := path + "?" + params.Encode()
+	if c.cache != nil {
+		if cached := c.cache.get(key); cached != nil {
+			return cached, nil
+		}
+	}
+
 	var resp GeocodeResponse
-	if err := c.doRequest("GET", "/geocode/reverse", params, &resp); err != nil {
+	if err := c.doRequest(ctx, "GET", path, params, &resp); err != nil {
 		return nil, err
 	}
+
+	if c.cache != nil {
+		c.cache.set(key, &resp)
+	}
 	return &resp, nil
 }
 
-// Routing calculates a route between waypoints
-func (c *Client) Routing(req RoutingRequest) (*RoutingResponse, error) {
+// RoutingContext calculates a route between waypoints
+func (c *Client) RoutingContext(ctx context.Context, req RoutingRequest) (*RoutingResponse, error) {
 	params := url.Values{}
 
 	// Build waypoints parameter
@@ -208,14 +353,260 @@ func (c *Client) Routing(req RoutingRequest) (*RoutingResponse, error) {
 	}
 
 	var resp RoutingResponse
-	if err := c.doRequest("GET", "/routing", params, &resp); err != nil {
+	if err := c.doRequest(ctx, "GET", "/routing", params, &resp); err != nil {
 		return nil, err
 	}
 	return &resp, nil
 }
 
-// Places searches for nearby places (POIs)
-func (c *Client) Places(req PlacesRequest) (*PlacesResponse, error) {
+// Routing is like RoutingContext but uses context.Background()
+func (c *Client) Routing(req RoutingRequest) (*RoutingResponse, error) {
+	return c.RoutingContext(context.Background(), req)
+}
+
+// IsolineContext calculates the areas reachable from a point within the given time or distance ranges
+func (c *Client) IsolineContext(ctx context.Context, req IsolineRequest) (*IsolineResponse, error) {
+	if len(req.Range) == 0 {
+		return nil, fmt.Errorf("at least one range value is required")
+	}
+
+	params := url.Values{}
+	params.Set("lat", fmt.Sprintf("%f", req.Lat))
+	params.Set("lon", fmt.Sprintf("%f", req.Lon))
+
+	if req.Type == "" {
+		req.Type = "time"
+	}
+	params.Set("type", req.Type)
+
+	if req.Mode == "" {
+		req.Mode = "drive"
+	}
+	params.Set("mode", req.Mode)
+
+	ranges := make([]string, len(req.Range))
+	for i, r := range req.Range {
+		ranges[i] = fmt.Sprintf("%d", r)
+	}
+	params.Set("range", strings.Join(ranges, ","))
+
+	var resp IsolineResponse
+	if err := c.doRequest(ctx, "GET", "/isoline", params, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Isoline is like IsolineContext but uses context.Background()
+func (c *Client) Isoline(req IsolineRequest) (*IsolineResponse, error) {
+	return c.IsolineContext(context.Background(), req)
+}
+
+// RouteMatrixContext calculates travel times and distances between every source and target
+func (c *Client) RouteMatrixContext(ctx context.Context, req MatrixRequest) (*MatrixResponse, error) {
+	if len(req.Sources) == 0 || len(req.Targets) == 0 {
+		return nil, fmt.Errorf("sources and targets must not be empty")
+	}
+	if req.Mode == "" {
+		req.Mode = "drive"
+	}
+
+	toLocations := func(waypoints []Waypoint) []matrixLocation {
+		locations := make([]matrixLocation, len(waypoints))
+		for i, wp := range waypoints {
+			locations[i] = matrixLocation{Location: [2]float64{wp.Lon, wp.Lat}}
+		}
+		return locations
+	}
+
+	body := map[string]interface{}{
+		"mode":    req.Mode,
+		"sources": toLocations(req.Sources),
+		"targets": toLocations(req.Targets),
+	}
+
+	var resp MatrixResponse
+	if err := c.doPostRequest(ctx, "/routematrix", body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RouteMatrix is like RouteMatrixContext but uses context.Background()
+func (c *Client) RouteMatrix(req MatrixRequest) (*MatrixResponse, error) {
+	return c.RouteMatrixContext(context.Background(), req)
+}
+
+// doPostRequest sends a JSON body to a read-only v1 endpoint
+func (c *Client) doPostRequest(ctx context.Context, path string, body interface{}, response interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set("apiKey", c.APIKey)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+path+"?"+params.Encode(), bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// These POSTs only compute results, so they are safe to retry
+	httputil.MarkIdempotent(req)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	if response != nil {
+		if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// BatchGeocodeContext geocodes many addresses with a single asynchronous batch job.
+// Results are returned in the same order as the input addresses.
+func (c *Client) BatchGeocodeContext(ctx context.Context, addresses []string) ([]BatchGeocodeResult, error) {
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("at least one address is required")
+	}
+
+	body, err := json.Marshal(addresses)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal addresses: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set("apiKey", c.APIKey)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/batch/geocode/search?"+params.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var job batchJob
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return nil, fmt.Errorf("failed to decode batch job: %w", err)
+	}
+	if job.ID == "" {
+		return nil, fmt.Errorf("batch job response did not include an id")
+	}
+
+	results, err := c.waitForBatch(ctx, job.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return orderBatchResults(addresses, results), nil
+}
+
+// BatchGeocode is like BatchGeocodeContext but uses context.Background()
+func (c *Client) BatchGeocode(addresses []string) ([]BatchGeocodeResult, error) {
+	return c.BatchGeocodeContext(context.Background(), addresses)
+}
+
+// waitForBatch polls a batch job until its results are ready or BatchPollTimeout elapses
+func (c *Client) waitForBatch(ctx context.Context, jobID string) ([]map[string]interface{}, error) {
+	params := url.Values{}
+	params.Set("id", jobID)
+	params.Set("apiKey", c.APIKey)
+	jobURL := baseURL + "/batch/geocode/search?" + params.Encode()
+
+	deadline := time.Now().Add(c.BatchPollTimeout)
+	for {
+		req, err := http.NewRequestWithContext(ctx, "GET", jobURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		resp, err := c.do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to poll batch job: %w", err)
+		}
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			var results []map[string]interface{}
+			err := json.NewDecoder(resp.Body).Decode(&results)
+			resp.Body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode batch results: %w", err)
+			}
+			return results, nil
+
+		case http.StatusAccepted:
+			// Job is still pending
+			resp.Body.Close()
+
+		default:
+			bodyBytes, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		}
+
+		if time.Now().Add(c.BatchPollInterval).After(deadline) {
+			return nil, fmt.Errorf("batch job %s did not complete within %s", jobID, c.BatchPollTimeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(c.BatchPollInterval):
+		}
+	}
+}
+
+// orderBatchResults matches batch results back to their input addresses.
+// Results are matched on the echoed query text, falling back to position.
+func orderBatchResults(addresses []string, results []map[string]interface{}) []BatchGeocodeResult {
+	byText := make(map[string][]map[string]interface{})
+	for _, r := range results {
+		if query, ok := r["query"].(map[string]interface{}); ok {
+			if text, ok := query["text"].(string); ok {
+				byText[text] = append(byText[text], r)
+			}
+		}
+	}
+
+	ordered := make([]BatchGeocodeResult, len(addresses))
+	for i, address := range addresses {
+		ordered[i].Address = address
+		if matches := byText[address]; len(matches) > 0 {
+			ordered[i].Result = matches[0]
+			byText[address] = matches[1:]
+		} else if len(byText) == 0 && i < len(results) {
+			ordered[i].Result = results[i]
+		}
+	}
+	return ordered
+}
+
+// PlacesContext searches for nearby places (POIs)
+func (c *Client) PlacesContext(ctx context.Context, req PlacesRequest) (*PlacesResponse, error) {
 	params := url.Values{}
 
 	// Categories parameter
@@ -244,14 +635,19 @@ func (c *Client) Places(req PlacesRequest) (*PlacesResponse, error) {
 
 	var resp PlacesResponse
 	// Use v2 API for places
-	if err := c.doRequestV2("GET", "/places", params, &resp); err != nil {
+	if err := c.doRequestV2(ctx, "GET", "/places", params, &resp); err != nil {
 		return nil, err
 	}
 	return &resp, nil
 }
 
+// Places is like PlacesContext but uses context.Background()
+func (c *Client) Places(req PlacesRequest) (*PlacesResponse, error) {
+	return c.PlacesContext(context.Background(), req)
+}
+
 // doRequestV2 is similar to doRequest but uses the v2 API base URL
-func (c *Client) doRequestV2(method, path string, params url.Values, response interface{}) error {
+func (c *Client) doRequestV2(ctx context.Context, method, path string, params url.Values, response interface{}) error {
 	// Add API key to params
 	if params == nil {
 		params = url.Values{}
@@ -260,12 +656,12 @@ func (c *Client) doRequestV2(method, path string, params url.Values, response in
 
 	fullURL := "https://api.geoapify.com/v2" + path + "?" + params.Encode()
 
-	req, err := http.NewRequest(method, fullURL, nil)
+	req, err := http.NewRequestWithContext(ctx, method, fullURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
@@ -0,0 +1,138 @@
+// Package httputil provides HTTP helpers shared by the tool clients.
+package httputil
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultMaxAttempts is the number of attempts used when a client doesn't configure one
+	DefaultMaxAttempts = 3
+
+	defaultBaseDelay = 500 * time.Millisecond
+	defaultMaxDelay  = 30 * time.Second
+)
+
+// Retrier retries idempotent requests that fail with a transport error, 429 or 5xx,
+// backing off exponentially and honoring Retry-After.
+type Retrier struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration // Upper bound for both backoff and Retry-After waits
+}
+
+// NewRetrier creates a Retrier that makes at most maxAttempts attempts per request
+func NewRetrier(maxAttempts int) *Retrier {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &Retrier{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   defaultBaseDelay,
+		MaxDelay:    defaultMaxDelay,
+	}
+}
+
+// MarkIdempotent flags a request with a non-idempotent method (e.g. a read-only POST)
+// as safe to retry. Like net/http, a nil Idempotency-Key header is not sent on the wire.
+func MarkIdempotent(req *http.Request) {
+	if _, ok := req.Header["Idempotency-Key"]; !ok {
+		req.Header["Idempotency-Key"] = nil
+	}
+}
+
+// Do sends req with client, retrying when allowed. On the final attempt the
+// response is returned as-is so callers keep their own status handling.
+func (r *Retrier) Do(client *http.Client, req *http.Request) (*http.Response, error) {
+	attempts := r.MaxAttempts
+	if attempts < 1 || !isIdempotent(req) {
+		attempts = 1
+	}
+	if req.Body != nil && req.GetBody == nil {
+		// The body can't be replayed
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind request body: %w", err)
+			}
+			req.Body = body
+		}
+
+		resp, err := client.Do(req)
+		if attempt >= attempts || !shouldRetry(resp, err) {
+			return resp, err
+		}
+
+		delay := r.backoff(attempt)
+		if resp != nil {
+			if after, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = after
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if r.MaxDelay > 0 && delay > r.MaxDelay {
+			delay = r.MaxDelay
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns an exponentially growing delay with up to 25% jitter
+func (r *Retrier) backoff(attempt int) time.Duration {
+	delay := r.BaseDelay << (attempt - 1)
+	if delay <= 0 {
+		return 0
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/4+1))
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, hasKey := req.Header["Idempotency-Key"]
+	return hasKey
+}
+
+// parseRetryAfter understands both the delay-seconds and HTTP-date forms
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		delay := time.Until(t)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// ServiceName identifies the router in exported traces
+const ServiceName = "llm-router"
+
+// propagator reads and writes W3C traceparent and baggage headers
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Tracer returns the router's tracer. Until Init installs an exporter it
+// is backed by OpenTelemetry's no-op provider, so spans cost next to nothing.
+func Tracer() trace.Tracer {
+	return otel.Tracer(ServiceName)
+}
+
+// Init exports spans over OTLP/HTTP to endpoint, such as
+// "http://otel-collector:4318". Tracing stays a no-op when endpoint is empty.
+// W3C trace context is propagated either way. The returned function flushes
+// and stops the exporter.
+func Init(endpoint string, logger *zap.Logger) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q", endpoint)
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(endpoint)}
+	if parsed.Path == "" || parsed.Path == "/" {
+		opts = append(opts, otlptracehttp.WithURLPath("/v1/traces"))
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	logger.Info("Tracing enabled", zap.String("endpoint", endpoint))
+	return provider.Shutdown, nil
+}
+
+// Extract returns ctx carrying the trace context from an incoming request's headers
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Inject writes ctx's trace context into outgoing request headers as traceparent
+func Inject(ctx context.Context, header http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// RecordResponse sets span's status from the outcome of an HTTP exchange.
+// Transport errors and 5xx responses mark the span as failed.
+func RecordResponse(span trace.Span, statusCode int, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+	if statusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(statusCode))
+	}
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries a request's ID between the client, the router and backends
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds an incoming request ID so it can't bloat logs
+const maxRequestIDLength = 128
+
+// RequestInfo collects details about a request while it is handled so they
+// can be reported in its access log line
+type RequestInfo struct {
+	RequestID string
+	Backend   string // backend that served the request, the last one tried on fallback
+	UserID    int64
+	APIKeyID  int64
+}
+
+type requestInfoKey struct{}
+
+// WithRequestInfo returns a context carrying a new RequestInfo for the request ID
+func WithRequestInfo(ctx context.Context, requestID string) (context.Context, *RequestInfo) {
+	info := &RequestInfo{RequestID: requestID}
+	return context.WithValue(ctx, requestInfoKey{}, info), info
+}
+
+// RequestInfoFrom returns the context's RequestInfo, or nil if it has none
+func RequestInfoFrom(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*RequestInfo)
+	return info
+}
+
+// RequestIDFrom returns the request ID recorded in the context, or "" if there is none
+func RequestIDFrom(ctx context.Context) string {
+	if info := RequestInfoFrom(ctx); info != nil {
+		return info.RequestID
+	}
+	return ""
+}
+
+// RequestID returns the request's incoming X-Request-ID, or a new ID when it
+// has none or the one it has is unusable
+func RequestID(r *http.Request) string {
+	if id := r.Header.Get(RequestIDHeader); validRequestID(id) {
+		return id
+	}
+	return uuid.New().String()
+}
+
+// validRequestID accepts IDs made of characters that are safe to log and echo
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '/', c == '+', c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"regexp"
 	"strings"
 	"unicode"
 
@@ -37,17 +38,47 @@ func RedactAuthorization(auth string) string {
 	}, auth)
 }
 
-func DrainBody(body io.ReadCloser) (io.ReadCloser, string) {
+// Patterns for secrets that RedactSecrets masks in logged bodies
+var (
+	secretFieldPattern = regexp.MustCompile(`(?i)("(?:api[_-]?key|password)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	bearerTokenPattern = regexp.MustCompile(`(?i)\bBearer\s+[A-Za-z0-9._~+/=-]+`)
+	apiKeyPattern      = regexp.MustCompile(`\bsk[-_][A-Za-z0-9_-]+`)
+)
+
+// RedactSecrets masks values that look like credentials so request and response
+// bodies can be logged: sk- style API keys, bearer tokens, and string values of
+// api_key or password fields.
+func RedactSecrets(body string) string {
+	body = secretFieldPattern.ReplaceAllString(body, `$1"[REDACTED]"`)
+	body = bearerTokenPattern.ReplaceAllString(body, "Bearer [REDACTED]")
+	return apiKeyPattern.ReplaceAllStringFunc(body, func(key string) string {
+		return key[:3] + "[REDACTED]"
+	})
+}
+
+// DrainBody reads the whole body and returns a replacement reader along with
+// the body formatted for logging. Read errors, including *http.MaxBytesError,
+// are returned so the caller can reject the request.
+func DrainBody(body io.ReadCloser) (io.ReadCloser, string, error) {
 	if body == nil {
-		return nil, ""
+		return nil, "", nil
 	}
 
 	bodyBytes, err := io.ReadAll(body)
 	if err != nil {
-		return body, fmt.Sprintf("Error reading body: %v", err)
+		return body, fmt.Sprintf("Error reading body: %v", err), err
 	}
 
-	return io.NopCloser(bytes.NewBuffer(bodyBytes)), formatJSON(bodyBytes)
+	return io.NopCloser(bytes.NewBuffer(bodyBytes)), formatJSON(bodyBytes), nil
+}
+
+// IsStreamRequest reports whether a JSON request body asks for a streamed
+// response with "stream": true, wherever the field appears in the body
+func IsStreamRequest(body []byte) bool {
+	var req struct {
+		Stream bool `json:"stream"`
+	}
+	return json.Unmarshal(body, &req) == nil && req.Stream
 }
 
 func formatJSON(data []byte) string {
@@ -76,7 +107,7 @@ func LogRequestResponse(logger *zap.Logger, req *http.Request, resp *http.Respon
 			zap.String("method", req.Method),
 			zap.String("url", req.URL.String()),
 			zap.Any("headers", buildHeaderMap(req.Header, true)),
-			zap.String("body", reqBody),
+			zap.String("body", RedactSecrets(reqBody)),
 		)
 	}
 
@@ -84,7 +115,7 @@ func LogRequestResponse(logger *zap.Logger, req *http.Request, resp *http.Respon
 		logger.Debug("Full response details",
 			zap.Int("status", resp.StatusCode),
 			zap.Any("headers", buildHeaderMap(resp.Header, false)),
-			zap.String("body", respBody),
+			zap.String("body", RedactSecrets(respBody)),
 		)
 	}
 }
@@ -92,6 +123,7 @@ func LogRequestResponse(logger *zap.Logger, req *http.Request, resp *http.Respon
 type ResponseRecorder struct {
 	http.ResponseWriter
 	StatusCode     int
+	BytesWritten   int64
 	Body           bytes.Buffer
 	streaming      bool
 	maxCaptureSize int
@@ -119,6 +151,7 @@ func (r *ResponseRecorder) WriteHeader(statusCode int) {
 
 func (r *ResponseRecorder) Write(b []byte) (int, error) {
 	n, err := r.ResponseWriter.Write(b)
+	r.BytesWritten += int64(n)
 
 	if err == nil && n > 0 && r.capturedSize < r.maxCaptureSize {
 		remainingCapacity := r.maxCaptureSize - r.capturedSize
@@ -249,7 +282,10 @@ func processStreamSample(content string) string {
 	return builder.String()
 }
 
-func DrainAndCapture(body io.ReadCloser, isStreaming bool) (io.ReadCloser, string) {
+// DrainAndCapture returns a replacement body and a sample of it for logging.
+// Streaming bodies are only peeked at. Non-streaming bodies are passed through
+// in full, but at most maxCapture bytes of them are kept in the returned string.
+func DrainAndCapture(body io.ReadCloser, isStreaming bool, maxCapture int) (io.ReadCloser, string) {
 	if body == nil {
 		return nil, ""
 	}
@@ -266,11 +302,16 @@ func DrainAndCapture(body io.ReadCloser, isStreaming bool) (io.ReadCloser, strin
 			combinedReader := io.MultiReader(bytes.NewReader(peeked), body)
 			content := string(peeked)
 
+			// Keep the upstream's Close so abandoning the stream closes its connection
+			replacement := struct {
+				io.Reader
+				io.Closer
+			}{combinedReader, body}
 			if strings.Contains(content, "data: {") && strings.Contains(content, "delta") {
-				return io.NopCloser(combinedReader), processStreamSample(content)
+				return replacement, processStreamSample(content)
 			}
 
-			return io.NopCloser(combinedReader), "STREAMING: " + formatJSON(peeked) + "..."
+			return replacement, "STREAMING: " + formatJSON(peeked) + "..."
 		}
 		return body, "STREAMING CONTENT (empty or could not be sampled)"
 	}
@@ -280,9 +321,24 @@ func DrainAndCapture(body io.ReadCloser, isStreaming bool) (io.ReadCloser, strin
 		return body, fmt.Sprintf("Error reading body: %v", err)
 	}
 
+	if maxCapture > 0 && len(bodyBytes) > maxCapture {
+		truncated := fmt.Sprintf("%s\n... [body truncated for logging, %d of %d bytes shown] ...",
+			bodyBytes[:maxCapture], maxCapture, len(bodyBytes))
+		return io.NopCloser(bytes.NewBuffer(bodyBytes)), truncated
+	}
+
 	return io.NopCloser(bytes.NewBuffer(bodyBytes)), formatJSON(bodyBytes)
 }
 
+// ExtractClientIP strips the port from a request's RemoteAddr
+func ExtractClientIP(remoteAddr string) string {
+	clientIP := remoteAddr
+	if idx := strings.LastIndex(clientIP, ":"); idx != -1 {
+		clientIP = clientIP[:idx]
+	}
+	return strings.Trim(clientIP, "[]")
+}
+
 func GenerateStrongAPIKey() (string, error) {
 	randomBytes := make([]byte, apiKeyLength)
 	if _, err := io.ReadFull(rand.Reader, randomBytes); err != nil {
@@ -1,22 +1,39 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"llm-router/internal/config"
+	"llm-router/internal/events"
 	"llm-router/internal/handler"
 	"llm-router/internal/identity"
 	"llm-router/internal/logging"
 	"llm-router/internal/model"
 	"llm-router/internal/proxy"
+	"llm-router/internal/tracing"
 
 	"go.uber.org/zap"
 )
 
+// defaultShutdownTimeout is how long in-flight requests get to finish on shutdown
+const defaultShutdownTimeout = 30 * time.Second
+
+// Build details, set at build time with
+// -ldflags "-X main.version=... -X main.commit=... -X main.buildDate=..."
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
 func main() {
 	// DefaultConfig is the default configuration in case the configuration file cannot be read.
 	var defaultConfig = model.Config{
@@ -40,7 +57,7 @@ func main() {
 	}
 
 	// Initialize command-line flags
-	configFile, llmRouterAPIKeyEnv, llmRouterAPIKey, listeningPort, logLevel, exaAPIKey, geoapifyAPIKey := config.InitFlags()
+	configFile, llmRouterAPIKeyEnv, llmRouterAPIKey, listeningPort, logLevel, exaAPIKey, geoapifyAPIKey, watchConfig := config.InitFlags()
 
 	// Initialize the logger
 	logger, err := logging.NewLogger(logLevel)
@@ -49,23 +66,32 @@ func main() {
 	}
 	defer logger.Sync()
 
+	logger.Info("Starting llm-router",
+		zap.String("version", version),
+		zap.String("commit", commit),
+		zap.String("build_date", buildDate))
+	handler.SetBuildInfo(handler.BuildInfo{Version: version, Commit: commit, BuildDate: buildDate})
+
 	// Load the configuration
 	cfg, err := config.LoadConfig(configFile, llmRouterAPIKeyEnv, llmRouterAPIKey, listeningPort, defaultConfig, logger)
 	if err != nil {
 		logger.Fatal("Failed to load configuration", zap.Error(err))
 	}
 
-	// Apply Exa API key override from command line if provided
-	if exaAPIKey != "" {
-		cfg.ExaAPIKey = exaAPIKey
-		logger.Info("Exa API key override applied from command line")
-	}
+	applyFlagOverrides := func(cfg *model.Config) {
+		// Apply Exa API key override from command line if provided
+		if exaAPIKey != "" {
+			cfg.ExaAPIKey = exaAPIKey
+			logger.Info("Exa API key override applied from command line")
+		}
 
-	// Apply Geoapify API key override from command line if provided
-	if geoapifyAPIKey != "" {
-		cfg.GeoapifyAPIKey = geoapifyAPIKey
-		logger.Info("Geoapify API key override applied from command line")
+		// Apply Geoapify API key override from command line if provided
+		if geoapifyAPIKey != "" {
+			cfg.GeoapifyAPIKey = geoapifyAPIKey
+			logger.Info("Geoapify API key override applied from command line")
+		}
 	}
+	applyFlagOverrides(cfg)
 
 	// If using a generated key, log it through the logger
 	if cfg.UseGeneratedKey {
@@ -74,51 +100,94 @@ func main() {
 			zap.String("env_var", cfg.LLMRouterAPIKeyEnv))
 	}
 
+	// Tracing is set up once; changing the endpoint needs a restart
+	shutdownTracing, err := tracing.Init(cfg.OTLPEndpoint, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize tracing", zap.Error(err))
+	}
+
 	// Log backend count
 	logger.Info("Backends initialized", zap.Int("count", len(cfg.Backends)))
 
 	// Initialize proxies based on the loaded configuration
+	proxy.SetMaxLoggedResponseSize(cfg.LoggedResponseLimit())
+	proxy.SetStreamHeartbeat(cfg.StreamHeartbeatInterval())
+	proxy.SetStreamIdleTimeout(cfg.StreamIdleDuration())
 	proxy.InitializeProxies(cfg.Backends, logger)
 
-	// Initialize attachment store
-	attachmentStore, err := identity.NewLocalFileStore("")
-	if err != nil {
-		logger.Fatal("Failed to initialize attachment store", zap.Error(err))
-	}
-	handler.SetAttachmentStore(attachmentStore)
-	identity.SetGlobalAttachmentStore(attachmentStore)
-	identity.SetGlobalLogger(logger)
-	logger.Info("Attachment store initialized", zap.String("directory", "./data/attachments"))
+	// Requests read the config through currentCfg so a reload can swap it
+	// without affecting requests already in flight
+	var currentCfg atomic.Pointer[model.Config]
+	currentCfg.Store(cfg)
 
-	// Initialize identity system if database URL is provided
-	var db identity.Database
-	if cfg.DatabaseURL != "" {
-		logger.Info("Initializing identity system with database")
-		var err error
-		db, err = identity.NewPostgresDB(cfg.DatabaseURL)
+	var reloadMu sync.Mutex
+	reloadConfig := func() error {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+
+		newCfg, err := config.LoadConfig(configFile, llmRouterAPIKeyEnv, llmRouterAPIKey, listeningPort, defaultConfig, logger)
 		if err != nil {
-			logger.Fatal("Failed to initialize database", zap.Error(err))
+			return err
 		}
+		applyFlagOverrides(newCfg)
 
-		authManager := identity.NewAuthManager(db)
-		handler.SetAuthManager(authManager)
-		logger.Info("Identity system initialized successfully")
+		// Keep the session's generated key so existing clients stay authenticated
+		oldCfg := currentCfg.Load()
+		if newCfg.UseGeneratedKey && oldCfg.UseGeneratedKey {
+			newCfg.LLMRouterAPIKey = oldCfg.LLMRouterAPIKey
+		}
+
+		proxy.SetMaxLoggedResponseSize(newCfg.LoggedResponseLimit())
+		proxy.SetStreamHeartbeat(newCfg.StreamHeartbeatInterval())
+		proxy.SetStreamIdleTimeout(newCfg.StreamIdleDuration())
+		proxy.InitializeProxies(newCfg.Backends, logger)
+		identity.SetAttachmentLimits(attachmentLimits(newCfg))
+		identity.SetDefaultStorageQuota(newCfg.StorageQuota)
+		identity.SetTitleGenerator(titleGenerator(newCfg))
+		identity.SetWebhooks(newCfg.Webhooks)
+		identity.SetAuditRetention(newCfg.AuditRetentionPeriod())
+		currentCfg.Store(newCfg)
+		logger.Info("Configuration reloaded", zap.Int("backends", len(newCfg.Backends)))
+		return nil
+	}
+	handler.SetConfigReloader(reloadConfig)
 
-		// Set up graceful shutdown for database
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-		go func() {
-			<-sigChan
-			logger.Info("Shutting down gracefully...")
-			if db != nil {
-				db.Close()
+	// Reload on SIGHUP as well as after settings are saved
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for range hupChan {
+			logger.Info("Received SIGHUP, reloading configuration")
+			if err := reloadConfig(); err != nil {
+				logger.Error("Failed to reload configuration, keeping current config", zap.Error(err))
 			}
-			os.Exit(0)
-		}()
-	} else {
-		logger.Info("Identity system disabled (no DATABASE_URL provided)")
+		}
+	}()
+
+	// Optionally pick up hand edits to the config file
+	if watchConfig {
+		watcher, err := config.WatchConfig(configFile, config.DefaultWatchDebounce, reloadConfig, logger)
+		if err != nil {
+			logger.Error("Failed to watch config file", zap.String("file", configFile), zap.Error(err))
+		} else {
+			defer watcher.Close()
+		}
 	}
 
+	// Initialize attachment store
+	attachmentStore, err := newAttachmentStore(cfg.Attachments, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize attachment store", zap.Error(err))
+	}
+	handler.SetAttachmentStore(attachmentStore)
+	identity.SetGlobalAttachmentStore(attachmentStore)
+	identity.SetAttachmentLimits(attachmentLimits(cfg))
+	identity.SetDefaultStorageQuota(cfg.StorageQuota)
+	identity.SetTitleGenerator(titleGenerator(cfg))
+	identity.SetWebhooks(cfg.Webhooks)
+	identity.SetAuditRetention(cfg.AuditRetentionPeriod())
+	identity.SetGlobalLogger(logger)
+
 	// Serve static files from web/dist (built frontend)
 	// In development, run the Vite dev server separately
 	webDir := "./web/dist"
@@ -126,6 +195,16 @@ func main() {
 		webDir = "./web" // Fallback for development
 	}
 
+	// The listener starts before the database connects so /readyz can report
+	// the wait; API requests get a 503 until startup finishes
+	var started atomic.Bool
+
+	// Kubernetes probes sit outside the API so they skip auth and request logging
+	http.HandleFunc("/livez", handler.HandleLivez)
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleReadyz(w, r, currentCfg.Load())
+	})
+
 	// Set up unified HTTP handler
 	fs := http.FileServer(http.Dir(webDir))
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -141,7 +220,12 @@ func main() {
 		}
 
 		if isAPIRequest {
-			handler.HandleRequest(cfg, w, r)
+			// The identity system isn't set up until the database connects
+			if !started.Load() {
+				http.Error(w, "starting up", http.StatusServiceUnavailable)
+				return
+			}
+			handler.HandleRequest(currentCfg.Load(), w, r)
 			return
 		}
 
@@ -160,8 +244,142 @@ func main() {
 
 	// Start the server
 	addr := fmt.Sprintf(":%d", cfg.ListeningPort)
-	logger.Info("Starting server", zap.String("address", addr))
-	if err := http.ListenAndServe(addr, nil); err != nil {
+	server := &http.Server{Addr: addr}
+	// End admin event streams so they don't hold up a graceful shutdown
+	server.RegisterOnShutdown(events.Default().Close)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Starting server", zap.String("address", addr))
+		serverErr <- server.ListenAndServe()
+	}()
+
+	// Initialize identity system if database URL is provided
+	var db identity.Database
+	var authManager *identity.AuthManager
+	if cfg.DatabaseURL != "" {
+		logger.Info("Initializing identity system with database")
+		var err error
+		interval, maxInterval := cfg.DatabaseRetryIntervals()
+		db, err = identity.NewPostgresDB(cfg.DatabaseURL, cfg.DatabasePool(), identity.ConnectRetry{
+			Attempts:    cfg.DatabaseConnectAttempts(),
+			Interval:    interval,
+			MaxInterval: maxInterval,
+		}, logger)
+		if err != nil {
+			logger.Fatal("Failed to initialize database", zap.Error(err))
+		}
+
+		handler.SetDatabase(db)
+		authManager = identity.NewAuthManager(db)
+		handler.SetAuthManager(authManager)
+		logger.Info("Identity system initialized successfully")
+	} else {
+		logger.Info("Identity system disabled (no DATABASE_URL provided)")
+	}
+	started.Store(true)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err := <-serverErr:
 		logger.Fatal("Failed to start server", zap.Error(err))
+	case sig := <-sigChan:
+		logger.Info("Shutting down gracefully...", zap.String("signal", sig.String()))
+	}
+
+	// Stop accepting new connections and let in-flight requests (including
+	// long streaming completions) finish within the grace period
+	gracePeriod := defaultShutdownTimeout
+	if cfg.ShutdownTimeout > 0 {
+		gracePeriod = time.Duration(cfg.ShutdownTimeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+
+	// Hijacked sync WebSockets aren't closed by Shutdown, so send them a close
+	// frame first; new ones are refused from here on
+	if authManager != nil {
+		if err := authManager.CloseSyncConnections(ctx); err != nil {
+			logger.Warn("Sync connections did not close in time", zap.Error(err))
+		}
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Warn("Grace period expired, closing remaining connections", zap.Duration("grace_period", gracePeriod), zap.Error(err))
+		server.Close()
+	}
+
+	if db != nil {
+		db.Close()
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Warn("Failed to flush traces", zap.Error(err))
+	}
+	logger.Info("Server stopped")
+}
+
+// newAttachmentStore builds the configured attachment store, local disk by default.
+// The store is chosen at startup; changing it needs a restart.
+func newAttachmentStore(cfg *model.AttachmentsConfig, logger *zap.Logger) (identity.AttachmentStore, error) {
+	if cfg != nil && cfg.Store == model.AttachmentStoreS3 {
+		store, err := identity.NewS3Store(identity.S3StoreConfig{
+			Bucket:          cfg.S3.Bucket,
+			Region:          cfg.S3.Region,
+			Endpoint:        cfg.S3.Endpoint,
+			Prefix:          cfg.S3.Prefix,
+			AccessKeyID:     cfg.S3.AccessKeyID,
+			SecretAccessKey: cfg.S3.SecretAccessKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("Attachment store initialized",
+			zap.String("store", model.AttachmentStoreS3),
+			zap.String("bucket", cfg.S3.Bucket),
+			zap.String("endpoint", cfg.S3.Endpoint))
+		return store, nil
+	}
+
+	dir := ""
+	dedup := false
+	if cfg != nil {
+		dir = cfg.Dir
+		dedup = cfg.Dedup
+	}
+	newStore := identity.NewLocalFileStore
+	if dedup {
+		newStore = identity.NewContentAddressedStore
+	}
+	store, err := newStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		dir = "./data/attachments"
+	}
+	logger.Info("Attachment store initialized",
+		zap.String("store", model.AttachmentStoreLocal),
+		zap.String("directory", dir),
+		zap.Bool("dedup", dedup))
+	return store, nil
+}
+
+// titleGenerator titles untitled conversations with the configured title
+// model, or returns nil when none is set
+func titleGenerator(cfg *model.Config) identity.TitleGenerator {
+	if cfg.TitleModel == "" {
+		return nil
+	}
+	return func(ctx context.Context, message string) (string, error) {
+		return handler.GenerateTitle(ctx, cfg, message)
+	}
+}
+
+// attachmentLimits returns the configured limits for stored attachments
+func attachmentLimits(cfg *model.Config) identity.AttachmentLimits {
+	return identity.AttachmentLimits{
+		MaxSize:      cfg.AttachmentSizeLimit(),
+		AllowedTypes: cfg.AttachmentTypes(),
 	}
 }
@@ -55,8 +55,15 @@ interface DeltaSyncRequest {
   delete_ids?: string[];            // Conversations deleted locally
 }
 
+interface PushedConversation {
+  conversation_id: string;
+  version: number;
+  hash: string;
+  updated_at: string;
+}
+
 interface DeltaSyncResponse {
-  pushed: string[];                  // IDs that were successfully pushed
+  pushed: PushedConversation[];      // Stored state of each pushed conversation
   pulled: ConversationHistory[];     // Conversations pulled from server
   conflicts?: string[];              // Conflict IDs (if any)
   server_deleted?: string[];         // IDs deleted on server
@@ -73,6 +80,9 @@ export function useHistory() {
 
   // Track local hashes to detect changes
   const localHashesRef = useRef<Map<string, string>>(new Map());
+  // Server hash of each conversation as of its last sync; while neither side's
+  // hash has moved on from it, the conversation is in sync
+  const serverHashesRef = useRef<Map<string, string>>(new Map());
 
   const setSyncStatus = useCallback((status: 'idle' | 'syncing' | 'error') => {
     useUIStore.getState().setSyncStatus(status);
@@ -130,6 +140,7 @@ export function useHistory() {
       const currentConversations = useUIStore.getState().conversations;
       const toPush: ConversationHistory[] = [];
       const toPull: string[] = [];
+      const localHashes = new Map<string, string>();
 
       for (const conv of Object.values(currentConversations)) {
         const fullConv = await loadFullConversation(conv.id);
@@ -150,6 +161,14 @@ export function useHistory() {
         const localHash = generateConversationHash(completeConv);
         const serverItem = serverItems.get(conv.id);
 
+        if (serverItem &&
+            localHashesRef.current.get(conv.id) === localHash &&
+            serverHashesRef.current.get(conv.id) === serverItem.hash) {
+          // Unchanged on both sides since the last sync
+          continue;
+        }
+        localHashes.set(conv.id, localHash);
+
         if (!serverItem) {
           // New local conversation - push to server
           toPush.push({
@@ -179,8 +198,6 @@ export function useHistory() {
           }
         }
         // If hashes match, no sync needed
-
-        localHashesRef.current.set(conv.id, localHash);
       }
 
       // Check for server conversations we don't have locally
@@ -220,6 +237,15 @@ export function useHistory() {
 
       const deltaResponse: DeltaSyncResponse = await response.json();
 
+      // Record the server's state for what was pushed so it isn't pushed again
+      for (const pushed of deltaResponse.pushed ?? []) {
+        const localHash = localHashes.get(pushed.conversation_id);
+        if (localHash) {
+          localHashesRef.current.set(pushed.conversation_id, localHash);
+          serverHashesRef.current.set(pushed.conversation_id, pushed.hash);
+        }
+      }
+
       // Step 4: Apply pulled conversations
       if (deltaResponse.pulled && deltaResponse.pulled.length > 0) {
         const mergedConversations = { ...currentConversations };
@@ -231,6 +257,10 @@ export function useHistory() {
             title: history.title,
             updatedAt: new Date(history.updated_at).getTime(),
           };
+          localHashesRef.current.set(history.conversation_id, generateConversationHash(mergedConversations[history.conversation_id]));
+          if (history.hash) {
+            serverHashesRef.current.set(history.conversation_id, history.hash);
+          }
         }
 
         setConversations(mergedConversations);
@@ -374,6 +404,9 @@ export function useHistory() {
         // Cache the hash
         const conv = loadedConversations[history.conversation_id];
         localHashesRef.current.set(conv.id, generateConversationHash(conv));
+        if (history.hash) {
+          serverHashesRef.current.set(conv.id, history.hash);
+        }
       });
 
       setConversations(loadedConversations);
@@ -406,6 +439,7 @@ export function useHistory() {
 
     // Remove from local hash cache
     localHashesRef.current.delete(conversationId);
+    serverHashesRef.current.delete(conversationId);
 
     return response.json();
   }, []);
@@ -439,6 +473,7 @@ export function useHistory() {
 
       // Clear local hash cache
       localHashesRef.current.clear();
+      serverHashesRef.current.clear();
 
     } catch (error) {
       throw error;
@@ -14,6 +14,8 @@ export interface BackendConfig {
   api_keys?: string[];
   role_rewrites?: Record<string, string>;
   unsupported_params?: string[];
+  enabled?: boolean;
+  emulate_tools?: boolean;
 }
 
 export interface Settings {
@@ -251,6 +251,13 @@ function SettingsPage() {
 
                     <div className="flex items-center justify-between mt-6 pt-6 border-t border-terminal-border/50">
                       <div className="flex items-center gap-6">
+                        <div className="flex items-center gap-2">
+                          <Switch
+                            checked={backend.enabled !== false}
+                            onCheckedChange={(c) => updateBackend(index, 'enabled', c)}
+                          />
+                          <span className="text-sm text-terminal-muted">Enabled</span>
+                        </div>
                         <div className="flex items-center gap-2">
                           <Switch
                             checked={backend.require_api_key}
@@ -265,6 +272,13 @@ function SettingsPage() {
                           />
                           <span className="text-sm text-terminal-muted">Default Provider</span>
                         </div>
+                        <div className="flex items-center gap-2">
+                          <Switch
+                            checked={backend.emulate_tools}
+                            onCheckedChange={(c) => updateBackend(index, 'emulate_tools', c)}
+                          />
+                          <span className="text-sm text-terminal-muted">Emulate Tools</span>
+                        </div>
                       </div>
                       <Button
                         variant="ghost"